@@ -0,0 +1,186 @@
+package lxcri
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// apparmorProfilesFile lists the profiles loaded into the kernel.
+	apparmorProfilesFile = "/sys/kernel/security/apparmor/profiles"
+	// apparmorParser is the command used to load profiles.
+	apparmorParser = "apparmor_parser"
+	// apparmorFeaturesDir lists the features mediated by the kernel.
+	apparmorFeaturesDir = "/sys/kernel/security/apparmor/features"
+)
+
+// apparmorCacheDir is the directory within Runtime.Root that contains
+// the hashes of the profiles loaded from Runtime.ApparmorProfileDir.
+const apparmorCacheDir = ".apparmor"
+
+// isApparmorProfileLoaded returns true if the profile with the given
+// name is listed in the profiles file.
+func isApparmorProfileLoaded(profilesFile string, name string) (bool, error) {
+	f, err := os.Open(profilesFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	// e.g `lxcri-default (enforce)`
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.LastIndex(line, " ("); i > 0 && line[:i] == name {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// loadApparmorProfile loads the profile with the given name from Runtime.ApparmorProfileDir,
+// if the profile file exists. The file name must match the profile name.
+// The hash of the loaded profile is cached, so apparmor_parser is only invoked
+// if the profile is not loaded yet or if the profile file was changed.
+func (rt *Runtime) loadApparmorProfile(name string) error {
+	if rt.ApparmorProfileDir == "" || name == "unconfined" || strings.ContainsRune(name, '/') {
+		return nil
+	}
+	src := filepath.Join(rt.ApparmorProfileDir, name)
+	// #nosec
+	data, err := os.ReadFile(src)
+	if os.IsNotExist(err) {
+		// not a bundled profile
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read apparmor profile: %w", err)
+	}
+	return rt.replaceApparmorProfile(name, data, src)
+}
+
+// replaceApparmorProfile loads the profile with the given name and content
+// into the kernel, unless the same content is loaded already (see loadApparmorProfile).
+// The profile is read from src, or from stdin if src is empty.
+func (rt *Runtime) replaceApparmorProfile(name string, data []byte, src string) error {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	cacheDir := filepath.Join(rt.Root, apparmorCacheDir)
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return fmt.Errorf("failed to create apparmor cache dir: %w", err)
+	}
+	// Serialize concurrent create calls that use the same profile.
+	unlock, err := flockDir(cacheDir, unix.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cacheFile := filepath.Join(cacheDir, name)
+	cached, err := os.ReadFile(cacheFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read apparmor cache: %w", err)
+	}
+	if string(cached) == hash {
+		loaded, err := isApparmorProfileLoaded(apparmorProfilesFile, name)
+		if err != nil {
+			return fmt.Errorf("failed to list loaded apparmor profiles: %w", err)
+		}
+		if loaded {
+			rt.Log.Debug().Str("profile", name).Msg("apparmor profile is up-to-date")
+			return nil
+		}
+	}
+
+	rt.Log.Info().Str("profile", name).Str("file", src).Msg("loading apparmor profile")
+	args := []string{"--replace"}
+	if src != "" {
+		args = append(args, src)
+	}
+	// #nosec
+	cmd := exec.Command(apparmorParser, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to load apparmor profile %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	if err := os.WriteFile(cacheFile, []byte(hash), 0600); err != nil {
+		return fmt.Errorf("failed to write apparmor cache: %w", err)
+	}
+	return nil
+}
+
+// apparmorProtectProfile is the profile that denies access to the
+// runtime directories (see RuntimeFeatures.ApparmorProtectRuntime).
+// It is stacked with the container profile.
+const apparmorProtectProfile = "lxcri-protect-runtime"
+
+// apparmorFeatureRules are the allow rules for rule classes that are only
+// mediated (and denied if not allowed) by newer kernels, by the kernel feature
+// that enables the mediation (relative to apparmorFeaturesDir).
+var apparmorFeatureRules = []struct {
+	feature string
+	rule    string
+}{
+	{"namespaces/userns_create", "userns"},
+	{"ipc/posix_mqueue", "mqueue"},
+	{"io_uring", "io_uring"},
+}
+
+// apparmorProtectProfileData returns the profile apparmorProtectProfile.
+// Everything but the access to the runtime directories is allowed,
+// so the restrictions of the container profile are not changed.
+// Rule classes that are mediated by the kernel must be allowed explicitly,
+// they are only added if the kernel supports them, because the parser
+// rejects rules that are not supported by the kernel feature ABI.
+func apparmorProtectProfileData(rt *Runtime) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "profile %s flags=(attach_disconnected,mediate_deleted) {\n", apparmorProtectProfile)
+	for _, rule := range []string{"file", "capability", "network", "mount", "remount", "umount", "pivot_root", "ptrace", "signal", "unix", "dbus", "change_profile -> **"} {
+		fmt.Fprintf(&b, "  %s,\n", rule)
+	}
+	for _, fr := range apparmorFeatureRules {
+		if _, err := os.Stat(filepath.Join(apparmorFeaturesDir, fr.feature)); err == nil {
+			fmt.Fprintf(&b, "  %s,\n", fr.rule)
+		}
+	}
+	for _, rule := range apparmorDenyRules(rt) {
+		fmt.Fprintf(&b, "  %s\n", rule)
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// apparmorProtectRuntime returns the container profile restricted by the
+// rules that deny access to the runtime directories.
+// The rules are added to the profile generated by liblxc. Other profiles,
+// that can not be modified, are stacked with apparmorProtectProfile.
+func apparmorProtectRuntime(rt *Runtime, c *Container, profile string) (string, error) {
+	if profile == "generated" {
+		if !c.supportsConfigItem("lxc.apparmor.raw") {
+			return "", fmt.Errorf("lxc.apparmor.raw is not supported by liblxc")
+		}
+		for _, rule := range apparmorDenyRules(rt) {
+			if err := c.setConfigItem("lxc.apparmor.raw", rule); err != nil {
+				return "", err
+			}
+		}
+		return profile, nil
+	}
+	if err := rt.replaceApparmorProfile(apparmorProtectProfile, apparmorProtectProfileData(rt), ""); err != nil {
+		return "", err
+	}
+	if profile == "unconfined" {
+		return apparmorProtectProfile, nil
+	}
+	return profile + "//&" + apparmorProtectProfile, nil
+}
@@ -0,0 +1,134 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadApparmorProfile(t *testing.T) {
+	tmp := t.TempDir()
+	rt := &Runtime{Root: filepath.Join(tmp, "root"), ApparmorProfileDir: filepath.Join(tmp, "profiles")}
+	require.NoError(t, os.MkdirAll(rt.ApparmorProfileDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rt.ApparmorProfileDir, "lxcri-default"), []byte("profile lxcri-default {}\n"), 0644))
+
+	// The fake parser records the calls and marks the profile as loaded.
+	calls := filepath.Join(tmp, "calls")
+	profiles := filepath.Join(tmp, "profiles-loaded")
+	parser := filepath.Join(tmp, "apparmor_parser")
+	script := "#!/bin/sh\necho \"$@\" >> " + calls + "\necho 'lxcri-default (enforce)' > " + profiles + "\n"
+	require.NoError(t, os.WriteFile(parser, []byte(script), 0755))
+	require.NoError(t, os.WriteFile(profiles, nil, 0644))
+
+	defer func(parser, profiles string) {
+		apparmorParser = parser
+		apparmorProfilesFile = profiles
+	}(apparmorParser, apparmorProfilesFile)
+	apparmorParser = parser
+	apparmorProfilesFile = profiles
+
+	countCalls := func() int {
+		data, err := os.ReadFile(calls)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		require.NoError(t, err)
+		return strings.Count(string(data), "\n")
+	}
+
+	// not a bundled profile
+	require.NoError(t, rt.loadApparmorProfile("other"))
+	require.Equal(t, 0, countCalls())
+
+	require.NoError(t, rt.loadApparmorProfile("lxcri-default"))
+	require.Equal(t, 1, countCalls())
+
+	// cached
+	require.NoError(t, rt.loadApparmorProfile("lxcri-default"))
+	require.Equal(t, 1, countCalls())
+
+	// reloaded if changed
+	require.NoError(t, os.WriteFile(filepath.Join(rt.ApparmorProfileDir, "lxcri-default"), []byte("profile lxcri-default { }\n"), 0644))
+	require.NoError(t, rt.loadApparmorProfile("lxcri-default"))
+	require.Equal(t, 2, countCalls())
+
+	// reloaded if unloaded from the kernel
+	require.NoError(t, os.WriteFile(profiles, nil, 0644))
+	require.NoError(t, rt.loadApparmorProfile("lxcri-default"))
+	require.Equal(t, 3, countCalls())
+}
+
+func TestApparmorProtectProfileData(t *testing.T) {
+	defer func(dir string) { apparmorFeaturesDir = dir }(apparmorFeaturesDir)
+	apparmorFeaturesDir = t.TempDir()
+	rt := &Runtime{Root: "/run/lxcri", LibexecDir: "/usr/libexec/lxcri"}
+
+	expected := `profile lxcri-protect-runtime flags=(attach_disconnected,mediate_deleted) {
+  file,
+  capability,
+  network,
+  mount,
+  remount,
+  umount,
+  pivot_root,
+  ptrace,
+  signal,
+  unix,
+  dbus,
+  change_profile -> **,
+  deny /run/lxcri/{,**} rwlkmx,
+  deny /usr/libexec/lxcri/{,**} rwlkmx,
+}
+`
+	require.Equal(t, expected, string(apparmorProtectProfileData(rt)))
+
+	// rule classes mediated by the kernel are allowed
+	require.NoError(t, os.MkdirAll(filepath.Join(apparmorFeaturesDir, "namespaces"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(apparmorFeaturesDir, "namespaces", "userns_create"), []byte("pciu&\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(apparmorFeaturesDir, "ipc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(apparmorFeaturesDir, "ipc", "posix_mqueue"), []byte("create read write\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(apparmorFeaturesDir, "io_uring"), 0755))
+
+	expected = strings.Replace(expected, "  change_profile -> **,\n",
+		"  change_profile -> **,\n  userns,\n  mqueue,\n  io_uring,\n", 1)
+	require.Equal(t, expected, string(apparmorProtectProfileData(rt)))
+}
+
+func TestApparmorProtectRuntime(t *testing.T) {
+	tmp := t.TempDir()
+	rt := &Runtime{Root: filepath.Join(tmp, "root"), LibexecDir: "/usr/libexec/lxcri"}
+
+	data := string(apparmorProtectProfileData(rt))
+	require.True(t, strings.HasPrefix(data, "profile lxcri-protect-runtime "))
+	require.Contains(t, data, "  file,\n")
+	require.Contains(t, data, "  deny "+rt.Root+"/{,**} rwlkmx,\n")
+	require.Contains(t, data, "  deny /usr/libexec/lxcri/{,**} rwlkmx,\n")
+
+	// The fake parser records the profile read from stdin.
+	loaded := filepath.Join(tmp, "loaded")
+	parser := filepath.Join(tmp, "apparmor_parser")
+	script := "#!/bin/sh\ncat > " + loaded + "\n"
+	require.NoError(t, os.WriteFile(parser, []byte(script), 0755))
+	defer func(parser, profiles string) {
+		apparmorParser = parser
+		apparmorProfilesFile = profiles
+	}(apparmorParser, apparmorProfilesFile)
+	apparmorParser = parser
+	apparmorProfilesFile = filepath.Join(tmp, "profiles-loaded")
+	require.NoError(t, os.WriteFile(apparmorProfilesFile, nil, 0644))
+
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	profile, err := apparmorProtectRuntime(rt, c, "unconfined")
+	require.NoError(t, err)
+	require.Equal(t, "lxcri-protect-runtime", profile)
+	out, err := os.ReadFile(loaded)
+	require.NoError(t, err)
+	require.Equal(t, data, string(out))
+
+	profile, err = apparmorProtectRuntime(rt, c, "lxcri-default")
+	require.NoError(t, err)
+	require.Equal(t, "lxcri-default//&lxcri-protect-runtime", profile)
+}
@@ -0,0 +1,177 @@
+package lxcri
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// DenialSource is the mechanism that denied an operation of the container.
+type DenialSource string
+
+// Known denial sources.
+const (
+	// DenialCapability means that an operation failed with EPERM or EACCES,
+	// most likely because a capability is missing.
+	DenialCapability DenialSource = "capability"
+	// DenialLSM means that an operation was denied by apparmor or selinux.
+	DenialLSM DenialSource = "lsm"
+	// DenialSeccomp means that a syscall was logged or killed by the seccomp filter.
+	// Syscalls that fail with an errno action are only logged if the
+	// seccomp profile uses the action SCMP_ACT_LOG.
+	DenialSeccomp DenialSource = "seccomp"
+)
+
+// Denial is a denied operation of the container found by the
+// denial audit (see ContainerConfig.AuditDenials).
+type Denial struct {
+	Source DenialSource
+	// Operation is the denied operation, e.g `mount` or `syscall=165`.
+	Operation string `json:",omitempty"`
+	// Capability is the capability that is required for the operation (if known).
+	Capability string `json:",omitempty"`
+	// Missing is true if Capability is not granted to the container process.
+	Missing bool `json:",omitempty"`
+	// Line is the log line or kernel message that reported the denial.
+	Line string
+}
+
+func (d Denial) String() string {
+	var b strings.Builder
+	b.WriteString(string(d.Source))
+	if d.Operation != "" {
+		fmt.Fprintf(&b, " operation=%s", d.Operation)
+	}
+	if d.Capability != "" {
+		fmt.Fprintf(&b, " capability=%s", d.Capability)
+		if d.Missing {
+			b.WriteString(" (missing)")
+		}
+	}
+	fmt.Fprintf(&b, ": %s", d.Line)
+	return b.String()
+}
+
+// errnoDenied matches log lines of operations that failed with EPERM or EACCES.
+var errnoDenied = regexp.MustCompile(`(?i)(operation not permitted|permission denied|EPERM|EACCES)`)
+
+// operationCapabilities are the capabilities required for the operations
+// that commonly fail when a container is started without privileges.
+// The first operation that is found as a word in a log line wins (see containsWord).
+var operationCapabilities = []struct {
+	operation  string
+	capability string
+}{
+	{"mknod", "CAP_MKNOD"},
+	{"pivot_root", "CAP_SYS_ADMIN"},
+	{"mount", "CAP_SYS_ADMIN"},
+	{"hostname", "CAP_SYS_ADMIN"},
+	{"domainname", "CAP_SYS_ADMIN"},
+	{"setns", "CAP_SYS_ADMIN"},
+	{"setgroups", "CAP_SETGID"},
+	{"setgid", "CAP_SETGID"},
+	{"setuid", "CAP_SETUID"},
+	{"chown", "CAP_CHOWN"},
+	{"chroot", "CAP_SYS_CHROOT"},
+	{"setrlimit", "CAP_SYS_RESOURCE"},
+	{"prlimit", "CAP_SYS_RESOURCE"},
+	{"rlimit", "CAP_SYS_RESOURCE"},
+	{"oom_score_adj", "CAP_SYS_RESOURCE"},
+	{"capabilities", "CAP_SETPCAP"},
+	{"capability", "CAP_SETPCAP"},
+	{"sysctl", "CAP_SYS_ADMIN"},
+	{"/proc/sys", "CAP_SYS_ADMIN"},
+}
+
+var (
+	// e.g `apparmor="DENIED" operation="capable" profile="p" pid=1 comm="sh" capability=21  capname="sys_admin"`
+	apparmorDenied = regexp.MustCompile(`apparmor="DENIED" operation="([^"]+)"`)
+	apparmorCap    = regexp.MustCompile(`capname="([^"]+)"`)
+	// e.g `avc:  denied  { sys_admin } for  pid=1 comm="sh" capability=21 scontext=... tclass=capability permissive=0`
+	avcDenied = regexp.MustCompile(`avc:\s+denied\s+\{ ([^}]+) \}.*tclass=(\S+)`)
+	// e.g `audit: type=1326 audit(1618231234.123:42): ... syscall=165 compat=0 ip=0x7f code=0x0`
+	seccompSyscall = regexp.MustCompile(`syscall=(\d+)`)
+)
+
+// auditDenials returns the denied operations reported in the liblxc log lines,
+// the monitor output and the kernel messages.
+func auditDenials(proc *specs.Process, logLines []string, monitorOutput []string, kmsgs []string) []Denial {
+	var denials []Denial
+
+	capDenial := func(source DenialSource, operation string, capName string, line string) Denial {
+		d := Denial{Source: source, Operation: operation, Capability: capName, Line: line}
+		if capName != "" {
+			d.Missing = proc == nil || !hasProcessCapability(proc, capName)
+		}
+		return d
+	}
+
+	for _, lines := range [][]string{logLines, monitorOutput} {
+		for _, line := range lines {
+			if !errnoDenied.MatchString(line) {
+				continue
+			}
+			d := Denial{Source: DenialCapability, Line: line}
+			lower := strings.ToLower(line)
+			for _, oc := range operationCapabilities {
+				if containsWord(lower, oc.operation) {
+					d = capDenial(DenialCapability, oc.operation, oc.capability, line)
+					break
+				}
+			}
+			denials = append(denials, d)
+		}
+	}
+
+	for _, msg := range kmsgs {
+		if m := apparmorDenied.FindStringSubmatch(msg); m != nil {
+			d := Denial{Source: DenialLSM, Operation: m[1], Line: msg}
+			if c := apparmorCap.FindStringSubmatch(msg); c != nil {
+				d = capDenial(DenialLSM, m[1], "CAP_"+strings.ToUpper(c[1]), msg)
+			}
+			denials = append(denials, d)
+			continue
+		}
+		if m := avcDenied.FindStringSubmatch(msg); m != nil {
+			d := Denial{Source: DenialLSM, Operation: m[1], Line: msg}
+			if strings.HasPrefix(m[2], "cap") {
+				perm := strings.Fields(m[1])[0]
+				d = capDenial(DenialLSM, m[1], "CAP_"+strings.ToUpper(perm), msg)
+			}
+			denials = append(denials, d)
+			continue
+		}
+		if strings.Contains(msg, "type=1326") {
+			d := Denial{Source: DenialSeccomp, Line: msg}
+			if m := seccompSyscall.FindStringSubmatch(msg); m != nil {
+				d.Operation = "syscall=" + m[1]
+			}
+			denials = append(denials, d)
+		}
+	}
+	return denials
+}
+
+// containsWord returns true if s contains word, and word is neither preceded
+// nor followed by a letter, digit or underscore (e.g `mount` is not found in `umount`).
+func containsWord(s string, word string) bool {
+	for i := 0; i < len(s); {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start := i + j
+		end := start + len(word)
+		if (start == 0 || !isWordChar(s[start-1])) && (end == len(s) || !isWordChar(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
@@ -0,0 +1,48 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditDenials(t *testing.T) {
+	proc := &specs.Process{Capabilities: &specs.LinuxCapabilities{
+		Bounding:  []string{"CAP_CHOWN", "CAP_SYS_ADMIN"},
+		Effective: []string{"CAP_CHOWN", "CAP_SYS_ADMIN"},
+		Permitted: []string{"CAP_CHOWN", "CAP_SYS_ADMIN"},
+	}}
+	logLines := []string{
+		`lxc c1 20210101 ERROR conf - conf.c:lxc_setup_dev:1 - Operation not permitted - Failed to mknod "/dev/fuse"`,
+		`lxc c1 20210101 ERROR conf - conf.c:mount_entry:2 - Operation not permitted - Failed to mount "proc" onto "/proc"`,
+		`lxc c1 20210101 ERROR start - start.c:1 - Failed to spawn container`,
+	}
+	monitorOutput := []string{`lxcri-init: failed to open /data: Permission denied`}
+	kmsgs := []string{
+		`audit: type=1400 audit(1618231234.123:42): apparmor="DENIED" operation="capable" profile="c1" pid=1 comm="sh" capability=12  capname="net_admin"`,
+		`audit: type=1400 audit(1618231234.123:43): avc:  denied  { sys_time } for  pid=1 comm="date" capability=25 scontext=s tcontext=t tclass=capability permissive=0`,
+		`audit: type=1326 audit(1618231234.123:44): auid=4294967295 pid=1 comm="sh" sig=31 arch=c000003e syscall=165 compat=0 ip=0x7f code=0x0`,
+	}
+
+	denials := auditDenials(proc, logLines, monitorOutput, kmsgs)
+	require.Len(t, denials, 6)
+	require.Equal(t, Denial{Source: DenialCapability, Operation: "mknod", Capability: "CAP_MKNOD", Missing: true, Line: logLines[0]}, denials[0])
+	require.Equal(t, Denial{Source: DenialCapability, Operation: "mount", Capability: "CAP_SYS_ADMIN", Line: logLines[1]}, denials[1])
+	require.Equal(t, Denial{Source: DenialCapability, Line: monitorOutput[0]}, denials[2])
+	require.Equal(t, Denial{Source: DenialLSM, Operation: "capable", Capability: "CAP_NET_ADMIN", Missing: true, Line: kmsgs[0]}, denials[3])
+	require.Equal(t, "CAP_SYS_TIME", denials[4].Capability)
+	require.Equal(t, Denial{Source: DenialSeccomp, Operation: "syscall=165", Line: kmsgs[2]}, denials[5])
+
+	require.Equal(t, `capability operation=mknod capability=CAP_MKNOD (missing): `+logLines[0], denials[0].String())
+}
+
+func TestContainsWord(t *testing.T) {
+	require.True(t, containsWord("failed to mount proc", "mount"))
+	require.True(t, containsWord("mount", "mount"))
+	require.True(t, containsWord("failed to umount /a, failed to mount /b", "mount"))
+	require.False(t, containsWord("failed to umount proc", "mount"))
+	require.False(t, containsWord("conf.c:mount_entry: failed", "mount"))
+	require.True(t, containsWord("failed to write /proc/sys/net", "/proc/sys"))
+	require.False(t, containsWord("failed to setrlimit", "rlimit"))
+}
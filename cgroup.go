@@ -3,7 +3,6 @@ package lxcri
 import (
 	"context"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -11,29 +10,97 @@ import (
 	"time"
 
 	//"github.com/fsnotify/fsnotify"
+	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 )
 
 var cgroupRoot = "/sys/fs/cgroup"
 
+// cgroups is the cgroup hierarchy of the host detected by Runtime.Init.
+var cgroups cgroupHierarchy = unifiedHierarchy{}
+
+// cgroupHierarchy abstracts the controller interface files of the cgroup2
+// unified hierarchy and the cgroup v1 controller hierarchies (legacy or hybrid mode).
+// The cgroup dir arguments are relative to the cgroup root (e.g Container.CgroupDir).
+type cgroupHierarchy interface {
+	// version returns the cgroup version (1 or 2) of the controllers.
+	version() int
+	// configKey returns the liblxc config key for a controller interface file (e.g pids.max).
+	configKey(file string) string
+	// isPopulated returns true if the cgroup has member processes.
+	isPopulated(fs FS, dir string) (bool, error)
+	// setFrozen freezes or thaws the cgroup.
+	setFrozen(fs FS, dir string, freeze bool) error
+	// isFrozen returns true if the cgroup is frozen.
+	isFrozen(fs FS, dir string) (bool, error)
+	// readStats reads the resource statistics of the cgroup.
+	readStats(fs FS, dir string) (*CgroupStats, error)
+	// memoryEventsFile returns the file that contains the oom_kill counter.
+	memoryEventsFile(dir string) string
+}
+
+// unifiedHierarchy is the cgroup2 unified hierarchy mounted at cgroupRoot.
+type unifiedHierarchy struct{}
+
+func (unifiedHierarchy) version() int {
+	return 2
+}
+
+func (unifiedHierarchy) configKey(file string) string {
+	return "lxc.cgroup2." + file
+}
+
+func (unifiedHierarchy) isPopulated(fs FS, dir string) (bool, error) {
+	ev, err := parseCgroupEvents(fs, filepath.Join(cgroupRoot, dir, "cgroup.events"))
+	return ev.populated, err
+}
+
+func (unifiedHierarchy) setFrozen(fs FS, dir string, freeze bool) error {
+	return cgroupFreeze(fs, filepath.Join(cgroupRoot, dir, "cgroup.freeze"), freeze)
+}
+
+func (unifiedHierarchy) isFrozen(fs FS, dir string) (bool, error) {
+	ev, err := parseCgroupEvents(fs, filepath.Join(cgroupRoot, dir, "cgroup.events"))
+	return ev.frozen, err
+}
+
+func (unifiedHierarchy) readStats(fs FS, dir string) (*CgroupStats, error) {
+	return readCgroupStats(fs, filepath.Join(cgroupRoot, dir))
+}
+
+func (unifiedHierarchy) memoryEventsFile(dir string) string {
+	return filepath.Join(cgroupRoot, dir, "memory.events")
+}
+
+// detectCgroupRoot detects the cgroup hierarchy (see cgroups) and
+// returns the root of the hierarchy used to track the container processes.
+// In hybrid mode this is the cgroup2 hierarchy mounted at /sys/fs/cgroup/unified,
+// and in legacy mode the named systemd hierarchy at /sys/fs/cgroup/systemd.
 func detectCgroupRoot() (string, error) {
 	var cgroupRoot string
+	cgroups = unifiedHierarchy{}
 	if err := isFilesystem("/sys/fs/cgroup", "cgroup2"); err == nil {
 		cgroupRoot = "/sys/fs/cgroup"
-	}
-	if err := isFilesystem("/sys/fs/cgroup/unified", "cgroup2"); err == nil {
+	} else if err := isFilesystem("/sys/fs/cgroup/unified", "cgroup2"); err == nil {
 		cgroupRoot = "/sys/fs/cgroup/unified"
+		cgroups = legacyHierarchy{root: "/sys/fs/cgroup"}
+	} else if err := isFilesystem("/sys/fs/cgroup/systemd", "cgroup"); err == nil {
+		cgroupRoot = "/sys/fs/cgroup/systemd"
+		cgroups = legacyHierarchy{root: "/sys/fs/cgroup"}
 	}
 
 	// TODO use /proc/self/mounts to detect cgroupv2 root !
 
 	if os.Getuid() == 0 {
 		if cgroupRoot == "" {
-			return "", fmt.Errorf("failed to detect cgroupv2 root")
+			return "", fmt.Errorf("failed to detect cgroup root")
 		}
 		return cgroupRoot, nil
 	}
+	if cgroups.version() == 1 {
+		return cgroupRoot, fmt.Errorf("cgroup v1 controllers can not be used by unprivileged users")
+	}
 
 	// Use the cgroup path of the runtime user if unprivileged.
 	data, err := os.ReadFile("/proc/self/cgroup")
@@ -51,13 +118,24 @@ func detectCgroupRoot() (string, error) {
 	return cgroupRoot, fmt.Errorf("failed to parse cgroup from /proc/self/cgroup")
 }
 
+// checkCgroupRoot checks that the cgroup root is a mounted cgroup filesystem.
+func checkCgroupRoot() error {
+	if cgroups.version() == 1 {
+		if err := isFilesystem(cgroupRoot, "cgroup2"); err == nil {
+			return nil
+		}
+		return isFilesystem(cgroupRoot, "cgroup")
+	}
+	return isFilesystem(cgroupRoot, "cgroup2")
+}
+
 // checkCgroup checks if the cgroup of the container is non-empty.
 func checkCgroup(c *Container) error {
-	ev, err := parseCgroupEvents(filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events"))
+	populated, err := cgroups.isPopulated(c.sysFS(), c.CgroupDir)
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to parse cgroup events: %w", err)
+		return fmt.Errorf("failed to check cgroup members: %w", err)
 	}
-	if err == nil && ev.populated {
+	if err == nil && populated {
 		return fmt.Errorf("container cgroup %s is not empty", c.CgroupDir)
 	}
 	return nil
@@ -75,6 +153,12 @@ func configureCgroup(rt *Runtime, c *Container) error {
 		return err
 	}
 
+	if rt.Rootless && cgroups.version() == 2 {
+		if err := checkCgroupDelegation(rt, c); err != nil {
+			return err
+		}
+	}
+
 	if devices := c.Spec.Linux.Resources.Devices; devices != nil {
 		if rt.Features.CgroupDevices {
 			if err := configureDeviceController(c); err != nil {
@@ -91,13 +175,13 @@ func configureCgroup(rt *Runtime, c *Container) error {
 	}
 
 	if cpu := c.Spec.Linux.Resources.CPU; cpu != nil {
-		if err := configureCPUController(rt, cpu); err != nil {
+		if err := configureCPUController(c, cpu); err != nil {
 			return err
 		}
 	}
 
-	if pids := c.Spec.Linux.Resources.Pids; pids != nil {
-		if err := c.setConfigItem("lxc.cgroup2.pids.max", fmt.Sprintf("%d", pids.Limit)); err != nil {
+	if pids := c.Spec.Linux.Resources.Pids; pids != nil && !c.isSkippedLimit("pids.max") {
+		if err := c.setConfigItem(cgroups.configKey("pids.max"), fmt.Sprintf("%d", pids.Limit)); err != nil {
 			return err
 		}
 	}
@@ -122,6 +206,19 @@ func configureCgroupPath(rt *Runtime, c *Container) error {
 		c.CgroupDir = c.Spec.Linux.CgroupsPath
 	}
 
+	if rt.CgroupManager == CgroupManagerSystemd {
+		if _, _, err := systemdScope(c.CgroupDir); err != nil {
+			return fmt.Errorf("systemd cgroup manager requires a systemd cgroup path: %w", err)
+		}
+	}
+
+	if rt.ExternalCgroups {
+		if err := checkExternalCgroup(c.CgroupDir); err != nil {
+			return err
+		}
+		c.ExternalCgroup = true
+	}
+
 	if err := c.setConfigItem("lxc.cgroup.relative", "0"); err != nil {
 		return err
 	}
@@ -131,12 +228,18 @@ func configureCgroupPath(rt *Runtime, c *Container) error {
 	//  lxc.cgroup.dir.payload and lxc.cgroup.dir.monitor
 	splitCgroup := c.supportsConfigItem("lxc.cgroup.dir.container", "lxc.cgroup.dir.monitor")
 
-	if !splitCgroup || rt.MonitorCgroup == "" {
-		return c.setConfigItem("lxc.cgroup.dir", c.CgroupDir)
+	if rt.MonitorInContainerCgroup {
+		if !splitCgroup {
+			return fmt.Errorf("monitor in container cgroup requires lxc.cgroup.dir.monitor support")
+		}
+		c.MonitorCgroupDir = filepath.Join(c.CgroupDir, monitorCgroupName)
+	} else {
+		if !splitCgroup || rt.MonitorCgroup == "" {
+			return c.setConfigItem("lxc.cgroup.dir", c.CgroupDir)
+		}
+		c.MonitorCgroupDir = filepath.Join(rt.MonitorCgroup, c.ContainerID+".scope")
 	}
 
-	c.MonitorCgroupDir = filepath.Join(rt.MonitorCgroup, c.ContainerID+".scope")
-
 	if err := c.setConfigItem("lxc.cgroup.dir.container", c.CgroupDir); err != nil {
 		return err
 	}
@@ -144,7 +247,7 @@ func configureCgroupPath(rt *Runtime, c *Container) error {
 		return err
 	}
 
-	if c.supportsConfigItem("lxc.cgroup.dir.monitor.pivot") {
+	if rt.MonitorCgroup != "" && c.supportsConfigItem("lxc.cgroup.dir.monitor.pivot") {
 		if err := c.setConfigItem("lxc.cgroup.dir.monitor.pivot", rt.MonitorCgroup); err != nil {
 			return err
 		}
@@ -153,14 +256,74 @@ func configureCgroupPath(rt *Runtime, c *Container) error {
 
 }
 
+// translateCgroupMount translates a mount of type "cgroup" (see runtime-spec config.md#mounts)
+// into a mount of the container cgroup2 subtree. Like runc, the cgroup2 filesystem
+// is mounted if the container has a cgroup namespace, so the container cgroup
+// is the root of the mounted hierarchy. Otherwise the container cgroup directory
+// is bind mounted from the host. Without a user namespace the mount is read-only,
+// unless the mount options explicitly request a read-write mount.
+func translateCgroupMount(c *Container, ms *specs.Mount) error {
+	if err := isFilesystem(cgroupRoot, "cgroup2"); err != nil {
+		return fmt.Errorf("cgroup mount %s requires cgroup2: %w", ms.Destination, err)
+	}
+	if isNamespaceEnabled(c.Spec, specs.CgroupNamespace) {
+		ms.Type = "cgroup2"
+		ms.Source = "cgroup2"
+	} else {
+		if c.CgroupDir == "" {
+			return fmt.Errorf("cgroup mount %s requires a container cgroup", ms.Destination)
+		}
+		ms.Type = "bind"
+		ms.Source = filepath.Join(cgroupRoot, c.CgroupDir)
+		if !specki.HasMountOption(ms.Options, "rbind") {
+			ms.Options = append(ms.Options, "rbind")
+		}
+	}
+	if !specki.HasMountOption(ms.Options, "ro") && !specki.HasMountOption(ms.Options, "rw") {
+		if isNamespaceEnabled(c.Spec, specs.UserNamespace) {
+			ms.Options = append(ms.Options, "rw")
+		} else {
+			ms.Options = append(ms.Options, "ro")
+		}
+	}
+	return nil
+}
+
+// monitorCgroupName is the name of the monitor cgroup within
+// the container cgroup (see Runtime.MonitorInContainerCgroup).
+const monitorCgroupName = "lxcri-monitor"
+
+// isMonitorInContainerCgroup returns true if the monitor cgroup
+// is the container cgroup or is nested within the container cgroup.
+func (c *Container) isMonitorInContainerCgroup() bool {
+	return c.MonitorCgroupDir == c.CgroupDir || strings.HasPrefix(c.MonitorCgroupDir, c.CgroupDir+"/")
+}
+
+// checkExternalCgroup checks that the externally managed cgroup exists.
+// The processes are placed into the existing cgroup.
+func checkExternalCgroup(cgroupDir string) error {
+	if cgroupDir == "" {
+		return fmt.Errorf("external cgroup management requires a cgroup path")
+	}
+	_, err := os.Stat(filepath.Join(cgroupRoot, cgroupDir, "cgroup.procs"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("externally managed cgroup %s does not exist", cgroupDir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check externally managed cgroup %s: %w", cgroupDir, err)
+	}
+	return nil
+}
+
 func configureDeviceController(c *Container) error {
-	devicesAllow := "lxc.cgroup2.devices.allow"
-	devicesDeny := "lxc.cgroup2.devices.deny"
+	devicesAllow := cgroups.configKey("devices.allow")
+	devicesDeny := cgroups.configKey("devices.deny")
 
 	// Set cgroup device permissions from spec.
 	// Device rule parsing in LXC is not well documented in lxc.container.conf
 	// see https://github.com/lxc/lxc/blob/79c66a2af36ee8e967c5260428f8cdb5c82efa94/src/lxc/cgroups/cgfsng.c#L2545
 	// Mixing allow/deny is not permitted by lxc.cgroup2.devices.
+	// With cgroup v1 the rules are written to devices.allow and devices.deny in order.
 	// Best practise is to build up an allow list to disable access restrict access to new/unhandled devices.
 
 	anyDevice := ""
@@ -187,6 +350,12 @@ func configureDeviceController(c *Container) error {
 		case anyDevice:
 			// do not deny any device, this will also deny access to default devices
 			if !dev.Allow {
+				// cgroup v1 allows access to all devices unless denied
+				if cgroups.version() == 1 && maj == "*" && min == "*" {
+					if err := c.setConfigItem(key, "a"); err != nil {
+						return err
+					}
+				}
 				continue
 			}
 			// decompose
@@ -210,10 +379,18 @@ func configureDeviceController(c *Container) error {
 	return nil
 }
 
-func configureCPUController(clxc *Runtime, slinux *specs.LinuxCPU) error {
+func configureCPUController(c *Container, cpu *specs.LinuxCPU) error {
 	// CPU resource restriction configuration
 	// use strconv.FormatUint(n, 10) instead of fmt.Sprintf ?
-	clxc.Log.Debug().Msg("TODO configure cgroup cpu controller")
+	c.Log.Debug().Msg("TODO configure cgroup cpu controller")
+
+	// NUMA memory nodes, the memory policy of the container process
+	// is set by lxcri-init (see internal/mempolicy)
+	if cpu.Mems != "" && !c.isSkippedLimit("cpuset.mems") {
+		if err := c.setConfigItem(cgroups.configKey("cpuset.mems"), cpu.Mems); err != nil {
+			return err
+		}
+	}
 	/*
 		if cpu.Shares != nil && *cpu.Shares > 0 {
 				if err := clxc.setConfigItem("lxc.cgroup2.cpu.shares", fmt.Sprintf("%d", *cpu.Shares)); err != nil {
@@ -246,7 +423,6 @@ func configureCPUController(clxc *Runtime, slinux *specs.LinuxCPU) error {
 			}
 		}
 	*/
-	// Mems string `json:"mems,omitempty"`
 	return nil
 }
 
@@ -276,84 +452,125 @@ func parseSystemdCgroupPath(s string) string {
 
 // killCgroup freezes the cgroups of the given container
 // and sends the given signal sig to all cgroup members.
-func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
+// The cgroup is always thawed before killCgroup returns.
+func killCgroup(ctx context.Context, c *Container, sig unix.Signal) (retErr error) {
 	if c.CgroupDir == "" {
 		return nil
 	}
-	rootDir := filepath.Join(cgroupRoot, c.CgroupDir)
-	eventsFile := filepath.Join(rootDir, "cgroup.events")
-
-	ev, err := parseCgroupEvents(eventsFile)
+	populated, err := cgroups.isPopulated(c.sysFS(), c.CgroupDir)
 	if err != nil {
 		return err
 	}
-	if !ev.populated {
+	if !populated {
 		return nil
 	}
 
-	freezer := filepath.Join(rootDir, "cgroup.freeze")
+	// Thaw on every return path, including a failed or timed out freeze.
+	defer func() {
+		err := cgroups.setFrozen(c.sysFS(), c.CgroupDir, false)
+		if err != nil && retErr == nil {
+			retErr = fmt.Errorf("failed to thaw cgroup: %w", err)
+		}
+	}()
 
-	err = cgroupFreeze(freezer, true)
-	if err != nil {
+	if err := freezeCgroup(ctx, c, c.CgroupDir, true); err != nil {
 		return err
 	}
 
-	err = pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
-		return ev.frozen
-	})
+	pids, err := readCgroupProcs(c.sysFS(), filepath.Join(cgroupRoot, c.CgroupDir))
 	if err != nil {
 		return err
 	}
 
-	err = filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.Name() != "cgroup.procs" {
-			return nil
-		}
-		procsData, err := os.ReadFile(path)
-		if err != nil {
-			return err
+	c.Log.Debug().Msgf("killing %d cgroup procs: %v", len(pids), pids)
+	for _, pid := range pids {
+		// do not kill the monitor process
+		if pid == c.Pid {
+			continue
 		}
-		// cgroup.procs contains one PID per line and is newline separated.
-		// A trailing newline is always present.
-		s := strings.TrimSpace(string(procsData))
-		if s == "" {
-			return nil
+		err = unix.Kill(pid, sig)
+		if err != nil && err != unix.ESRCH {
+			c.Log.Error().Msgf("failed to kill %d: %s", pid, err)
+			continue
 		}
-		vals := strings.Split(s, "\n")
+	}
+	return nil
+}
 
-		c.Log.Debug().Msgf("killing %d cgroup procs: %s", len(vals), vals)
-		for _, s := range vals {
-			pid, err := strconv.Atoi(s)
-			if err != nil {
-				c.Log.Error().Msgf("failed to convert PID %q to number: %s", s, err)
-				continue
-			}
-			// do not kill the monitor process
-			if pid == c.Pid {
-				continue
-			}
-			err = unix.Kill(pid, sig)
-			if err != nil && err != unix.ESRCH {
-				c.Log.Error().Msgf("failed to kill %d: %s", pid, err)
-				continue
-			}
-		}
-		return nil
+// freezeCgroup freezes (or thaws) the cgroup dir and waits until
+// the cgroup is frozen (or thawed).
+func freezeCgroup(ctx context.Context, c *Container, dir string, freeze bool) error {
+	if err := cgroups.setFrozen(c.sysFS(), dir, freeze); err != nil {
+		return fmt.Errorf("failed to freeze cgroup: %w", err)
+	}
+	return pollCgroup(ctx, c, func() (bool, error) {
+		frozen, err := cgroups.isFrozen(c.sysFS(), dir)
+		return frozen == freeze, err
 	})
+}
 
+// killCgroupTree kills all processes of the container cgroup (including child cgroups)
+// with SIGKILL, by writing to cgroup.kill (since kernel 5.14).
+// It returns false if cgroup.kill is not supported, or if the monitor process
+// is a member of the container cgroup, because the monitor must not be killed.
+func killCgroupTree(c *Container) (bool, error) {
+	if c.CgroupDir == "" {
+		return false, nil
+	}
+	if c.isMonitorInContainerCgroup() {
+		return false, nil
+	}
+	f, err := os.OpenFile(filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.kill"), os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
+	defer f.Close()
+	c.Log.Debug().Msg("killing cgroup procs with cgroup.kill")
+	_, err = f.Write([]byte("1"))
+	return err == nil, err
+}
 
-	err = cgroupFreeze(freezer, false)
+// readCgroupProcs returns the PIDs from cgroup.procs
+// of the given cgroup directory and all of its child cgroups.
+func readCgroupProcs(fsys FS, dir string) ([]int, error) {
+	procsData, err := fsys.ReadFile(filepath.Join(dir, "cgroup.procs"))
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return nil
+	var pids []int
+	// cgroup.procs contains one PID per line and is newline separated.
+	// A trailing newline is always present.
+	if s := strings.TrimSpace(string(procsData)); s != "" {
+		for _, s := range strings.Split(s, "\n") {
+			pid, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert PID %q to number: %w", s, err)
+			}
+			pids = append(pids, pid)
+		}
+	}
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		childPids, err := readCgroupProcs(fsys, filepath.Join(dir, e.Name()))
+		// The child cgroup may be removed while the container is killed.
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, childPids...)
+	}
+	return pids, nil
 }
 
 type cgroupEvents struct {
@@ -361,9 +578,9 @@ type cgroupEvents struct {
 	populated bool
 }
 
-func parseCgroupEvents(filename string) (cgroupEvents, error) {
+func parseCgroupEvents(fs FS, filename string) (cgroupEvents, error) {
 	ev := cgroupEvents{}
-	data, err := os.ReadFile(filename)
+	data, err := fs.ReadFile(filename)
 	if err != nil {
 		return ev, err
 	}
@@ -383,55 +600,66 @@ func parseCgroupEvents(filename string) (cgroupEvents, error) {
 	return ev, nil
 }
 
-func cgroupFreeze(filename string, freeze bool) error {
-	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+// parseCgroupMemoryOOMKills returns the value of the oom_kill counter
+// from the cgroup2 memory.events file.
+func parseCgroupMemoryOOMKills(fs FS, filename string) (uint64, error) {
+	data, err := fs.ReadFile(filename)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer f.Close()
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		vals := strings.Fields(line)
+		if len(vals) == 2 && vals[0] == "oom_kill" {
+			return strconv.ParseUint(vals[1], 10, 64)
+		}
+	}
+	return 0, nil
+}
+
+func cgroupFreeze(fs FS, filename string, freeze bool) error {
 	if freeze {
-		_, err = f.Write([]byte("1"))
-	} else {
-		_, err = f.Write([]byte("0"))
+		return fs.WriteFile(filename, []byte("1"))
 	}
-	return err
+	return fs.WriteFile(filename, []byte("0"))
 }
 
-func pollCgroupEvents(ctx context.Context, eventsFile string, fn func(ev cgroupEvents) bool) error {
+func pollCgroupEvents(ctx context.Context, c *Container, eventsFile string, fn func(ev cgroupEvents) bool) error {
+	return pollCgroup(ctx, c, func() (bool, error) {
+		ev, err := parseCgroupEvents(c.sysFS(), eventsFile)
+		return err == nil && fn(ev), err
+	})
+}
+
+// pollCgroup calls cond until it returns true or an error.
+func pollCgroup(ctx context.Context, c *Container, cond func() (bool, error)) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			ev, err := parseCgroupEvents(eventsFile)
+			ok, err := cond()
 			if err != nil {
 				return err
 			}
-			if fn(ev) {
+			if ok {
 				return nil
 			}
-			time.Sleep(time.Millisecond * 5)
+			<-c.sysClock().After(time.Millisecond * 5)
 		}
 	}
 }
 
-func deleteCgroup(cgroupName string) error {
-	return deleteCgroupRecursive(cgroupName, 0, 10)
+func deleteCgroup(fs FS, cgroupName string) error {
+	return deleteCgroupRecursive(fs, cgroupName, 0, 10)
 }
 
-func deleteCgroupRecursive(cgroupName string, level, max int) error {
+func deleteCgroupRecursive(fs FS, cgroupName string, level, max int) error {
 	if level == max {
 		return fmt.Errorf("reached max recursion of %d", max)
 	}
 	dirName := filepath.Join(cgroupRoot, cgroupName)
-	dir, err := os.Open(dirName)
-	if err != nil {
-		return err
-	}
-	entries, err := dir.Readdir(-1)
-	if err := dir.Close(); err != nil {
-		return err
-	}
+	entries, err := fs.ReadDir(dirName)
 	if err != nil {
 		return err
 	}
@@ -444,10 +672,10 @@ func deleteCgroupRecursive(cgroupName string, level, max int) error {
 			continue
 		}
 		childGroup := filepath.Join(cgroupName, name)
-		err := deleteCgroupRecursive(childGroup, level+1, max)
+		err := deleteCgroupRecursive(fs, childGroup, level+1, max)
 		if err != nil {
 			return err
 		}
 	}
-	return unix.Rmdir(dirName)
+	return fs.Rmdir(dirName)
 }
@@ -1,9 +1,17 @@
 package lxcri
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestParseSystemCgroupPath(t *testing.T) {
@@ -11,3 +19,110 @@ func TestParseSystemCgroupPath(t *testing.T) {
 	cg := parseSystemdCgroupPath(s)
 	require.Equal(t, "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-123.slice/crio-ABC.scope", cg)
 }
+
+func TestKillCgroupThawsOnError(t *testing.T) {
+	freezeFile := filepath.Join(cgroupRoot, "test", "cgroup.freeze")
+	eventsFile := filepath.Join(cgroupRoot, "test", "cgroup.events")
+	procsFile := filepath.Join(cgroupRoot, "test", "cgroup.procs")
+	mfs := &memFS{files: map[string][]byte{
+		freezeFile: []byte("0"),
+		eventsFile: []byte("populated 1\nfrozen 0\n"),
+		procsFile:  []byte("1\nnot-a-pid\n"),
+	}}
+	mfs.onRead = func(name string, n int) {
+		if name == eventsFile {
+			mfs.files[name] = []byte(fmt.Sprintf("populated 1\nfrozen %s\n", mfs.files[freezeFile]))
+		}
+	}
+	c := &Container{
+		ContainerConfig: &ContainerConfig{
+			CgroupDir: "test",
+			Log:       zerolog.Nop(),
+		},
+		clock: &fakeClock{now: time.Unix(0, 0)},
+		fs:    mfs,
+	}
+
+	err := killCgroup(context.Background(), c, unix.SIGKILL)
+	require.Error(t, err)
+	require.Equal(t, "0", string(mfs.files[freezeFile]))
+}
+
+func TestKillCgroupTree(t *testing.T) {
+	defer func(root string) { cgroupRoot = root }(cgroupRoot)
+	cgroupRoot = t.TempDir()
+
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "pod/ctr", MonitorCgroupDir: "monitor"}}
+	require.NoError(t, os.MkdirAll(filepath.Join(cgroupRoot, c.CgroupDir), 0755))
+
+	// cgroup.kill is not supported
+	killed, err := killCgroupTree(c)
+	require.NoError(t, err)
+	require.False(t, killed)
+
+	killFile := filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.kill")
+	require.NoError(t, os.WriteFile(killFile, nil, 0600))
+	killed, err = killCgroupTree(c)
+	require.NoError(t, err)
+	require.True(t, killed)
+	data, err := os.ReadFile(killFile)
+	require.NoError(t, err)
+	require.Equal(t, "1", string(data))
+
+	// the monitor process is a member of the container cgroup
+	c.MonitorCgroupDir = "pod/ctr/monitor"
+	killed, err = killCgroupTree(c)
+	require.NoError(t, err)
+	require.False(t, killed)
+}
+
+func TestCheckExternalCgroup(t *testing.T) {
+	defer func(root string) { cgroupRoot = root }(cgroupRoot)
+	cgroupRoot = t.TempDir()
+
+	require.Error(t, checkExternalCgroup(""))
+	require.Error(t, checkExternalCgroup("kubepods.slice/crio-ABC.scope"))
+
+	dir := filepath.Join(cgroupRoot, "kubepods.slice/crio-ABC.scope")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), nil, 0644))
+	require.NoError(t, checkExternalCgroup("kubepods.slice/crio-ABC.scope"))
+}
+
+func TestIsMonitorInContainerCgroup(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "kubepods.slice/crio-ABC.scope"}}
+	c.MonitorCgroupDir = filepath.Join(c.CgroupDir, monitorCgroupName)
+	require.True(t, c.isMonitorInContainerCgroup())
+	c.MonitorCgroupDir = "lxcri-monitor.slice/ABC.scope"
+	require.False(t, c.isMonitorInContainerCgroup())
+	c.MonitorCgroupDir = c.CgroupDir + "-monitor"
+	require.False(t, c.isMonitorInContainerCgroup())
+}
+
+func TestTranslateCgroupMount(t *testing.T) {
+	if err := isFilesystem(cgroupRoot, "cgroup2"); err != nil {
+		t.Skipf("cgroup2 is required: %s", err)
+	}
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec:      &specs.Spec{Linux: &specs.Linux{}},
+		CgroupDir: "pod/ctr",
+	}}
+
+	ms := specs.Mount{Destination: "/sys/fs/cgroup", Type: "cgroup", Source: "cgroup", Options: []string{"nosuid", "noexec", "nodev"}}
+	require.NoError(t, translateCgroupMount(c, &ms))
+	require.Equal(t, "bind", ms.Type)
+	require.Equal(t, filepath.Join(cgroupRoot, "pod/ctr"), ms.Source)
+	require.Equal(t, []string{"nosuid", "noexec", "nodev", "rbind", "ro"}, ms.Options)
+
+	c.Spec.Linux.Namespaces = []specs.LinuxNamespace{{Type: specs.CgroupNamespace}, {Type: specs.UserNamespace}}
+	ms = specs.Mount{Destination: "/sys/fs/cgroup", Type: "cgroup", Source: "cgroup", Options: []string{"nosuid"}}
+	require.NoError(t, translateCgroupMount(c, &ms))
+	require.Equal(t, "cgroup2", ms.Type)
+	require.Equal(t, "cgroup2", ms.Source)
+	require.Equal(t, []string{"nosuid", "rw"}, ms.Options)
+
+	// explicit mount options are not changed
+	ms = specs.Mount{Destination: "/sys/fs/cgroup", Type: "cgroup", Source: "cgroup", Options: []string{"ro"}}
+	require.NoError(t, translateCgroupMount(c, &ms))
+	require.Equal(t, []string{"ro"}, ms.Options)
+}
@@ -0,0 +1,280 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CgroupStats are the resource statistics of the container cgroup.
+type CgroupStats struct {
+	Memory MemoryStats
+	CPU    CPUStats
+	Pids   PidsStats
+	// IO are the statistics per block device.
+	IO []IOStats `json:",omitempty"`
+	// Pressure is the pressure stall information (PSI),
+	// which requires a kernel with CONFIG_PSI.
+	Pressure *PressureStats `json:",omitempty"`
+}
+
+// MemoryStats are the statistics of the cgroup2 memory controller.
+type MemoryStats struct {
+	// Current is the memory usage in bytes.
+	Current uint64
+	// Peak is the maximum memory usage in bytes (requires kernel >= 5.19).
+	Peak uint64 `json:",omitempty"`
+	// Swap is the swap usage in bytes.
+	Swap uint64
+	// Limit is the memory limit in bytes, 0 if unlimited.
+	Limit uint64 `json:",omitempty"`
+	// Stat are the values from memory.stat (e.g anon, file)
+	Stat map[string]uint64 `json:",omitempty"`
+}
+
+// CPUStats are the statistics from cpu.stat.
+type CPUStats struct {
+	UsageUsec     uint64
+	UserUsec      uint64
+	SystemUsec    uint64
+	NrPeriods     uint64 `json:",omitempty"`
+	NrThrottled   uint64 `json:",omitempty"`
+	ThrottledUsec uint64 `json:",omitempty"`
+}
+
+// PidsStats are the statistics of the cgroup2 pids controller.
+type PidsStats struct {
+	Current uint64
+	// Limit is the maximum number of pids, 0 if unlimited.
+	Limit uint64 `json:",omitempty"`
+}
+
+// IOStats are the statistics of a block device from io.stat.
+type IOStats struct {
+	Major  uint64
+	Minor  uint64
+	RBytes uint64
+	WBytes uint64
+	RIOs   uint64
+	WIOs   uint64
+}
+
+// PressureStats are the pressure stall information per resource.
+type PressureStats struct {
+	CPU    *Pressure `json:",omitempty"`
+	Memory *Pressure `json:",omitempty"`
+	IO     *Pressure `json:",omitempty"`
+}
+
+// Pressure is the content of a PSI file (e.g cpu.pressure).
+// See https://www.kernel.org/doc/html/latest/accounting/psi.html
+type Pressure struct {
+	Some PressureData
+	Full PressureData
+}
+
+// PressureData is a single line of a PSI file.
+type PressureData struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total is the total stall time in microseconds.
+	Total uint64
+}
+
+// readCgroupStats reads the statistics from the cgroup directory dir.
+// Files of controllers that are not enabled are skipped.
+// An error that satisfies os.IsNotExist is returned if the cgroup does not exist.
+func readCgroupStats(fs FS, dir string) (*CgroupStats, error) {
+	// cgroup.events exists in every non-root cgroup
+	if _, err := fs.ReadFile(filepath.Join(dir, "cgroup.events")); err != nil {
+		return nil, err
+	}
+	stats := &CgroupStats{}
+	var err error
+
+	values := []struct {
+		file string
+		dst  *uint64
+	}{
+		{"memory.current", &stats.Memory.Current},
+		{"memory.peak", &stats.Memory.Peak},
+		{"memory.swap.current", &stats.Memory.Swap},
+		{"memory.max", &stats.Memory.Limit},
+		{"pids.current", &stats.Pids.Current},
+		{"pids.max", &stats.Pids.Limit},
+	}
+	for _, v := range values {
+		*v.dst, err = readCgroupValue(fs, filepath.Join(dir, v.file))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	stats.Memory.Stat, err = readCgroupKeyedFile(fs, filepath.Join(dir, "memory.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cpu, err := readCgroupKeyedFile(fs, filepath.Join(dir, "cpu.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.CPU = CPUStats{
+		UsageUsec:     cpu["usage_usec"],
+		UserUsec:      cpu["user_usec"],
+		SystemUsec:    cpu["system_usec"],
+		NrPeriods:     cpu["nr_periods"],
+		NrThrottled:   cpu["nr_throttled"],
+		ThrottledUsec: cpu["throttled_usec"],
+	}
+
+	data, err := fs.ReadFile(filepath.Join(dir, "io.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.IO, err = parseIOStat(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	pressure := &PressureStats{}
+	for name, dst := range map[string]**Pressure{"cpu.pressure": &pressure.CPU, "memory.pressure": &pressure.Memory, "io.pressure": &pressure.IO} {
+		data, err := fs.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		*dst, err = parsePressure(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+	}
+	if pressure.CPU != nil || pressure.Memory != nil || pressure.IO != nil {
+		stats.Pressure = pressure
+	}
+	return stats, nil
+}
+
+// readCgroupValue reads a single value cgroup file.
+// The value "max" is returned as 0.
+func readCgroupValue(fs FS, filename string) (uint64, error) {
+	data, err := fs.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value in %s: %w", filename, err)
+	}
+	return n, nil
+}
+
+// readCgroupKeyedFile reads a flat keyed cgroup file (e.g cpu.stat).
+func readCgroupKeyedFile(fs FS, filename string) (map[string]uint64, error) {
+	data, err := fs.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	vals := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s in %s: %w", fields[0], filename, err)
+		}
+		vals[fields[0]] = n
+	}
+	return vals, nil
+}
+
+// parseIOStat parses the content of io.stat,
+// e.g `8:0 rbytes=1024 wbytes=0 rios=1 wios=0 dbytes=0 dios=0`
+func parseIOStat(data string) ([]IOStats, error) {
+	var devices []IOStats
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var dev IOStats
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &dev.Major, &dev.Minor); err != nil {
+			return nil, fmt.Errorf("invalid io.stat device %q: %w", fields[0], err)
+		}
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			n, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid io.stat value %q: %w", f, err)
+			}
+			switch kv[0] {
+			case "rbytes":
+				dev.RBytes = n
+			case "wbytes":
+				dev.WBytes = n
+			case "rios":
+				dev.RIOs = n
+			case "wios":
+				dev.WIOs = n
+			}
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+// parsePressure parses the content of a PSI file, e.g
+// `some avg10=0.00 avg60=0.00 avg300=0.00 total=0`
+func parsePressure(data string) (*Pressure, error) {
+	p := &Pressure{}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var pd *PressureData
+		switch fields[0] {
+		case "some":
+			pd = &p.Some
+		case "full":
+			pd = &p.Full
+		default:
+			return nil, fmt.Errorf("invalid pressure line %q", line)
+		}
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid pressure value %q", f)
+			}
+			var err error
+			switch kv[0] {
+			case "avg10":
+				pd.Avg10, err = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				pd.Avg60, err = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				pd.Avg300, err = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				pd.Total, err = strconv.ParseUint(kv[1], 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid pressure value %q: %w", f, err)
+			}
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,48 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCgroupStats(t *testing.T) {
+	dir := filepath.Join(cgroupRoot, "test")
+	mfs := &memFS{files: map[string][]byte{
+		filepath.Join(dir, "cgroup.events"):       []byte("populated 1\nfrozen 0\n"),
+		filepath.Join(dir, "memory.current"):      []byte("4096\n"),
+		filepath.Join(dir, "memory.swap.current"): []byte("0\n"),
+		filepath.Join(dir, "memory.max"):          []byte("max\n"),
+		filepath.Join(dir, "memory.stat"):         []byte("anon 1024\nfile 2048\n"),
+		filepath.Join(dir, "pids.current"):        []byte("3\n"),
+		filepath.Join(dir, "pids.max"):            []byte("100\n"),
+		filepath.Join(dir, "cpu.stat"):            []byte("usage_usec 300\nuser_usec 200\nsystem_usec 100\n"),
+		filepath.Join(dir, "io.stat"):             []byte("8:0 rbytes=1024 wbytes=512 rios=2 wios=1 dbytes=0 dios=0\n"),
+		filepath.Join(dir, "memory.pressure"):     []byte("some avg10=1.50 avg60=0.00 avg300=0.00 total=42\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=7\n"),
+	}}
+
+	stats, err := readCgroupStats(mfs, dir)
+	require.NoError(t, err)
+	require.Equal(t, MemoryStats{Current: 4096, Stat: map[string]uint64{"anon": 1024, "file": 2048}}, stats.Memory)
+	require.Equal(t, PidsStats{Current: 3, Limit: 100}, stats.Pids)
+	require.Equal(t, CPUStats{UsageUsec: 300, UserUsec: 200, SystemUsec: 100}, stats.CPU)
+	require.Equal(t, []IOStats{{Major: 8, Minor: 0, RBytes: 1024, WBytes: 512, RIOs: 2, WIOs: 1}}, stats.IO)
+	require.NotNil(t, stats.Pressure)
+	require.Nil(t, stats.Pressure.CPU)
+	require.Equal(t, &Pressure{
+		Some: PressureData{Avg10: 1.5, Total: 42},
+		Full: PressureData{Total: 7},
+	}, stats.Pressure.Memory)
+
+	_, err = readCgroupStats(mfs, filepath.Join(cgroupRoot, "deleted"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestParsePressureInvalid(t *testing.T) {
+	_, err := parsePressure("none avg10=0.00\n")
+	require.Error(t, err)
+	_, err = parsePressure("some avg10=x\n")
+	require.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupV1Unlimited is the lowest value that cgroup v1 reports
+// for an unlimited resource (PAGE_COUNTER_MAX rounded to the page size).
+const cgroupV1Unlimited = 1 << 62
+
+// legacyHierarchy are the cgroup v1 controller hierarchies mounted
+// below root (e.g /sys/fs/cgroup/memory), as used in legacy and hybrid mode.
+// The container processes are tracked in the hierarchy at cgroupRoot.
+type legacyHierarchy struct {
+	root string
+}
+
+// controllerDir returns the directory of the cgroup dir in the controller hierarchy.
+func (h legacyHierarchy) controllerDir(controller string, dir string) string {
+	return filepath.Join(h.root, controller, dir)
+}
+
+func (legacyHierarchy) version() int {
+	return 1
+}
+
+func (legacyHierarchy) configKey(file string) string {
+	return "lxc.cgroup." + file
+}
+
+// isPopulated uses cgroup.events if the processes are tracked in the
+// cgroup2 hierarchy (hybrid mode). Otherwise cgroup.procs of the freezer
+// controller is read, which does not include the members of child cgroups.
+func (h legacyHierarchy) isPopulated(fs FS, dir string) (bool, error) {
+	ev, err := parseCgroupEvents(fs, filepath.Join(cgroupRoot, dir, "cgroup.events"))
+	if err == nil {
+		return ev.populated, nil
+	}
+	data, err := fs.ReadFile(filepath.Join(h.controllerDir("freezer", dir), "cgroup.procs"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(data)) != "", nil
+}
+
+func (h legacyHierarchy) setFrozen(fs FS, dir string, freeze bool) error {
+	state := "THAWED"
+	if freeze {
+		state = "FROZEN"
+	}
+	return fs.WriteFile(filepath.Join(h.controllerDir("freezer", dir), "freezer.state"), []byte(state))
+}
+
+// isFrozen returns false while the freezer is in the transitional state FREEZING.
+func (h legacyHierarchy) isFrozen(fs FS, dir string) (bool, error) {
+	data, err := fs.ReadFile(filepath.Join(h.controllerDir("freezer", dir), "freezer.state"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(data)) == "FROZEN", nil
+}
+
+func (h legacyHierarchy) memoryEventsFile(dir string) string {
+	// memory.oom_control contains the oom_kill counter since kernel 4.13
+	return filepath.Join(h.controllerDir("memory", dir), "memory.oom_control")
+}
+
+// readStats reads the statistics from the cgroup v1 controllers.
+// Files of controllers that are not mounted are skipped.
+// Pressure stall information is not available for cgroup v1.
+func (h legacyHierarchy) readStats(fs FS, dir string) (*CgroupStats, error) {
+	if _, err := fs.ReadFile(filepath.Join(h.controllerDir("freezer", dir), "cgroup.procs")); err != nil {
+		return nil, err
+	}
+	stats := &CgroupStats{}
+	memDir := h.controllerDir("memory", dir)
+	cpuDir := h.controllerDir("cpuacct", dir)
+
+	var memswUsage, cpuUsage, cpuUser, cpuSystem uint64
+	values := []struct {
+		file string
+		dst  *uint64
+	}{
+		{filepath.Join(memDir, "memory.usage_in_bytes"), &stats.Memory.Current},
+		{filepath.Join(memDir, "memory.max_usage_in_bytes"), &stats.Memory.Peak},
+		{filepath.Join(memDir, "memory.memsw.usage_in_bytes"), &memswUsage},
+		{filepath.Join(memDir, "memory.limit_in_bytes"), &stats.Memory.Limit},
+		{filepath.Join(cpuDir, "cpuacct.usage"), &cpuUsage},
+		{filepath.Join(cpuDir, "cpuacct.usage_user"), &cpuUser},
+		{filepath.Join(cpuDir, "cpuacct.usage_sys"), &cpuSystem},
+		{filepath.Join(h.controllerDir("pids", dir), "pids.current"), &stats.Pids.Current},
+		{filepath.Join(h.controllerDir("pids", dir), "pids.max"), &stats.Pids.Limit},
+	}
+	var err error
+	for _, v := range values {
+		*v.dst, err = readCgroupValue(fs, v.file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if stats.Memory.Limit >= cgroupV1Unlimited {
+		stats.Memory.Limit = 0
+	}
+	// memsw is the sum of the memory and swap usage
+	if memswUsage > stats.Memory.Current {
+		stats.Memory.Swap = memswUsage - stats.Memory.Current
+	}
+
+	stats.Memory.Stat, err = readCgroupKeyedFile(fs, filepath.Join(memDir, "memory.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// The cgroup v1 CPU times are in nanoseconds.
+	cpu, err := readCgroupKeyedFile(fs, filepath.Join(h.controllerDir("cpu", dir), "cpu.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.CPU = CPUStats{
+		UsageUsec:     cpuUsage / 1000,
+		UserUsec:      cpuUser / 1000,
+		SystemUsec:    cpuSystem / 1000,
+		NrPeriods:     cpu["nr_periods"],
+		NrThrottled:   cpu["nr_throttled"],
+		ThrottledUsec: cpu["throttled_time"] / 1000,
+	}
+
+	blkioDir := h.controllerDir("blkio", dir)
+	ioBytes, err := fs.ReadFile(filepath.Join(blkioDir, "blkio.throttle.io_service_bytes"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ioOps, err := fs.ReadFile(filepath.Join(blkioDir, "blkio.throttle.io_serviced"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.IO, err = parseBlkioStats(string(ioBytes), string(ioOps))
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// parseBlkioStats parses the content of blkio.throttle.io_service_bytes
+// and blkio.throttle.io_serviced, e.g
+// `8:0 Read 1024` `8:0 Write 512` ... `Total 1536`
+func parseBlkioStats(bytes string, ops string) ([]IOStats, error) {
+	var devices []IOStats
+	index := make(map[string]int)
+	parse := func(data string, read func(*IOStats) *uint64, write func(*IOStats) *uint64) error {
+		for _, line := range strings.Split(data, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			i, ok := index[fields[0]]
+			if !ok {
+				var dev IOStats
+				if _, err := fmt.Sscanf(fields[0], "%d:%d", &dev.Major, &dev.Minor); err != nil {
+					return fmt.Errorf("invalid blkio device %q: %w", fields[0], err)
+				}
+				i = len(devices)
+				index[fields[0]] = i
+				devices = append(devices, dev)
+			}
+			n, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid blkio value %q: %w", line, err)
+			}
+			switch fields[1] {
+			case "Read":
+				*read(&devices[i]) = n
+			case "Write":
+				*write(&devices[i]) = n
+			}
+		}
+		return nil
+	}
+	err := parse(bytes, func(s *IOStats) *uint64 { return &s.RBytes }, func(s *IOStats) *uint64 { return &s.WBytes })
+	if err != nil {
+		return nil, err
+	}
+	err = parse(ops, func(s *IOStats) *uint64 { return &s.RIOs }, func(s *IOStats) *uint64 { return &s.WIOs })
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
@@ -0,0 +1,75 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyHierarchyFreezer(t *testing.T) {
+	h := legacyHierarchy{root: "/sys/fs/cgroup"}
+	state := "/sys/fs/cgroup/freezer/test/freezer.state"
+	procs := "/sys/fs/cgroup/freezer/test/cgroup.procs"
+	mfs := &memFS{files: map[string][]byte{
+		state: []byte("THAWED\n"),
+		procs: []byte("42\n"),
+	}}
+
+	require.Equal(t, "lxc.cgroup.pids.max", h.configKey("pids.max"))
+
+	populated, err := h.isPopulated(mfs, "test")
+	require.NoError(t, err)
+	require.True(t, populated)
+
+	require.NoError(t, h.setFrozen(mfs, "test", true))
+	require.Equal(t, "FROZEN", string(mfs.files[state]))
+	mfs.files[state] = []byte("FREEZING\n")
+	frozen, err := h.isFrozen(mfs, "test")
+	require.NoError(t, err)
+	require.False(t, frozen)
+	mfs.files[state] = []byte("FROZEN\n")
+	frozen, err = h.isFrozen(mfs, "test")
+	require.NoError(t, err)
+	require.True(t, frozen)
+
+	mfs.files[procs] = nil
+	populated, err = h.isPopulated(mfs, "test")
+	require.NoError(t, err)
+	require.False(t, populated)
+}
+
+func TestLegacyHierarchyStats(t *testing.T) {
+	h := legacyHierarchy{root: "/sys/fs/cgroup"}
+	dir := func(controller, file string) string {
+		return filepath.Join("/sys/fs/cgroup", controller, "test", file)
+	}
+	mfs := &memFS{files: map[string][]byte{
+		dir("freezer", "cgroup.procs"):                  []byte("42\n"),
+		dir("memory", "memory.usage_in_bytes"):          []byte("4096\n"),
+		dir("memory", "memory.max_usage_in_bytes"):      []byte("8192\n"),
+		dir("memory", "memory.memsw.usage_in_bytes"):    []byte("5120\n"),
+		dir("memory", "memory.limit_in_bytes"):          []byte("9223372036854771712\n"),
+		dir("memory", "memory.stat"):                    []byte("cache 1024\nrss 2048\n"),
+		dir("cpuacct", "cpuacct.usage"):                 []byte("3000000\n"),
+		dir("cpuacct", "cpuacct.usage_user"):            []byte("2000000\n"),
+		dir("cpuacct", "cpuacct.usage_sys"):             []byte("1000000\n"),
+		dir("cpu", "cpu.stat"):                          []byte("nr_periods 10\nnr_throttled 2\nthrottled_time 5000\n"),
+		dir("pids", "pids.current"):                     []byte("3\n"),
+		dir("pids", "pids.max"):                         []byte("max\n"),
+		dir("blkio", "blkio.throttle.io_service_bytes"): []byte("8:0 Read 1024\n8:0 Write 512\n8:0 Sync 0\nTotal 1536\n"),
+		dir("blkio", "blkio.throttle.io_serviced"):      []byte("8:0 Read 2\n8:0 Write 1\nTotal 3\n"),
+	}}
+
+	stats, err := h.readStats(mfs, "test")
+	require.NoError(t, err)
+	require.Equal(t, MemoryStats{Current: 4096, Peak: 8192, Swap: 1024, Stat: map[string]uint64{"cache": 1024, "rss": 2048}}, stats.Memory)
+	require.Equal(t, CPUStats{UsageUsec: 3000, UserUsec: 2000, SystemUsec: 1000, NrPeriods: 10, NrThrottled: 2, ThrottledUsec: 5}, stats.CPU)
+	require.Equal(t, PidsStats{Current: 3}, stats.Pids)
+	require.Equal(t, []IOStats{{Major: 8, Minor: 0, RBytes: 1024, WBytes: 512, RIOs: 2, WIOs: 1}}, stats.IO)
+	require.Nil(t, stats.Pressure)
+
+	_, err = h.readStats(mfs, "deleted")
+	require.True(t, os.IsNotExist(err))
+}
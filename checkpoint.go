@@ -0,0 +1,208 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// CheckpointDir is the default directory (relative to the container runtime directory)
+// for the checkpoint images.
+const CheckpointDir = "checkpoint"
+
+// CheckpointOptions are the options for Runtime.Checkpoint.
+type CheckpointOptions struct {
+	// ImagePath is the directory where the checkpoint images are written to.
+	// The default is CheckpointDir within the container runtime directory.
+	ImagePath string
+	// WorkPath is the optional directory where the CRIU log files are copied to.
+	// liblxc writes the CRIU log files into ImagePath.
+	WorkPath string
+	// ParentPath is the directory of a previous pre-dump,
+	// which is used to only dump the memory pages modified since.
+	ParentPath string
+	// PreDump only dumps the memory pages, and the container keeps running.
+	// A pre-dump is used as ParentPath for the final checkpoint.
+	PreDump bool
+	// LeaveRunning keeps the container running after the checkpoint.
+	LeaveRunning bool
+	// Verbose enables verbose CRIU logging.
+	Verbose bool
+}
+
+// RestoreOptions are the options for Runtime.Restore.
+type RestoreOptions struct {
+	// ImagePath is the directory that contains the checkpoint images.
+	// The default is CheckpointDir within the container runtime directory.
+	ImagePath string
+	// WorkPath is the optional directory where the CRIU log files are copied to.
+	WorkPath string
+	// Verbose enables verbose CRIU logging.
+	Verbose bool
+}
+
+func (c *Container) checkpointDir(p string) string {
+	if p == "" {
+		return c.RuntimePath(CheckpointDir)
+	}
+	return p
+}
+
+func checkCRIU() error {
+	if !lxc.VersionAtLeast(2, 0, 0) {
+		return fmt.Errorf("checkpoint/restore requires liblxc >= 2.0.0 (was %s)", lxc.Version())
+	}
+	if _, err := exec.LookPath("criu"); err != nil {
+		return fmt.Errorf("checkpoint/restore requires criu: %w", err)
+	}
+	return nil
+}
+
+// Checkpoint dumps the state of the running container with CRIU
+// (using the liblxc CRIU integration) into the checkpoint images.
+// Unless LeaveRunning or PreDump is set, the container is stopped,
+// and the container restart policy is disabled.
+func (rt *Runtime) Checkpoint(ctx context.Context, c *Container, opts CheckpointOptions) error {
+	if err := checkCRIU(); err != nil {
+		return errorf("checkpoint/restore is not supported: %w", err)
+	}
+	unlock, err := rt.lockContainer(c.ContainerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := c.ContainerState()
+	if err != nil {
+		return err
+	}
+	if state != specs.StateRunning {
+		return errorf("container must be running to checkpoint, but was %s", state)
+	}
+
+	dir := c.checkpointDir(opts.ImagePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errorf("failed to create checkpoint image directory: %w", err)
+	}
+
+	stop := !opts.LeaveRunning && !opts.PreDump
+	if stop {
+		if err := c.disableRestart(); err != nil {
+			return errorf("failed to disable restart: %w", err)
+		}
+	}
+
+	cmd := uint(lxc.MIGRATE_DUMP)
+	if opts.PreDump {
+		cmd = lxc.MIGRATE_PRE_DUMP
+	}
+	c.Log.Info().Str("dir", dir).Bool("predump", opts.PreDump).Bool("stop", stop).Msg("checkpoint container")
+	err = c.LinuxContainer.Migrate(cmd, lxc.MigrateOptions{
+		Directory:  dir,
+		PredumpDir: opts.ParentPath,
+		Verbose:    opts.Verbose,
+		Stop:       stop,
+	})
+	if werr := copyCRIULogs(dir, opts.WorkPath); werr != nil {
+		c.Log.Warn().Msgf("failed to copy criu logs: %s", werr)
+	}
+	if err != nil {
+		return errorf("checkpoint failed: %w", err)
+	}
+	return nil
+}
+
+// Restore restores the container from the checkpoint images.
+// The container must be stopped and its runtime directory must still exist
+// (e.g after Runtime.Checkpoint without CheckpointOptions.LeaveRunning).
+// The restored container is monitored by a liblxc monitor process
+// instead of ExecStart, so the container restart policy does not apply.
+func (rt *Runtime) Restore(ctx context.Context, c *Container, opts RestoreOptions) error {
+	if err := checkCRIU(); err != nil {
+		return errorf("checkpoint/restore is not supported: %w", err)
+	}
+	unlock, err := rt.lockContainer(c.ContainerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := c.ContainerState()
+	if err != nil {
+		return err
+	}
+	if state != specs.StateStopped {
+		return errorf("container must be stopped to restore, but was %s", state)
+	}
+
+	dir := c.checkpointDir(opts.ImagePath)
+	c.Log.Info().Str("dir", dir).Msg("restore container")
+	err = c.LinuxContainer.Restore(lxc.RestoreOptions{Directory: dir, Verbose: opts.Verbose})
+	if werr := copyCRIULogs(dir, opts.WorkPath); werr != nil {
+		c.Log.Warn().Msgf("failed to copy criu logs: %s", werr)
+	}
+	if err != nil {
+		return errorf("restore failed: %w", err)
+	}
+
+	// The monitor process forked by liblxc is the parent of the restored init process.
+	pid := c.LinuxContainer.InitPid()
+	if pid < 1 {
+		return errorf("restored container init process is not running")
+	}
+	status, err := readProcStatus(rt.sysFS(), pid)
+	if err != nil {
+		return errorf("failed to read restored init process status: %w", err)
+	}
+	c.Pid, err = strconv.Atoi(status["PPid"])
+	if err != nil {
+		return errorf("invalid parent pid of restored init process: %w", err)
+	}
+	c.CreatedAt = rt.sysClock().Now()
+	return rt.saveState(c, true)
+}
+
+// copyCRIULogs copies the CRIU log files from the image directory to the work directory.
+func copyCRIULogs(imageDir string, workDir string) error {
+	if workDir == "" {
+		return nil
+	}
+	logs, err := filepath.Glob(filepath.Join(imageDir, "*.log"))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		return err
+	}
+	for _, src := range logs {
+		if err := copyFile(src, filepath.Join(workDir, filepath.Base(src))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src string, dst string) error {
+	// #nosec
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
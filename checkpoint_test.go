@@ -0,0 +1,30 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointDir(t *testing.T) {
+	c := &Container{runtimeDir: "/run/lxcri/c1"}
+	require.Equal(t, "/run/lxcri/c1/checkpoint", c.checkpointDir(""))
+	require.Equal(t, "/var/lib/checkpoint", c.checkpointDir("/var/lib/checkpoint"))
+}
+
+func TestCopyCRIULogs(t *testing.T) {
+	imageDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(imageDir, "dump.log"), []byte("dump"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(imageDir, "pages-1.img"), []byte("pages"), 0600))
+
+	require.NoError(t, copyCRIULogs(imageDir, ""))
+
+	workDir := filepath.Join(t.TempDir(), "work")
+	require.NoError(t, copyCRIULogs(imageDir, workDir))
+	data, err := os.ReadFile(filepath.Join(workDir, "dump.log"))
+	require.NoError(t, err)
+	require.Equal(t, "dump", string(data))
+	require.NoFileExists(t, filepath.Join(workDir, "pages-1.img"))
+}
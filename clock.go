@@ -0,0 +1,112 @@
+package lxcri
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// TimeSyncAnnotation enables ContainerConfig.TimeSync if the value is "true".
+const TimeSyncAnnotation = "org.linuxcontainers.lxcri.TimeSync"
+
+// rtcDevice is the host real-time clock device exposed to the container.
+var rtcDevice = "/dev/rtc0"
+
+// timeSyscalls are the syscalls used to adjust the system clock (e.g by chrony or ntpd).
+var timeSyscalls = []string{"adjtimex", "clock_adjtime", "clock_adjtime64", "clock_settime", "clock_settime64", "settimeofday"}
+
+func (c *Container) timeSyncEnabled() bool {
+	if val, ok := c.Spec.Annotations[TimeSyncAnnotation]; ok {
+		return val == "true"
+	}
+	return c.TimeSync
+}
+
+// configureTimeSync exposes the real-time clock device and allows the syscalls
+// required to adjust the system clock, if time synchronization is enabled.
+// The system clock is not namespaced, so the container adjusts the host clock.
+// CAP_SYS_TIME must be granted to the container process and the runtime.
+func configureTimeSync(rt *Runtime, c *Container) error {
+	if !c.timeSyncEnabled() {
+		return nil
+	}
+	if !hasProcessCapability(c.Spec.Process, "CAP_SYS_TIME") {
+		return fmt.Errorf("time synchronization requires capability CAP_SYS_TIME")
+	}
+	if !rt.hasCapability("sys_time") {
+		return fmt.Errorf("time synchronization requires capability CAP_SYS_TIME for the runtime")
+	}
+
+	dev, err := hostDevice(rtcDevice)
+	if err != nil {
+		return fmt.Errorf("real-time clock device unavailable: %w", err)
+	}
+	for _, d := range []string{rtcDevice, "/dev/rtc"} {
+		dev.Path = d
+		enabled, err := specki.IsDeviceEnabled(c.Spec, dev)
+		if err != nil {
+			return err
+		}
+		if enabled {
+			continue
+		}
+		c.Spec.Linux.Devices = append(c.Spec.Linux.Devices, dev)
+	}
+	if c.Spec.Linux.Resources == nil {
+		c.Spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	major, minor := dev.Major, dev.Minor
+	c.Spec.Linux.Resources.Devices = append(c.Spec.Linux.Resources.Devices,
+		specs.LinuxDeviceCgroup{Allow: true, Type: dev.Type, Major: &major, Minor: &minor, Access: "rw"},
+	)
+
+	if s := c.Spec.Linux.Seccomp; s != nil && len(s.Syscalls) > 0 {
+		allowSyscalls(s, timeSyscalls)
+	}
+	return nil
+}
+
+// allowSyscalls removes the given syscalls from the existing rules of the
+// seccomp profile and inserts a rule that allows them as the first rule.
+// Otherwise an existing (e.g errno) rule for the syscalls could take precedence.
+func allowSyscalls(s *specs.LinuxSeccomp, names []string) {
+	allow := make(map[string]bool, len(names))
+	for _, name := range names {
+		allow[name] = true
+	}
+	syscalls := []specs.LinuxSyscall{{Names: names, Action: specs.ActAllow}}
+	for _, sc := range s.Syscalls {
+		var keep []string
+		for _, name := range sc.Names {
+			if !allow[name] {
+				keep = append(keep, name)
+			}
+		}
+		if len(keep) == 0 {
+			continue
+		}
+		sc.Names = keep
+		syscalls = append(syscalls, sc)
+	}
+	s.Syscalls = syscalls
+}
+
+// hasProcessCapability returns true if the capability is in
+// the bounding, effective and permitted set of the process.
+func hasProcessCapability(proc *specs.Process, capName string) bool {
+	if proc.Capabilities == nil {
+		return false
+	}
+	for _, set := range [][]string{proc.Capabilities.Bounding, proc.Capabilities.Effective, proc.Capabilities.Permitted} {
+		found := false
+		for _, c := range set {
+			found = found || strings.EqualFold(c, capName)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
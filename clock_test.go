@@ -0,0 +1,55 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasProcessCapability(t *testing.T) {
+	proc := &specs.Process{}
+	require.False(t, hasProcessCapability(proc, "CAP_SYS_TIME"))
+
+	proc.Capabilities = &specs.LinuxCapabilities{
+		Bounding:  []string{"CAP_CHOWN", "CAP_SYS_TIME"},
+		Effective: []string{"CAP_SYS_TIME"},
+		Permitted: []string{"cap_sys_time"},
+	}
+	require.True(t, hasProcessCapability(proc, "CAP_SYS_TIME"))
+
+	proc.Capabilities.Effective = nil
+	require.False(t, hasProcessCapability(proc, "CAP_SYS_TIME"))
+}
+
+func TestTimeSyncEnabled(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: &specs.Spec{}}}
+	require.False(t, c.timeSyncEnabled())
+	c.TimeSync = true
+	require.True(t, c.timeSyncEnabled())
+	c.Spec.Annotations = map[string]string{TimeSyncAnnotation: "false"}
+	require.False(t, c.timeSyncEnabled())
+}
+
+func TestConfigureTimeSyncWithoutCapability(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{
+		TimeSync: true,
+		Spec:     &specs.Spec{Process: &specs.Process{}},
+	}}
+	require.Error(t, configureTimeSync(&Runtime{}, c))
+}
+
+func TestAllowSyscalls(t *testing.T) {
+	s := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"read", "settimeofday"}, Action: specs.ActAllow},
+			{Names: []string{"clock_settime", "adjtimex"}, Action: specs.ActErrno},
+		},
+	}
+	allowSyscalls(s, []string{"adjtimex", "clock_settime", "settimeofday"})
+	require.Equal(t, []specs.LinuxSyscall{
+		{Names: []string{"adjtimex", "clock_settime", "settimeofday"}, Action: specs.ActAllow},
+		{Names: []string{"read"}, Action: specs.ActAllow},
+	}, s.Syscalls)
+}
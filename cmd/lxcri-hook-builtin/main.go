@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/lxc/lxcri/internal/mountattr"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -23,6 +25,48 @@ func main() {
 		}
 	}
 
+	// The mount destinations of recursive read-only mounts and the
+	// writable mounts nested below them are already resolved by the runtime.
+	// They are applied in mount order, so writable mounts nested below
+	// a recursive read-only mount, that are mounted later, stay writable.
+	for i, m := range spec.Mounts {
+		if !specki.HasMountOption(m.Options, "rro") {
+			continue
+		}
+		if err := mountattr.SetReadonlyRecursive(filepath.Join(rootfs, m.Destination)); err != nil {
+			err := fmt.Errorf("failed to make mount %s recursively read-only: %w", m.Destination, err)
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		for _, dst := range writableSubmounts(spec.Mounts, i) {
+			if err := mountattr.ClearReadonly(filepath.Join(rootfs, dst)); err != nil {
+				err := fmt.Errorf("failed to make mount %s writable: %w", dst, err)
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+	}
+
+	// The propagation type is normalized to the recursive type by the runtime.
+	if p := spec.Linux.RootfsPropagation; p != "" {
+		if err := setPropagation(rootfs, p); err != nil {
+			err := fmt.Errorf("failed to set rootfs propagation %s: %w", p, err)
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// liblxc does not support the domainname.
+	// It is only set on a new UTS namespace. A joined UTS namespace
+	// is configured by the runtime (see lxcri.ContainerConfig.SetSharedUTSName).
+	if spec.Domainname != "" && clonesUTSNamespace(spec) {
+		if err := unix.Setdomainname([]byte(spec.Domainname)); err != nil {
+			err := fmt.Errorf("failed to set domainname: %w", err)
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
 	for _, p := range spec.Linux.MaskedPaths {
 		if err := maskPath(filepath.Join(rootfs, p)); err != nil {
 			err := fmt.Errorf("failed to mask path %s: %w", p, err)
@@ -31,6 +75,52 @@ func main() {
 	}
 }
 
+// writableSubmounts returns the destinations of the writable mounts
+// nested below the mount mounts[i], that are mounted after it.
+func writableSubmounts(mounts []specs.Mount, i int) []string {
+	prefix := filepath.Clean(mounts[i].Destination) + "/"
+	if prefix == "//" {
+		prefix = "/"
+	}
+	var dsts []string
+	for _, m := range mounts[i+1:] {
+		dst := filepath.Clean(m.Destination)
+		if !strings.HasPrefix(dst, prefix) {
+			continue
+		}
+		if specki.HasMountOption(m.Options, "ro") || specki.HasMountOption(m.Options, "rro") {
+			continue
+		}
+		dsts = append(dsts, dst)
+	}
+	return dsts
+}
+
+func clonesUTSNamespace(spec *specs.Spec) bool {
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == specs.UTSNamespace {
+			return ns.Path == ""
+		}
+	}
+	return false
+}
+
+var propagationFlags = map[string]uintptr{
+	"rshared":     unix.MS_SHARED | unix.MS_REC,
+	"rslave":      unix.MS_SLAVE | unix.MS_REC,
+	"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
+	"runbindable": unix.MS_UNBINDABLE | unix.MS_REC,
+}
+
+// setPropagation changes the propagation type of the rootfs mount and all submounts.
+func setPropagation(rootfs string, propagation string) error {
+	flags, ok := propagationFlags[propagation]
+	if !ok {
+		return fmt.Errorf("unsupported propagation type")
+	}
+	return unix.Mount("", rootfs, "", flags, "")
+}
+
 func getDeviceMode(dev specs.LinuxDevice) (uint32, error) {
 	var fileType uint32
 
@@ -62,12 +152,34 @@ func createDevice(rootfs string, dev specs.LinuxDevice) error {
 	mkdev := int(unix.Mkdev(uint32(dev.Major), uint32(dev.Minor)))
 
 	err = unix.Mknod(filepath.Join(rootfs, dev.Path), mode, mkdev)
+	// mknod is not permitted in a user namespace.
+	// The runtime has checked that the host device matches (see lxcri.configureUserNamespaceDevices).
+	if err == unix.EPERM && (dev.Type == "b" || dev.Type == "c") {
+		return bindDevice(rootfs, dev)
+	}
 	if err != nil {
 		return fmt.Errorf("mknod failed: %s", err)
 	}
 	return nil
 }
 
+// bindDevice bind mounts the host device dev.Path into the rootfs.
+func bindDevice(rootfs string, dev specs.LinuxDevice) error {
+	dst := filepath.Join(rootfs, dev.Path)
+	// #nosec
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create bind mount target: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := unix.Mount(dev.Path, dst, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to bind mount host device: %w", err)
+	}
+	return nil
+}
+
 func maskPath(p string) error {
 	err := unix.Mount("/dev/null", p, "", unix.MS_BIND, "")
 	if os.IsNotExist(err) {
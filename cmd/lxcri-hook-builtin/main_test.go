@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritableSubmounts(t *testing.T) {
+	mounts := []specs.Mount{
+		{Destination: "/data/cache", Options: []string{"rw"}},
+		{Destination: "/data", Options: []string{"rbind", "rro"}},
+		{Destination: "/data/logs", Options: []string{"rbind", "rw"}},
+		{Destination: "/data/logs/archive", Options: []string{"bind", "ro"}},
+		{Destination: "/data/tmp/", Options: []string{"bind"}},
+		{Destination: "/database", Options: []string{"bind"}},
+		{Destination: "/data/secrets", Options: []string{"bind", "rro"}},
+	}
+	// /data/cache is shadowed by /data, /database is not nested
+	require.Equal(t, []string{"/data/logs", "/data/tmp"}, writableSubmounts(mounts, 1))
+	require.Empty(t, writableSubmounts(mounts, 6))
+
+	mounts = []specs.Mount{
+		{Destination: "/", Options: []string{"rro"}},
+		{Destination: "/tmp", Options: []string{"rw"}},
+	}
+	require.Equal(t, []string{"/tmp"}, writableSubmounts(mounts, 0))
+}
@@ -12,6 +12,10 @@ import (
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
+// createRuntimePostMount is set if the createRuntime hooks
+// are run from the lxc mount hook (see lxcri#ContainerConfig.CreateRuntimeHooksPostMount).
+var createRuntimePostMount bool
+
 func init() {
 	// from `man lxc.container.conf`
 	// Standard  output from the hooks is logged at debug level
@@ -24,6 +28,7 @@ func main() {
 	var timeout int
 	// Individual hooks should set a timeout lower than the overall timeout.
 	flag.IntVar(&timeout, "timeout", 30, "maximum run time in seconds allowed for all hooks")
+	flag.BoolVar(&createRuntimePostMount, "create-runtime-post-mount", false, "run the createRuntime hooks from the lxc mount hook")
 	flag.Parse()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
@@ -51,7 +56,7 @@ func run(ctx context.Context, env *Env) error {
 		return err
 	}
 
-	hooksToRun, status, err := ociHooksAndState(env.Type, &hooks)
+	hooksToRun, status, err := ociHooksAndState(env.Type, &hooks, createRuntimePostMount)
 	if err != nil {
 		return err
 	}
@@ -69,24 +74,50 @@ func run(ctx context.Context, env *Env) error {
 	state.Status = status
 
 	fmt.Printf("running OCI hooks for lxc hook %q", env.Type)
-	return specki.RunHooks(ctx, &state, hooksToRun, false)
+	start := time.Now()
+	err = specki.RunHooks(ctx, &state, hooksToRun, false)
+	writeHookTiming(filepath.Join(runtimeDir, hookTimingsFile), env.Type, time.Since(start))
+	return err
+}
+
+// hookTimingsFile is the file where the duration of the hooks is appended.
+// NOTE keep in sync with lxcri#hookTimingsFile
+const hookTimingsFile = "hooks.timings"
+
+// writeHookTiming appends the hook duration to the timings file.
+// Errors are only logged, because the timings are informational.
+func writeHookTiming(filename string, t HookType, d time.Duration) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Printf("failed to open hook timings file: %s\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s %d\n", t, d.Nanoseconds()); err != nil {
+		fmt.Printf("failed to write hook timing: %s\n", err)
+	}
 }
 
 // https://github.com/opencontainers/runtime-spec/blob/master/specs-go/state.go
 // The only value that does change is the specs.ContainerState in specs.State.Status.
 // The specs.ContainerState is implied by the runtime hook.
 // status, and the status is already defined by the hook itself ...
-func ociHooksAndState(t HookType, hooks *specs.Hooks) ([]specs.Hook, specs.ContainerState, error) {
+// If postMount is true the createRuntime hooks are run by the mount hook
+// before the createContainer hooks, with the container rootfs mounted.
+func ociHooksAndState(t HookType, hooks *specs.Hooks, postMount bool) ([]specs.Hook, specs.ContainerState, error) {
 	switch t {
 	case HookPreMount:
 		// quote from https://github.com/opencontainers/runtime-spec/blob/master/config.md#posix-platform-hooks
 		// > For runtimes that implement the deprecated prestart hooks as createRuntime hooks,
 		// > createRuntime hooks MUST be called after the prestart hooks.
-		if len(hooks.CreateRuntime) > 0 {
+		if len(hooks.CreateRuntime) > 0 && !postMount {
 			return append(hooks.Prestart, hooks.CreateRuntime...), specs.StateCreating, nil
 		}
 		return hooks.Prestart, specs.StateCreating, nil
 	case HookMount:
+		if postMount {
+			return append(append([]specs.Hook{}, hooks.CreateRuntime...), hooks.CreateContainer...), specs.StateCreating, nil
+		}
 		return hooks.CreateContainer, specs.StateCreating, nil
 	//case HookStart:
 	//	return hooks.StartContainer, specs.StateCreated, nil
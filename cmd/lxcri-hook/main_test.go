@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOCIHooksAndState(t *testing.T) {
+	hooks := &specs.Hooks{
+		Prestart:        []specs.Hook{{Path: "/prestart"}},
+		CreateRuntime:   []specs.Hook{{Path: "/create-runtime"}},
+		CreateContainer: []specs.Hook{{Path: "/create-container"}},
+	}
+
+	run, status, err := ociHooksAndState(HookPreMount, hooks, false)
+	require.NoError(t, err)
+	require.Equal(t, specs.StateCreating, status)
+	require.Equal(t, []specs.Hook{{Path: "/prestart"}, {Path: "/create-runtime"}}, run)
+
+	run, _, err = ociHooksAndState(HookMount, hooks, false)
+	require.NoError(t, err)
+	require.Equal(t, []specs.Hook{{Path: "/create-container"}}, run)
+
+	run, _, err = ociHooksAndState(HookPreMount, hooks, true)
+	require.NoError(t, err)
+	require.Equal(t, []specs.Hook{{Path: "/prestart"}}, run)
+
+	run, _, err = ociHooksAndState(HookMount, hooks, true)
+	require.NoError(t, err)
+	require.Equal(t, []specs.Hook{{Path: "/create-runtime"}, {Path: "/create-container"}}, run)
+	// the hooks are not modified
+	require.Len(t, hooks.CreateRuntime, 1)
+
+	_, _, err = ociHooksAndState(HookStop, hooks, false)
+	require.Error(t, err)
+}
@@ -2,13 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
 
+	"github.com/lxc/lxcri/internal/cpuaffinity"
+	"github.com/lxc/lxcri/internal/handshake"
+	"github.com/lxc/lxcri/internal/mempolicy"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -28,8 +35,29 @@ func main() {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(3)
 	}
+	restoreProtectedEnv(spec)
 
-	err = doInit(runtimeDir, spec)
+	// The monitor process writes the restart count file before
+	// the container is restarted. There is no runtime process
+	// waiting for the handshake in this case.
+	// NOTE keep in sync with cmd/lxcri-start#RESTART_COUNT_FILE
+	if _, statErr := os.Stat(filepath.Join(runtimeDir, "restarts")); statErr == nil {
+		err = doRestart(runtimeDir, spec)
+	} else {
+		socketPath := filepath.Join(runtimeDir, "sync", handshake.SocketName)
+		l, lerr := net.Listen("unix", socketPath)
+		if lerr != nil {
+			fmt.Fprintf(os.Stderr, "failed to listen on init socket: %s\n", lerr)
+			os.Exit(5)
+		}
+		// The runtime process UID/GID can be different from the init process UID/GID.
+		// Access to the socket is protected by the runtime directory.
+		if err := unix.Chmod(socketPath, 0666); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to chmod init socket: %s\n", err)
+			os.Exit(5)
+		}
+		err = doInit(runtimeDir, spec, l)
+	}
 	if err != nil {
 		if err := writeTerminationLog(spec, "init failed: %s\n", err); err != nil {
 			fmt.Fprintf(os.Stderr, "%s", err)
@@ -39,6 +67,28 @@ func main() {
 	}
 }
 
+// Placeholders of protected values in the process environment.
+// NOTE keep in sync with lxcri#redactedValue and lxcri#encryptedValue
+const (
+	redactedValue  = "lxcri:redacted"
+	encryptedValue = "lxcri:enc:"
+)
+
+// restoreProtectedEnv replaces the protected values (see lxcri#StateProtection)
+// of the process environment with the values that the monitor process
+// passed to the init process (as lxc.environment).
+func restoreProtectedEnv(spec *specs.Spec) {
+	for i, kv := range spec.Process.Env {
+		vals := strings.SplitN(kv, "=", 2)
+		if len(vals) != 2 || (vals[1] != redactedValue && !strings.HasPrefix(vals[1], encryptedValue)) {
+			continue
+		}
+		if val, ok := os.LookupEnv(vals[0]); ok {
+			spec.Process.Env[i] = vals[0] + "=" + val
+		}
+	}
+}
+
 func writeTerminationLog(spec *specs.Spec, format string, a ...interface{}) error {
 	var terminationLog string
 	if spec.Annotations != nil {
@@ -61,11 +111,71 @@ func writeTerminationLog(spec *specs.Spec, format string, a ...interface{}) erro
 	return nil
 }
 
-func doInit(runtimeDir string, spec *specs.Spec) error {
+// doInit prepares the container process and executes it
+// after the runtime sent the start message.
+// Errors are reported to the runtime through the init socket.
+func doInit(runtimeDir string, spec *specs.Spec, l net.Listener) error {
+	state, cmdPath, prepErr := prepare(runtimeDir, spec)
+
+	// Reply to the `create` command.
+	conn, err := l.Accept()
+	if err != nil {
+		return fmt.Errorf("failed to accept connection: %w", err)
+	}
+	if prepErr != nil {
+		sendError(conn, prepErr)
+		return prepErr
+	}
+	err = handshake.Send(conn, handshake.NewMessage(handshake.MsgReady))
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to send ready message: %w", err)
+	}
+
+	// Wait for the `start` command.
+	conn, err = l.Accept()
+	if err != nil {
+		return fmt.Errorf("failed to accept connection: %w", err)
+	}
+	defer conn.Close()
+	msg, err := handshake.Receive(json.NewDecoder(conn))
+	if err != nil {
+		return fmt.Errorf("failed to receive start message: %w", err)
+	}
+	if msg.Type != handshake.MsgStart {
+		return fmt.Errorf("unexpected message %q (expected %q)", msg.Type, handshake.MsgStart)
+	}
+	if err := createSecrets(spec, msg); err != nil {
+		sendError(conn, err)
+		return err
+	}
+
+	// TODO use environment variable to control timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	err = specki.RunHooks(ctx, state, spec.Hooks.StartContainer, false)
+	if err != nil {
+		sendError(conn, err)
+		return err
+	}
+
+	if err := handshake.Send(conn, handshake.NewMessage(handshake.MsgExec)); err != nil {
+		return fmt.Errorf("failed to send exec message: %w", err)
+	}
+	// The connection is closed on exec (close-on-exec).
+	err = unix.Exec(cmdPath, spec.Process.Args, spec.Process.Env)
+	err = fmt.Errorf("exec failed: %w", err)
+	sendError(conn, err)
+	return err
+}
+
+// prepare prepares the environment for the container process
+// and returns the path of the command to execute.
+func prepare(runtimeDir string, spec *specs.Spec) (*specs.State, string, error) {
 	statePath := filepath.Join(runtimeDir, "state.json")
 	state, err := specki.LoadSpecStateJSON(statePath)
 	if err != nil {
-		return fmt.Errorf("failed to read spec %q: %s", statePath, err)
+		return nil, "", fmt.Errorf("failed to read spec %q: %s", statePath, err)
 	}
 
 	cmdPath := spec.Process.Args[0]
@@ -73,11 +183,11 @@ func doInit(runtimeDir string, spec *specs.Spec) error {
 	if exist {
 		err := os.Setenv("PATH", val)
 		if err != nil {
-			return fmt.Errorf("failed to set PATH environment variable: %s", err)
+			return nil, "", fmt.Errorf("failed to set PATH environment variable: %s", err)
 		}
 		cmdPath, err = exec.LookPath(spec.Process.Args[0])
 		if err != nil {
-			return fmt.Errorf("lookup path for %s failed: %w", spec.Process.Args[0], err)
+			return nil, "", fmt.Errorf("lookup path for %s failed: %w", spec.Process.Args[0], err)
 		}
 	}
 
@@ -86,16 +196,49 @@ func doInit(runtimeDir string, spec *specs.Spec) error {
 		addEnvHome(spec)
 	}
 
+	if val, ok := spec.Annotations[mempolicy.Annotation]; ok {
+		policy, err := mempolicy.Parse(val)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid memory policy: %w", err)
+		}
+		// The memory policy is set per thread and the container
+		// process is exec'd from this thread.
+		runtime.LockOSThread()
+		if err := mempolicy.Set(policy); err != nil {
+			return nil, "", err
+		}
+	}
+
+	affinity, err := cpuaffinity.FromSpec(spec)
+	if err != nil {
+		return nil, "", err
+	}
+	if affinity != nil {
+		// The CPU affinity is set per thread and the container
+		// process is exec'd from this thread.
+		runtime.LockOSThread()
+		if err := cpuaffinity.Set(affinity); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if spec.Process.User.Umask != nil {
+		unix.Umask(int(*spec.Process.User.Umask))
+	}
+
 	err = unix.Chdir(spec.Process.Cwd)
 	if err != nil {
-		return fmt.Errorf("failed to change cwd to %s: %w", spec.Process.Cwd, err)
+		return nil, "", fmt.Errorf("failed to change cwd to %s: %w", spec.Process.Cwd, err)
 	}
+	return state, cmdPath, nil
+}
 
-	err = readSyncfifo(filepath.Join(runtimeDir, "syncfifo"))
+// doRestart executes the container process without handshake.
+func doRestart(runtimeDir string, spec *specs.Spec) error {
+	state, cmdPath, err := prepare(runtimeDir, spec)
 	if err != nil {
 		return err
 	}
-
 	// TODO use environment variable to control timeout
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
@@ -103,20 +246,40 @@ func doInit(runtimeDir string, spec *specs.Spec) error {
 	if err != nil {
 		return err
 	}
+	err = unix.Exec(cmdPath, spec.Process.Args, spec.Process.Env)
+	return fmt.Errorf("exec failed: %w", err)
+}
 
-	unix.Exec(cmdPath, spec.Process.Args, spec.Process.Env)
-	if err != nil {
-		return fmt.Errorf("exec failed: %w", err)
+// createSecrets adds the secret environment variables to the process environment
+// and writes the secret files to the secrets directory.
+// NOTE keep in sync with lxcri#SecretsDir
+func createSecrets(spec *specs.Spec, msg *handshake.Message) error {
+	for _, kv := range msg.Env {
+		spec.Process.Env, _ = specki.Setenv(spec.Process.Env, kv, true)
+	}
+	for name, data := range msg.Files {
+		p := filepath.Join("/run/secrets", filepath.Base(name))
+		// #nosec
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+		if err != nil {
+			return fmt.Errorf("failed to create secret: %w", err)
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write secret %s: %w", p, err)
+		}
 	}
 	return nil
 }
 
-func readSyncfifo(filename string) error {
-	f, err := os.OpenFile(filename, os.O_RDONLY, 0)
-	if err != nil {
-		return fmt.Errorf("failed to open %s: %w", filename, err)
+func sendError(conn net.Conn, err error) {
+	if err := handshake.Send(conn, handshake.NewError(err)); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to send error message: %s\n", err)
 	}
-	return f.Close()
+	conn.Close()
 }
 
 /*
@@ -2,9 +2,17 @@
 #include <errno.h>
 #include <fcntl.h>
 #include <signal.h>
+#include <stdbool.h>
 #include <stdio.h>
+#include <stdlib.h>
 #include <string.h>
+#include <poll.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
 #include <sys/types.h>
+#include <sys/wait.h>
+#include <time.h>
 #include <unistd.h>
 
 #include <lxc/lxccontainer.h>
@@ -15,6 +23,55 @@
 */
 #define ENABLE_LXCINIT 0
 
+/*
+/ The exit status of the container init process is written to this file
+/ (relative to the working directory, which is the container runtime directory).
+/ The first line is the raw wait status, the second line is an optional error message.
+*/
+#define EXIT_STATUS_FILE "exitstatus"
+
+/*
+/ The number of container restarts is written to this file.
+/ NOTE keep in sync with lxcri#restartCountFile and cmd/lxcri-init
+*/
+#define RESTART_COUNT_FILE "restarts"
+
+/*
+/ The runtime creates this file to prevent further restarts
+/ e.g when the container is killed or deleted.
+/ NOTE keep in sync with lxcri#noRestartFile
+*/
+#define NO_RESTART_FILE "norestart"
+
+/* The maximum delay between two restarts. */
+#define RESTART_BACKOFF_MAX_MS 60000
+
+/*
+/ File descriptors passed by the runtime in console mode 'stdio'.
+/ NOTE keep in sync with lxcri#setupConsoleStdio
+*/
+#define CONSOLE_FORWARD_FD 3
+#define CONSOLE_LISTEN_FD 4
+
+/*
+/ The PID of the console forwarder process is written to this file,
+/ so the runtime can kill the forwarder when the container is deleted.
+/ NOTE keep in sync with lxcri#consoleForwarderPidFile
+*/
+#define CONSOLE_FORWARDER_PID_FILE "console.pid"
+
+/*
+/ The maximum time the forwarder waits for a client to drain
+/ the remaining output after the container stdio was closed.
+*/
+#define CONSOLE_DRAIN_TIMEOUT_MS 10000
+
+enum restart_policy {
+	RESTART_NO,
+	RESTART_ON_FAILURE,
+	RESTART_ALWAYS,
+};
+
 #define ERROR(format, ...)                                                  \
 	{                                                                   \
 		fprintf(stderr, "[lxcri-start] " format, ##__VA_ARGS__); \
@@ -22,6 +79,359 @@
 		goto out;                                                   \
 	}
 
+static void write_exit_status(int status, const char *msg)
+{
+	FILE *f = fopen(EXIT_STATUS_FILE, "we");
+	if (f == NULL) {
+		fprintf(stderr, "[lxcri-start] failed to open %s: %s\n",
+			EXIT_STATUS_FILE, strerror(errno));
+		return;
+	}
+	fprintf(f, "%d\n%s\n", status, msg);
+	fclose(f);
+}
+
+static void write_restart_count(int count)
+{
+	FILE *f = fopen(RESTART_COUNT_FILE, "we");
+	if (f == NULL) {
+		fprintf(stderr, "[lxcri-start] failed to open %s: %s\n",
+			RESTART_COUNT_FILE, strerror(errno));
+		return;
+	}
+	fprintf(f, "%d\n", count);
+	fclose(f);
+}
+
+static long getenv_long(const char *name, long def)
+{
+	const char *val = getenv(name);
+	if (val == NULL || *val == '\0')
+		return def;
+	return strtol(val, NULL, 10);
+}
+
+/*
+/ Read the container process environment passed by the runtime
+/ through an in-memory file, if the spec in the runtime directory
+/ is protected. The variables are separated by '\0'.
+/ NOTE keep in sync with lxcri#passProcessEnv
+*/
+static char *read_process_env(size_t *len)
+{
+	long fd = getenv_long("LXCRI_PROCESS_ENV_FD", -1);
+	size_t size = 0;
+	char *buf = NULL;
+	char *tmp;
+	ssize_t n;
+
+	*len = 0;
+	if (fd < 0)
+		return NULL;
+
+	for (;;) {
+		if (*len == size) {
+			size = size == 0 ? 4096 : size * 2;
+			tmp = realloc(buf, size + 1);
+			if (tmp == NULL)
+				goto err;
+			buf = tmp;
+		}
+		n = read(fd, buf + *len, size - *len);
+		if (n < 0 && errno == EINTR)
+			continue;
+		if (n < 0)
+			goto err;
+		if (n == 0)
+			break;
+		*len += n;
+	}
+	close(fd);
+	buf[*len] = '\0';
+	return buf;
+err:
+	close(fd);
+	free(buf);
+	*len = 0;
+	return NULL;
+}
+
+/*
+/ Set the container process environment as lxc.environment.
+/ The items are only kept in memory and never written to the config file.
+*/
+static bool set_process_env(struct lxc_container *c, const char *env, size_t len)
+{
+	for (size_t i = 0; i < len; i += strlen(env + i) + 1) {
+		if (env[i] == '\0')
+			continue;
+		if (!c->set_config_item(c, "lxc.environment", env + i))
+			return false;
+	}
+	return true;
+}
+
+/*
+/ Set the OOM score adjustment of the monitor process, so the monitor
+/ is not killed by the OOM killer before the container processes.
+/ The container init process inherits the value unless lxc.proc.oom_score_adj is set.
+*/
+static void set_oom_score_adj()
+{
+	const char *val = getenv("LXCRI_MONITOR_OOM_SCORE_ADJ");
+	FILE *f;
+
+	if (val == NULL || *val == '\0')
+		return;
+
+	f = fopen("/proc/self/oom_score_adj", "we");
+	if (f == NULL) {
+		fprintf(stderr, "[lxcri-start] failed to open oom_score_adj: %s\n",
+			strerror(errno));
+		return;
+	}
+	fprintf(f, "%s\n", val);
+	if (fclose(f) != 0) {
+		fprintf(stderr, "[lxcri-start] failed to set oom_score_adj to %s: %s\n",
+			val, strerror(errno));
+	}
+}
+
+/*
+/ Set the file mode creation mask of the monitor process,
+/ e.g for the liblxc log and the console log in the runtime directory.
+*/
+static void set_umask()
+{
+	const char *val = getenv("LXCRI_MONITOR_UMASK");
+	char *end;
+	long mask;
+
+	if (val == NULL || *val == '\0')
+		return;
+
+	errno = 0;
+	mask = strtol(val, &end, 8);
+	if (errno != 0 || *end != '\0' || mask < 0 || mask > 0777) {
+		fprintf(stderr, "[lxcri-start] invalid umask %s\n", val);
+		return;
+	}
+	umask((mode_t)mask);
+}
+
+static enum restart_policy getenv_restart_policy()
+{
+	const char *val = getenv("LXCRI_RESTART_POLICY");
+	if (val == NULL)
+		return RESTART_NO;
+	if (strcmp(val, "always") == 0)
+		return RESTART_ALWAYS;
+	if (strcmp(val, "on-failure") == 0)
+		return RESTART_ON_FAILURE;
+	return RESTART_NO;
+}
+
+/*
+/ Restarts are disabled if the runtime created the NO_RESTART_FILE,
+/ or if the runtime directory (the working directory) was deleted.
+*/
+static bool restart_disabled()
+{
+	struct stat st;
+
+	if (stat(".", &st) == -1 || st.st_nlink == 0)
+		return true;
+	return access(NO_RESTART_FILE, F_OK) == 0;
+}
+
+static bool should_restart(enum restart_policy policy, int status,
+			   long restarts, long max_retries)
+{
+	if (restart_disabled())
+		return false;
+
+	switch (policy) {
+	case RESTART_ALWAYS:
+		return true;
+	case RESTART_ON_FAILURE:
+		if (max_retries > 0 && restarts >= max_retries)
+			return false;
+		return !(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+	default:
+		return false;
+	}
+}
+
+/*
+/ Sleep for the given backoff delay in small steps,
+/ so a restart can be cancelled by the runtime.
+/ Returns false if the restart was cancelled.
+*/
+static bool restart_backoff(long delay_ms)
+{
+	struct timespec step = { .tv_sec = 0, .tv_nsec = 100 * 1000 * 1000 };
+
+	for (long waited = 0; waited < delay_ms; waited += 100) {
+		if (restart_disabled())
+			return false;
+		nanosleep(&step, NULL);
+	}
+	return !restart_disabled();
+}
+
+static bool write_all(int fd, const char *buf, ssize_t len)
+{
+	while (len > 0) {
+		ssize_t n = write(fd, buf, len);
+		if (n < 0) {
+			if (errno == EINTR)
+				continue;
+			return false;
+		}
+		buf += n;
+		len -= n;
+	}
+	return true;
+}
+
+/* Returns the monotonic time in milliseconds. */
+static long long monotonic_ms()
+{
+	struct timespec ts;
+
+	clock_gettime(CLOCK_MONOTONIC, &ts);
+	return (long long)ts.tv_sec * 1000 + ts.tv_nsec / 1000000;
+}
+
+/*
+/ Forward the container stdio to a single connected client.
+/ The container stdio is not read while no client is connected,
+/ so no output is lost. The forwarder exits when the container stdio
+/ is closed (all container processes and the monitor exited)
+/ and the remaining output is drained, or no client connected
+/ within CONSOLE_DRAIN_TIMEOUT_MS to drain it.
+*/
+static void console_forward(int console, int listener)
+{
+	char buf[BUFSIZ];
+	int client = -1;
+	bool hangup = false;
+	long long drain_deadline = 0;
+
+	for (;;) {
+		struct pollfd fds[3] = {
+			{ .fd = listener, .events = POLLIN },
+			{ .fd = console, .events = client >= 0 ? POLLIN : 0 },
+			{ .fd = client, .events = POLLIN },
+		};
+		ssize_t n;
+		int pending = 0;
+		int timeout = -1;
+		int ret;
+
+		/*
+		/ Without a client only the hangup of the console is detected.
+		/ After the hangup the remaining output is drained by the next client,
+		/ but the forwarder does not wait forever for a client to connect.
+		*/
+		if (hangup && client < 0) {
+			fds[1].fd = -1;
+			timeout = drain_deadline - monotonic_ms();
+			if (timeout <= 0)
+				break;
+		}
+
+		ret = poll(fds, 3, timeout);
+		if (ret < 0) {
+			if (errno == EINTR)
+				continue;
+			break;
+		}
+		if (ret == 0)
+			continue;
+
+		if (fds[0].revents & POLLIN) {
+			int fd = accept4(listener, NULL, NULL, SOCK_CLOEXEC);
+			/* Only a single client is supported. */
+			if (fd >= 0 && client >= 0)
+				close(fd);
+			else if (fd >= 0)
+				client = fd;
+		}
+
+		if (client < 0 && (fds[1].revents & POLLHUP)) {
+			if (ioctl(console, FIONREAD, &pending) < 0 || pending == 0)
+				break;
+			if (!hangup)
+				drain_deadline = monotonic_ms() + CONSOLE_DRAIN_TIMEOUT_MS;
+			hangup = true;
+		} else if (fds[1].revents & (POLLIN | POLLHUP)) {
+			n = read(console, buf, sizeof(buf));
+			if (n == 0)
+				break;
+			if (n > 0 && !write_all(client, buf, n)) {
+				close(client);
+				client = -1;
+			}
+		}
+
+		if (client >= 0 && (fds[2].revents & (POLLIN | POLLHUP))) {
+			n = read(client, buf, sizeof(buf));
+			if (n <= 0 || !write_all(console, buf, n)) {
+				close(client);
+				client = -1;
+			}
+		}
+	}
+	if (client >= 0)
+		close(client);
+}
+
+/*
+/ Fork the console forwarder process if the runtime passed
+/ the console file descriptors (see CONSOLE_FORWARD_FD).
+*/
+static int start_console_forwarder()
+{
+	const char *val = getenv("LXCRI_CONSOLE_FORWARD");
+	pid_t pid;
+	FILE *f;
+	int fd;
+
+	if (val == NULL || strcmp(val, "1") != 0)
+		return 0;
+
+	pid = fork();
+	if (pid < 0)
+		return -1;
+
+	if (pid == 0) {
+		/* The container end of the socketpair must be closed to detect the hangup. */
+		fd = open("/dev/null", O_RDWR | O_CLOEXEC);
+		if (fd >= 0) {
+			dup2(fd, STDIN_FILENO);
+			dup2(fd, STDOUT_FILENO);
+			dup2(fd, STDERR_FILENO);
+			if (fd > STDERR_FILENO)
+				close(fd);
+		}
+		signal(SIGPIPE, SIG_IGN);
+		console_forward(CONSOLE_FORWARD_FD, CONSOLE_LISTEN_FD);
+		_exit(EXIT_SUCCESS);
+	}
+
+	close(CONSOLE_FORWARD_FD);
+	close(CONSOLE_LISTEN_FD);
+
+	f = fopen(CONSOLE_FORWARDER_PID_FILE, "we");
+	if (f == NULL)
+		return -1;
+	fprintf(f, "%d\n", pid);
+	if (fclose(f) != 0)
+		return -1;
+	return 0;
+}
+
 /* NOTE lxc_execute.c was taken as guidline and some lines where copied. */
 int main(int argc, char **argv)
 {
@@ -30,6 +440,12 @@ int main(int argc, char **argv)
 	const char *name;
 	const char *lxcpath;
 	const char *rcfile;
+	enum restart_policy policy;
+	long max_retries;
+	long backoff_ms;
+	long restarts = 0;
+	char *env = NULL;
+	size_t env_len = 0;
 
 	/* Ensure stdout and stderr are line bufferd. */
 	setvbuf(stdout, NULL, _IOLBF, -1);
@@ -48,6 +464,21 @@ int main(int argc, char **argv)
 	setsid();
 	errno = 0;
 
+	set_oom_score_adj();
+	errno = 0;
+
+	set_umask();
+
+	/* Read the environment before the console forwarder inherits the file. */
+	if (getenv("LXCRI_PROCESS_ENV_FD") != NULL) {
+		env = read_process_env(&env_len);
+		if (env == NULL)
+			ERROR("failed to read process environment: %s\n", strerror(errno));
+	}
+
+	if (start_console_forwarder() < 0)
+		ERROR("failed to start console forwarder: %s\n", strerror(errno));
+
 	name = argv[1];
 	lxcpath = argv[2];
 	rcfile = argv[3];
@@ -61,11 +492,40 @@ int main(int argc, char **argv)
 	if (!c->load_config(c, rcfile))
 		ERROR("failed to load container config %s\n", rcfile);
 
+	if (!set_process_env(c, env, env_len))
+		ERROR("failed to set process environment\n");
+	free(env);
+	env = NULL;
+
 	/* Do not daemonize - this would null the inherited stdio. */
 	c->daemonize = false;
 
-	if (!c->start(c, ENABLE_LXCINIT, NULL))
-		ERROR("monitor process pid=%d failed (container error_num:%d)\n", getpid(), c->error_num);
+	policy = getenv_restart_policy();
+	max_retries = getenv_long("LXCRI_RESTART_MAX_RETRIES", 0);
+	backoff_ms = getenv_long("LXCRI_RESTART_BACKOFF_MS", 100);
+
+	for (;;) {
+		if (!c->start(c, ENABLE_LXCINIT, NULL)) {
+			write_exit_status(c->error_num, "failed to start container");
+			ERROR("monitor process pid=%d failed (container error_num:%d)\n", getpid(), c->error_num);
+		}
+
+		write_exit_status(c->error_num, "");
+
+		if (!should_restart(policy, c->error_num, restarts, max_retries))
+			break;
+		if (!restart_backoff(backoff_ms))
+			break;
+
+		restarts++;
+		write_restart_count(restarts);
+		fprintf(stderr, "[lxcri-start] restarting container (restarts:%ld status:%d)\n",
+			restarts, c->error_num);
+
+		backoff_ms *= 2;
+		if (backoff_ms > RESTART_BACKOFF_MAX_MS)
+			backoff_ms = RESTART_BACKOFF_MAX_MS;
+	}
 
 	/* Try to die with the same signal the task did. */
 	/* FIXME error_num is zero if init was killed with SIGHUP */
@@ -75,6 +535,7 @@ int main(int argc, char **argv)
 	if (WIFEXITED(c->error_num))
 		ret = WEXITSTATUS(c->error_num);
 out:
+	free(env);
 	if (c != NULL)
 		lxc_container_put(c);
 	exit(ret);
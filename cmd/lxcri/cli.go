@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 	"text/template"
 	"time"
 
@@ -15,6 +19,7 @@ import (
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/unix"
 	"sigs.k8s.io/yaml"
 )
 
@@ -36,13 +41,16 @@ type app struct {
 }
 
 type logConfig struct {
-	file       *os.File
+	file       io.WriteCloser
 	logConsole bool
 
 	LogFile   string `json:",omitempty"`
 	LogLevel  string `json:",omitempty"`
 	Timestamp string `json:",omitempty"`
 
+	// LogBackend is the backend for runtime logs (file|journald).
+	LogBackend string `json:",omitempty"`
+
 	ContainerLogLevel string `json:",omitempty"`
 	ContainerLogFile  string `json:",omitempty"`
 }
@@ -67,6 +75,7 @@ var defaultApp = app{
 		},
 	},
 	LogConfig: logConfig{
+		LogBackend:        "file",
 		LogFile:           "/var/log/lxcri/lxcri.log",
 		LogLevel:          "info",
 		ContainerLogFile:  "/var/log/lxcri/lxcri.log",
@@ -93,12 +102,23 @@ func (app *app) configureLogger() error {
 		app.Runtime.Log = log.ConsoleLogger(true, level)
 		app.LogConfig.ContainerLogFile = "/dev/stdout"
 	} else {
-		// TODO use console logger if filepath is /dev/stdout or /dev/stderr ?
-		l, err := log.OpenFile(app.LogConfig.LogFile, 0600)
-		if err != nil {
-			return fmt.Errorf("failed to open log file: %w", err)
+		switch app.LogConfig.LogBackend {
+		case "", "file":
+			// TODO use console logger if filepath is /dev/stdout or /dev/stderr ?
+			l, err := log.OpenFile(app.LogConfig.LogFile, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open log file: %w", err)
+			}
+			app.LogConfig.file = l
+		case "journald":
+			w, err := log.NewJournalWriter("lxcri")
+			if err != nil {
+				return err
+			}
+			app.LogConfig.file = w
+		default:
+			return fmt.Errorf("unsupported log backend %q", app.LogConfig.LogBackend)
 		}
-		app.LogConfig.file = l
 		logCtx := log.NewLogger(app.LogConfig.file, level)
 
 		app.Runtime.Log = logCtx.Str("cmd", app.command).Str("cid", app.containerID).Logger()
@@ -112,7 +132,7 @@ func (app *app) loadContainer(containerID string) (*lxcri.Container, error) {
 	if err != nil {
 		return c, err
 	}
-	c.Log = app.Runtime.Log
+	c.Log = log.Sample(app.Runtime.Log, app.LogSampling)
 	err = c.SetLog(app.LogConfig.ContainerLogFile, app.LogConfig.ContainerLogLevel)
 	return c, err
 }
@@ -166,11 +186,31 @@ func main() {
 		&createCmd,
 		&startCmd,
 		&killCmd,
+		&pauseCmd,
+		&resumeCmd,
+		&updateCmd,
 		&deleteCmd,
+		&checkpointCmd,
+		&restoreCmd,
 		&execCmd,
+		&consoleCmd,
 		&inspectCmd,
+		&daemonCmd,
+		&statsCmd,
+		&eventsCmd,
+		&explainCmd,
+		&logsCmd,
 		&listCmd,
+		&shutdownCmd,
+		&generateCmd,
 		&configCmd,
+		&featuresCmd,
+		&inventoryCmd,
+		&healthCmd,
+		&seccompCmd,
+		&profileCmd,
+		&exportCmd,
+		&importCmd,
 	}
 
 	err := loadConfig()
@@ -186,6 +226,13 @@ func main() {
 			Value:       clxc.LogConfig.LogLevel,
 			Destination: &clxc.LogConfig.LogLevel,
 		},
+		&cli.StringFlag{
+			Name:        "log-backend",
+			Usage:       "set the runtime (lxcri) log backend (file|journald)",
+			EnvVars:     []string{"LXCRI_LOG_BACKEND"},
+			Value:       clxc.LogConfig.LogBackend,
+			Destination: &clxc.LogConfig.LogBackend,
+		},
 		&cli.StringFlag{
 			Name:        "log-file",
 			Usage:       "set the runtime (lxcri) log file path",
@@ -200,6 +247,21 @@ func main() {
 			Value:       clxc.LogConfig.Timestamp,
 			Destination: &clxc.LogConfig.Timestamp,
 		},
+		&cli.UintFlag{
+			Name:    "log-sampling-burst",
+			Usage:   "number of container debug/trace log entries per sampling period that are always logged",
+			EnvVars: []string{"LXCRI_LOG_SAMPLING_BURST"},
+		},
+		&cli.DurationFlag{
+			Name:    "log-sampling-period",
+			Usage:   "container debug/trace log sampling period",
+			EnvVars: []string{"LXCRI_LOG_SAMPLING_PERIOD"},
+		},
+		&cli.UintFlag{
+			Name:    "log-sampling-every",
+			Usage:   "log every n-th container debug/trace entry that exceeds the burst (0 drops the entries)",
+			EnvVars: []string{"LXCRI_LOG_SAMPLING_EVERY"},
+		},
 		&cli.StringFlag{
 			Name:        "container-log-level",
 			Usage:       "set the container (liblxc) log level (trace|debug|info|notice|warn|error|crit|alert|fatal)",
@@ -219,6 +281,20 @@ func main() {
 			Usage:       "write log output to stdout. --log-file and --container-log-file options are ignored",
 			Destination: &clxc.LogConfig.logConsole,
 		},
+		&cli.BoolFlag{
+			Name:        "rootless",
+			Usage:       "run as unprivileged user (state is stored in $XDG_RUNTIME_DIR/lxcri unless --root is set)",
+			EnvVars:     []string{"LXCRI_ROOTLESS"},
+			Value:       clxc.Rootless,
+			Destination: &clxc.Rootless,
+		},
+		&cli.BoolFlag{
+			Name:        "require-resource-limits",
+			Usage:       "fail container create in rootless mode if resource limits can not be enforced because cgroup controllers are not delegated",
+			EnvVars:     []string{"LXCRI_REQUIRE_RESOURCE_LIMITS"},
+			Value:       clxc.RequireResourceLimits,
+			Destination: &clxc.RequireResourceLimits,
+		},
 		&cli.StringFlag{
 			Name:    "root",
 			Usage:   "root directory for storage of container runtime state (tmpfs is recommended)",
@@ -227,10 +303,66 @@ func main() {
 			Value:       clxc.Root,
 			Destination: &clxc.Root,
 		},
+		&cli.StringFlag{
+			Name:        "tenant",
+			Usage:       "scope the runtime root and monitor cgroup to the given tenant",
+			EnvVars:     []string{"LXCRI_TENANT"},
+			Value:       clxc.Tenant,
+			Destination: &clxc.Tenant,
+		},
+		&cli.IntFlag{
+			Name:        "max-containers",
+			Usage:       "maximum number of containers (of the tenant), 0 is unlimited",
+			EnvVars:     []string{"LXCRI_MAX_CONTAINERS"},
+			Value:       clxc.MaxContainers,
+			Destination: &clxc.MaxContainers,
+		},
+		&cli.StringFlag{
+			Name:        "ephemeral-root",
+			Usage:       "optional tmpfs directory for ephemeral container runtime files (fifos, seccomp profile)",
+			EnvVars:     []string{"LXCRI_EPHEMERAL_ROOT"},
+			Value:       clxc.EphemeralRoot,
+			Destination: &clxc.EphemeralRoot,
+		},
 		&cli.BoolFlag{
 			Name:  "systemd-cgroup",
 			Usage: "cgroup path in container spec is systemd encoded and must be expanded",
 		},
+		&cli.StringFlag{
+			Name:        "security-sensor-command",
+			Usage:       "executable that is notified with the kernel identifiers (cgroup ID, namespace inodes, init PID) of created containers",
+			EnvVars:     []string{"LXCRI_SECURITY_SENSOR_COMMAND"},
+			Value:       clxc.SecuritySensor.Command,
+			Destination: &clxc.SecuritySensor.Command,
+		},
+		&cli.StringFlag{
+			Name:        "security-sensor-socket",
+			Usage:       "unix socket of the HTTP endpoint that is notified with the kernel identifiers of created containers",
+			EnvVars:     []string{"LXCRI_SECURITY_SENSOR_SOCKET"},
+			Value:       clxc.SecuritySensor.Socket,
+			Destination: &clxc.SecuritySensor.Socket,
+		},
+		&cli.BoolFlag{
+			Name:        "security-sensor-required",
+			Usage:       "fail container create if the security sensor notification fails",
+			EnvVars:     []string{"LXCRI_SECURITY_SENSOR_REQUIRED"},
+			Value:       clxc.SecuritySensor.Required,
+			Destination: &clxc.SecuritySensor.Required,
+		},
+		&cli.StringFlag{
+			Name:        "cgroup-manager",
+			Usage:       "cgroup manager (cgroupfs|systemd)",
+			EnvVars:     []string{"LXCRI_CGROUP_MANAGER"},
+			Value:       clxc.CgroupManager,
+			Destination: &clxc.CgroupManager,
+		},
+		&cli.StringFlag{
+			Name:        "monitor-slice",
+			Usage:       "systemd slice for the liblxc monitor scopes (systemd cgroup manager only)",
+			EnvVars:     []string{"LXCRI_MONITOR_SLICE"},
+			Value:       clxc.MonitorSlice,
+			Destination: &clxc.MonitorSlice,
+		},
 		&cli.StringFlag{
 			Name:        "monitor-cgroup",
 			Usage:       "cgroup path for liblxc monitor process",
@@ -238,6 +370,20 @@ func main() {
 			Value:       clxc.MonitorCgroup,
 			Destination: &clxc.MonitorCgroup,
 		},
+		&cli.BoolFlag{
+			Name:        "monitor-in-container-cgroup",
+			Usage:       "place the liblxc monitor process into a child cgroup of the container cgroup",
+			EnvVars:     []string{"LXCRI_MONITOR_IN_CONTAINER_CGROUP"},
+			Value:       clxc.MonitorInContainerCgroup,
+			Destination: &clxc.MonitorInContainerCgroup,
+		},
+		&cli.BoolFlag{
+			Name:        "external-cgroups",
+			Usage:       "use the existing container cgroup managed by the caller and do not delete it",
+			EnvVars:     []string{"LXCRI_EXTERNAL_CGROUPS"},
+			Value:       clxc.ExternalCgroups,
+			Destination: &clxc.ExternalCgroups,
+		},
 		&cli.StringFlag{
 			Name:        "libexec",
 			Usage:       "path to directory that contains the runtime executables",
@@ -252,6 +398,20 @@ func main() {
 			Value:       clxc.Features.Apparmor,
 			Destination: &clxc.Features.Apparmor,
 		},
+		&cli.StringFlag{
+			Name:        "apparmor-profile-dir",
+			Usage:       "directory with apparmor profiles that are loaded when used by a container",
+			EnvVars:     []string{"LXCRI_APPARMOR_PROFILE_DIR"},
+			Value:       clxc.ApparmorProfileDir,
+			Destination: &clxc.ApparmorProfileDir,
+		},
+		&cli.BoolFlag{
+			Name:        "apparmor-protect-runtime",
+			Usage:       "deny access to the runtime directories from within the container, regardless of the container apparmor profile",
+			EnvVars:     []string{"LXCRI_APPARMOR_PROTECT_RUNTIME"},
+			Value:       clxc.Features.ApparmorProtectRuntime,
+			Destination: &clxc.Features.ApparmorProtectRuntime,
+		},
 		&cli.BoolFlag{
 			Name:        "capabilities",
 			Usage:       "keep capabilities defined in container spec",
@@ -266,6 +426,27 @@ func main() {
 			Value:       clxc.Features.CgroupDevices,
 			Destination: &clxc.Features.CgroupDevices,
 		},
+		&cli.BoolFlag{
+			Name:        "keyring",
+			Usage:       "create a new session keyring for each container and mask /proc/keys",
+			EnvVars:     []string{"LXCRI_KEYRING"},
+			Value:       clxc.Features.Keyring,
+			Destination: &clxc.Features.Keyring,
+		},
+		&cli.BoolFlag{
+			Name:        "readonly-proc-sys",
+			Usage:       "mount /proc/sys read-only except for the namespaced network and IPC subtrees",
+			EnvVars:     []string{"LXCRI_READONLY_PROC_SYS"},
+			Value:       clxc.Features.ReadonlyProcSys,
+			Destination: &clxc.Features.ReadonlyProcSys,
+		},
+		&cli.BoolFlag{
+			Name:        "default-masked-paths",
+			Usage:       "mask and mount read-only the CRI-O default paths if the container spec defines none",
+			EnvVars:     []string{"LXCRI_DEFAULT_MASKED_PATHS"},
+			Value:       clxc.Features.DefaultMaskedPaths,
+			Destination: &clxc.Features.DefaultMaskedPaths,
+		},
 		&cli.BoolFlag{
 			Name:        "seccomp",
 			Usage:       "Generate and apply seccomp profile for lxc from container spec",
@@ -273,6 +454,152 @@ func main() {
 			Value:       clxc.Features.Seccomp,
 			Destination: &clxc.Features.Seccomp,
 		},
+		&cli.BoolFlag{
+			Name:        "core-dumps",
+			Usage:       "enable core dumps of container processes",
+			EnvVars:     []string{"LXCRI_CORE_DUMPS"},
+			Value:       clxc.CoreDumps,
+			Destination: &clxc.CoreDumps,
+		},
+		&cli.BoolFlag{
+			Name:        "validate-entrypoint",
+			Usage:       "check on create that the container process executable can be executed",
+			EnvVars:     []string{"LXCRI_VALIDATE_ENTRYPOINT"},
+			Value:       clxc.ValidateEntrypoint,
+			Destination: &clxc.ValidateEntrypoint,
+		},
+		&cli.IntFlag{
+			Name:    "monitor-oom-score-adj",
+			Usage:   "OOM score adjustment of the liblxc monitor process (e.g -999)",
+			EnvVars: []string{"LXCRI_MONITOR_OOM_SCORE_ADJ"},
+		},
+		&cli.StringFlag{
+			Name:        "wasm-runtime",
+			Usage:       "path to the WASM runtime executable used for WASM images (experimental)",
+			EnvVars:     []string{"LXCRI_WASM_RUNTIME"},
+			Value:       clxc.Wasm.Runtime,
+			Destination: &clxc.Wasm.Runtime,
+		},
+		&cli.StringSliceFlag{
+			Name:    "wasm-runtime-arg",
+			Usage:   "argument inserted between the WASM runtime executable and the WASM module",
+			EnvVars: []string{"LXCRI_WASM_RUNTIME_ARGS"},
+			Value:   cli.NewStringSlice(clxc.Wasm.Args...),
+		},
+		&cli.BoolFlag{
+			Name:        "trace-config",
+			Usage:       "record the liblxc config decisions on create (see command explain)",
+			EnvVars:     []string{"LXCRI_TRACE_CONFIG"},
+			Value:       clxc.TraceConfig,
+			Destination: &clxc.TraceConfig,
+		},
+		&cli.BoolFlag{
+			Name:        "kill-on-poststart-hook-error",
+			Usage:       "kill the container if a poststart hook fails",
+			EnvVars:     []string{"LXCRI_KILL_ON_POSTSTART_HOOK_ERROR"},
+			Value:       clxc.KillOnPoststartHookError,
+			Destination: &clxc.KillOnPoststartHookError,
+		},
+		&cli.BoolFlag{
+			Name:        "copy-resolv-conf",
+			Usage:       "copy a bind mounted /etc/resolv.conf into the runtime directory if the user namespace is enabled",
+			EnvVars:     []string{"LXCRI_COPY_RESOLV_CONF"},
+			Value:       clxc.CopyResolvConf,
+			Destination: &clxc.CopyResolvConf,
+		},
+		&cli.BoolFlag{
+			Name:        "hash-long-container-ids",
+			Usage:       "use the hash of container IDs longer than 64 characters as runtime directory name",
+			EnvVars:     []string{"LXCRI_HASH_LONG_CONTAINER_IDS"},
+			Value:       clxc.HashLongContainerIDs,
+			Destination: &clxc.HashLongContainerIDs,
+		},
+		&cli.StringFlag{
+			Name:        "network-rootfs",
+			Usage:       "policy for a container rootfs on a network filesystem (''|deny), the default creates the container in degraded mode",
+			EnvVars:     []string{"LXCRI_NETWORK_ROOTFS"},
+			Value:       clxc.NetworkRootfs,
+			Destination: &clxc.NetworkRootfs,
+		},
+		&cli.StringSliceFlag{
+			Name:    "default-rlimit",
+			Usage:   "resource limit of the container process if not defined in the spec (<name>=<soft>[:<hard>] e.g nofile=1048576)",
+			EnvVars: []string{"LXCRI_DEFAULT_RLIMITS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "allowed-sysctl",
+			Usage:   "sysctl that can be set by containers, a trailing '*' matches all sysctls with the prefix (default all namespaced sysctls)",
+			EnvVars: []string{"LXCRI_ALLOWED_SYSCTLS"},
+			Value:   cli.NewStringSlice(clxc.AllowedSysctls...),
+		},
+		&cli.StringSliceFlag{
+			Name:    "denied-mount-source",
+			Usage:   "host path (and paths below it) that must not be bind mounted into containers, '/' denies only the host root (an empty value disables the policy)",
+			EnvVars: []string{"LXCRI_DENIED_MOUNT_SOURCES"},
+			Value:   cli.NewStringSlice(lxcri.DefaultDeniedMountSources...),
+		},
+		&cli.StringFlag{
+			Name:    "denied-mount-action",
+			Usage:   "action for bind mounts with a denied source, one of 'reject', 'readonly' or 'log'",
+			EnvVars: []string{"LXCRI_DENIED_MOUNT_ACTION"},
+			Value:   string(lxcri.MountPolicyReject),
+		},
+		&cli.StringFlag{
+			Name:        "swap-dir",
+			Usage:       "directory for container swap files (see create --swap-size)",
+			EnvVars:     []string{"LXCRI_SWAP_DIR"},
+			Value:       clxc.SwapDir,
+			Destination: &clxc.SwapDir,
+		},
+		&cli.BoolFlag{
+			Name:        "spec-reference",
+			Usage:       "store a reference to the spec in the runtime directory instead of the spec in the container state",
+			EnvVars:     []string{"LXCRI_SPEC_REFERENCE"},
+			Value:       clxc.SpecReference,
+			Destination: &clxc.SpecReference,
+		},
+		&cli.StringFlag{
+			Name:        "state-protection",
+			Usage:       "protection of the process environment in the persisted container state (redact|encrypt)",
+			EnvVars:     []string{"LXCRI_STATE_PROTECTION"},
+			Value:       clxc.StateProtection.Mode,
+			Destination: &clxc.StateProtection.Mode,
+		},
+		&cli.StringFlag{
+			Name:        "state-protection-key-file",
+			Usage:       "path to the 32 byte AES-256 key file for state protection mode 'encrypt'",
+			EnvVars:     []string{"LXCRI_STATE_PROTECTION_KEY_FILE"},
+			Value:       clxc.StateProtection.KeyFile,
+			Destination: &clxc.StateProtection.KeyFile,
+		},
+		&cli.StringFlag{
+			Name:        "core-dump-dir",
+			Usage:       "directory where core dumps are collected (default is the container runtime directory, which is removed on delete)",
+			EnvVars:     []string{"LXCRI_CORE_DUMP_DIR"},
+			Value:       clxc.CoreDumpDir,
+			Destination: &clxc.CoreDumpDir,
+		},
+		&cli.Int64Flag{
+			Name:        "max-memory-reservation",
+			Usage:       "maximum sum of container memory reservations in bytes (0 disables the check)",
+			EnvVars:     []string{"LXCRI_MAX_MEMORY_RESERVATION"},
+			Value:       clxc.ResourceLimits.Memory,
+			Destination: &clxc.ResourceLimits.Memory,
+		},
+		&cli.Float64Flag{
+			Name:        "max-cpu-reservation",
+			Usage:       "maximum sum of container CPU reservations in CPUs (0 disables the check)",
+			EnvVars:     []string{"LXCRI_MAX_CPU_RESERVATION"},
+			Value:       clxc.ResourceLimits.CPUs,
+			Destination: &clxc.ResourceLimits.CPUs,
+		},
+		&cli.BoolFlag{
+			Name:        "reservation-warn-only",
+			Usage:       "log a warning instead of refusing create if a reservation limit is exceeded",
+			EnvVars:     []string{"LXCRI_RESERVATION_WARN_ONLY"},
+			Value:       clxc.ResourceLimits.WarnOnly,
+			Destination: &clxc.ResourceLimits.WarnOnly,
+		},
 		&cli.UintFlag{
 			Name:        "create-timeout",
 			Usage:       "maximum duration in seconds for create to complete",
@@ -319,11 +646,56 @@ func main() {
 
 	app.Before = func(ctx *cli.Context) error {
 		clxc.command = ctx.Args().Get(0)
+		if ctx.IsSet("wasm-runtime-arg") {
+			clxc.Wasm.Args = ctx.StringSlice("wasm-runtime-arg")
+		}
+		if ctx.IsSet("default-rlimit") {
+			clxc.DefaultRlimits = nil
+			for _, val := range ctx.StringSlice("default-rlimit") {
+				limit, err := lxcri.ParseRlimit(val)
+				if err != nil {
+					return err
+				}
+				clxc.DefaultRlimits = append(clxc.DefaultRlimits, limit)
+			}
+		}
+		if ctx.IsSet("allowed-sysctl") {
+			clxc.AllowedSysctls = ctx.StringSlice("allowed-sysctl")
+		}
+		if ctx.IsSet("denied-mount-source") {
+			clxc.MountPolicy.DeniedSources = ctx.StringSlice("denied-mount-source")
+		}
+		if ctx.IsSet("denied-mount-action") {
+			clxc.MountPolicy.Action = lxcri.MountPolicyAction(ctx.String("denied-mount-action"))
+		}
+		if ctx.IsSet("log-sampling-burst") {
+			clxc.LogSampling.Burst = uint32(ctx.Uint("log-sampling-burst"))
+		}
+		if ctx.IsSet("log-sampling-period") {
+			clxc.LogSampling.Period = ctx.Duration("log-sampling-period")
+		}
+		if ctx.IsSet("log-sampling-every") {
+			clxc.LogSampling.Every = uint32(ctx.Uint("log-sampling-every"))
+		}
+		if clxc.Rootless && !ctx.IsSet("root") && clxc.Root == defaultApp.Root {
+			// use $XDG_RUNTIME_DIR/lxcri (see lxcri.Runtime.Rootless)
+			clxc.Root = ""
+		}
+		if ctx.IsSet("monitor-oom-score-adj") {
+			adj := ctx.Int("monitor-oom-score-adj")
+			clxc.MonitorOOMScoreAdj = &adj
+		}
 		return nil
 	}
 
 	setupCmd := func(ctx *cli.Context) error {
-		if clxc.command == "list" || clxc.command == "config" {
+		if clxc.command == "list" || clxc.command == "config" || clxc.command == "features" || clxc.command == "seccomp" || clxc.command == "generate" || clxc.command == "inventory" || clxc.command == "health" || clxc.command == "profile" {
+			return nil
+		}
+		if clxc.command == "shutdown" || clxc.command == "daemon" {
+			if err := clxc.configureLogger(); err != nil {
+				return fmt.Errorf("failed to configure logger: %w", err)
+			}
 			return nil
 		}
 		containerID := ctx.Args().Get(0)
@@ -387,6 +759,67 @@ var createCmd = cli.Command{
 			Name:  "pid-file",
 			Usage: "path to write container PID",
 		},
+		&cli.BoolFlag{
+			Name:  "expand-env",
+			Usage: "expand ${container_id}, ${runtime_dir}, ${bundle} and ${hostname} in process environment values",
+		},
+		&cli.StringSliceFlag{
+			Name:  "volume",
+			Usage: "container path for which an anonymous volume is created",
+		},
+		&cli.StringFlag{
+			Name:  "rootfs-shift",
+			Usage: "ID shifting method for the rootfs (idmap)",
+		},
+		&cli.BoolFlag{
+			Name:  "set-shared-hostname",
+			Usage: "set the hostname and domainname on a joined UTS namespace",
+		},
+		&cli.StringSliceFlag{
+			Name:  "wait-for",
+			Usage: "condition that must be met before the container process is started (<path|device|socket>:<host path>[:<timeout>])",
+		},
+		&cli.StringSliceFlag{
+			Name:  "secret",
+			Usage: "host file exposed to the container process when it is started (<env|file>:<name>=<host path>)",
+		},
+		&cli.BoolFlag{
+			Name:  "time-sync",
+			Usage: "expose the real-time clock and allow the container to adjust the system clock (requires CAP_SYS_TIME)",
+		},
+		&cli.IntFlag{
+			Name:  "console-ttys",
+			Usage: "number of ttys allocated for the container that can be attached with the console command",
+		},
+		&cli.BoolFlag{
+			Name:  "create-runtime-hooks-post-mount",
+			Usage: "run the createRuntime hooks within the container mount namespace after the rootfs is mounted",
+		},
+		&cli.BoolFlag{
+			Name:  "create-frozen",
+			Usage: "freeze the container cgroup until the container is started",
+		},
+		&cli.BoolFlag{
+			Name:  "audit-denials",
+			Usage: "report denied operations and missing capabilities if the container fails to start",
+		},
+		&cli.StringFlag{
+			Name:  "console-mode",
+			Usage: "connect the container stdio to a pty, to a socket or to a logged serial console in the runtime dir ('' (pty)|stdio|serial)",
+		},
+		&cli.StringFlag{
+			Name:  "swap-size",
+			Usage: "size of the swap file provisioned for the container (e.g 512M or 2G)",
+		},
+		&cli.StringFlag{
+			Name:  "restart",
+			Usage: "restart policy applied when the container process exits (no|on-failure[:<max retries>]|always)",
+		},
+		&cli.DurationFlag{
+			Name:  "restart-backoff",
+			Usage: "initial delay before the container is restarted (doubled after each restart)",
+			Value: time.Millisecond * 100,
+		},
 		&cli.UintFlag{
 			Name:        "timeout",
 			Usage:       "maximum duration in seconds for create to complete",
@@ -403,14 +836,24 @@ func doCreate(ctxcli *cli.Context) error {
 	}
 
 	cfg := lxcri.ContainerConfig{
-		ContainerID:   clxc.containerID,
-		BundlePath:    ctxcli.String("bundle"),
-		ConsoleSocket: ctxcli.String("console-socket"),
-		SystemdCgroup: ctxcli.Bool("systemd-cgroup"),
-		Log:           clxc.Runtime.Log,
-		LogFile:       clxc.LogConfig.ContainerLogFile,
-		LogLevel:      clxc.LogConfig.ContainerLogLevel,
+		ContainerID:      clxc.containerID,
+		BundlePath:       ctxcli.String("bundle"),
+		ConsoleSocket:    ctxcli.String("console-socket"),
+		SystemdCgroup:    ctxcli.Bool("systemd-cgroup"),
+		ExpandEnv:        ctxcli.Bool("expand-env"),
+		SetSharedUTSName: ctxcli.Bool("set-shared-hostname"),
+		RootfsShift:      ctxcli.String("rootfs-shift"),
+		Volumes:          ctxcli.StringSlice("volume"),
+		TimeSync:         ctxcli.Bool("time-sync"),
+		ConsoleTTYs:      ctxcli.Int("console-ttys"),
+		ConsoleMode:      ctxcli.String("console-mode"),
+		Log:              log.Sample(clxc.Runtime.Log, clxc.LogSampling),
+		LogFile:          clxc.LogConfig.ContainerLogFile,
+		LogLevel:         clxc.LogConfig.ContainerLogLevel,
 	}
+	cfg.CreateRuntimeHooksPostMount = ctxcli.Bool("create-runtime-hooks-post-mount")
+	cfg.AuditDenials = ctxcli.Bool("audit-denials")
+	cfg.CreateFrozen = ctxcli.Bool("create-frozen")
 
 	specPath := filepath.Join(cfg.BundlePath, lxcri.BundleConfigFile)
 	spec, err := specki.LoadSpecJSON(specPath)
@@ -418,6 +861,39 @@ func doCreate(ctxcli *cli.Context) error {
 		return fmt.Errorf("failed to load container spec from bundle: %w", err)
 	}
 	cfg.Spec = spec
+
+	if val := ctxcli.String("swap-size"); val != "" {
+		size, err := lxcri.ParseSize(val)
+		if err != nil {
+			return fmt.Errorf("invalid --swap-size: %w", err)
+		}
+		cfg.SwapSize = size
+	}
+
+	for _, val := range ctxcli.StringSlice("wait-for") {
+		w, err := lxcri.ParseWaitCondition(val)
+		if err != nil {
+			return err
+		}
+		cfg.WaitFor = append(cfg.WaitFor, *w)
+	}
+
+	for _, val := range ctxcli.StringSlice("secret") {
+		s, err := lxcri.ParseSecret(val)
+		if err != nil {
+			return err
+		}
+		cfg.Secrets = append(cfg.Secrets, *s)
+	}
+
+	if val := ctxcli.String("restart"); val != "" {
+		cfg.RestartPolicy, err = lxcri.ParseRestartPolicy(val)
+		if err != nil {
+			return err
+		}
+		cfg.RestartPolicy.Backoff = ctxcli.Duration("restart-backoff")
+	}
+
 	pidFile := ctxcli.String("pid-file")
 
 	timeout := time.Duration(clxc.Timeouts.CreateTimeout) * time.Second
@@ -425,6 +901,10 @@ func doCreate(ctxcli *cli.Context) error {
 	defer cancel()
 
 	if err := doCreateInternal(ctx, &cfg, pidFile); err != nil {
+		if errors.Is(err, lxcri.ErrExist) {
+			// Do not delete the existing container.
+			return err
+		}
 		// Create a new context because create may fail with a timeout.
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.DeleteTimeout)*time.Second)
 		defer cancel()
@@ -568,6 +1048,180 @@ func doKill(ctxcli *cli.Context) error {
 	return clxc.Kill(ctx, c, signum)
 }
 
+var pauseCmd = cli.Command{
+	Name:      "pause",
+	Usage:     "freezes all processes of a running container",
+	ArgsUsage: "<containerID>",
+	Action:    doPause,
+}
+
+func doPause(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return clxc.Pause(ctx, c)
+}
+
+var resumeCmd = cli.Command{
+	Name:      "resume",
+	Usage:     "thaws all processes of a paused container",
+	ArgsUsage: "<containerID>",
+	Action:    doResume,
+}
+
+func doResume(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return clxc.Resume(ctx, c)
+}
+
+var updateCmd = cli.Command{
+	Name:      "update",
+	Usage:     "updates the resource limits of a container",
+	ArgsUsage: "<containerID>",
+	Action:    doUpdate,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "resources",
+			Aliases:  []string{"r"},
+			Usage:    "path to the JSON file with the linux resources (see runtime-spec linux.resources), '-' reads from stdin",
+			Required: true,
+		},
+	},
+}
+
+func doUpdate(ctxcli *cli.Context) error {
+	in := os.Stdin
+	if p := ctxcli.String("resources"); p != "-" {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	var resources specs.LinuxResources
+	if err := json.NewDecoder(in).Decode(&resources); err != nil {
+		return fmt.Errorf("failed to decode resources: %w", err)
+	}
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	return clxc.Update(context.Background(), c, &resources)
+}
+
+var checkpointCmd = cli.Command{
+	Name:   "checkpoint",
+	Usage:  "checkpoints a running container with CRIU",
+	Action: doCheckpoint,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to checkpoint
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "image-path",
+			Usage: "directory for the checkpoint images (default: 'checkpoint' in the container runtime dir)",
+		},
+		&cli.StringFlag{
+			Name:  "work-path",
+			Usage: "directory for the criu log files",
+		},
+		&cli.StringFlag{
+			Name:  "parent-path",
+			Usage: "directory of the previous pre-dump",
+		},
+		&cli.BoolFlag{
+			Name:  "leave-running",
+			Usage: "leave the container running after the checkpoint",
+		},
+		&cli.BoolFlag{
+			Name:  "pre-dump",
+			Usage: "only dump the memory pages and leave the container running",
+		},
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "enable verbose criu logging",
+		},
+	},
+}
+
+func doCheckpoint(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	opts := lxcri.CheckpointOptions{
+		ImagePath:    ctxcli.String("image-path"),
+		WorkPath:     ctxcli.String("work-path"),
+		ParentPath:   ctxcli.String("parent-path"),
+		LeaveRunning: ctxcli.Bool("leave-running"),
+		PreDump:      ctxcli.Bool("pre-dump"),
+		Verbose:      ctxcli.Bool("verbose"),
+	}
+	return clxc.Checkpoint(context.Background(), c, opts)
+}
+
+var restoreCmd = cli.Command{
+	Name:   "restore",
+	Usage:  "restores a stopped container from a CRIU checkpoint",
+	Action: doRestore,
+	ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to restore
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "image-path",
+			Usage: "directory of the checkpoint images (default: 'checkpoint' in the container runtime dir)",
+		},
+		&cli.StringFlag{
+			Name:  "work-path",
+			Usage: "directory for the criu log files",
+		},
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "enable verbose criu logging",
+		},
+	},
+}
+
+func doRestore(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	opts := lxcri.RestoreOptions{
+		ImagePath: ctxcli.String("image-path"),
+		WorkPath:  ctxcli.String("work-path"),
+		Verbose:   ctxcli.Bool("verbose"),
+	}
+	return clxc.Restore(context.Background(), c, opts)
+}
+
 var deleteCmd = cli.Command{
 	Name:   "delete",
 	Usage:  "deletes a container",
@@ -581,6 +1235,11 @@ var deleteCmd = cli.Command{
 			Name:  "force",
 			Usage: "force deletion",
 		},
+		&cli.BoolFlag{
+			Name:        "keep-volumes",
+			Usage:       "do not delete the anonymous volumes of the container",
+			Destination: &clxc.KeepVolumes,
+		},
 		&cli.UintFlag{
 			Name:        "timeout",
 			Usage:       "maximum duration in seconds for delete to complete",
@@ -605,16 +1264,125 @@ func doDelete(ctxcli *cli.Context) error {
 	return err
 }
 
-var execCmd = cli.Command{
-	Name:      "exec",
-	Usage:     "execute a new process in a running container",
-	ArgsUsage: "<containerID> [COMMAND] [args...]",
-	Action:    doExec,
+var shutdownCmd = cli.Command{
+	Name:      "shutdown",
+	Usage:     "stop all or the given containers (e.g when the node is drained)",
+	ArgsUsage: "[containerID...]",
+	Action:    doShutdown,
 	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:    "process",
-			Aliases: []string{"p"},
-			Usage:   "path to process json - cmd and args are ignored if set",
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "grace period before the container processes are killed",
+			Value: lxcri.DefaultStopTimeout,
+		},
+		&cli.BoolFlag{
+			Name:  "reverse",
+			Usage: "stop the containers one after another in reverse creation order",
+		},
+		&cli.BoolFlag{
+			Name:  "delete",
+			Usage: "delete the containers after they are stopped",
+		},
+	},
+}
+
+func doShutdown(ctxcli *cli.Context) error {
+	if err := clxc.Init(); err != nil {
+		return err
+	}
+	return clxc.Shutdown(context.Background(), lxcri.ShutdownOptions{
+		Timeout:      ctxcli.Duration("timeout"),
+		ReverseOrder: ctxcli.Bool("reverse"),
+		Delete:       ctxcli.Bool("delete"),
+		ContainerIDs: ctxcli.Args().Slice(),
+	})
+}
+
+var generateCmd = cli.Command{
+	Name:  "generate",
+	Usage: "generate configuration files for a container",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "systemd",
+			Usage:     "generate a systemd service unit that runs the container",
+			ArgsUsage: "<containerID>",
+			Action:    doGenerateSystemd,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "lxcri",
+					Usage: "path to the lxcri executable used in the unit (default is the current executable)",
+				},
+			},
+		},
+	},
+}
+
+func doGenerateSystemd(ctxcli *cli.Context) error {
+	containerID := ctxcli.Args().Get(0)
+	if containerID == "" {
+		return fmt.Errorf("missing container ID")
+	}
+	exe := ctxcli.String("lxcri")
+	if exe == "" {
+		var err error
+		exe, err = os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to detect lxcri executable: %w", err)
+		}
+	}
+	c, err := clxc.loadContainer(containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+	_, err = fmt.Fprint(os.Stdout, generateSystemdUnit(c, exe))
+	return err
+}
+
+var consoleCmd = cli.Command{
+	Name:      "console",
+	Usage:     "attach to a console tty of a running container",
+	ArgsUsage: "<containerID>",
+	Action:    doConsole,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "tty",
+			Usage: "tty number to attach to, the first unused tty is attached if -1",
+			Value: -1,
+		},
+		&cli.StringFlag{
+			Name:  "escape",
+			Usage: "escape character, the console is detached with <Ctrl+escape q>",
+			Value: "a",
+		},
+	},
+}
+
+func doConsole(ctxcli *cli.Context) error {
+	escape := []rune(ctxcli.String("escape"))
+	if len(escape) != 1 {
+		return fmt.Errorf("invalid escape character %q", ctxcli.String("escape"))
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	fmt.Fprintf(os.Stderr, "Type <Ctrl+%c q> to exit the console\n", escape[0])
+	return c.Console(ctxcli.Int("tty"), os.Stdin, os.Stdout, os.Stderr, escape[0])
+}
+
+var execCmd = cli.Command{
+	Name:      "exec",
+	Usage:     "execute a new process in a running container",
+	ArgsUsage: "<containerID> [COMMAND] [args...]",
+	Action:    doExec,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "process",
+			Aliases: []string{"p"},
+			Usage:   "path to process json - cmd and args are ignored if set",
 			Value:   "",
 		},
 		&cli.StringFlag{
@@ -627,6 +1395,15 @@ var execCmd = cli.Command{
 			Aliases: []string{"d"},
 			Usage:   "detach from the executed process",
 		},
+		&cli.BoolFlag{
+			Name:    "tty",
+			Aliases: []string{"t"},
+			Usage:   "allocate a pty for the executed process",
+		},
+		&cli.StringFlag{
+			Name:  "console-socket",
+			Usage: "send the pty master fd of the executed process to this socket path",
+		},
 		&cli.BoolFlag{
 			Name:  "cgroup",
 			Usage: "run in container cgroup namespace",
@@ -715,6 +1492,9 @@ func doExec(ctxcli *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if ctxcli.IsSet("tty") {
+		procSpec.Terminal = ctxcli.Bool("tty")
+	}
 
 	c, err := clxc.loadContainer(clxc.containerID)
 	if err != nil {
@@ -722,7 +1502,12 @@ func doExec(ctxcli *cli.Context) error {
 	}
 	defer clxc.releaseContainer(c)
 
-	opts := lxcri.ExecOptions{}
+	opts := lxcri.ExecOptions{
+		ConsoleSocket: ctxcli.String("console-socket"),
+	}
+	if detach && procSpec.Terminal && opts.ConsoleSocket == "" {
+		return fmt.Errorf("console-socket is required for a detached process with a terminal")
+	}
 
 	if ctxcli.Bool("cgroup") {
 		opts.Namespaces = append(opts.Namespaces, specs.CgroupNamespace)
@@ -755,7 +1540,7 @@ func doExec(ctxcli *cli.Context) error {
 		Str("namespaces", fmt.Sprintf("%s", opts.Namespaces)).Msg("execute cmd")
 
 	if detach {
-		pid, err := c.ExecDetached(procSpec, &opts)
+		pid, err := clxc.ExecDetached(context.Background(), c, procSpec, opts)
 		if err != nil {
 			return err
 		}
@@ -763,7 +1548,7 @@ func doExec(ctxcli *cli.Context) error {
 			return createPidFile(pidFile, pid)
 		}
 	} else {
-		status, err := c.Exec(procSpec, &opts)
+		status, err := clxc.Exec(context.Background(), c, procSpec, opts)
 		if err != nil {
 			return err
 		}
@@ -774,6 +1559,81 @@ func doExec(ctxcli *cli.Context) error {
 	return nil
 }
 
+var statsCmd = cli.Command{
+	Name:      "stats",
+	Usage:     "display the runtime statistics of a container as JSON",
+	ArgsUsage: "<containerID>",
+	Action:    doStats,
+}
+
+func doStats(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	stats, err := c.Stats()
+	if err != nil {
+		return fmt.Errorf("failed to get container stats: %w", err)
+	}
+	j, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(j))
+	return err
+}
+
+var eventsCmd = cli.Command{
+	Name:      "events",
+	Usage:     "display container events (stats and OOM) as JSON lines",
+	ArgsUsage: "<containerID>",
+	Action:    doEvents,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "stats",
+			Usage: "display the container stats only once",
+		},
+		&cli.DurationFlag{
+			Name:  "interval",
+			Usage: "the stats collection interval",
+			Value: 5 * time.Second,
+		},
+	},
+}
+
+func doEvents(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	enc := json.NewEncoder(os.Stdout)
+	if ctxcli.Bool("stats") {
+		ev, err := clxc.StatsEvent(c)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(ev)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer stop()
+
+	events, err := clxc.Events(ctx, c, ctxcli.Duration("interval"))
+	if err != nil {
+		return err
+	}
+	for ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var inspectCmd = cli.Command{
 	Name:   "inspect",
 	Usage:  "display the status of one or more containers",
@@ -808,6 +1668,122 @@ func doInspect(ctxcli *cli.Context) (err error) {
 	return nil
 }
 
+var exportCmd = cli.Command{
+	Name:   "export",
+	Usage:  "export a stopped container to a gzip compressed tar archive",
+	Action: doExport,
+	ArgsUsage: `containerID
+
+<containerID> is the ID of the container to export
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "write the archive to this file instead of stdout",
+		},
+		&cli.BoolFlag{
+			Name:  "rootfs",
+			Usage: "add the changes of the container rootfs (the overlay upper directory or the diff against --base-rootfs) to the archive",
+		},
+		&cli.StringFlag{
+			Name:  "base-rootfs",
+			Usage: "lower (image) layer the rootfs is compared with, if the rootfs is not an overlay mount",
+		},
+	},
+}
+
+func doExport(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	out := os.Stdout
+	if p := ctxcli.String("output"); p != "" {
+		out, err = os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	return clxc.Export(c, out, lxcri.ExportOptions{
+		Rootfs:     ctxcli.Bool("rootfs"),
+		BaseRootfs: ctxcli.String("base-rootfs"),
+	})
+}
+
+var importCmd = cli.Command{
+	Name:   "import",
+	Usage:  "create a container from an archive created by the export command",
+	Action: doImport,
+	ArgsUsage: `containerID
+
+<containerID> is the ID of the created container
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "bundle",
+			Usage:    "directory where the bundle is extracted to",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: "read the archive from this file instead of stdin",
+		},
+		&cli.StringFlag{
+			Name:  "rootfs",
+			Usage: "rootfs with the base layer of the exported container, the rootfs diff is applied to it",
+		},
+		&cli.StringFlag{
+			Name:  "pid-file",
+			Usage: "path to write container PID",
+		},
+	},
+}
+
+func doImport(ctxcli *cli.Context) error {
+	if err := clxc.Init(); err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if p := ctxcli.String("input"); p != "" {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	cfg, state, err := clxc.Import(in, ctxcli.String("bundle"), lxcri.ImportOptions{Rootfs: ctxcli.String("rootfs")})
+	if err != nil {
+		return fmt.Errorf("failed to import container: %w", err)
+	}
+	if state != nil {
+		clxc.Log.Info().Time("created", state.CreatedAt).Int("restarts", state.Restarts).
+			Interface("exit", state.Exit).Msg("imported state of exported container")
+	}
+	cfg.ContainerID = clxc.containerID
+	cfg.LogFile = clxc.LogConfig.ContainerLogFile
+	cfg.LogLevel = clxc.LogConfig.ContainerLogLevel
+
+	timeout := time.Duration(clxc.Timeouts.CreateTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := doCreateInternal(ctx, cfg, ctxcli.String("pid-file")); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.DeleteTimeout)*time.Second)
+		defer cancel()
+		if err := clxc.Delete(ctx, clxc.containerID, true); err != nil {
+			clxc.Log.Error().Err(err).Msg("failed to destroy container")
+		}
+		return err
+	}
+	return nil
+}
+
 var listCmd = cli.Command{
 	Name:   "list",
 	Usage:  "list available containers",
@@ -859,15 +1835,34 @@ func inspectContainer(id string, t *template.Template) error {
 	if err != nil {
 		return fmt.Errorf("failed ot get container state: %w", err)
 	}
+	stats, err := c.Stats()
+	if err != nil {
+		return fmt.Errorf("failed to get container stats: %w", err)
+	}
+	du, err := clxc.DiskUsage(c)
+	if err != nil {
+		return fmt.Errorf("failed to get container disk usage: %w", err)
+	}
+	// The cgroup is deleted when the container is stopped.
+	res, err := c.EffectiveResources()
+	if err != nil && !os.IsNotExist(err) {
+		c.Log.Warn().Msgf("failed to get effective resources: %s", err)
+	}
 
 	info := struct {
 		Spec      *specs.Spec
 		Container *lxcri.Container
 		State     *lxcri.State
+		Stats     *lxcri.Stats
+		DiskUsage *lxcri.DiskUsage
+		Resources *lxcri.EffectiveResources `json:",omitempty"`
 	}{
 		Spec:      c.Spec,
 		Container: c,
 		State:     state,
+		Stats:     stats,
+		DiskUsage: du,
+		Resources: res,
 	}
 
 	if t != nil {
@@ -886,6 +1881,114 @@ func inspectContainer(id string, t *template.Template) error {
 	return err
 }
 
+var logsCmd = cli.Command{
+	Name:   "logs",
+	Usage:  "print the liblxc log lines of a container",
+	Action: doLogs,
+	ArgsUsage: `containerID
+
+<containerID> is the ID of the container.
+`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "lxc",
+			Usage: "print the liblxc log (the container process output is not recorded by the runtime)",
+		},
+		&cli.BoolFlag{
+			Name:    "follow",
+			Aliases: []string{"f"},
+			Usage:   "wait for new log lines",
+		},
+		&cli.StringFlag{
+			Name:  "level",
+			Usage: "minimum log level (trace|debug|info|notice|warn|error|crit|alert|fatal)",
+		},
+		&cli.IntFlag{
+			Name:  "tail",
+			Usage: "number of lines to print from the end of the log (-1 for all)",
+			Value: -1,
+		},
+	},
+}
+
+func doLogs(ctxcli *cli.Context) error {
+	if !ctxcli.Bool("lxc") {
+		return fmt.Errorf("only the liblxc log is supported (--lxc)")
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	ctx, stop := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer stop()
+
+	opts := lxcri.LogOptions{
+		Level:  ctxcli.String("level"),
+		Tail:   ctxcli.Int("tail"),
+		Follow: ctxcli.Bool("follow"),
+	}
+	return c.ReadLog(ctx, opts, func(line string) {
+		fmt.Println(line)
+	})
+}
+
+var explainCmd = cli.Command{
+	Name:   "explain",
+	Usage:  "explain the liblxc config of a container created with --trace-config",
+	Action: doExplain,
+	ArgsUsage: `containerID [prefix]
+
+<containerID> is the ID of the container.
+[prefix] only shows the liblxc config items that start with prefix (e.g lxc.cgroup2).
+`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "output the config trace as JSON",
+		},
+	},
+}
+
+func doExplain(ctxcli *cli.Context) error {
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+	trace, err := c.ConfigTrace()
+	if err != nil {
+		return err
+	}
+	prefix := ctxcli.Args().Get(1)
+	decisions := trace[:0]
+	for _, d := range trace {
+		if strings.HasPrefix(d.Key, prefix) {
+			decisions = append(decisions, d)
+		}
+	}
+
+	if ctxcli.Bool("json") {
+		j, err := json.MarshalIndent(decisions, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal json: %w", err)
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(j))
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SPEC FIELD\tCONFIG ITEM\tREASON")
+	for _, d := range decisions {
+		field := d.SpecField
+		if field == "" {
+			field = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s = %s\t%s\n", field, d.Key, d.Value, d.Reason)
+	}
+	return w.Flush()
+}
+
 var configCmd = cli.Command{
 	Name:   "config",
 	Usage:  "Output a config file for lxcri. Global options modify the output.",
@@ -938,3 +2041,277 @@ func doConfig(ctxcli *cli.Context) error {
 	}
 	return nil
 }
+
+var featuresCmd = cli.Command{
+	Name:   "features",
+	Usage:  "show the OCI runtime features document",
+	Action: doFeatures,
+}
+
+func doFeatures(ctxcli *cli.Context) error {
+	if err := clxc.Init(); err != nil {
+		return err
+	}
+	j, err := json.MarshalIndent(clxc.OCIFeatures(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(j))
+	return err
+}
+
+var inventoryCmd = cli.Command{
+	Name:   "inventory",
+	Usage:  "show the host resources available to containers as JSON",
+	Action: doInventory,
+}
+
+func doInventory(ctxcli *cli.Context) error {
+	if err := clxc.Init(); err != nil {
+		return err
+	}
+	inv, err := clxc.Inventory()
+	if err != nil {
+		return err
+	}
+	j, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(j))
+	return err
+}
+
+var seccompCmd = cli.Command{
+	Name:  "seccomp",
+	Usage: "validate and compare seccomp profiles (JSON encoded LinuxSeccomp from the runtime spec)",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "lint",
+			Usage:     "validate a seccomp profile",
+			ArgsUsage: "<profile>",
+			Action:    doSeccompLint,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "syscalls",
+					Usage: "kernel syscall header used to detect unknown syscalls",
+					Value: "/usr/include/asm/unistd_64.h",
+				},
+			},
+		},
+		{
+			Name:      "diff",
+			Usage:     "compare the syscall rules of two seccomp profiles",
+			ArgsUsage: "<profile> <profile>",
+			Action:    doSeccompDiff,
+		},
+	},
+}
+
+func doSeccompLint(ctxcli *cli.Context) error {
+	if ctxcli.NArg() != 1 {
+		return fmt.Errorf("expected a single seccomp profile")
+	}
+	seccomp, err := specki.LoadSeccompJSON(ctxcli.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	var isKnown func(string) bool
+	// #nosec
+	f, err := os.Open(ctxcli.String("syscalls"))
+	if err == nil {
+		syscalls, err := specki.ReadSyscallNames(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read syscall names: %w", err)
+		}
+		isKnown = func(name string) bool { return syscalls[name] }
+	} else {
+		fmt.Fprintf(os.Stderr, "syscall names unavailable - skipping check for unknown syscalls: %s\n", err)
+	}
+
+	issues := lxcri.LintSeccompProfile(seccomp, isKnown)
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("found %d issues in seccomp profile", len(issues))
+	}
+	return nil
+}
+
+func doSeccompDiff(ctxcli *cli.Context) error {
+	if ctxcli.NArg() != 2 {
+		return fmt.Errorf("expected two seccomp profiles")
+	}
+	a, err := specki.LoadSeccompJSON(ctxcli.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	b, err := specki.LoadSeccompJSON(ctxcli.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	d := specki.DiffSeccomp(a, b)
+	if d.Empty() {
+		return nil
+	}
+	j, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(j))
+	return err
+}
+
+var profileCmd = cli.Command{
+	Name:  "profile",
+	Usage: "generate seccomp profiles from the syscalls used by a container",
+	Subcommands: []*cli.Command{
+		{
+			Name: "record",
+			Usage: `record the syscalls of a container from the audit log until interrupted and write an allow-list profile.
+   The container must run with a seccomp profile with defaultAction SCMP_ACT_LOG.
+   Records are attributed to the container by the cgroup of the process when the record is read.
+   The syscalls of processes that exited before that are missing, so the profile may be incomplete
+   and must be reviewed before it is used.`,
+			ArgsUsage: "<containerID>",
+			Action:    doProfileRecord,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "log",
+					Usage: "audit log that contains the SECCOMP records",
+					Value: "/var/log/audit/audit.log",
+				},
+				&cli.StringFlag{
+					Name:  "syscalls",
+					Usage: "kernel syscall header used to resolve syscall numbers",
+					Value: "/usr/include/asm/unistd_64.h",
+				},
+				&cli.StringFlag{
+					Name:  "arch",
+					Usage: "audit architecture (hex) of the syscall header, records of other architectures are skipped (default: native architecture)",
+				},
+				&cli.StringFlag{
+					Name:  "output",
+					Usage: "write the profile to this file instead of stdout",
+				},
+				&cli.BoolFlag{
+					Name:  "from-start",
+					Usage: "read the audit log from the start instead of following new records only",
+				},
+			},
+		},
+	},
+}
+
+func doProfileRecord(ctxcli *cli.Context) error {
+	if ctxcli.NArg() != 1 {
+		return fmt.Errorf("missing container ID")
+	}
+	clxc.containerID = ctxcli.Args().Get(0)
+	if err := clxc.configureLogger(); err != nil {
+		return fmt.Errorf("failed to configure logger: %w", err)
+	}
+
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+	if c.CgroupDir == "" {
+		return fmt.Errorf("container has no cgroup")
+	}
+
+	// #nosec
+	f, err := os.Open(ctxcli.String("syscalls"))
+	if err != nil {
+		return fmt.Errorf("failed to open syscall header: %w", err)
+	}
+	table, err := specki.ReadSyscallTable(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read syscall table: %w", err)
+	}
+
+	// #nosec
+	auditLog, err := os.Open(ctxcli.String("log"))
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer auditLog.Close()
+	if !ctxcli.Bool("from-start") {
+		if _, err := auditLog.Seek(0, io.SeekEnd); err != nil {
+			return fmt.Errorf("failed to seek audit log: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer stop()
+
+	arch := ctxcli.String("arch")
+	if arch == "" {
+		var uts unix.Utsname
+		if err := unix.Uname(&uts); err != nil {
+			return err
+		}
+		machine := unix.ByteSliceToString(uts.Machine[:])
+		var ok bool
+		if arch, ok = auditArchs[machine]; !ok {
+			return fmt.Errorf("unknown audit architecture for %q, use --arch", machine)
+		}
+	}
+
+	rec := newSyscallRecorder(c.CgroupDir, arch, table)
+	if err := followLog(ctx, auditLog, rec.record); err != nil {
+		return err
+	}
+	for n := range rec.unknown {
+		c.Log.Warn().Int("syscall", n).Msg("unknown syscall number")
+	}
+	for a, n := range rec.foreign {
+		c.Log.Warn().Str("arch", a).Int("records", n).Msg("skipped records of foreign architecture")
+	}
+	if rec.exited > 0 {
+		c.Log.Warn().Int("records", rec.exited).Msg("skipped records of exited processes, the profile may be incomplete")
+	}
+
+	var archs []specs.Arch
+	if c.Spec.Linux != nil && c.Spec.Linux.Seccomp != nil {
+		archs = c.Spec.Linux.Seccomp.Architectures
+	}
+	j, err := json.MarshalIndent(specki.SeccompAllowProfile(rec.names(), archs), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+	if out := ctxcli.String("output"); out != "" {
+		return os.WriteFile(out, append(j, '\n'), 0640)
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(j))
+	return err
+}
+
+var healthCmd = cli.Command{
+	Name:   "health",
+	Usage:  "check the runtime health and show the health report as JSON",
+	Action: doHealth,
+}
+
+func doHealth(ctxcli *cli.Context) error {
+	if err := clxc.Init(); err != nil {
+		return err
+	}
+	report := clxc.Healthy()
+	j, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+	if _, err := fmt.Fprintln(os.Stdout, string(j)); err != nil {
+		return err
+	}
+	if !report.Healthy {
+		return fmt.Errorf("runtime is unhealthy")
+	}
+	return nil
+}
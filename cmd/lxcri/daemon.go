@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/log"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/unix"
+)
+
+var daemonCmd = cli.Command{
+	Name:   "daemon",
+	Usage:  "serve the container lifecycle operations on a unix socket",
+	Action: doDaemon,
+	Description: `The daemon initializes the runtime once and serves a JSON API over HTTP:
+
+  GET    /v1/containers               list container IDs
+  POST   /v1/containers               create a container (daemonCreateRequest)
+  GET    /v1/containers/<id>          get the container state
+  POST   /v1/containers/<id>/start    start a container
+  POST   /v1/containers/<id>/kill     send a signal to a container (daemonKillRequest)
+  DELETE /v1/containers/<id>[?force] delete a container
+
+Errors are returned as {"Error": "<message>"} with a 4xx or 5xx status code.
+
+The API is plain JSON over HTTP instead of gRPC, so the runtime does not
+depend on a protobuf toolchain and the API can be used with curl, e.g
+  curl --unix-socket /run/lxcri.sock http://localhost/v1/containers
+
+The daemon has no stdio to pass to the container process, so a create request
+requires a ConsoleSocket, a terminal or the ConsoleMode "stdio" or "serial".
+Requests that modify a container are serialized per container ID.
+`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "socket",
+			Usage:   "path to the unix socket of the API",
+			EnvVars: []string{"LXCRI_DAEMON_SOCKET"},
+			Value:   "/run/lxcri.sock",
+		},
+	},
+}
+
+// daemonCreateRequest are the parameters of the create operation.
+// They match the flags of the create command.
+type daemonCreateRequest struct {
+	ID            string
+	Bundle        string
+	ConsoleSocket string `json:",omitempty"`
+	ConsoleMode   string `json:",omitempty"`
+	SystemdCgroup bool   `json:",omitempty"`
+	PidFile       string `json:",omitempty"`
+}
+
+type daemonCreateResponse struct {
+	ID  string
+	Pid int
+}
+
+type daemonKillRequest struct {
+	Signal string
+}
+
+type daemonError struct {
+	Error string
+}
+
+// errInvalidRequest is returned for requests with invalid parameters.
+var errInvalidRequest = errors.New("invalid request")
+
+func doDaemon(ctxcli *cli.Context) error {
+	if err := clxc.Init(); err != nil {
+		return err
+	}
+
+	socket := ctxcli.String("socket")
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	// The socket must not be accessible by other users,
+	// not even before its permissions could be changed.
+	oldMask := unix.Umask(0177)
+	l, err := net.Listen("unix", socket)
+	unix.Umask(oldMask)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	ctx, stop := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Handler: http.HandlerFunc(serveDaemon)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			clxc.Log.Warn().Msgf("failed to shutdown daemon: %s", err)
+		}
+	}()
+
+	clxc.Log.Info().Str("socket", socket).Msg("daemon started")
+	if err := srv.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	clxc.Log.Info().Msg("daemon stopped")
+	return nil
+}
+
+// daemonLocks serializes the requests that modify a container.
+// The runtime locks the container runtime directory itself, but the
+// create and delete operations would fail instead of waiting for each other.
+// Requests for different containers are processed concurrently,
+// the handlers only read the global clxc (runtime and CLI state).
+var daemonLocks = containerLocks{locks: make(map[string]*containerLock)}
+
+type containerLocks struct {
+	mu    sync.Mutex
+	locks map[string]*containerLock
+}
+
+type containerLock struct {
+	sync.Mutex
+	// refs is the number of requests holding or waiting for the lock.
+	refs int
+}
+
+// lock locks the given container ID and returns the unlock function.
+func (l *containerLocks) lock(id string) func() {
+	l.mu.Lock()
+	cl, ok := l.locks[id]
+	if !ok {
+		cl = &containerLock{}
+		l.locks[id] = cl
+	}
+	cl.refs++
+	l.mu.Unlock()
+
+	cl.Lock()
+	return func() {
+		cl.Unlock()
+		l.mu.Lock()
+		cl.refs--
+		if cl.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// serveDaemon dispatches the API request by path and method.
+func serveDaemon(w http.ResponseWriter, r *http.Request) {
+	id, op, ok := parseDaemonPath(r.URL.Path)
+	if !ok {
+		writeDaemonError(w, http.StatusNotFound, fmt.Errorf("invalid path %s", r.URL.Path))
+		return
+	}
+
+	var result interface{}
+	var err error
+	status := http.StatusOK
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		result, err = clxc.List()
+	case id == "" && r.Method == http.MethodPost:
+		result, err = daemonCreate(r)
+		status = http.StatusCreated
+	case op == "" && r.Method == http.MethodGet:
+		result, err = daemonState(id)
+	case op == "" && r.Method == http.MethodDelete:
+		_, force := r.URL.Query()["force"]
+		unlock := daemonLocks.lock(id)
+		err = daemonDelete(id, force)
+		unlock()
+	case op == "start" && r.Method == http.MethodPost:
+		unlock := daemonLocks.lock(id)
+		err = daemonStart(id)
+		unlock()
+	case op == "kill" && r.Method == http.MethodPost:
+		unlock := daemonLocks.lock(id)
+		err = daemonKill(id, r)
+		unlock()
+	default:
+		writeDaemonError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	if err != nil {
+		clxc.Log.Error().Err(err).Str("cid", id).Str("method", r.Method).Str("path", r.URL.Path).Msg("request failed")
+		writeDaemonError(w, daemonErrorStatus(err), err)
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		clxc.Log.Warn().Msgf("failed to write response: %s", err)
+	}
+}
+
+// parseDaemonPath splits the path /v1/containers[/<id>[/<op>]].
+func parseDaemonPath(p string) (id string, op string, ok bool) {
+	rest := strings.TrimPrefix(p, "/v1/containers")
+	if rest == p || (rest != "" && rest[0] != '/') {
+		return "", "", false
+	}
+	rest = strings.Trim(rest, "/")
+	if rest == "" {
+		return "", "", true
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) > 2 || parts[0] == "" {
+		return "", "", false
+	}
+	if len(parts) == 2 {
+		return parts[0], parts[1], parts[1] != ""
+	}
+	return parts[0], "", true
+}
+
+func daemonErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, lxcri.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, lxcri.ErrExist):
+		return http.StatusConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errInvalidRequest):
+		return http.StatusBadRequest
+	case errors.As(err, new(*json.SyntaxError)), errors.As(err, new(*json.UnmarshalTypeError)),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeDaemonError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// #nosec
+	json.NewEncoder(w).Encode(daemonError{Error: err.Error()})
+}
+
+// daemonLoad loads the container with a logger for the container ID.
+func daemonLoad(id string) (*lxcri.Container, error) {
+	c, err := clxc.Load(id)
+	if err != nil {
+		return c, err
+	}
+	c.Log = log.Sample(clxc.Runtime.Log.With().Str("cid", id).Logger(), clxc.LogSampling)
+	err = c.SetLog(clxc.LogConfig.ContainerLogFile, clxc.LogConfig.ContainerLogLevel)
+	return c, err
+}
+
+func daemonCreate(r *http.Request) (*daemonCreateResponse, error) {
+	var req daemonCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	if req.ID == "" || req.Bundle == "" {
+		return nil, fmt.Errorf("%w: container ID and bundle are required", errInvalidRequest)
+	}
+	spec, err := specki.LoadSpecJSON(filepath.Join(req.Bundle, lxcri.BundleConfigFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container spec from bundle: %w", err)
+	}
+	if err := checkDaemonStdio(&req, spec); err != nil {
+		return nil, err
+	}
+	unlock := daemonLocks.lock(req.ID)
+	defer unlock()
+
+	cfg := &lxcri.ContainerConfig{
+		ContainerID:   req.ID,
+		BundlePath:    req.Bundle,
+		ConsoleSocket: req.ConsoleSocket,
+		ConsoleMode:   req.ConsoleMode,
+		SystemdCgroup: req.SystemdCgroup,
+		Spec:          spec,
+		Log:           log.Sample(clxc.Runtime.Log.With().Str("cid", req.ID).Logger(), clxc.LogSampling),
+		LogFile:       clxc.LogConfig.ContainerLogFile,
+		LogLevel:      clxc.LogConfig.ContainerLogLevel,
+	}
+
+	timeout := time.Duration(clxc.Timeouts.CreateTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	c, err := clxc.Create(ctx, cfg)
+	if err == nil {
+		defer clxc.releaseContainer(c)
+		if req.PidFile != "" {
+			err = createPidFile(req.PidFile, c.Pid)
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, lxcri.ErrExist) {
+			daemonCleanup(req.ID)
+		}
+		return nil, err
+	}
+	return &daemonCreateResponse{ID: c.ContainerID, Pid: c.Pid}, nil
+}
+
+// checkDaemonStdio rejects create requests where the container process
+// would inherit the stdio of the daemon process.
+func checkDaemonStdio(req *daemonCreateRequest, spec *specs.Spec) error {
+	if req.ConsoleSocket != "" || req.ConsoleMode == lxcri.ConsoleStdio || req.ConsoleMode == lxcri.ConsoleSerial {
+		return nil
+	}
+	if spec.Process != nil && spec.Process.Terminal {
+		return nil
+	}
+	return fmt.Errorf("%w: a console socket, a terminal or the console mode %q or %q is required",
+		errInvalidRequest, lxcri.ConsoleStdio, lxcri.ConsoleSerial)
+}
+
+func daemonStart(id string) error {
+	c, err := daemonLoad(id)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	timeout := time.Duration(clxc.Timeouts.StartTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := clxc.Start(ctx, c); err != nil {
+		daemonCleanup(id)
+		return err
+	}
+	return nil
+}
+
+func daemonState(id string) (*lxcri.State, error) {
+	c, err := daemonLoad(id)
+	if err != nil {
+		return nil, err
+	}
+	defer clxc.releaseContainer(c)
+	return c.State()
+}
+
+func daemonKill(id string, r *http.Request) error {
+	var req daemonKillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	signum := parseSignal(req.Signal)
+	if signum == 0 {
+		return fmt.Errorf("invalid signal %q", req.Signal)
+	}
+	c, err := daemonLoad(id)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return clxc.Kill(ctx, c, signum)
+}
+
+func daemonDelete(id string, force bool) error {
+	timeout := time.Duration(clxc.Timeouts.DeleteTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return clxc.Delete(ctx, id, force)
+}
+
+// daemonCleanup deletes a container that failed to create or start,
+// like the create and start commands do.
+func daemonCleanup(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.DeleteTimeout)*time.Second)
+	defer cancel()
+	if err := clxc.Delete(ctx, id, true); err != nil && !errors.Is(err, lxcri.ErrNotExist) {
+		clxc.Log.Error().Err(err).Str("cid", id).Msg("failed to destroy container")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDaemonPath(t *testing.T) {
+	tests := []struct {
+		path string
+		id   string
+		op   string
+		ok   bool
+	}{
+		{"/v1/containers", "", "", true},
+		{"/v1/containers/", "", "", true},
+		{"/v1/containers/c1", "c1", "", true},
+		{"/v1/containers/c1/start", "c1", "start", true},
+		{"/v1/containers/c1/start/now", "", "", false},
+		{"/v1/containers//start", "", "", false},
+		{"/v1/images", "", "", false},
+		{"/v1/containersX", "", "", false},
+		{"/v1/containersX/start", "", "", false},
+		{"/", "", "", false},
+	}
+	for _, tc := range tests {
+		id, op, ok := parseDaemonPath(tc.path)
+		require.Equal(t, tc.ok, ok, tc.path)
+		require.Equal(t, tc.id, id, tc.path)
+		require.Equal(t, tc.op, op, tc.path)
+	}
+}
+
+func TestDaemonErrorStatus(t *testing.T) {
+	require.Equal(t, http.StatusNotFound, daemonErrorStatus(lxcri.ErrNotExist))
+	require.Equal(t, http.StatusConflict, daemonErrorStatus(fmt.Errorf("create: %w", lxcri.ErrExist)))
+	require.Equal(t, http.StatusGatewayTimeout, daemonErrorStatus(context.DeadlineExceeded))
+
+	var v daemonKillRequest
+	err := json.Unmarshal([]byte("{"), &v)
+	require.Equal(t, http.StatusBadRequest, daemonErrorStatus(err))
+	err = json.NewDecoder(strings.NewReader("")).Decode(&v)
+	require.Equal(t, http.StatusBadRequest, daemonErrorStatus(err))
+
+	require.Equal(t, http.StatusBadRequest, daemonErrorStatus(fmt.Errorf("%w: no ID", errInvalidRequest)))
+	require.Equal(t, http.StatusInternalServerError, daemonErrorStatus(fmt.Errorf("failed")))
+}
+
+func TestCheckDaemonStdio(t *testing.T) {
+	spec := &specs.Spec{Process: &specs.Process{}}
+	err := checkDaemonStdio(&daemonCreateRequest{}, spec)
+	require.ErrorIs(t, err, errInvalidRequest)
+
+	require.NoError(t, checkDaemonStdio(&daemonCreateRequest{ConsoleSocket: "/run/console.sock"}, spec))
+	require.NoError(t, checkDaemonStdio(&daemonCreateRequest{ConsoleMode: lxcri.ConsoleStdio}, spec))
+	require.NoError(t, checkDaemonStdio(&daemonCreateRequest{ConsoleMode: lxcri.ConsoleSerial}, spec))
+
+	spec.Process.Terminal = true
+	require.NoError(t, checkDaemonStdio(&daemonCreateRequest{}, spec))
+}
+
+func TestContainerLocks(t *testing.T) {
+	l := containerLocks{locks: make(map[string]*containerLock)}
+	unlock := l.lock("c1")
+
+	// other containers are not blocked
+	l.lock("c2")()
+
+	locked := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		unlock := l.lock("c1")
+		close(locked)
+		unlock()
+		close(done)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("container lock was acquired twice")
+	case <-time.After(time.Millisecond * 50):
+	}
+	unlock()
+	<-locked
+	<-done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	require.Empty(t, l.locks)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+)
+
+// auditArchs maps the machine name (see `uname -m`) to the
+// audit architecture (AUDIT_ARCH_*) as shown in the SECCOMP audit records.
+var auditArchs = map[string]string{
+	"x86_64":  "c000003e",
+	"aarch64": "c00000b7",
+	"ppc64le": "c0000015",
+	"s390x":   "80000016",
+	"riscv64": "c00000f3",
+}
+
+// syscallRecorder collects the syscalls from SECCOMP audit records
+// of processes that are members of the container cgroup.
+type syscallRecorder struct {
+	// cgroup is the container cgroup path as shown in /proc/[pid]/cgroup
+	cgroup  string
+	procDir string
+	// arch is the audit architecture of the syscall table.
+	// Records of other architectures (e.g compat syscalls) are skipped,
+	// because their syscall numbers can not be resolved with the table.
+	arch string
+	// table maps the syscall numbers to names
+	table    map[int]string
+	syscalls map[string]bool
+	unknown  map[int]bool
+	// foreign counts the skipped records by architecture
+	foreign map[string]int
+	// exited counts the records of processes that exited
+	// before the record was read.
+	exited int
+}
+
+func newSyscallRecorder(cgroup string, arch string, table map[int]string) *syscallRecorder {
+	return &syscallRecorder{
+		cgroup:   filepath.Join("/", cgroup),
+		procDir:  "/proc",
+		arch:     arch,
+		table:    table,
+		syscalls: make(map[string]bool),
+		unknown:  make(map[int]bool),
+		foreign:  make(map[string]int),
+	}
+}
+
+// record adds the syscall from the given audit log line,
+// if the line is a SECCOMP record for a process of the container.
+func (r *syscallRecorder) record(line string) {
+	rec, ok := specki.ParseSeccompAuditRecord(line)
+	if !ok || !r.isMember(rec.Pid) {
+		return
+	}
+	if rec.Arch != r.arch {
+		r.foreign[rec.Arch]++
+		return
+	}
+	name, ok := r.table[rec.Syscall]
+	if !ok {
+		r.unknown[rec.Syscall] = true
+		return
+	}
+	r.syscalls[name] = true
+}
+
+// isMember returns true if the process pid is a member of the container cgroup.
+// The membership can only be checked for processes that are still running.
+// The records of processes that exited before the record was read
+// can not be attributed to the container and are counted in r.exited.
+func (r *syscallRecorder) isMember(pid int) bool {
+	data, err := os.ReadFile(filepath.Join(r.procDir, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			r.exited++
+		}
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		p := strings.TrimPrefix(line, "0::")
+		if p == line {
+			continue
+		}
+		if p == r.cgroup || strings.HasPrefix(p, r.cgroup+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// names returns the sorted names of the recorded syscalls.
+func (r *syscallRecorder) names() []string {
+	names := make([]string, 0, len(r.syscalls))
+	for name := range r.syscalls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// followLog calls fn for every line read from r until the context is done.
+// Like `tail -f` it waits for new lines at the end of the file.
+func followLog(ctx context.Context, r io.Reader, fn func(line string)) error {
+	reader := bufio.NewReader(r)
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			partial += line
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(200 * time.Millisecond):
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+		fn(partial + line)
+		partial = ""
+	}
+}
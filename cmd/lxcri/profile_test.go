@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyscallRecorder(t *testing.T) {
+	procDir := t.TempDir()
+	for pid, cgroup := range map[string]string{"10": "0::/lxcri/c1\n", "11": "0::/lxcri/c1/init\n", "12": "0::/lxcri/c10\n"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(procDir, pid), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, pid, "cgroup"), []byte(cgroup), 0644))
+	}
+
+	rec := newSyscallRecorder("lxcri/c1", "c000003e", map[int]string{0: "read", 1: "write", 59: "execve"})
+	rec.procDir = procDir
+	rec.record(`type=SECCOMP msg=audit(1618231234.123:42): pid=10 comm="sh" arch=c000003e syscall=59 compat=0`)
+	rec.record(`type=SECCOMP msg=audit(1618231234.123:43): pid=11 comm="sh" arch=c000003e syscall=0 compat=0`)
+	rec.record(`type=SECCOMP msg=audit(1618231234.123:44): pid=11 comm="sh" arch=c000003e syscall=999 compat=0`)
+	// not a member of the container cgroup
+	rec.record(`type=SECCOMP msg=audit(1618231234.123:45): pid=12 comm="sh" arch=c000003e syscall=1 compat=0`)
+	// process does not exist
+	rec.record(`type=SECCOMP msg=audit(1618231234.123:46): pid=13 comm="sh" arch=c000003e syscall=1 compat=0`)
+	// compat syscall (i386 write) is not resolved with the native table
+	rec.record(`type=SECCOMP msg=audit(1618231234.123:47): pid=10 comm="sh" arch=40000003 syscall=4 compat=1`)
+
+	require.Equal(t, []string{"execve", "read"}, rec.names())
+	require.Equal(t, map[int]bool{999: true}, rec.unknown)
+	require.Equal(t, map[string]int{"40000003": 1}, rec.foreign)
+	require.Equal(t, 1, rec.exited)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// systemdEscapePath escapes the given path like `systemd-escape --path`.
+func systemdEscapePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return "-"
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		ch := p[i]
+		switch {
+		case ch == '/':
+			b.WriteByte('-')
+		case ch == '.' && i == 0:
+			fmt.Fprintf(&b, "\\x%02x", ch)
+		case ch == '_' || ch == '.' || ch == ':' ||
+			(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9'):
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "\\x%02x", ch)
+		}
+	}
+	return b.String()
+}
+
+// systemdDeviceUnits returns the device units for the devices
+// passed through to the container. The essential devices are omitted.
+func systemdDeviceUnits(spec *specs.Spec) []string {
+	essential := make(map[string]bool)
+	for _, dev := range specki.EssentialDevices {
+		essential[dev.Path] = true
+	}
+	var units []string
+	if spec.Linux == nil {
+		return units
+	}
+	for _, dev := range spec.Linux.Devices {
+		if essential[dev.Path] || (dev.Type != "b" && dev.Type != "c") {
+			continue
+		}
+		units = append(units, systemdEscapePath(dev.Path)+".device")
+	}
+	return units
+}
+
+// systemdQuote quotes the given command line argument for systemd.
+// Specifiers (%) and variables ($) are escaped, and the argument is
+// enclosed in double quotes if it contains whitespace or special characters.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return r <= ' ' || r == 0x7f || strings.ContainsRune("\"'\\;", r)
+	}) < 0 {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		ch := arg[i]
+		switch {
+		case ch == '"' || ch == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch < ' ' || ch == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// generateSystemdUnit returns a systemd service unit that creates and starts the
+// container from its bundle, and stops and deletes the container with the lxcri cli.
+// The monitor process is the main process of the service, so systemd tracks
+// the lifetime of the container.
+func generateSystemdUnit(c *lxcri.Container, exe string) string {
+	id := systemdQuote(c.ContainerID)
+	exe = systemdQuote(exe)
+	stopTimeout := int(lxcri.DefaultStopTimeout.Seconds())
+	if val, ok := c.Spec.Annotations[lxcri.StopTimeoutAnnotation]; ok {
+		if n, err := strconv.Atoi(val); err == nil {
+			stopTimeout = n
+		}
+	}
+	devices := strings.Join(systemdDeviceUnits(c.Spec), " ")
+	// The monitor PID is written by `lxcri create --pid-file`.
+	// The container ID is valid within a path (see Runtime.checkContainerID).
+	pidFile := "%t/lxcri-" + c.ContainerID + ".pid"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by `lxcri generate systemd %s`\n", c.ContainerID)
+	fmt.Fprintf(&b, "# Runtime specific create options (e.g volumes and secrets) are not preserved.\n")
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=lxcri container %s\n", c.ContainerID)
+	fmt.Fprintf(&b, "Wants=network-online.target\n")
+	fmt.Fprintf(&b, "After=network-online.target\n")
+	if devices != "" {
+		fmt.Fprintf(&b, "BindsTo=%s\n", devices)
+		fmt.Fprintf(&b, "After=%s\n", devices)
+	}
+	fmt.Fprintf(&b, "\n[Service]\n")
+	fmt.Fprintf(&b, "Type=forking\n")
+	fmt.Fprintf(&b, "PIDFile=%s\n", pidFile)
+	fmt.Fprintf(&b, "ExecStartPre=-%s delete --force %s\n", exe, id)
+	fmt.Fprintf(&b, "ExecStart=%s create --bundle %s --pid-file %s %s\n", exe, systemdQuote(c.BundlePath), pidFile, id)
+	fmt.Fprintf(&b, "ExecStartPost=%s start %s\n", exe, id)
+	// The stop signal and grace period annotations are applied by `lxcri shutdown`.
+	fmt.Fprintf(&b, "ExecStop=%s shutdown --delete --timeout %ds %s\n", exe, stopTimeout, id)
+	// Allow some time to kill the container processes after the grace period.
+	fmt.Fprintf(&b, "TimeoutStopSec=%d\n", stopTimeout+10)
+	fmt.Fprintf(&b, "\n[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=multi-user.target\n")
+	return b.String()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdEscapePath(t *testing.T) {
+	require.Equal(t, "dev-sda1", systemdEscapePath("/dev/sda1"))
+	require.Equal(t, "dev-disk-by\\x2dlabel-data", systemdEscapePath("/dev/disk/by-label/data"))
+	require.Equal(t, "-", systemdEscapePath("/"))
+}
+
+func TestGenerateSystemdUnit(t *testing.T) {
+	spec := specki.NewSpec("/rootfs", "/bin/sh")
+	spec.Linux.Devices = append(spec.Linux.Devices, specs.LinuxDevice{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 229})
+	spec.Annotations = map[string]string{lxcri.StopSignalAnnotation: "SIGQUIT"}
+	c := &lxcri.Container{ContainerConfig: &lxcri.ContainerConfig{
+		ContainerID: "web",
+		BundlePath:  "/srv/web",
+		Spec:        spec,
+	}}
+	unit := generateSystemdUnit(c, "/usr/bin/lxcri")
+	require.Contains(t, unit, "BindsTo=dev-fuse.device\n")
+	require.Contains(t, unit, "Type=forking\n")
+	require.Contains(t, unit, "PIDFile=%t/lxcri-web.pid\n")
+	require.Contains(t, unit, "ExecStart=/usr/bin/lxcri create --bundle /srv/web --pid-file %t/lxcri-web.pid web\n")
+	require.Contains(t, unit, "ExecStop=/usr/bin/lxcri shutdown --delete --timeout 10s web\n")
+	require.NotContains(t, unit, "RemainAfterExit")
+
+	c.BundlePath = "/srv/my web/100%"
+	unit = generateSystemdUnit(c, "/usr/bin/lxcri")
+	require.Contains(t, unit, `--bundle "/srv/my web/100%%" `)
+}
+
+func TestSystemdQuote(t *testing.T) {
+	require.Equal(t, "/srv/web", systemdQuote("/srv/web"))
+	require.Equal(t, `"/srv/my web"`, systemdQuote("/srv/my web"))
+	require.Equal(t, `"a\"b\\c"`, systemdQuote(`a"b\c`))
+	require.Equal(t, "$$HOME%%n", systemdQuote("$HOME%n"))
+	require.Equal(t, `"\x01"`, systemdQuote("\x01"))
+	require.Equal(t, `""`, systemdQuote(""))
+}
@@ -4,27 +4,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 
+	"github.com/lxc/lxcri"
 	"golang.org/x/sys/unix"
 )
 
+// parseSignal parses the signal argument (see lxcri.ParseSignal).
+// SIGTERM is returned if sig is empty.
 func parseSignal(sig string) unix.Signal {
 	if sig == "" {
 		return unix.SIGTERM
 	}
-	// handle numerical signal value
-	if num, err := strconv.Atoi(sig); err == nil {
-		return unix.Signal(num)
-	}
-
-	// gracefully handle all string variants e.g 'sigkill|SIGKILL|kill|KILL'
-	s := strings.ToUpper(sig)
-	if !strings.HasPrefix(s, "SIG") {
-		s = "SIG" + s
-	}
-	return unix.SignalNum(s)
+	return lxcri.ParseSignal(sig)
 }
 
 // createPidFile atomically creates a pid file for the given pid at the given path
@@ -0,0 +1,251 @@
+package lxcri
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// ConsoleTTYsAnnotation overrides ContainerConfig.ConsoleTTYs.
+const ConsoleTTYsAnnotation = "org.linuxcontainers.lxcri.ConsoleTTYs"
+
+// ptsMajor is the device major number of the pseudo terminal devices (/dev/pts/*).
+const ptsMajor = 136
+
+func (c *Container) consoleTTYs() (int, error) {
+	if val, ok := c.Spec.Annotations[ConsoleTTYsAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid annotation %s: %q", ConsoleTTYsAnnotation, val)
+		}
+		return n, nil
+	}
+	return c.ConsoleTTYs, nil
+}
+
+// configureConsoleTTYs allocates the ttys (/dev/tty1 ... /dev/ttyN) that can be
+// attached with Container.Console. The ttys are pseudo terminals allocated
+// by the monitor, so access to the pts devices must be allowed.
+// This must be called before configureCgroup.
+func configureConsoleTTYs(c *Container) error {
+	n, err := c.consoleTTYs()
+	if err != nil || n == 0 {
+		return err
+	}
+	if err := c.setConfigItem("lxc.tty.max", strconv.Itoa(n)); err != nil {
+		return err
+	}
+	allowPtsDevices(c)
+	return nil
+}
+
+// allowPtsDevices allows access to the pseudo terminals allocated by the monitor.
+func allowPtsDevices(c *Container) {
+	if c.Spec.Linux.Resources == nil {
+		c.Spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	pts := specs.LinuxDevice{Type: "c", Major: ptsMajor, Minor: 0}
+	if !isDeviceAllowed(c.Spec.Linux.Resources.Devices, pts) {
+		major := int64(ptsMajor)
+		c.Spec.Linux.Resources.Devices = append(c.Spec.Linux.Resources.Devices,
+			specs.LinuxDeviceCgroup{Allow: true, Type: "c", Major: &major, Access: "rwm"},
+		)
+	}
+}
+
+// Console attaches the given terminal files to a tty of the running container
+// (see ContainerConfig.ConsoleTTYs). If tty is -1 the first unused tty is attached.
+// The console is detached with the key sequence <Ctrl+escape q>.
+// Unlike Runtime.Exec the console reaches the tty device (e.g a getty of a system container),
+// even if no process can be executed within the container.
+func (c *Container) Console(tty int, stdin *os.File, stdout *os.File, stderr *os.File, escape rune) error {
+	if n := c.getConfigItem("lxc.tty.max"); n == "" || n == "0" {
+		return fmt.Errorf("no console ttys configured for container %s", c.ContainerID)
+	}
+	if !c.LinuxContainer.Running() {
+		return fmt.Errorf("container %s is not running", c.ContainerID)
+	}
+	opts := lxc.ConsoleOptions{
+		Tty:             tty,
+		StdinFd:         stdin.Fd(),
+		StdoutFd:        stdout.Fd(),
+		StderrFd:        stderr.Fd(),
+		EscapeCharacter: escape,
+	}
+	if err := c.LinuxContainer.Console(opts); err != nil {
+		return errorf("failed to attach console: %w", err)
+	}
+	return nil
+}
+
+// Console modes for the stdio of the container process (see ContainerConfig.ConsoleMode).
+const (
+	// ConsolePTY connects the container process to a pty if Spec.Process.Terminal is true,
+	// otherwise the container process inherits the stdio of the runtime.
+	ConsolePTY = ""
+	// ConsoleStdio connects the stdio of the container process to a socketpair.
+	// The runtime end of the socketpair is forwarded by the monitor process
+	// to a client connected to ConsoleStdioSocket in the container runtime directory.
+	// Unlike a pty the output is not subject to line discipline (e.g CRLF conversion)
+	// and large writes are not truncated.
+	// The container process blocks on write if no client is connected
+	// and the socket buffer is full.
+	ConsoleStdio = "stdio"
+	// ConsoleSerial connects /dev/console and the stdio of the container process
+	// to a pty allocated by the monitor process, like the serial console of a VM.
+	// The console output (e.g the early boot output of a systemd payload)
+	// is recorded to ConsoleLogFile in the container runtime directory.
+	ConsoleSerial = "serial"
+)
+
+// ConsoleLogFile is the console log (relative to the container runtime directory)
+// in ConsoleSerial mode. It is rotated when it exceeds consoleLogSize.
+const ConsoleLogFile = "console.log"
+
+const consoleLogSize = "1MB"
+
+// ConsoleStdioSocket is the unix socket (relative to the container runtime directory)
+// that forwards the stdio of the container process in ConsoleStdio mode.
+const ConsoleStdioSocket = "console.sock"
+
+// consoleForwarderPidFile contains the PID of the console forwarder process
+// forked by the monitor process in ConsoleStdio mode.
+// NOTE keep in sync with cmd/lxcri-start CONSOLE_FORWARDER_PID_FILE
+const consoleForwarderPidFile = "console.pid"
+
+// checkConsoleMode validates the console mode.
+func checkConsoleMode(c *Container) error {
+	switch c.ConsoleMode {
+	case ConsolePTY:
+		return nil
+	case ConsoleStdio, ConsoleSerial:
+		if c.ConsoleSocket != "" {
+			return fmt.Errorf("console mode %q can not be used with a console socket", c.ConsoleMode)
+		}
+		if c.Spec.Process.Terminal && c.ConsoleMode == ConsoleStdio {
+			c.Log.Warn().Msg("terminal is ignored in console mode stdio")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported console mode %q", c.ConsoleMode)
+}
+
+// configureSerialConsole records the output of the container console
+// (allocated by liblxc and mounted to /dev/console) to ConsoleLogFile.
+// This must be called before configureCgroup.
+func configureSerialConsole(c *Container) error {
+	if c.ConsoleMode != ConsoleSerial {
+		return nil
+	}
+	if err := c.setConfigItem("lxc.console.logfile", c.RuntimePath(ConsoleLogFile)); err != nil {
+		return err
+	}
+	if err := c.setConfigItem("lxc.console.size", consoleLogSize); err != nil {
+		return err
+	}
+	if err := c.setConfigItem("lxc.console.rotate", "1"); err != nil {
+		return err
+	}
+	allowPtsDevices(c)
+	return nil
+}
+
+// setupConsoleStdio connects the stdio of the monitor process, which is inherited
+// by the container process, to a socketpair. The runtime end of the socketpair
+// and the listening socket ConsoleStdioSocket are passed to the monitor process
+// (as file descriptors 3 and 4), which forwards the stdio to connected clients.
+// The returned files must be closed after the monitor process is started.
+func (rt *Runtime) setupConsoleStdio(c *Container, cmd *exec.Cmd) ([]*os.File, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socketpair: %w", err)
+	}
+	stdio := os.NewFile(uintptr(fds[0]), "console-stdio")
+	forward := os.NewFile(uintptr(fds[1]), "console-forward")
+
+	p := c.RuntimePath(ConsoleStdioSocket)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: p, Net: "unix"})
+	if err != nil {
+		stdio.Close()
+		forward.Close()
+		return nil, fmt.Errorf("failed to listen on console socket: %w", err)
+	}
+	l.SetUnlinkOnClose(false)
+	// The listener file descriptor is a duplicate.
+	listener, err := l.File()
+	l.Close()
+	if err == nil {
+		err = os.Chmod(p, rt.FileModes.PrivateFileMode)
+	}
+	if err == nil {
+		err = rt.chgrp(p)
+	}
+	files := []*os.File{stdio, forward, listener}
+	if err != nil {
+		closeFiles(files)
+		return nil, fmt.Errorf("failed to setup console socket: %w", err)
+	}
+
+	cmd.Stdin = stdio
+	cmd.Stdout = stdio
+	cmd.Stderr = stdio
+	cmd.ExtraFiles = []*os.File{forward, listener}
+	cmd.Env = append(cmd.Env, "LXCRI_CONSOLE_FORWARD=1")
+	return files, nil
+}
+
+// killConsoleForwarder kills the console forwarder process.
+// The forwarder exits when the container output is drained, or no client connected
+// within the drain timeout, but it must not outlive the deleted container.
+func (c *Container) killConsoleForwarder() error {
+	// #nosec
+	data, err := os.ReadFile(c.RuntimePath(consoleForwarderPidFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid < 2 {
+		return fmt.Errorf("invalid console forwarder PID %q", data)
+	}
+	// The forwarder may have exited and the PID may have been reused.
+	// The working directory of the forwarder is the runtime directory.
+	cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	if os.IsNotExist(err) || errors.Is(err, unix.ESRCH) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(c.runtimeDir)
+	if err != nil {
+		return err
+	}
+	if cwd != dir {
+		return nil
+	}
+	c.Log.Debug().Int("pid", pid).Msg("kill console forwarder")
+	if err := unix.Kill(pid, unix.SIGKILL); err != nil && err != unix.ESRCH {
+		return err
+	}
+	return nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package lxcri
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestConsoleTTYs(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec:        &specs.Spec{Annotations: map[string]string{}},
+		ConsoleTTYs: 2,
+	}}
+	n, err := c.consoleTTYs()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	c.Spec.Annotations[ConsoleTTYsAnnotation] = "4"
+	n, err = c.consoleTTYs()
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	c.Spec.Annotations[ConsoleTTYsAnnotation] = "-1"
+	_, err = c.consoleTTYs()
+	require.Error(t, err)
+}
+
+func TestCheckConsoleMode(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{Process: &specs.Process{}},
+		Log:  zerolog.Nop(),
+	}}
+	require.NoError(t, checkConsoleMode(c))
+
+	c.ConsoleMode = ConsoleStdio
+	require.NoError(t, checkConsoleMode(c))
+
+	c.ConsoleMode = ConsoleSerial
+	c.Spec.Process.Terminal = true
+	require.NoError(t, checkConsoleMode(c))
+
+	c.ConsoleSocket = "/run/console.sock"
+	require.Error(t, checkConsoleMode(c))
+	c.ConsoleMode = ConsoleStdio
+	require.Error(t, checkConsoleMode(c))
+
+	c.ConsoleMode = "other"
+	require.Error(t, checkConsoleMode(c))
+}
+
+func TestSetupConsoleStdio(t *testing.T) {
+	rt := &Runtime{}
+	rt.FileModes.PrivateFileMode = 0600
+	c := &Container{ContainerConfig: &ContainerConfig{Log: zerolog.Nop()}, runtimeDir: t.TempDir()}
+	cmd := exec.Command("true")
+
+	files, err := rt.setupConsoleStdio(c, cmd)
+	require.NoError(t, err)
+	defer closeFiles(files)
+
+	require.Len(t, cmd.ExtraFiles, 2)
+	require.Contains(t, cmd.Env, "LXCRI_CONSOLE_FORWARD=1")
+
+	// the container stdio is connected to the forwarded end of the socketpair
+	_, err = files[0].Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(cmd.ExtraFiles[0], buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+
+	info, err := os.Stat(c.RuntimePath(ConsoleStdioSocket))
+	require.NoError(t, err)
+	require.Equal(t, os.ModeSocket, info.Mode()&os.ModeSocket)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestKillConsoleForwarder(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{Log: zerolog.Nop()}, runtimeDir: t.TempDir()}
+	// no forwarder was started
+	require.NoError(t, c.killConsoleForwarder())
+
+	cmd := exec.Command("sleep", "10")
+	cmd.Dir = c.runtimeDir
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+	pidFile := c.RuntimePath(consoleForwarderPidFile)
+	require.NoError(t, os.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0600))
+
+	// a process with a different working directory is not killed
+	other := &Container{ContainerConfig: &ContainerConfig{Log: zerolog.Nop()}, runtimeDir: t.TempDir()}
+	require.NoError(t, os.WriteFile(other.RuntimePath(consoleForwarderPidFile), []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0600))
+	require.NoError(t, other.killConsoleForwarder())
+	require.NoError(t, unix.Kill(cmd.Process.Pid, 0))
+
+	require.NoError(t, c.killConsoleForwarder())
+	require.EqualError(t, cmd.Wait(), "signal: killed")
+}
@@ -2,12 +2,19 @@ package lxcri
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lxc/lxcri/internal/cpuaffinity"
+	"github.com/lxc/lxcri/internal/handshake"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/rs/zerolog"
@@ -15,6 +22,15 @@ import (
 	"gopkg.in/lxc/go-lxc.v2"
 )
 
+// Rootfs ID shifting methods (see ContainerConfig.RootfsShift).
+const (
+	// RootfsShiftNone disables ID shifting.
+	RootfsShiftNone = ""
+	// RootfsShiftIDMap uses an idmapped mount of the rootfs.
+	// The container UID and GID mappings are applied to the rootfs mount.
+	RootfsShiftIDMap = "idmap"
+)
+
 // ContainerConfig is the configuration for a single Container instance.
 type ContainerConfig struct {
 	// The Spec used to generate the liblxc config file.
@@ -26,9 +42,10 @@ type ContainerConfig struct {
 	Spec *specs.Spec
 
 	// ContainerID is the identifier of the container.
-	// The ContainerID is used as name for the containers runtime directory.
+	// The ContainerID is used as name for the containers runtime directory
+	// (see Runtime.HashLongContainerIDs).
 	// The ContainerID must be unique at least through all containers of a runtime.
-	// The ContainerID should match the following pattern `[a-z][a-z0-9-_]+`
+	// The ContainerID must match the pattern `[a-zA-Z0-9][a-zA-Z0-9_.-]*`
 	ContainerID string
 
 	// BundlePath is the OCI bundle path.
@@ -36,6 +53,17 @@ type ContainerConfig struct {
 
 	ConsoleSocket string `json:",omitempty"`
 
+	// CreateRuntimeHooksPostMount runs the createRuntime hooks from the liblxc mount hook
+	// within the container mount namespace, after the container rootfs is mounted
+	// (at LXC_ROOTFS_MOUNT), instead of the liblxc pre-mount hook.
+	// This is required for hooks that must modify the mounted rootfs
+	// (e.g device injection or ldconfig). The hooks are run before the createContainer hooks.
+	CreateRuntimeHooksPostMount bool `json:",omitempty"`
+
+	// ConsoleMode selects how the stdio of the container process is connected
+	// (ConsolePTY or ConsoleStdio).
+	ConsoleMode string `json:",omitempty"`
+
 	// MonitorCgroupDir is the cgroup directory path
 	// for the liblxc monitor process `lxcri-start`
 	// relative to the cgroup root.
@@ -43,10 +71,93 @@ type ContainerConfig struct {
 
 	CgroupDir string
 
+	// ExternalCgroup is true if the cgroup CgroupDir is managed
+	// by the caller (see Runtime.ExternalCgroups).
+	ExternalCgroup bool `json:",omitempty"`
+
 	// Use systemd encoded cgroup path (from crio-o/conmon)
 	// is true if /etc/crio/crio.conf#cgroup_manager = "systemd"
 	SystemdCgroup bool
 
+	// SystemdScopes are the transient systemd scope units of the container
+	// (see Runtime.CgroupManager).
+	SystemdScopes []string `json:",omitempty"`
+
+	// RootfsShift is the ID shifting method used for the rootfs.
+	// With ID shifting, containers with different user namespace mappings
+	// can share a single read-only image rootfs owned by the host root user.
+	RootfsShift string `json:",omitempty"`
+
+	// NetworkRootfs is the network filesystem (e.g nfs or cifs) the rootfs
+	// is located on, if the container was created in degraded mode (see Runtime.NetworkRootfs).
+	NetworkRootfs string `json:",omitempty"`
+
+	// SetSharedUTSName allows to set Spec.Hostname and Spec.Domainname
+	// on a joined UTS namespace that is not shared with the runtime.
+	// Otherwise the hostname and domainname of a joined UTS namespace are not changed.
+	SetSharedUTSName bool `json:",omitempty"`
+
+	// ExpandEnv enables the expansion of the following variables
+	// in the values of Spec.Process.Env when the container is created:
+	// ${container_id}, ${runtime_dir}, ${bundle} and ${hostname}.
+	// Other variables are not expanded.
+	ExpandEnv bool `json:",omitempty"`
+
+	// Devpts are the mount options of the devpts filesystem at /dev/pts.
+	// See DevptsMaxAnnotation, DevptsPtmxModeAnnotation and DevptsGIDAnnotation.
+	Devpts *DevptsOptions `json:",omitempty"`
+
+	// TimeSync exposes the host real-time clock device (/dev/rtc0) and allows
+	// the syscalls to adjust the system clock (e.g for chrony or ntpd in system containers).
+	// The container process must be granted CAP_SYS_TIME. See TimeSyncAnnotation.
+	TimeSync bool `json:",omitempty"`
+
+	// ConsoleTTYs is the number of ttys (/dev/tty1 ... /dev/ttyN) allocated
+	// for the container, that can be attached with Container.Console
+	// (e.g for emergency access to a system container). See ConsoleTTYsAnnotation.
+	ConsoleTTYs int `json:",omitempty"`
+
+	// SwapSize is the size in bytes of the swap file provisioned for the container
+	// in Runtime.SwapDir. The swap usage of the container is limited to SwapSize.
+	// See SwapSizeAnnotation.
+	SwapSize int64 `json:",omitempty"`
+
+	// Volumes are container paths for which anonymous volumes are created
+	// e.g the paths of the VOLUME directive of the container image.
+	// Anonymous volumes are deleted with the container unless Runtime.KeepVolumes is set.
+	Volumes []string `json:",omitempty"`
+
+	// WaitFor are conditions that must be met before Runtime.Start
+	// signals the container init process to execute the container process.
+	// The conditions are evaluated in order.
+	WaitFor []WaitCondition `json:",omitempty"`
+
+	// Secrets are exposed to the container process when it is started.
+	// Secrets are not supported with a restart policy, because the secrets
+	// are not available when the monitor process restarts the container.
+	Secrets []Secret `json:",omitempty"`
+
+	// CreateFrozen freezes the container cgroup when the container is created,
+	// so external agents can attach to the container (e.g eBPF programs scoped
+	// to the container cgroup) before the container process is executed.
+	// The cgroup is thawed by Runtime.Start.
+	CreateFrozen bool `json:",omitempty"`
+
+	// AuditDenials enables the audit of operations that were denied (EPERM/EACCES)
+	// when the container fails to start. The denials and the capabilities
+	// that are likely missing are added to the StartError.
+	// Seccomp denials are only reported if the seccomp profile logs them (SCMP_ACT_LOG).
+	AuditDenials bool `json:",omitempty"`
+
+	// SkippedLimits are the resource limits of the spec that are not applied
+	// by a rootless runtime, because the cgroup controller is not delegated
+	// to the runtime user (see Runtime.RequireResourceLimits).
+	SkippedLimits []SkippedLimit `json:",omitempty"`
+
+	// RestartPolicy is the optional restart policy applied
+	// by the monitor process when the container process exits.
+	RestartPolicy *RestartPolicy `json:",omitempty"`
+
 	// LogFile is the liblxc log file path
 	LogFile string
 
@@ -62,8 +173,28 @@ func (c Container) ConfigFilePath() string {
 	return c.RuntimePath("config")
 }
 
-func (c Container) syncFifoPath() string {
-	return c.RuntimePath("syncfifo")
+// syncDirPath is the directory that contains the init socket.
+// It is bind mounted read-write into the container at /.lxcri/sync.
+func (c Container) syncDirPath() string {
+	return c.EphemeralPath("sync")
+}
+
+func (c Container) initSocketPath() string {
+	return filepath.Join(c.syncDirPath(), handshake.SocketName)
+}
+
+// monitorStderrPath is the file where the stderr of the liblxc
+// monitor process is written to, if stderr is not inherited
+// from the runtime process.
+func (c Container) monitorStderrPath() string {
+	return c.RuntimePath("monitor.stderr")
+}
+
+// exitStatusPath is the file where the liblxc monitor process
+// writes the exit status of the container init process.
+// NOTE keep in sync with cmd/lxcri-start#EXIT_STATUS_FILE
+func (c Container) exitStatusPath() string {
+	return c.RuntimePath("exitstatus")
 }
 
 // RuntimePath returns the absolute path to the given sub path
@@ -72,6 +203,13 @@ func (c Container) RuntimePath(subPath ...string) string {
 	return filepath.Join(c.runtimeDir, filepath.Join(subPath...))
 }
 
+// EphemeralPath returns the absolute path to the given sub path
+// within the container directory for ephemeral runtime files.
+// This is the container runtime directory unless Runtime.EphemeralRoot is set.
+func (c Container) EphemeralPath(subPath ...string) string {
+	return filepath.Join(c.ephemeralDir, filepath.Join(subPath...))
+}
+
 // Container is the runtime state of a container instance.
 type Container struct {
 	LinuxContainer *lxc.Container `json:"-"`
@@ -81,32 +219,98 @@ type Container struct {
 	// Pid is the process ID of the liblxc monitor process ( see ExecStart )
 	Pid int
 
-	runtimeDir string
+	// CreateTimings are the durations of the Runtime.Create phases.
+	CreateTimings *CreateTimings `json:",omitempty"`
+
+	// BundleHash is the SHA-256 hash of the bundle spec (BundleConfigFile)
+	// consumed by Runtime.Create. It is verified by Runtime.Start and Container.Exec.
+	BundleHash string `json:",omitempty"`
+
+	// SpecHash is the SHA-256 hash of the spec in the runtime directory (BundleConfigFile),
+	// if the spec is not serialized with the container state (see Runtime.SpecReference).
+	SpecHash string `json:",omitempty"`
+
+	runtimeDir   string
+	ephemeralDir string
+
+	// traceConfig enables the recording of the config items in configTrace.
+	traceConfig bool
+	configTrace []ConfigDecision
+
+	// clock and fs are inherited from the runtime (see Runtime.Clock and Runtime.FS).
+	clock Clock
+	fs    FS
+
+	// monitor is set if the monitor process was started by this runtime process.
+	monitor *monitorProcess
+
+	// startPids are the container process IDs observed while the
+	// container was started (see Container.trackStartPids).
+	startPids []int
 }
 
-func (c *Container) create() error {
-	if err := os.MkdirAll(c.runtimeDir, 0777); err != nil {
-		return fmt.Errorf("failed to create container dir: %w", err)
+// create creates the container runtime directory and returns with the
+// exclusive lock (see Runtime.lockContainer) held on the directory.
+func (c *Container) create(modes RuntimeFileModes, reservation *ResourceReservation) (_ func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(c.runtimeDir), modes.DirMode); err != nil {
+		return nil, fmt.Errorf("failed to create runtime root: %w", err)
+	}
+	// The runtime directory is locked before it is created,
+	// so a concurrent Runtime.Delete can not remove it before the container is created.
+	unlock, err := createDirLocked(c.runtimeDir, modes.DirMode, func(tmp string) error {
+		// The reservation must be visible together with the runtime directory (see Runtime.Reservations).
+		if reservation != nil {
+			err := specki.EncodeJSONFile(filepath.Join(tmp, reservationFile), reservation, os.O_EXCL|os.O_CREATE, modes.PrivateFileMode)
+			if err != nil {
+				return fmt.Errorf("failed to write reservation: %w", err)
+			}
+		}
+		// Store the original ID if the directory name is hashed (see Runtime.HashLongContainerIDs).
+		if filepath.Base(c.runtimeDir) == c.ContainerID {
+			return nil
+		}
+		err := os.WriteFile(filepath.Join(tmp, ContainerIDFile), []byte(c.ContainerID+"\n"), 0444)
+		if err != nil {
+			return fmt.Errorf("failed to write container ID file: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			unlock()
+		}
+	}()
 
-	if err := os.Chmod(c.runtimeDir, 0777); err != nil {
-		return errorf("failed to chmod %s: %w", err)
+	if c.ephemeralDir != c.runtimeDir {
+		if err := os.MkdirAll(c.ephemeralDir, modes.DirMode); err != nil {
+			return nil, fmt.Errorf("failed to create ephemeral container dir: %w", err)
+		}
+		if err := os.Chmod(c.ephemeralDir, modes.DirMode); err != nil {
+			return nil, errorf("failed to chmod %s: %w", c.ephemeralDir, err)
+		}
 	}
 
-	f, err := os.OpenFile(c.RuntimePath("config"), os.O_EXCL|os.O_CREATE|os.O_RDWR, 0640)
+	f, err := os.OpenFile(c.RuntimePath("config"), os.O_EXCL|os.O_CREATE|os.O_RDWR, modes.ConfigFileMode)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := f.Close(); err != nil {
-		return fmt.Errorf("failed to close empty config tmpfile: %w", err)
+		return nil, fmt.Errorf("failed to close empty config tmpfile: %w", err)
+	}
+	// The initial permissions are affected by the umask.
+	if err := os.Chmod(c.RuntimePath("config"), modes.ConfigFileMode); err != nil {
+		return nil, fmt.Errorf("failed to chmod config file: %w", err)
 	}
 
-	c.LinuxContainer, err = lxc.NewContainer(c.ContainerID, filepath.Dir(c.runtimeDir))
+	c.LinuxContainer, err = lxc.NewContainer(filepath.Base(c.runtimeDir), filepath.Dir(c.runtimeDir))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return unlock, nil
 }
 
 func (c *Container) load() error {
@@ -119,7 +323,7 @@ func (c *Container) load() error {
 	if err != nil {
 		return fmt.Errorf("failed to load lxc config file: %w", err)
 	}
-	c.LinuxContainer, err = lxc.NewContainer(c.ContainerID, filepath.Dir(c.runtimeDir))
+	c.LinuxContainer, err = lxc.NewContainer(filepath.Base(c.runtimeDir), filepath.Dir(c.runtimeDir))
 	if err != nil {
 		return fmt.Errorf("failed to create lxc container: %w", err)
 	}
@@ -132,23 +336,18 @@ func (c *Container) load() error {
 }
 
 func (c *Container) waitMonitorStopped(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if !c.isMonitorRunning() {
-				return nil
-			}
-			time.Sleep(time.Millisecond * 100)
-		}
-	}
+	return pollUntil(ctx, c.sysClock(), 0, time.Millisecond*100, func() (bool, error) {
+		return !c.isMonitorRunning(), nil
+	})
 }
 
 func (c *Container) isMonitorRunning() bool {
 	if c.Pid < 2 {
 		return false
 	}
+	if c.monitor != nil {
+		return !c.monitor.exited()
+	}
 
 	var ws unix.WaitStatus
 	pid, err := unix.Wait4(c.Pid, &ws, unix.WNOHANG, nil)
@@ -180,46 +379,55 @@ func (c *Container) isMonitorRunning() bool {
 }
 
 func (c *Container) waitCreated(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if !c.isMonitorRunning() {
-				return fmt.Errorf("monitor already died")
-			}
-			state := c.LinuxContainer.State()
-			if !(state == lxc.RUNNING) {
-				c.Log.Debug().Stringer("state", state).Msg("wait for state lxc.RUNNING")
-				time.Sleep(time.Millisecond * 100)
-				continue
-			}
-			initState, err := c.getContainerInitState()
-			if err != nil {
-				return err
-			}
-			if initState == specs.StateCreated {
-				return nil
-			}
-			return fmt.Errorf("unexpected init state %q", initState)
+	err := pollUntil(ctx, c.sysClock(), 0, time.Millisecond*100, func() (bool, error) {
+		c.trackStartPids()
+		if !c.isMonitorRunning() {
+			return false, fmt.Errorf("monitor already died")
+		}
+		state := c.LinuxContainer.State()
+		if !(state == lxc.RUNNING) {
+			c.Log.Debug().Stringer("state", state).Msg("wait for state lxc.RUNNING")
+			return false, nil
 		}
+		return true, nil
+	})
+	if err != nil {
+		return err
 	}
+	conn, err := c.dialInit(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return handshake.Expect(json.NewDecoder(conn), handshake.MsgReady)
 }
 
-func (c *Container) waitStarted(ctx context.Context) error {
+// dialInit connects to the init socket.
+// The socket may not yet exist (or accept connections)
+// while the init process is starting.
+func (c *Container) dialInit(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{}
 	for {
+		conn, err := dialer.DialContext(ctx, "unix", c.initSocketPath())
+		if err == nil {
+			if deadline, ok := ctx.Deadline(); ok {
+				if err := conn.SetDeadline(deadline); err != nil {
+					conn.Close()
+					return nil, err
+				}
+			}
+			return conn, nil
+		}
+		if !errors.Is(err, unix.ENOENT) && !errors.Is(err, unix.ECONNREFUSED) {
+			return nil, fmt.Errorf("failed to connect to init socket: %w", err)
+		}
+		if !c.isMonitorRunning() {
+			return nil, fmt.Errorf("monitor already died")
+		}
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if !c.isMonitorRunning() {
-				return nil
-			}
-			initState, _ := c.getContainerInitState()
-			if initState != specs.StateCreated {
-				return nil
-			}
-			time.Sleep(time.Millisecond * 10)
+			return nil, ctx.Err()
+		case <-c.sysClock().After(time.Millisecond * 10):
 		}
 	}
 }
@@ -229,6 +437,35 @@ type State struct {
 	ContainerState string
 	RuntimePath    string
 	SpecState      specs.State
+	// Exit is the termination state of the container process.
+	// It is only set if the container is stopped.
+	Exit *ExitState `json:",omitempty"`
+	// Security is the effective security state of the container init process.
+	// It is only set if the container init process is running.
+	Security *SecurityState `json:",omitempty"`
+	// RestartCount is the number of times the container was restarted
+	// by the monitor process (see ContainerConfig.RestartPolicy).
+	RestartCount int `json:",omitempty"`
+	// OOMKills is the number of processes in the container cgroup
+	// that were killed by the OOM killer (see Runtime.WatchOOM).
+	OOMKills uint64 `json:",omitempty"`
+}
+
+// ExitState describes why the container process terminated.
+type ExitState struct {
+	// ExitCode is the exit code of the container process.
+	// If the process was terminated by a signal ExitCode is 128 + signal number.
+	// ExitCode is 255 if the container failed to start.
+	ExitCode int
+	// Signal is the name of the signal that terminated the container process.
+	Signal string `json:",omitempty"`
+	// CoreDumped is true if the container process produced a core dump.
+	CoreDumped bool `json:",omitempty"`
+	// OOMKilled is true if processes in the container cgroup
+	// were killed by the OOM killer.
+	OOMKilled bool
+	// Error is the last error reported by the liblxc monitor process.
+	Error string `json:",omitempty"`
 }
 
 // State returns the runtime state of the containers process.
@@ -253,9 +490,114 @@ func (c *Container) State() (*State, error) {
 		},
 	}
 
+	if status == specs.StateStopped {
+		c.checkMonitorDied()
+		state.Exit, err = c.exitState()
+		if err != nil {
+			c.Log.Warn().Msgf("failed to load exit state: %s", err)
+		}
+	} else if initPid := c.LinuxContainer.InitPid(); initPid > 0 {
+		state.Security, err = readSecurityState(c.sysFS(), initPid)
+		if err != nil {
+			c.Log.Warn().Msgf("failed to read security state: %s", err)
+		}
+	}
+
+	state.OOMKills, err = c.oomKills()
+	if err != nil {
+		c.Log.Warn().Msgf("failed to get OOM kills: %s", err)
+	}
+
+	if c.RestartPolicy != nil {
+		state.RestartCount, err = c.restartCount()
+		if err != nil {
+			c.Log.Warn().Msgf("failed to read restart count: %s", err)
+		}
+	}
+
 	return state, nil
 }
 
+// exitState returns the termination state of the container process.
+// The returned ExitState is nil if the monitor process
+// has not yet written the exit status.
+func (c *Container) exitState() (*ExitState, error) {
+	data, err := os.ReadFile(c.exitStatusPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	exit, err := parseExitStatus(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := c.oomKills()
+	if err != nil {
+		c.Log.Warn().Msgf("failed to get OOM kills: %s", err)
+	}
+	exit.OOMKilled = n > 0
+	return exit, nil
+}
+
+// checkMonitorDied records an exit status, if the monitor process died
+// without writing the exit status of the container process
+// (e.g the monitor was killed by the OOM killer).
+// The container init process is killed by the kernel when the monitor
+// process dies (PR_SET_PDEATHSIG), so the container is stopped.
+func (c *Container) checkMonitorDied() {
+	if c.Pid < 2 || c.isMonitorRunning() {
+		return
+	}
+	if _, err := os.Stat(c.exitStatusPath()); !os.IsNotExist(err) {
+		return
+	}
+	msg := fmt.Sprintf("monitor process %d died unexpectedly", c.Pid)
+	c.Log.Warn().Msg(msg)
+
+	// #nosec
+	f, err := os.OpenFile(c.exitStatusPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		c.Log.Warn().Msgf("failed to record exit status: %s", err)
+		return
+	}
+	defer f.Close()
+	// exit code 255
+	if _, err := fmt.Fprintf(f, "%d\n%s\n", 255<<8, msg); err != nil {
+		c.Log.Warn().Msgf("failed to record exit status: %s", err)
+	}
+}
+
+// parseExitStatus parses the exit status file written by the liblxc monitor process.
+// The first line is the raw wait status, the second line is an optional error message.
+// A status that is neither an exit nor a signal (e.g -1 if the container failed to start)
+// is reported as exit code 255, like the failures recorded by checkMonitorDied.
+func parseExitStatus(s string) (*ExitState, error) {
+	lines := strings.SplitN(s, "\n", 2)
+	n, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid exit status %q: %w", lines[0], err)
+	}
+	exit := new(ExitState)
+	if len(lines) > 1 {
+		exit.Error = strings.TrimSpace(lines[1])
+	}
+	ws := unix.WaitStatus(n)
+	switch {
+	case ws.Exited():
+		exit.ExitCode = ws.ExitStatus()
+	case ws.Signaled():
+		exit.ExitCode = 128 + int(ws.Signal())
+		exit.Signal = unix.SignalName(ws.Signal())
+		exit.CoreDumped = ws.CoreDump()
+	default:
+		exit.ExitCode = 255
+	}
+	return exit, nil
+}
+
 // ContainerState returns the current state of the container process,
 // as defined by the OCI runtime spec.
 func (c *Container) ContainerState() (specs.ContainerState, error) {
@@ -269,7 +611,18 @@ func (c *Container) state(s lxc.State) (specs.ContainerState, error) {
 	case lxc.STARTING:
 		return specs.StateCreating, nil
 	case lxc.RUNNING, lxc.STOPPING, lxc.ABORTING, lxc.FREEZING, lxc.FROZEN, lxc.THAWED:
-		return c.getContainerInitState()
+		state, err := c.getContainerInitState()
+		if err != nil || state != specs.StateRunning {
+			return state, err
+		}
+		paused, err := c.isPaused(s)
+		if err != nil {
+			c.Log.Warn().Msgf("failed to check whether container is paused: %s", err)
+		}
+		if paused {
+			return StatePaused, nil
+		}
+		return state, nil
 	default:
 		return specs.StateStopped, fmt.Errorf("unsupported lxc container state %q", s)
 	}
@@ -316,6 +669,19 @@ func (c *Container) kill(ctx context.Context, signum unix.Signal) error {
 	return nil
 }
 
+// killAll kills all processes in the container cgroup with SIGKILL.
+// cgroup.kill is used if supported.
+func (c *Container) killAll(ctx context.Context) error {
+	killed, err := killCgroupTree(c)
+	if err != nil {
+		c.Log.Warn().Msgf("failed to kill cgroup with cgroup.kill: %s", err)
+	}
+	if killed {
+		return nil
+	}
+	return c.kill(ctx, unix.SIGKILL)
+}
+
 // getConfigItem is a wrapper function and returns the
 // first value returned by lxc.Container.ConfigItem
 func (c *Container) getConfigItem(key string) string {
@@ -339,6 +705,7 @@ func (c *Container) setConfigItem(key, value string) error {
 		return fmt.Errorf("failed to set config item '%s=%s': %w", key, value, err)
 	}
 	c.Log.Debug().Str(key, value).Msg("set config item")
+	c.traceConfigItem(key, value)
 	return nil
 }
 
@@ -364,15 +731,33 @@ func (c *Container) Release() error {
 }
 
 func (c *Container) start(ctx context.Context) error {
-	// #nosec
-	fifo, err := os.OpenFile(c.syncFifoPath(), os.O_WRONLY, 0)
+	conn, err := c.dialInit(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	msg := handshake.NewMessage(handshake.MsgStart)
+	msg.Env, msg.Files, err = c.readSecrets()
 	if err != nil {
 		return err
 	}
-	if err := fifo.Close(); err != nil {
+	if err := handshake.Send(conn, msg); err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	dec := json.NewDecoder(conn)
+	if err := handshake.Expect(dec, handshake.MsgExec); err != nil {
+		return err
+	}
+	// The connection is closed when the container process is executed.
+	_, err = handshake.Receive(dec)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
-	return c.waitStarted(ctx)
+	return fmt.Errorf("unexpected message after %q", handshake.MsgExec)
 }
 
 // ExecOptions contains options for Container.Exec and Container.ExecDetached
@@ -380,6 +765,13 @@ type ExecOptions struct {
 	// Namespaces is the list of container namespaces that the process is attached to.
 	// The process will is attached to all container namespaces if Namespaces is empty.
 	Namespaces []specs.LinuxNamespaceType
+
+	// ConsoleSocket is the path to the unix socket the pty master is sent to,
+	// if the process spec requests a terminal. See Runtime.Exec
+	ConsoleSocket string
+
+	// tty is the pty slave that replaces the process stdio.
+	tty *os.File
 }
 
 // ExecDetached executes the given process spec within the container.
@@ -393,7 +785,15 @@ func (c *Container) ExecDetached(proc *specs.Process, execOpts *ExecOptions) (pi
 		return 0, errorf("failed to create attach options: %w", err)
 	}
 
-	pid, err = c.LinuxContainer.RunCommandNoWait(proc.Args, opts)
+	affinity, err := cpuaffinity.FromSpec(c.Spec)
+	if err != nil {
+		return 0, err
+	}
+	// The attached process is forked from the calling thread and inherits the affinity.
+	err = cpuaffinity.Run(affinity, func() error {
+		pid, err = c.LinuxContainer.RunCommandNoWait(proc.Args, opts)
+		return err
+	})
 	if err != nil {
 		return pid, errorf("failed to run exec cmd detached: %w", err)
 	}
@@ -409,7 +809,14 @@ func (c *Container) Exec(proc *specs.Process, execOpts *ExecOptions) (exitStatus
 	if err != nil {
 		return 0, errorf("failed to create attach options: %w", err)
 	}
-	exitStatus, err = c.LinuxContainer.RunCommandStatus(proc.Args, opts)
+	affinity, err := cpuaffinity.FromSpec(c.Spec)
+	if err != nil {
+		return 0, err
+	}
+	err = cpuaffinity.Run(affinity, func() error {
+		exitStatus, err = c.LinuxContainer.RunCommandStatus(proc.Args, opts)
+		return err
+	})
 	if err != nil {
 		return exitStatus, errorf("failed to run exec cmd: %w", err)
 	}
@@ -417,6 +824,9 @@ func (c *Container) Exec(proc *specs.Process, execOpts *ExecOptions) (exitStatus
 }
 
 func (c *Container) attachOptions(procSpec *specs.Process, execOpts *ExecOptions) (lxc.AttachOptions, error) {
+	if err := c.checkBundle(); err != nil {
+		return lxc.AttachOptions{}, err
+	}
 	opts := lxc.AttachOptions{
 		StdinFd:  0,
 		StdoutFd: 1,
@@ -426,6 +836,13 @@ func (c *Container) attachOptions(procSpec *specs.Process, execOpts *ExecOptions
 	if procSpec == nil {
 		return opts, fmt.Errorf("process spec is nil")
 	}
+
+	if execOpts != nil && execOpts.tty != nil {
+		fd := execOpts.tty.Fd()
+		opts.StdinFd = fd
+		opts.StdoutFd = fd
+		opts.StderrFd = fd
+	}
 	opts.Cwd = procSpec.Cwd
 	// Use the environment defined by the process spec.
 	opts.ClearEnv = true
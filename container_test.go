@@ -0,0 +1,47 @@
+package lxcri
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExitStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		exit   *ExitState
+	}{
+		{"exit status 3", "768\n\n", &ExitState{ExitCode: 3}},
+		{"killed by SIGKILL", "9\n\n", &ExitState{ExitCode: 137, Signal: "SIGKILL"}},
+		{"SIGSEGV with core dump", "139\n\n", &ExitState{ExitCode: 139, Signal: "SIGSEGV", CoreDumped: true}},
+		{"failed to start", "-1\nfailed to start container\n", &ExitState{ExitCode: 255, Error: "failed to start container"}},
+		{"recorded by checkMonitorDied", "65280\nmonitor died\n", &ExitState{ExitCode: 255, Error: "monitor died"}},
+	}
+	for _, tc := range tests {
+		exit, err := parseExitStatus(tc.status)
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.exit, exit, tc.name)
+	}
+
+	_, err := parseExitStatus("")
+	require.Error(t, err)
+}
+
+func TestCheckMonitorDied(t *testing.T) {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+
+	c := &Container{
+		ContainerConfig: &ContainerConfig{Log: zerolog.Nop()},
+		Pid:             cmd.Process.Pid,
+		runtimeDir:      t.TempDir(),
+	}
+	c.checkMonitorDied()
+	exit, err := c.exitState()
+	require.NoError(t, err)
+	require.Equal(t, 255, exit.ExitCode)
+	require.Contains(t, exit.Error, "died unexpectedly")
+}
@@ -0,0 +1,87 @@
+package lxcri
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MaxContainerIDLength is the maximum length of a container ID
+	// if Runtime.HashLongContainerIDs is enabled.
+	// Otherwise the container ID is limited to the maximum
+	// length of a file name (NAME_MAX).
+	MaxContainerIDLength = 1024
+
+	// ContainerIDFile is the file within the runtime directory
+	// that stores the original ID of a container with a hashed directory name.
+	ContainerIDFile = "container-id"
+
+	nameMax = 255
+	// maxContainerDirName is the maximum length of a container ID
+	// that is used as directory name if Runtime.HashLongContainerIDs is enabled.
+	maxContainerDirName = 64
+	hashedDirPrefix     = "sha256-"
+)
+
+var containerIDPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// checkContainerID validates the container ID.
+// The container ID must start with an alphanumeric character and
+// may only contain alphanumeric characters, '_', '.' and '-'.
+// This rejects path separators and the relative path elements '.' and '..'.
+func (rt *Runtime) checkContainerID(id string) error {
+	maxLen := nameMax
+	if rt.HashLongContainerIDs {
+		maxLen = MaxContainerIDLength
+	}
+	if len(id) == 0 {
+		return fmt.Errorf("missing container ID")
+	}
+	if len(id) > maxLen {
+		return fmt.Errorf("container ID exceeds maximum length %d", maxLen)
+	}
+	if !containerIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid container ID %q: must match %s", id, containerIDPattern)
+	}
+	return nil
+}
+
+// containerDirName returns the name of the runtime directory for the given container ID.
+// Long container IDs are replaced by their SHA-256 hash if Runtime.HashLongContainerIDs
+// is enabled. The hashed name is longer than maxContainerDirName,
+// so it can not collide with the directory name of another container ID.
+func (rt *Runtime) containerDirName(id string) string {
+	if !rt.HashLongContainerIDs || len(id) <= maxContainerDirName {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hashedDirPrefix + hex.EncodeToString(sum[:])
+}
+
+// runtimeDir returns the runtime directory for the given container ID.
+func (rt *Runtime) runtimeDir(id string) string {
+	return filepath.Join(rt.Root, rt.containerDirName(id))
+}
+
+// containerIDFromDir returns the container ID for the given runtime directory name.
+// A directory name is only a hashed container ID if it has the exact length
+// of a hashed name and contains the ContainerIDFile. Otherwise, e.g for the
+// valid container ID `sha256-foo`, the directory name is the container ID.
+func (rt *Runtime) containerIDFromDir(name string) (string, error) {
+	if !strings.HasPrefix(name, hashedDirPrefix) || len(name) != len(hashedDirPrefix)+sha256.Size*2 {
+		return name, nil
+	}
+	data, err := os.ReadFile(filepath.Join(rt.Root, name, ContainerIDFile))
+	if os.IsNotExist(err) {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,49 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckContainerID(t *testing.T) {
+	rt := &Runtime{}
+	for _, id := range []string{"a", "web-1", "8f3e_c.1", strings.Repeat("a", nameMax)} {
+		require.NoError(t, rt.checkContainerID(id), id)
+	}
+	for _, id := range []string{"", ".", "..", "../etc", "a/b", "-a", ".hidden", "a b", "a\x00", strings.Repeat("a", nameMax+1)} {
+		require.Error(t, rt.checkContainerID(id), id)
+	}
+	rt.HashLongContainerIDs = true
+	require.NoError(t, rt.checkContainerID(strings.Repeat("a", MaxContainerIDLength)))
+	require.Error(t, rt.checkContainerID(strings.Repeat("a", MaxContainerIDLength+1)))
+}
+
+func TestContainerDirName(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	long := strings.Repeat("a", maxContainerDirName+1)
+	require.Equal(t, long, rt.containerDirName(long))
+
+	rt.HashLongContainerIDs = true
+	short := strings.Repeat("b", maxContainerDirName)
+	require.Equal(t, short, rt.containerDirName(short))
+
+	name := rt.containerDirName(long)
+	require.True(t, strings.HasPrefix(name, hashedDirPrefix))
+	require.Len(t, name, len(hashedDirPrefix)+64)
+	require.NotEqual(t, name, rt.containerDirName(long+"a"))
+
+	require.NoError(t, os.Mkdir(filepath.Join(rt.Root, name), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rt.Root, name, ContainerIDFile), []byte(long+"\n"), 0444))
+	require.NoError(t, os.Mkdir(filepath.Join(rt.Root, short), 0755))
+	// a short container ID with the hash prefix is not a hashed name
+	prefixed := hashedDirPrefix + "foo"
+	require.NoError(t, os.Mkdir(filepath.Join(rt.Root, prefixed), 0755))
+
+	ids, err := rt.List()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{long, short, prefixed}, ids)
+}
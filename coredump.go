@@ -0,0 +1,103 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// corePatternFile is the kernel core dump file name pattern, see `man 5 core`.
+var corePatternFile = "/proc/sys/kernel/core_pattern"
+
+// systemDirs are the directories of the standard filesystem hierarchy
+// that must not be shadowed by the core dump directory.
+var systemDirs = map[string]bool{
+	"/": true, "/bin": true, "/boot": true, "/dev": true, "/etc": true,
+	"/home": true, "/lib": true, "/lib32": true, "/lib64": true, "/media": true,
+	"/mnt": true, "/opt": true, "/proc": true, "/root": true, "/run": true,
+	"/sbin": true, "/srv": true, "/sys": true, "/tmp": true, "/usr": true,
+	"/usr/bin": true, "/usr/lib": true, "/usr/lib64": true, "/usr/local": true,
+	"/usr/sbin": true, "/usr/share": true, "/var": true, "/var/cache": true,
+	"/var/lib": true, "/var/log": true, "/var/run": true, "/var/spool": true,
+	"/var/tmp": true,
+}
+
+// corePatternDir returns the directory of the absolute core_pattern.
+// The directory is shadowed by the core dump directory within the container,
+// so an error is returned if it is a standard system directory, e.g
+// for the pattern `/tmp/core.%p` the containers /tmp would be hidden.
+func corePatternDir(pattern string) (string, error) {
+	dir := filepath.Dir(filepath.Clean(pattern))
+	if systemDirs[dir] {
+		return "", fmt.Errorf("core_pattern %q must use a dedicated directory, not %s", pattern, dir)
+	}
+	return dir, nil
+}
+
+// coreDumpDir returns the host directory for core dumps of the given container.
+func (rt *Runtime) coreDumpDir(c *Container) string {
+	if rt.CoreDumpDir != "" {
+		return filepath.Join(rt.CoreDumpDir, rt.containerDirName(c.ContainerID))
+	}
+	return c.RuntimePath("cores")
+}
+
+// configureCoreDumps enables core dumps for the container processes.
+// The core_pattern is global to the host but it is evaluated relative to the
+// mount namespace of the dumping process. So the directory of an absolute
+// core_pattern is shadowed by a bind mount of the per-container core dump directory.
+// The core_pattern must use a dedicated directory (see corePatternDir).
+func configureCoreDumps(rt *Runtime, c *Container) error {
+	hasCoreLimit := false
+	for _, limit := range c.Spec.Process.Rlimits {
+		if strings.EqualFold(limit.Type, "RLIMIT_CORE") {
+			hasCoreLimit = true
+		}
+	}
+	if !hasCoreLimit {
+		c.Spec.Process.Rlimits = append(c.Spec.Process.Rlimits,
+			specs.POSIXRlimit{Type: "RLIMIT_CORE", Soft: ^uint64(0), Hard: ^uint64(0)},
+		)
+	}
+
+	data, err := os.ReadFile(corePatternFile)
+	if err != nil {
+		return fmt.Errorf("failed to read core pattern: %w", err)
+	}
+	pattern := strings.TrimSpace(string(data))
+	if strings.HasPrefix(pattern, "|") {
+		c.Log.Info().Str("core_pattern", pattern).Msg("core dumps are piped to a helper program")
+		return nil
+	}
+	if !filepath.IsAbs(pattern) {
+		c.Log.Info().Str("core_pattern", pattern).Msg("core dumps are written to the working directory of the process")
+		return nil
+	}
+
+	dst, err := corePatternDir(pattern)
+	if err != nil {
+		return err
+	}
+
+	dir := rt.coreDumpDir(c)
+	if err := os.MkdirAll(dir, rt.FileModes.DirMode); err != nil {
+		return fmt.Errorf("failed to create core dump dir: %w", err)
+	}
+	// The container process must be able to write to the directory.
+	if err := os.Chmod(dir, rt.FileModes.DirMode); err != nil {
+		return fmt.Errorf("failed to chmod core dump dir: %w", err)
+	}
+	if err := rt.chgrp(dir); err != nil {
+		return err
+	}
+	c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+		Source:      dir,
+		Destination: dst,
+		Type:        "bind",
+		Options:     []string{"bind", "rw", "nosuid", "nodev", "noexec"},
+	})
+	return nil
+}
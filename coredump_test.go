@@ -0,0 +1,18 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorePatternDir(t *testing.T) {
+	dir, err := corePatternDir("/var/crash/core.%e.%p")
+	require.NoError(t, err)
+	require.Equal(t, "/var/crash", dir)
+
+	for _, pattern := range []string{"/core.%p", "/tmp/core.%p", "/var/lib//core", "/usr/../etc/core"} {
+		_, err := corePatternDir(pattern)
+		require.Error(t, err, pattern)
+	}
+}
@@ -2,13 +2,17 @@ package lxcri
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/lxc/lxcri/internal/cpuaffinity"
+	"github.com/lxc/lxcri/internal/mempolicy"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"gopkg.in/lxc/go-lxc.v2"
 )
 
 // Create creates a single container instance from the given ContainerConfig.
@@ -17,37 +21,93 @@ import (
 // You should call Runtime.Delete to cleanup container runtime state, even
 // if the Create returned with an error.
 func (rt *Runtime) Create(ctx context.Context, cfg *ContainerConfig) (*Container, error) {
+	start := rt.sysClock().Now()
 	if err := rt.checkConfig(cfg); err != nil {
 		return nil, err
 	}
 
-	c := &Container{ContainerConfig: cfg}
-	c.runtimeDir = filepath.Join(rt.Root, c.ContainerID)
+	var reservation *ResourceReservation
+	var unlockRoot func()
+	if rt.ResourceLimits.enabled() || rt.MaxContainers > 0 {
+		var err error
+		unlockRoot, err = rt.checkReservation(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if rt.ResourceLimits.enabled() {
+			r := specReservation(cfg.Spec)
+			reservation = &r
+		}
+	}
+
+	c := &Container{ContainerConfig: cfg, traceConfig: rt.TraceConfig, clock: rt.sysClock(), fs: rt.sysFS()}
+	c.CreateTimings = &CreateTimings{Check: rt.sysClock().Now().Sub(start)}
+	c.runtimeDir = rt.runtimeDir(c.ContainerID)
+	c.ephemeralDir = rt.ephemeralDir(c.ContainerID)
 
 	if cfg.Spec.Annotations == nil {
 		cfg.Spec.Annotations = make(map[string]string)
 	}
 	cfg.Spec.Annotations["org.linuxcontainers.lxc.ConfigFile"] = c.RuntimePath("config")
 
-	if err := c.create(); err != nil {
+	unlock, err := c.create(rt.FileModes, reservation)
+	// The reservation is recorded within the runtime directory,
+	// so it is visible to concurrent create calls.
+	if unlockRoot != nil {
+		unlockRoot()
+	}
+	if errors.Is(err, ErrExist) {
+		// Do not return the container, the runtime directory belongs to another container.
+		return nil, err
+	} else if err != nil {
 		return c, errorf("failed to create container: %w", err)
 	}
+	defer unlock()
+	if err := rt.chgrp(c.runtimeDir, c.ephemeralDir, c.ConfigFilePath()); err != nil {
+		return c, err
+	}
+
+	c.BundleHash, err = bundleHash(c.BundlePath)
+	if err != nil {
+		return c, errorf("failed to hash bundle spec: %w", err)
+	}
 
+	if c.ExpandEnv {
+		expandEnv(c)
+	}
+
+	configureStart := rt.sysClock().Now()
 	if err := configureContainer(rt, c); err != nil {
 		return c, errorf("failed to configure container: %w", err)
 	}
+	if c.traceConfig {
+		if err := c.writeConfigTrace(rt.FileModes.PrivateFileMode); err != nil {
+			return c, err
+		}
+	}
+
+	if rt.ValidateEntrypoint {
+		if err := validateEntrypoint(c.Spec); err != nil {
+			return c, errorf("invalid container process: %w", err)
+		}
+	}
 
 	cleanenv(c, true)
 
 	// Seralize the modified spec.Spec separately, to make it available for
 	// runtime hooks.
 	specPath := c.RuntimePath(BundleConfigFile)
-	err := specki.EncodeJSONFile(specPath, cfg.Spec, os.O_EXCL|os.O_CREATE, 0444)
+	spec, err := rt.protectedSpec(cfg.Spec)
+	if err != nil {
+		return c, errorf("failed to protect container spec: %w", err)
+	}
+	err = specki.EncodeJSONFile(specPath, spec, os.O_EXCL|os.O_CREATE, rt.FileModes.PublicFileMode)
 	if err != nil {
 		return c, err
 	}
 
-	err = specki.EncodeJSONFile(c.RuntimePath("hooks.json"), cfg.Spec.Hooks, os.O_EXCL|os.O_CREATE, 0444)
+	hooksPath := c.RuntimePath("hooks.json")
+	err = specki.EncodeJSONFile(hooksPath, cfg.Spec.Hooks, os.O_EXCL|os.O_CREATE, rt.FileModes.PublicFileMode)
 	if err != nil {
 		return c, err
 	}
@@ -55,15 +115,34 @@ func (rt *Runtime) Create(ctx context.Context, cfg *ContainerConfig) (*Container
 	if err != nil {
 		return c, err
 	}
-	err = specki.EncodeJSONFile(c.RuntimePath("state.json"), state.SpecState, os.O_EXCL|os.O_CREATE, 0444)
+	statePath := c.RuntimePath("state.json")
+	err = specki.EncodeJSONFile(statePath, state.SpecState, os.O_EXCL|os.O_CREATE, rt.FileModes.PublicFileMode)
 	if err != nil {
 		return c, err
 	}
+	if err := rt.chgrp(specPath, hooksPath, statePath); err != nil {
+		return c, err
+	}
+	if rt.SpecReference {
+		c.SpecHash, err = hashFile(specPath)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	c.CreateTimings.Configure = rt.sysClock().Now().Sub(configureStart)
 
 	if err := rt.runStartCmd(ctx, c); err != nil {
 		return c, errorf("failed to run container process: %w", err)
 	}
-	return c, nil
+
+	c.CreateTimings.Hooks, err = readHookTimings(c.RuntimePath(hookTimingsFile))
+	if err != nil {
+		c.Log.Warn().Msgf("failed to read hook timings: %s", err)
+	}
+	c.CreateTimings.Total = rt.sysClock().Now().Sub(start)
+	c.CreateTimings.log(c)
+	return c, rt.saveState(c, true)
 }
 
 func configureContainer(rt *Runtime, c *Container) error {
@@ -75,6 +154,12 @@ func configureContainer(rt *Runtime, c *Container) error {
 		return err
 	}
 
+	if rt.Rootless {
+		if err := configureRootless(rt, c); err != nil {
+			return err
+		}
+	}
+
 	if err := configureRootfs(rt, c); err != nil {
 		return fmt.Errorf("failed to configure rootfs: %w", err)
 	}
@@ -83,6 +168,16 @@ func configureContainer(rt *Runtime, c *Container) error {
 		return fmt.Errorf("failed to configure init: %w", err)
 	}
 
+	if err := configureWasm(rt, c); err != nil {
+		return fmt.Errorf("failed to configure WASM runtime: %w", err)
+	}
+
+	if rt.CoreDumps {
+		if err := configureCoreDumps(rt, c); err != nil {
+			return fmt.Errorf("failed to configure core dumps: %w", err)
+		}
+	}
+
 	if os.Getuid() != 0 {
 		// ensure user namespace is enabled
 		if !isNamespaceEnabled(c.Spec, specs.UserNamespace) {
@@ -100,6 +195,32 @@ func configureContainer(rt *Runtime, c *Container) error {
 		if err := c.setConfigItem("lxc.proc.oom_score_adj", fmt.Sprintf("%d", *c.Spec.Process.OOMScoreAdj)); err != nil {
 			return err
 		}
+	} else if rt.MonitorOOMScoreAdj != nil {
+		// The container would inherit the OOM score adjustment of the monitor process.
+		// #nosec
+		val, err := os.ReadFile("/proc/self/oom_score_adj")
+		if err != nil {
+			return fmt.Errorf("failed to read oom_score_adj: %w", err)
+		}
+		if err := c.setConfigItem("lxc.proc.oom_score_adj", strings.TrimSpace(string(val))); err != nil {
+			return err
+		}
+	}
+
+	// The CPU affinity is applied by lxcri-init, validate it here to fail early.
+	if _, err := cpuaffinity.FromSpec(c.Spec); err != nil {
+		return err
+	}
+
+	if val, ok := c.Spec.Annotations[mempolicy.Annotation]; ok {
+		// The policy is applied by lxcri-init, validate it here to fail early.
+		if _, err := mempolicy.Parse(val); err != nil {
+			return fmt.Errorf("invalid annotation %s: %w", mempolicy.Annotation, err)
+		}
+	}
+
+	if rt.Features.DefaultMaskedPaths {
+		configureDefaultMaskedPaths(c)
 	}
 
 	if c.Spec.Process.NoNewPrivileges {
@@ -109,17 +230,24 @@ func configureContainer(rt *Runtime, c *Container) error {
 	}
 
 	if rt.Features.Apparmor {
-		if err := configureApparmor(c); err != nil {
+		if err := configureApparmor(rt, c); err != nil {
 			return fmt.Errorf("failed to configure apparmor: %w", err)
 		}
 	} else {
 		rt.Log.Warn().Msg("apparmor feature is disabled - profile is set to unconfined")
 	}
 
+	if err := configureTimeSync(rt, c); err != nil {
+		return fmt.Errorf("failed to configure time synchronization: %w", err)
+	}
+
 	if rt.Features.Seccomp {
 		if c.Spec.Linux.Seccomp != nil && len(c.Spec.Linux.Seccomp.Syscalls) > 0 {
-			profilePath := c.RuntimePath("seccomp.conf")
-			if err := writeSeccompProfile(profilePath, c.Spec.Linux.Seccomp); err != nil {
+			profilePath := c.EphemeralPath("seccomp.conf")
+			if err := writeSeccompProfile(profilePath, c.Spec.Linux.Seccomp, rt.FileModes.PrivateFileMode); err != nil {
+				return err
+			}
+			if err := rt.chgrp(profilePath); err != nil {
 				return err
 			}
 			if err := c.setConfigItem("lxc.seccomp.profile", profilePath); err != nil {
@@ -130,6 +258,12 @@ func configureContainer(rt *Runtime, c *Container) error {
 		rt.Log.Warn().Msg("seccomp feature is disabled - all system calls are allowed")
 	}
 
+	if rt.Features.Keyring {
+		if err := configureKeyring(c); err != nil {
+			return fmt.Errorf("failed to configure keyring: %w", err)
+		}
+	}
+
 	if rt.Features.Capabilities {
 		if err := configureCapabilities(c); err != nil {
 			return fmt.Errorf("failed to configure capabilities: %w", err)
@@ -179,27 +313,44 @@ func configureContainer(rt *Runtime, c *Container) error {
 		}
 		c.Spec.Mounts = newMounts
 		c.Spec.Linux.Devices = nil
+	} else if isNamespaceEnabled(c.Spec, specs.UserNamespace) {
+		if err := configureUserNamespaceDevices(c); err != nil {
+			return err
+		}
 	}
 
 	if err := configureHooks(rt, c); err != nil {
 		return err
 	}
 
+	if err := checkConsoleMode(c); err != nil {
+		return err
+	}
+
+	if err := configureConsoleTTYs(c); err != nil {
+		return fmt.Errorf("failed to configure console ttys: %w", err)
+	}
+
+	if err := configureSerialConsole(c); err != nil {
+		return fmt.Errorf("failed to configure serial console: %w", err)
+	}
+
+	configureBlockDeviceMounts(c)
+
 	if err := configureCgroup(rt, c); err != nil {
 		return fmt.Errorf("failed to configure cgroups: %w", err)
 	}
 
-	for key, val := range c.Spec.Linux.Sysctl {
-		if err := c.setConfigItem("lxc.sysctl."+key, val); err != nil {
-			return err
-		}
+	if err := configureSysctls(rt, c); err != nil {
+		return fmt.Errorf("failed to configure sysctls: %w", err)
 	}
 
 	// `man lxc.container.conf`: "A resource with no explicitly configured limitation will be inherited
 	// from the process starting up the container"
+	applyDefaultRlimits(rt, c)
 	seenLimits := make([]string, 0, len(c.Spec.Process.Rlimits))
 	for _, limit := range c.Spec.Process.Rlimits {
-		name := strings.TrimPrefix(strings.ToLower(limit.Type), "rlimit_")
+		name := rlimitName(limit.Type)
 		for _, seen := range seenLimits {
 			if seen == name {
 				return fmt.Errorf("duplicate resource limit %q", limit.Type)
@@ -212,10 +363,36 @@ func configureContainer(rt *Runtime, c *Container) error {
 		}
 	}
 
+	if err := configureSecrets(c); err != nil {
+		return fmt.Errorf("failed to configure secrets: %w", err)
+	}
+
+	if err := configureVolumes(rt, c); err != nil {
+		return fmt.Errorf("failed to configure volumes: %w", err)
+	}
+
+	if err := configureSwap(rt, c); err != nil {
+		return fmt.Errorf("failed to configure swap: %w", err)
+	}
+
+	if err := configureDevpts(c); err != nil {
+		return fmt.Errorf("failed to configure devpts: %w", err)
+	}
+
 	if err := configureMounts(rt, c); err != nil {
 		return fmt.Errorf("failed to configure mounts: %w", err)
 	}
 
+	if err := configurePtmx(c); err != nil {
+		return fmt.Errorf("failed to configure /dev/ptmx: %w", err)
+	}
+
+	if rt.Features.ReadonlyProcSys {
+		if err := configureReadonlyProcSys(c); err != nil {
+			return fmt.Errorf("failed to configure read-only /proc/sys: %w", err)
+		}
+	}
+
 	if err := configureReadonlyPaths(c); err != nil {
 		return fmt.Errorf("failed to configure read-only paths: %w", err)
 	}
@@ -223,39 +400,60 @@ func configureContainer(rt *Runtime, c *Container) error {
 }
 
 func configureHostname(rt *Runtime, c *Container) error {
-	if c.Spec.Hostname == "" {
+	if c.Spec.Hostname == "" && c.Spec.Domainname == "" {
 		return nil
 	}
-	if err := c.setConfigItem("lxc.uts.name", c.Spec.Hostname); err != nil {
-		return err
-	}
-
-	// Check if UTS namespace is shared, but not with the host.
-	uts := getNamespace(c.Spec, specs.UTSNamespace)
-	if uts == nil {
-		return nil
+	// The domainname is set by the builtin hook (cmd/lxcri-hook-builtin)
+	// because liblxc does not support it.
+	if c.Spec.Hostname != "" {
+		if err := c.setConfigItem("lxc.uts.name", c.Spec.Hostname); err != nil {
+			return err
+		}
 	}
 
-	yes, err := isNamespaceSharedWithRuntime(uts)
+	nsPath, err := joinedUTSNamespace(c.Spec)
 	if err != nil {
 		return errorf("failed to check if uts namespace is shared with host: %w", err)
 	}
-	if yes {
+	if nsPath == "" {
+		return nil
+	}
+	if !c.SetSharedUTSName {
+		c.Log.Info().Str("ns", nsPath).Msg("hostname and domainname of joined uts namespace are not changed")
 		return nil
 	}
 
-	// Set the hostname on shared UTS namespace, since liblxc doesn't do it.
-	if err := setHostname(uts.Path, c.Spec.Hostname); err != nil {
-		return fmt.Errorf("failed  to set hostname: %w", err)
+	// Set the hostname and domainname on the joined UTS namespace, since liblxc doesn't do it.
+	if err := setUTSName(nsPath, c.Spec.Hostname, c.Spec.Domainname); err != nil {
+		return fmt.Errorf("failed to set hostname: %w", err)
 	}
 	return nil
 }
 
+// joinedUTSNamespace returns the path of the UTS namespace joined by the container.
+// An empty path is returned if the container creates a new UTS namespace
+// or if the UTS namespace is shared with the runtime.
+func joinedUTSNamespace(spec *specs.Spec) (string, error) {
+	uts := getNamespace(spec, specs.UTSNamespace)
+	if uts == nil || uts.Path == "" {
+		return "", nil
+	}
+	yes, err := isNamespaceSharedWithRuntime(uts)
+	if err != nil || yes {
+		return "", err
+	}
+	return uts.Path, nil
+}
+
 func configureRootfs(rt *Runtime, c *Container) error {
 	rootfs := c.Spec.Root.Path
 	if !filepath.IsAbs(rootfs) {
 		rootfs = filepath.Join(c.BundlePath, rootfs)
 	}
+	if err := checkNetworkRootfs(rt, c, rootfs); err != nil {
+		return err
+	}
+
 	if err := c.setConfigItem("lxc.rootfs.path", rootfs); err != nil {
 		return err
 	}
@@ -273,19 +471,89 @@ func configureRootfs(rt *Runtime, c *Container) error {
 		return err
 	}
 
-	rootfsOptions := []string{}
-	if c.Spec.Linux.RootfsPropagation != "" {
-		rootfsOptions = append(rootfsOptions, c.Spec.Linux.RootfsPropagation)
+	// The propagation is applied recursively to the rootfs mount
+	// by the builtin hook (cmd/lxcri-hook-builtin).
+	propagation, err := rootfsPropagation(c.Spec)
+	if err != nil {
+		return err
 	}
+	c.Spec.Linux.RootfsPropagation = propagation
+
+	rootfsOptions := []string{}
 	if c.Spec.Root.Readonly {
 		rootfsOptions = append(rootfsOptions, "ro")
 	}
+	if c.RootfsShift != RootfsShiftNone {
+		opt, err := rootfsShiftOption(rt, c)
+		if err != nil {
+			return err
+		}
+		rootfsOptions = append(rootfsOptions, opt)
+	}
 	if err := c.setConfigItem("lxc.rootfs.options", strings.Join(rootfsOptions, ",")); err != nil {
 		return err
 	}
 	return nil
 }
 
+// recursivePropagation maps the valid linux.rootfsPropagation values
+// to the recursive propagation type.
+var recursivePropagation = map[string]string{
+	"shared":      "rshared",
+	"rshared":     "rshared",
+	"slave":       "rslave",
+	"rslave":      "rslave",
+	"private":     "rprivate",
+	"rprivate":    "rprivate",
+	"unbindable":  "runbindable",
+	"runbindable": "runbindable",
+}
+
+// rootfsPropagation returns the recursive propagation type for the
+// spec linux.rootfsPropagation value, or an empty string if it is unset.
+// Like runc, the propagation type is applied to the rootfs mount and all submounts.
+// Mounts are never propagated back from a mount namespace owned by a user namespace
+// to the host (see mount_namespaces(7)), so shared propagation conflicts
+// with a user namespace.
+func rootfsPropagation(spec *specs.Spec) (string, error) {
+	val := spec.Linux.RootfsPropagation
+	if val == "" {
+		return "", nil
+	}
+	p, ok := recursivePropagation[val]
+	if !ok {
+		return "", fmt.Errorf("invalid rootfs propagation %q", val)
+	}
+	if p == "rshared" && isNamespaceEnabled(spec, specs.UserNamespace) {
+		return "", fmt.Errorf("rootfs propagation %q is not supported with a user namespace", val)
+	}
+	return p, nil
+}
+
+// lxcVersionAtLeast is replaced in tests to check the liblxc version requirements.
+var lxcVersionAtLeast = lxc.VersionAtLeast
+
+// rootfsShiftOption returns the lxc.rootfs.options value for the
+// configured ContainerConfig.RootfsShift.
+func rootfsShiftOption(rt *Runtime, c *Container) (string, error) {
+	switch c.RootfsShift {
+	case RootfsShiftIDMap:
+		if len(c.Spec.Linux.UIDMappings) == 0 || len(c.Spec.Linux.GIDMappings) == 0 {
+			return "", fmt.Errorf("rootfs shift %q requires uid and gid mappings", c.RootfsShift)
+		}
+		// idmapped mounts were introduced together with mount_setattr
+		if !rt.mountSetattr {
+			return "", fmt.Errorf("rootfs shift %q requires idmapped mounts (kernel >= 5.12)", c.RootfsShift)
+		}
+		if !lxcVersionAtLeast(5, 0, 0) {
+			return "", fmt.Errorf("rootfs shift %q requires liblxc >= 5.0.0 (was %s)", c.RootfsShift, lxc.Version())
+		}
+		return "idmap=container", nil
+	default:
+		return "", fmt.Errorf("unsupported rootfs shift %q", c.RootfsShift)
+	}
+}
+
 func configureReadonlyPaths(c *Container) error {
 	rootmnt := c.getConfigItem("lxc.rootfs.mount")
 	if rootmnt == "" {
@@ -300,15 +568,72 @@ func configureReadonlyPaths(c *Container) error {
 	return nil
 }
 
-func configureApparmor(c *Container) error {
+// configureDefaultMaskedPaths applies the default masked and read-only paths
+// if the spec defines neither of them. Paths defined by the spec are
+// never extended, because the defaults may break privileged containers.
+func configureDefaultMaskedPaths(c *Container) {
+	if len(c.Spec.Linux.MaskedPaths) > 0 || len(c.Spec.Linux.ReadonlyPaths) > 0 {
+		return
+	}
+	c.Log.Info().Msg("spec has no masked and read-only paths - using defaults")
+	c.Spec.Linux.MaskedPaths = append([]string{}, specki.DefaultMaskedPaths...)
+	c.Spec.Linux.ReadonlyPaths = append([]string{}, specki.DefaultReadonlyPaths...)
+}
+
+func configureApparmor(rt *Runtime, c *Container) error {
 	// The value *apparmor_profile*  from crio.conf is used if no profile is defined by the container.
 	aaprofile := c.Spec.Process.ApparmorProfile
 	if aaprofile == "" {
 		aaprofile = "unconfined"
 	}
+	if err := rt.loadApparmorProfile(aaprofile); err != nil {
+		return err
+	}
+	if rt.Features.ApparmorProtectRuntime {
+		var err error
+		aaprofile, err = apparmorProtectRuntime(rt, c, aaprofile)
+		if err != nil {
+			return fmt.Errorf("failed to protect runtime directories: %w", err)
+		}
+	}
 	return c.setConfigItem("lxc.apparmor.profile", aaprofile)
 }
 
+// apparmorDenyRules returns the apparmor rules that deny access to
+// the runtime directories from within the container.
+func apparmorDenyRules(rt *Runtime) []string {
+	dirs := []string{rt.Root, rt.LibexecDir}
+	if rt.EphemeralRoot != "" {
+		dirs = append(dirs, rt.EphemeralRoot)
+	}
+	rules := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		rules = append(rules, fmt.Sprintf("deny %s/{,**} rwlkmx,", filepath.Clean(dir)))
+	}
+	return rules
+}
+
+// configureKeyring creates a new session keyring for the container init process,
+// so the kernel keyring is not shared with other containers.
+// /proc/keys is masked because it lists all keys the caller has access to.
+// If liblxc does not support lxc.keyring.session only /proc/keys is masked.
+func configureKeyring(c *Container) error {
+	if c.supportsConfigItem("lxc.keyring.session") {
+		if err := c.setConfigItem("lxc.keyring.session", "1"); err != nil {
+			return err
+		}
+	} else {
+		c.Log.Warn().Msg("lxc.keyring.session is not supported by liblxc - the session keyring is not configured")
+	}
+	for _, p := range c.Spec.Linux.MaskedPaths {
+		if p == "/proc/keys" {
+			return nil
+		}
+	}
+	c.Spec.Linux.MaskedPaths = append(c.Spec.Linux.MaskedPaths, "/proc/keys")
+	return nil
+}
+
 // configureCapabilities configures the linux capabilities / privileges granted to the container processes.
 // See `man lxc.container.conf` lxc.cap.drop and lxc.cap.keep for details.
 // https://blog.container-solutions.com/linux-capabilities-in-practice
@@ -363,12 +688,18 @@ func configureHooks(rt *Runtime, c *Container) error {
 		return err
 	}
 
-	if len(c.Spec.Hooks.Prestart) > 0 || len(c.Spec.Hooks.CreateRuntime) > 0 {
+	postMount := c.CreateRuntimeHooksPostMount && len(c.Spec.Hooks.CreateRuntime) > 0
+	if len(c.Spec.Hooks.Prestart) > 0 || (len(c.Spec.Hooks.CreateRuntime) > 0 && !postMount) {
 		if err := c.setConfigItem("lxc.hook.pre-mount", rt.libexec(ExecHook)); err != nil {
 			return err
 		}
 	}
-	if len(c.Spec.Hooks.CreateContainer) > 0 {
+	if postMount {
+		// liblxc appends the hook arguments to the hook command.
+		if err := c.setConfigItem("lxc.hook.mount", rt.libexec(ExecHook)+" -create-runtime-post-mount"); err != nil {
+			return err
+		}
+	} else if len(c.Spec.Hooks.CreateContainer) > 0 {
 		if err := c.setConfigItem("lxc.hook.mount", rt.libexec(ExecHook)); err != nil {
 			return err
 		}
@@ -381,6 +712,24 @@ func configureHooks(rt *Runtime, c *Container) error {
 	return nil
 }
 
+// expandEnv replaces the template variables in the values of spec.Process.Env.
+// See ContainerConfig.ExpandEnv
+func expandEnv(c *Container) {
+	r := strings.NewReplacer(
+		"${container_id}", c.ContainerID,
+		"${runtime_dir}", c.RuntimePath(),
+		"${bundle}", c.BundlePath,
+		"${hostname}", c.Spec.Hostname,
+	)
+	for i, kv := range c.Spec.Process.Env {
+		vals := strings.SplitN(kv, "=", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		c.Spec.Process.Env[i] = vals[0] + "=" + r.Replace(vals[1])
+	}
+}
+
 // cleanenv removes duplicates from spec.Process.Env.
 // If overwrite is false the first defined value takes precedence,
 // if overwrite is true, the last defined value overwrites previously
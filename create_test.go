@@ -0,0 +1,108 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureDefaultMaskedPaths(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{Linux: &specs.Linux{}},
+		Log:  zerolog.Nop(),
+	}}
+	configureDefaultMaskedPaths(c)
+	require.Equal(t, specki.DefaultMaskedPaths, c.Spec.Linux.MaskedPaths)
+	require.Equal(t, specki.DefaultReadonlyPaths, c.Spec.Linux.ReadonlyPaths)
+
+	// paths defined by the spec are kept
+	c.Spec.Linux = &specs.Linux{ReadonlyPaths: []string{"/proc/bus"}}
+	configureDefaultMaskedPaths(c)
+	require.Empty(t, c.Spec.Linux.MaskedPaths)
+	require.Equal(t, []string{"/proc/bus"}, c.Spec.Linux.ReadonlyPaths)
+}
+
+func TestRootfsPropagation(t *testing.T) {
+	spec := &specs.Spec{Linux: &specs.Linux{}}
+	p, err := rootfsPropagation(spec)
+	require.NoError(t, err)
+	require.Equal(t, "", p)
+
+	for val, expected := range map[string]string{
+		"shared": "rshared", "rshared": "rshared",
+		"slave": "rslave", "rslave": "rslave",
+		"private": "rprivate", "rprivate": "rprivate",
+		"unbindable": "runbindable", "runbindable": "runbindable",
+	} {
+		spec.Linux.RootfsPropagation = val
+		p, err := rootfsPropagation(spec)
+		require.NoError(t, err)
+		require.Equal(t, expected, p)
+	}
+
+	spec.Linux.RootfsPropagation = "invalid"
+	_, err = rootfsPropagation(spec)
+	require.Error(t, err)
+
+	// shared propagation conflicts with a user namespace
+	spec.Linux.Namespaces = []specs.LinuxNamespace{{Type: specs.UserNamespace}}
+	spec.Linux.RootfsPropagation = "shared"
+	_, err = rootfsPropagation(spec)
+	require.Error(t, err)
+
+	spec.Linux.RootfsPropagation = "rslave"
+	p, err = rootfsPropagation(spec)
+	require.NoError(t, err)
+	require.Equal(t, "rslave", p)
+}
+
+func TestRootfsShiftOption(t *testing.T) {
+	defer func(fn func(int, int, int) bool) { lxcVersionAtLeast = fn }(lxcVersionAtLeast)
+
+	mapping := []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}}
+	cases := []struct {
+		name         string
+		shift        string
+		uidMappings  []specs.LinuxIDMapping
+		gidMappings  []specs.LinuxIDMapping
+		mountSetattr bool
+		lxc5         bool
+		option       string
+		err          string
+	}{
+		{"idmap", RootfsShiftIDMap, mapping, mapping, true, true, "idmap=container", ""},
+		{"no uid mapping", RootfsShiftIDMap, nil, mapping, true, true, "", "requires uid and gid mappings"},
+		{"no gid mapping", RootfsShiftIDMap, mapping, nil, true, true, "", "requires uid and gid mappings"},
+		{"kernel without idmapped mounts", RootfsShiftIDMap, mapping, mapping, false, true, "", "requires idmapped mounts"},
+		{"liblxc older than 5.0.0", RootfsShiftIDMap, mapping, mapping, true, false, "", "requires liblxc >= 5.0.0"},
+		{"unsupported", "shiftfs", mapping, mapping, true, true, "", "unsupported rootfs shift"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lxc5 := tc.lxc5
+			lxcVersionAtLeast = func(major, minor, micro int) bool {
+				require.Equal(t, []int{5, 0, 0}, []int{major, minor, micro})
+				return lxc5
+			}
+			rt := &Runtime{mountSetattr: tc.mountSetattr}
+			c := &Container{ContainerConfig: &ContainerConfig{
+				Spec: &specs.Spec{Linux: &specs.Linux{
+					UIDMappings: tc.uidMappings,
+					GIDMappings: tc.gidMappings,
+				}},
+				RootfsShift: tc.shift,
+			}}
+			opt, err := rootfsShiftOption(rt, c)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.option, opt)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SkippedLimit is a resource limit of the container spec that is not applied,
+// because the cgroup controller is not delegated to the runtime user.
+type SkippedLimit struct {
+	// File is the cgroup2 interface file of the limit, e.g memory.max
+	File string
+	// Controller is the cgroup controller that is not delegated, e.g memory
+	Controller string
+	// Value is the requested value.
+	Value string
+}
+
+func (l SkippedLimit) String() string {
+	return fmt.Sprintf("%s=%s (controller %s)", l.File, l.Value, l.Controller)
+}
+
+// checkCgroupDelegation compares the resource limits of the spec with the
+// controllers that are delegated to the runtime user. Limits of controllers
+// that are not available are recorded in ContainerConfig.SkippedLimits,
+// or an error is returned if Runtime.RequireResourceLimits is set.
+func checkCgroupDelegation(rt *Runtime, c *Container) error {
+	if c.Spec.Linux.Resources == nil || c.CgroupDir == "" {
+		return nil
+	}
+	items, err := cgroupResourceItems(c.Spec.Linux.Resources)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	controllers, err := delegatedControllers(c.sysFS(), c.CgroupDir)
+	if err != nil {
+		return fmt.Errorf("failed to detect delegated cgroup controllers: %w", err)
+	}
+
+	var skipped []string
+	for _, item := range items {
+		controller := strings.SplitN(item.name, ".", 2)[0]
+		if controllers[controller] {
+			continue
+		}
+		l := SkippedLimit{File: item.name, Controller: controller, Value: item.value}
+		c.SkippedLimits = append(c.SkippedLimits, l)
+		skipped = append(skipped, l.String())
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+	if rt.RequireResourceLimits {
+		return fmt.Errorf("resource limits can not be enforced without cgroup delegation: %s", strings.Join(skipped, ", "))
+	}
+	c.Log.Warn().Strs("limits", skipped).Msg("cgroup controllers are not delegated - skipping resource limits")
+	return nil
+}
+
+// isSkippedLimit returns true if the limit for the cgroup2 interface file
+// is in ContainerConfig.SkippedLimits.
+func (c *Container) isSkippedLimit(file string) bool {
+	for _, l := range c.SkippedLimits {
+		if l.File == file {
+			return true
+		}
+	}
+	return false
+}
+
+// delegatedControllers returns the controllers that are available
+// in the cgroup dir. If the cgroup does not exist yet, the controllers
+// of the closest existing parent cgroup are returned.
+func delegatedControllers(fs FS, dir string) (map[string]bool, error) {
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		data, err := fs.ReadFile(filepath.Join(cgroupRoot, dir, "cgroup.controllers"))
+		if os.IsNotExist(err) && dir != "." && dir != "/" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		controllers := make(map[string]bool)
+		for _, name := range strings.Fields(string(data)) {
+			controllers[name] = true
+		}
+		return controllers, nil
+	}
+}
@@ -0,0 +1,57 @@
+package lxcri
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegatedControllers(t *testing.T) {
+	mfs := &memFS{files: map[string][]byte{
+		filepath.Join(cgroupRoot, "cgroup.controllers"):        []byte("cpu memory pids\n"),
+		filepath.Join(cgroupRoot, "pod", "cgroup.controllers"): []byte("memory pids\n"),
+	}}
+	controllers, err := delegatedControllers(mfs, "pod/ctr")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"memory": true, "pids": true}, controllers)
+
+	controllers, err = delegatedControllers(mfs, "other/ctr")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"cpu": true, "memory": true, "pids": true}, controllers)
+}
+
+func TestCheckCgroupDelegation(t *testing.T) {
+	mfs := &memFS{files: map[string][]byte{
+		filepath.Join(cgroupRoot, "cgroup.controllers"): []byte("pids\n"),
+	}}
+	limit := int64(1 << 20)
+	newContainer := func() *Container {
+		return &Container{
+			ContainerConfig: &ContainerConfig{
+				CgroupDir: "ctr",
+				Log:       zerolog.Nop(),
+				Spec: &specs.Spec{Linux: &specs.Linux{Resources: &specs.LinuxResources{
+					Memory: &specs.LinuxMemory{Limit: &limit},
+					Pids:   &specs.LinuxPids{Limit: 100},
+				}}},
+			},
+			fs: mfs,
+		}
+	}
+
+	rt := &Runtime{}
+	c := newContainer()
+	require.NoError(t, checkCgroupDelegation(rt, c))
+	require.Equal(t, []SkippedLimit{{File: "memory.max", Controller: "memory", Value: "1048576"}}, c.SkippedLimits)
+	require.True(t, c.isSkippedLimit("memory.max"))
+	require.False(t, c.isSkippedLimit("pids.max"))
+
+	rt.RequireResourceLimits = true
+	c = newContainer()
+	err := checkCgroupDelegation(rt, c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "memory.max=1048576")
+}
@@ -0,0 +1,140 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// configureUserNamespaceDevices prepares the devices of a container
+// with a user namespace. The device nodes can not be created with mknod
+// within a user namespace, so lxcri-hook-builtin bind mounts the host
+// device (at the same path) instead. This checks that the host device matches
+// the device from the spec and allows access to the host device in the
+// device cgroup, since the device rules must permit the bind mounted device.
+func configureUserNamespaceDevices(c *Container) error {
+	for _, dev := range c.Spec.Linux.Devices {
+		if dev.Type != "b" && dev.Type != "c" {
+			continue
+		}
+		if err := checkHostDevice(dev); err != nil {
+			return fmt.Errorf("device %s can not be bind mounted: %w", dev.Path, err)
+		}
+		if !isDeviceAllowed(c.Spec.Linux.Resources.Devices, dev) {
+			c.Log.Debug().Str("device", dev.Path).Msg("allow access to bind mounted device")
+			major, minor := dev.Major, dev.Minor
+			c.Spec.Linux.Resources.Devices = append(c.Spec.Linux.Resources.Devices,
+				specs.LinuxDeviceCgroup{Allow: true, Type: dev.Type, Major: &major, Minor: &minor, Access: "rwm"},
+			)
+		}
+	}
+	return nil
+}
+
+// configureBlockDeviceMounts allows access to block devices that are
+// bind mounted into the container (e.g a Kubernetes volume with volumeMode: Block).
+// The bind mount creates the device node in the container, but access
+// to the device must be permitted by the device cgroup and the
+// mount must not have the nodev option.
+func configureBlockDeviceMounts(c *Container) {
+	for i, ms := range c.Spec.Mounts {
+		if !isBindMount(ms) {
+			continue
+		}
+		// The source is not a device if hostDevice fails.
+		dev, err := hostDevice(ms.Source)
+		if err != nil || dev.Type != "b" {
+			continue
+		}
+		if specki.HasMountOption(ms.Options, "nodev") {
+			c.Spec.Mounts[i].Options = removeOption(ms.Options, "nodev")
+		}
+		if c.Spec.Linux.Resources == nil {
+			c.Spec.Linux.Resources = &specs.LinuxResources{}
+		}
+		if isDeviceAllowed(c.Spec.Linux.Resources.Devices, dev) {
+			continue
+		}
+		access := "rw"
+		if specki.HasMountOption(ms.Options, "ro") {
+			access = "r"
+		}
+		c.Log.Debug().Str("device", ms.Source).Str("access", access).Msg("allow access to bind mounted block device")
+		major, minor := dev.Major, dev.Minor
+		c.Spec.Linux.Resources.Devices = append(c.Spec.Linux.Resources.Devices,
+			specs.LinuxDeviceCgroup{Allow: true, Type: dev.Type, Major: &major, Minor: &minor, Access: access},
+		)
+	}
+}
+
+func removeOption(opts []string, opt string) []string {
+	filtered := make([]string, 0, len(opts))
+	for _, o := range opts {
+		if o != opt {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// checkHostDevice checks that the host device at dev.Path
+// has the same type and device number as dev.
+func checkHostDevice(dev specs.LinuxDevice) error {
+	host, err := hostDevice(dev.Path)
+	if err != nil {
+		return err
+	}
+	if host.Type != dev.Type {
+		return fmt.Errorf("host device type mismatch (expected %s but was %s)", dev.Type, host.Type)
+	}
+	if host.Major != dev.Major || host.Minor != dev.Minor {
+		return fmt.Errorf("host device number mismatch (expected %d:%d but was %d:%d)", dev.Major, dev.Minor, host.Major, host.Minor)
+	}
+	return nil
+}
+
+// hostDevice returns the host device at path p.
+func hostDevice(p string) (specs.LinuxDevice, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(p, &stat); err != nil {
+		return specs.LinuxDevice{}, &os.PathError{Op: "stat", Path: p, Err: err}
+	}
+	dev := specs.LinuxDevice{
+		Path:  p,
+		Major: int64(unix.Major(uint64(stat.Rdev))),
+		Minor: int64(unix.Minor(uint64(stat.Rdev))),
+	}
+	switch stat.Mode & unix.S_IFMT {
+	case unix.S_IFCHR:
+		dev.Type = "c"
+	case unix.S_IFBLK:
+		dev.Type = "b"
+	default:
+		return dev, fmt.Errorf("%s is not a device", p)
+	}
+	mode := os.FileMode(stat.Mode & 0777)
+	dev.FileMode = &mode
+	return dev, nil
+}
+
+// isDeviceAllowed returns true if the last device cgroup rule
+// that matches the device allows access (rules are evaluated in order).
+func isDeviceAllowed(rules []specs.LinuxDeviceCgroup, dev specs.LinuxDevice) bool {
+	allowed := false
+	for _, r := range rules {
+		if r.Type != "" && r.Type != "a" && r.Type != dev.Type {
+			continue
+		}
+		if r.Major != nil && *r.Major != dev.Major {
+			continue
+		}
+		if r.Minor != nil && *r.Minor != dev.Minor {
+			continue
+		}
+		allowed = r.Allow
+	}
+	return allowed
+}
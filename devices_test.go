@@ -0,0 +1,74 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHostDevice(t *testing.T) {
+	require.NoError(t, checkHostDevice(specs.LinuxDevice{Path: "/dev/null", Type: "c", Major: 1, Minor: 3}))
+	require.Error(t, checkHostDevice(specs.LinuxDevice{Path: "/dev/null", Type: "c", Major: 1, Minor: 5}))
+	require.Error(t, checkHostDevice(specs.LinuxDevice{Path: "/dev/null", Type: "b", Major: 1, Minor: 3}))
+	require.Error(t, checkHostDevice(specs.LinuxDevice{Path: "/dev/nonexistent", Type: "c", Major: 1, Minor: 3}))
+}
+
+func TestIsDeviceAllowed(t *testing.T) {
+	major, minor := int64(1), int64(3)
+	dev := specs.LinuxDevice{Path: "/dev/null", Type: "c", Major: major, Minor: minor}
+	require.False(t, isDeviceAllowed(nil, dev))
+
+	rules := []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}}
+	require.False(t, isDeviceAllowed(rules, dev))
+
+	rules = append(rules, specs.LinuxDeviceCgroup{Allow: true, Type: "c", Major: &major, Access: "rwm"})
+	require.True(t, isDeviceAllowed(rules, dev))
+
+	rules = append(rules, specs.LinuxDeviceCgroup{Allow: false, Type: "b", Access: "rwm"})
+	require.True(t, isDeviceAllowed(rules, dev))
+
+	rules = append(rules, specs.LinuxDeviceCgroup{Allow: false, Type: "c", Minor: &minor, Access: "rwm"})
+	require.False(t, isDeviceAllowed(rules, dev))
+}
+
+func TestConfigureBlockDeviceMounts(t *testing.T) {
+	var blockDev string
+	entries, _ := os.ReadDir("/dev")
+	for _, e := range entries {
+		if e.Type()&os.ModeDevice != 0 && e.Type()&os.ModeCharDevice == 0 {
+			blockDev = filepath.Join("/dev", e.Name())
+			break
+		}
+	}
+	if blockDev == "" {
+		t.Skip("no block device available")
+	}
+
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{
+			Linux: &specs.Linux{},
+			Mounts: []specs.Mount{
+				{Source: blockDev, Destination: "/dev/xvda", Type: "bind", Options: []string{"bind", "nodev", "ro"}},
+				{Source: "/dev/null", Destination: "/dev/null", Type: "bind", Options: []string{"bind", "nodev"}},
+			},
+		},
+		Log: zerolog.Nop(),
+	}}
+	configureBlockDeviceMounts(c)
+	require.Equal(t, []string{"bind", "ro"}, c.Spec.Mounts[0].Options)
+	require.Equal(t, []string{"bind", "nodev"}, c.Spec.Mounts[1].Options)
+	require.Len(t, c.Spec.Linux.Resources.Devices, 1)
+	require.Equal(t, "r", c.Spec.Linux.Resources.Devices[0].Access)
+
+	dev, err := hostDevice(blockDev)
+	require.NoError(t, err)
+	require.True(t, isDeviceAllowed(c.Spec.Linux.Resources.Devices, dev))
+
+	// an allowed device is not added again
+	configureBlockDeviceMounts(c)
+	require.Len(t, c.Spec.Linux.Resources.Devices, 1)
+}
@@ -0,0 +1,156 @@
+package lxcri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Annotations to configure the devpts mount of a container.
+// Annotation values override the values from ContainerConfig.Devpts.
+const (
+	// DevptsMaxAnnotation is the maximum number of ptys (devpts option max).
+	DevptsMaxAnnotation = "org.linuxcontainers.lxcri.DevptsMax"
+	// DevptsPtmxModeAnnotation is the octal file mode of ptmx (devpts option ptmxmode).
+	DevptsPtmxModeAnnotation = "org.linuxcontainers.lxcri.DevptsPtmxMode"
+	// DevptsGIDAnnotation is the group ID of new ptys (devpts option gid) e.g the `tty` group.
+	DevptsGIDAnnotation = "org.linuxcontainers.lxcri.DevptsGID"
+)
+
+// DevptsOptions are the mount options of the new devpts instance
+// mounted at /dev/pts. Zero values keep the options of the spec mount.
+type DevptsOptions struct {
+	// Max is the maximum number of ptys.
+	Max int `json:",omitempty"`
+	// PtmxMode is the file mode of /dev/pts/ptmx.
+	PtmxMode uint32 `json:",omitempty"`
+	// GID is the group ID of new ptys. The group ID must be mapped
+	// into the user namespace of the container.
+	GID *uint32 `json:",omitempty"`
+}
+
+// devptsOptions returns the devpts options from ContainerConfig.Devpts
+// merged with the devpts annotations.
+func (c *Container) devptsOptions() (*DevptsOptions, error) {
+	opts := DevptsOptions{}
+	if c.Devpts != nil {
+		opts = *c.Devpts
+	}
+	if val, ok := c.Spec.Annotations[DevptsMaxAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid annotation %s: %q", DevptsMaxAnnotation, val)
+		}
+		opts.Max = n
+	}
+	if val, ok := c.Spec.Annotations[DevptsPtmxModeAnnotation]; ok {
+		n, err := strconv.ParseUint(val, 8, 32)
+		if err != nil || n > 0777 {
+			return nil, fmt.Errorf("invalid annotation %s: %q", DevptsPtmxModeAnnotation, val)
+		}
+		opts.PtmxMode = uint32(n)
+	}
+	if val, ok := c.Spec.Annotations[DevptsGIDAnnotation]; ok {
+		n, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %q", DevptsGIDAnnotation, val)
+		}
+		gid := uint32(n)
+		opts.GID = &gid
+	}
+	return &opts, nil
+}
+
+// configureDevpts sets the options of the devpts mount at /dev/pts.
+// The devpts filesystem is always mounted as new instance, so the
+// ptys are not shared with the host (or other containers).
+func configureDevpts(c *Container) error {
+	opts, err := c.devptsOptions()
+	if err != nil {
+		return err
+	}
+	for i := range c.Spec.Mounts {
+		m := &c.Spec.Mounts[i]
+		if m.Type != "devpts" || filepath.Clean("/"+m.Destination) != "/dev/pts" {
+			continue
+		}
+		m.Options = setMountOption(m.Options, "newinstance", "")
+		// The kernel default ptmxmode is 0000,
+		// which makes ptmx inaccessible for unprivileged users.
+		if !hasMountOptionKey(m.Options, "ptmxmode") {
+			m.Options = setMountOption(m.Options, "ptmxmode", "0666")
+		}
+		if opts.Max > 0 {
+			m.Options = setMountOption(m.Options, "max", strconv.Itoa(opts.Max))
+		}
+		if opts.PtmxMode != 0 {
+			m.Options = setMountOption(m.Options, "ptmxmode", fmt.Sprintf("%04o", opts.PtmxMode))
+		}
+		if opts.GID != nil {
+			m.Options = setMountOption(m.Options, "gid", strconv.FormatUint(uint64(*opts.GID), 10))
+		}
+		m.Options = checkDevptsGID(c, m.Options)
+	}
+	return nil
+}
+
+// configurePtmx bind mounts /dev/pts/ptmx to /dev/ptmx,
+// if /dev/pts is a devpts mount and /dev/ptmx is not defined by the spec.
+// The runtime spec allows a bind mount or a symlink. A bind mount is used
+// (like liblxc does), because the bind mount target can be created by liblxc,
+// and the /dev/ptmx device node (if any) in the rootfs is replaced.
+// This must be called after configureMounts, because the entry
+// must be mounted after the devpts filesystem.
+func configurePtmx(c *Container) error {
+	hasDevpts := false
+	for _, m := range c.Spec.Mounts {
+		dst := filepath.Clean("/" + m.Destination)
+		if dst == "/dev/ptmx" {
+			return nil
+		}
+		if m.Type == "devpts" && dst == "/dev/pts" {
+			hasDevpts = true
+		}
+	}
+	for _, dev := range c.Spec.Linux.Devices {
+		if dev.Path == "/dev/ptmx" {
+			return nil
+		}
+	}
+	if !hasDevpts {
+		return nil
+	}
+
+	rootmnt := c.getConfigItem("lxc.rootfs.mount")
+	if rootmnt == "" {
+		return fmt.Errorf("lxc.rootfs.mount unavailable")
+	}
+	mnt := fmt.Sprintf("%s %s %s %s", filepath.Join(rootmnt, "/dev/pts/ptmx"), "dev/ptmx", "bind", "bind,create=file")
+	return c.setConfigItem("lxc.mount.entry", mnt)
+}
+
+// setMountOption sets the mount option key to the given value.
+// An option without value is added if val is empty.
+func setMountOption(opts []string, key string, val string) []string {
+	opt := key
+	if val != "" {
+		opt = key + "=" + val
+	}
+	for i, o := range opts {
+		if o == key || strings.HasPrefix(o, key+"=") {
+			opts[i] = opt
+			return opts
+		}
+	}
+	return append(opts, opt)
+}
+
+func hasMountOptionKey(opts []string, key string) bool {
+	for _, o := range opts {
+		if o == key || strings.HasPrefix(o, key+"=") {
+			return true
+		}
+	}
+	return false
+}
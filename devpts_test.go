@@ -0,0 +1,52 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureDevpts(t *testing.T) {
+	gid := uint32(5)
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Devpts: &DevptsOptions{Max: 1024, GID: &gid},
+		Spec: &specs.Spec{
+			Annotations: map[string]string{DevptsMaxAnnotation: "16"},
+			Mounts: []specs.Mount{
+				{Destination: "/dev/pts", Type: "devpts", Source: "devpts",
+					Options: []string{"nosuid", "noexec", "mode=0620", "gid=100"},
+				},
+			},
+		},
+	}}
+	require.NoError(t, configureDevpts(c))
+	require.Equal(t, []string{"nosuid", "noexec", "mode=0620", "gid=5", "newinstance", "ptmxmode=0666", "max=16"}, c.Spec.Mounts[0].Options)
+
+	c.Spec.Annotations[DevptsPtmxModeAnnotation] = "0600"
+	require.NoError(t, configureDevpts(c))
+	require.Equal(t, []string{"nosuid", "noexec", "mode=0620", "gid=5", "newinstance", "ptmxmode=0600", "max=16"}, c.Spec.Mounts[0].Options)
+
+	c.Spec.Annotations[DevptsPtmxModeAnnotation] = "0999"
+	require.Error(t, configureDevpts(c))
+}
+
+func TestCheckDevptsGID(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Log: zerolog.Nop(),
+		Spec: &specs.Spec{
+			Linux: &specs.Linux{
+				Namespaces:  []specs.LinuxNamespace{{Type: specs.UserNamespace}},
+				GIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 5}},
+			},
+		},
+	}}
+	// gid 5 is not mapped
+	require.Equal(t, []string{"newinstance"}, checkDevptsGID(c, []string{"newinstance", "gid=5"}))
+	require.Equal(t, []string{"newinstance"}, checkDevptsGID(c, []string{"newinstance"}))
+	require.Equal(t, []string{"gid=4"}, checkDevptsGID(c, []string{"gid=4"}))
+
+	c.Spec.Linux.GIDMappings[0].Size = 65536
+	require.Equal(t, []string{"newinstance", "gid=5"}, checkDevptsGID(c, []string{"newinstance"}))
+}
@@ -0,0 +1,117 @@
+package lxcri
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Usage is the disk usage of a directory tree.
+type Usage struct {
+	// Bytes is the allocated disk space.
+	Bytes uint64
+	// Inodes is the number of inodes.
+	Inodes uint64
+}
+
+func (u *Usage) add(o Usage) {
+	u.Bytes += o.Bytes
+	u.Inodes += o.Inodes
+}
+
+// DiskUsage is the disk usage of the runtime managed container storage.
+// The container rootfs (e.g the writable overlay layer) is managed by the
+// caller (e.g containers/storage for cri-o) and is not accounted.
+type DiskUsage struct {
+	// Total is the sum of all other fields.
+	Total Usage
+	// RuntimeDir is the usage of the container runtime directory
+	// (and the ephemeral directory if Runtime.EphemeralRoot is set).
+	RuntimeDir Usage
+	// Volumes is the usage of the anonymous volumes (see ContainerConfig.Volumes).
+	Volumes Usage
+	// Swap is the usage of the swap file (see ContainerConfig.SwapSize).
+	Swap Usage
+}
+
+// DiskUsage returns the disk usage of the runtime managed storage of the container.
+func (rt *Runtime) DiskUsage(c *Container) (*DiskUsage, error) {
+	du := &DiskUsage{}
+	var err error
+	if du.RuntimeDir, err = dirUsage(c.RuntimePath()); err != nil {
+		return nil, errorf("failed to calculate runtime dir usage: %w", err)
+	}
+	if c.EphemeralPath() != c.RuntimePath() {
+		u, err := dirUsage(c.EphemeralPath())
+		if err != nil {
+			return nil, errorf("failed to calculate ephemeral dir usage: %w", err)
+		}
+		du.RuntimeDir.add(u)
+	}
+	if du.Volumes, err = dirUsage(rt.volumesDir(c.ContainerID)); err != nil {
+		return nil, errorf("failed to calculate volumes usage: %w", err)
+	}
+	if rt.SwapDir != "" {
+		if du.Swap, err = dirUsage(rt.swapFile(c.ContainerID)); err != nil {
+			return nil, errorf("failed to calculate swap file usage: %w", err)
+		}
+	}
+	du.Total.add(du.RuntimeDir)
+	du.Total.add(du.Volumes)
+	du.Total.add(du.Swap)
+	return du, nil
+}
+
+// dirUsage returns the disk usage of the file tree at root.
+// Hard linked files are counted once, and mount points
+// of other filesystems are not descended into.
+// A root that does not exist has no usage.
+func dirUsage(root string) (Usage, error) {
+	var u Usage
+	var rootStat unix.Stat_t
+	err := unix.Lstat(root, &rootStat)
+	if err == unix.ENOENT {
+		return u, nil
+	}
+	if err != nil {
+		return u, err
+	}
+
+	type inode struct{ dev, ino uint64 }
+	seen := make(map[inode]bool)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		// Files may be removed while the tree is walked.
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var st unix.Stat_t
+		err = unix.Lstat(p, &st)
+		if err == unix.ENOENT {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if st.Dev != rootStat.Dev {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		key := inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+		if st.Nlink > 1 && seen[key] {
+			return nil
+		}
+		seen[key] = true
+		u.Inodes++
+		// Blocks is the number of allocated 512 byte blocks.
+		u.Bytes += uint64(st.Blocks) * 512
+		return nil
+	})
+	return u, err
+}
@@ -0,0 +1,46 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirUsage(t *testing.T) {
+	dir := t.TempDir()
+	u, err := dirUsage(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	require.Equal(t, Usage{}, u)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "data"), make([]byte, 64*1024), 0644))
+	// hard links are counted once
+	require.NoError(t, os.Link(filepath.Join(dir, "sub", "data"), filepath.Join(dir, "link")))
+
+	u, err = dirUsage(dir)
+	require.NoError(t, err)
+	// root, sub and data
+	require.Equal(t, uint64(3), u.Inodes)
+	require.GreaterOrEqual(t, u.Bytes, uint64(64*1024))
+}
+
+func TestRuntimeDiskUsage(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1", Log: zerolog.Nop()}}
+	c.runtimeDir = rt.runtimeDir(c.ContainerID)
+	c.ephemeralDir = rt.ephemeralDir(c.ContainerID)
+	require.NoError(t, os.MkdirAll(c.runtimeDir, 0755))
+	require.NoError(t, os.WriteFile(c.RuntimePath("config"), []byte("lxc.uts.name = c1\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(rt.volumesDir(c.ContainerID), "0-data"), 0755))
+
+	du, err := rt.DiskUsage(c)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), du.RuntimeDir.Inodes)
+	require.Equal(t, uint64(2), du.Volumes.Inodes)
+	require.Equal(t, Usage{}, du.Swap)
+	require.Equal(t, uint64(4), du.Total.Inodes)
+	require.Equal(t, du.RuntimeDir.Bytes+du.Volumes.Bytes, du.Total.Bytes)
+}
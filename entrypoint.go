@@ -0,0 +1,224 @@
+package lxcri
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxSymlinks is the maximum number of symlinks followed
+	// when a path is resolved within the rootfs.
+	maxSymlinks = 40
+	// maxInterpreterDepth is the maximum number of nested script interpreters.
+	maxInterpreterDepth = 4
+)
+
+// elfMachines are the ELF machine types that can be executed on the runtime architecture.
+var elfMachines = map[string][]elf.Machine{
+	"386":     {elf.EM_386},
+	"amd64":   {elf.EM_X86_64, elf.EM_386},
+	"arm":     {elf.EM_ARM},
+	"arm64":   {elf.EM_AARCH64, elf.EM_ARM},
+	"ppc64le": {elf.EM_PPC64},
+	"riscv64": {elf.EM_RISCV},
+	"s390x":   {elf.EM_S390},
+}
+
+// validateEntrypoint checks that the container process executable exists
+// within the rootfs and that it can be executed, to return a meaningful error
+// on create instead of a failure when the container is started.
+// Executables that are located on a mount (e.g a volume) are not validated.
+func validateEntrypoint(spec *specs.Spec) error {
+	rootfs := spec.Root.Path
+	cmd := spec.Process.Args[0]
+
+	candidates := []string{cmd}
+	if !strings.Contains(cmd, "/") {
+		// Lookup the command like the init process does.
+		if val, ok := specki.Getenv(spec.Process.Env, "PATH"); ok {
+			candidates = candidates[:0]
+			for _, dir := range filepath.SplitList(val) {
+				candidates = append(candidates, filepath.Join(dir, cmd))
+			}
+		}
+	}
+
+	for _, p := range candidates {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(spec.Process.Cwd, p)
+		}
+		if isMountedPath(spec.Mounts, p) {
+			return nil
+		}
+		hostPath, err := resolveInRootfs(rootfs, p)
+		if err != nil {
+			continue
+		}
+		if isMountedPath(spec.Mounts, strings.TrimPrefix(hostPath, rootfs)) {
+			return nil
+		}
+		if err := unix.Access(hostPath, unix.X_OK); err != nil {
+			continue
+		}
+		fi, err := os.Stat(hostPath)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		return validateExecutable(spec, hostPath, 0)
+	}
+	return fmt.Errorf("executable %q not found in rootfs: %w", cmd, unix.ENOENT)
+}
+
+// validateExecutable checks the ELF architecture and the ELF interpreter,
+// or the script interpreter of the executable.
+func validateExecutable(spec *specs.Spec, hostPath string, depth int) error {
+	rootfs := spec.Root.Path
+	name := strings.TrimPrefix(hostPath, rootfs)
+
+	interp, err := readInterpreter(hostPath)
+	if err != nil {
+		return fmt.Errorf("executable %q: %w", name, err)
+	}
+	if interp == "" {
+		return nil
+	}
+	if isMountedPath(spec.Mounts, interp) {
+		return nil
+	}
+	interpPath, err := resolveInRootfs(rootfs, interp)
+	if err == nil {
+		var fi os.FileInfo
+		fi, err = os.Stat(interpPath)
+		if err == nil && !fi.Mode().IsRegular() {
+			err = unix.EACCES
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("interpreter %q of executable %q not found in rootfs: %w", interp, name, unix.ENOENT)
+	}
+	if depth == maxInterpreterDepth {
+		return fmt.Errorf("executable %q: too many levels of interpreters: %w", name, unix.ELOOP)
+	}
+	return validateExecutable(spec, interpPath, depth+1)
+}
+
+// readInterpreter returns the script interpreter (shebang) or the
+// ELF interpreter (PT_INTERP) of the given executable.
+// An empty string is returned for statically linked executables.
+func readInterpreter(filename string) (string, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return "", fmt.Errorf("failed to read header: %w", unix.ENOEXEC)
+	}
+
+	if bytes.HasPrefix(magic, []byte("#!")) {
+		// The kernel limits the shebang line to 256 bytes (BINPRM_BUF_SIZE).
+		line, _ := bufio.NewReaderSize(f, 256).ReadString('\n')
+		fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+		if len(fields) == 0 {
+			return "", fmt.Errorf("empty script interpreter: %w", unix.ENOEXEC)
+		}
+		return fields[0], nil
+	}
+
+	if !bytes.Equal(magic, []byte(elf.ELFMAG)) {
+		return "", fmt.Errorf("unknown executable format: %w", unix.ENOEXEC)
+	}
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		return "", fmt.Errorf("invalid ELF file (%s): %w", err, unix.ENOEXEC)
+	}
+	if machines, ok := elfMachines[runtime.GOARCH]; ok {
+		supported := false
+		for _, m := range machines {
+			supported = supported || ef.Machine == m
+		}
+		if !supported {
+			return "", fmt.Errorf("ELF architecture %s is not supported on %s: %w", ef.Machine, runtime.GOARCH, unix.ENOEXEC)
+		}
+	}
+	for _, p := range ef.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, p.Filesz)
+		if _, err := p.ReadAt(data, 0); err != nil {
+			return "", fmt.Errorf("failed to read ELF interpreter: %w", unix.ENOEXEC)
+		}
+		return string(bytes.TrimRight(data, "\x00")), nil
+	}
+	return "", nil
+}
+
+// resolveInRootfs resolves all symlinks of the container path p within rootfs
+// and returns the host path. Absolute symlinks are resolved relative to rootfs.
+func resolveInRootfs(rootfs string, p string) (string, error) {
+	resolved := "/"
+	rest := strings.Split(strings.Trim(filepath.Clean("/"+p), "/"), "/")
+	links := 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		if elem == "" || elem == "." {
+			continue
+		}
+		if elem == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, elem)
+		fi, err := os.Lstat(filepath.Join(rootfs, next))
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", unix.ELOOP
+		}
+		target, err := os.Readlink(filepath.Join(rootfs, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return filepath.Join(rootfs, resolved), nil
+}
+
+// isMountedPath returns true if the container path p is located on one of the mounts.
+func isMountedPath(mounts []specs.Mount, p string) bool {
+	p = filepath.Clean("/" + p)
+	for _, m := range mounts {
+		dst := filepath.Clean("/" + m.Destination)
+		if dst == "/" {
+			continue
+		}
+		if p == dst || strings.HasPrefix(p, dst+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package lxcri
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestResolveInRootfs(t *testing.T) {
+	rootfs := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "usr/bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "usr/bin/sh"), nil, 0755))
+	require.NoError(t, os.Symlink("/usr/bin", filepath.Join(rootfs, "bin")))
+	require.NoError(t, os.Symlink("../../../../usr/bin/sh", filepath.Join(rootfs, "usr/bin/ash")))
+
+	p, err := resolveInRootfs(rootfs, "/bin/sh")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(rootfs, "usr/bin/sh"), p)
+
+	// relative symlinks can not escape the rootfs
+	p, err = resolveInRootfs(rootfs, "/bin/ash")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(rootfs, "usr/bin/sh"), p)
+
+	_, err = resolveInRootfs(rootfs, "/bin/bash")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestValidateEntrypoint(t *testing.T) {
+	rootfs := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "bin/run.sh"), []byte("#!/bin/sh -e\nexit 0\n"), 0755))
+
+	spec := specki.NewSpec(rootfs, "run.sh")
+	spec.Process.Env = []string{"PATH=/usr/bin:/bin"}
+	err := validateEntrypoint(spec)
+	require.True(t, errors.Is(err, unix.ENOENT), err)
+	require.Contains(t, err.Error(), `interpreter "/bin/sh"`)
+
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "bin/sh"), []byte("#!/bin/run.sh\n"), 0755))
+	require.True(t, errors.Is(validateEntrypoint(spec), unix.ELOOP))
+
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "bin/sh"), []byte("\x7fELF garbage"), 0755))
+	require.True(t, errors.Is(validateEntrypoint(spec), unix.ENOEXEC))
+
+	spec.Process.Args = []string{"missing"}
+	require.True(t, errors.Is(validateEntrypoint(spec), unix.ENOENT))
+
+	// executables on mounts are not validated
+	spec.Process.Args = []string{"/opt/app/bin/app"}
+	spec.Mounts = append(spec.Mounts, specs.Mount{Destination: "/opt/app", Source: "/tmp", Type: "bind"})
+	require.NoError(t, validateEntrypoint(spec))
+}
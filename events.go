@@ -0,0 +1,202 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Event types emitted by Runtime.Events.
+const (
+	EventTypeStats = "stats"
+	EventTypeOOM   = "oom"
+)
+
+// Event is a container event. The JSON encoding is compatible with
+// the output of `runc events` (e.g used by conmon for OOM monitoring).
+type Event struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// Data is only set for events of type EventTypeStats.
+	Data *EventStats `json:"data,omitempty"`
+}
+
+// EventStats is the subset of the runc events statistics,
+// that is provided by the cgroup2 controllers.
+type EventStats struct {
+	CPU               EventCPU                `json:"cpu"`
+	Memory            EventMemory             `json:"memory"`
+	Pids              EventPids               `json:"pids"`
+	NetworkInterfaces []EventNetworkInterface `json:"network_interfaces,omitempty"`
+}
+
+// EventCPU are the CPU statistics of a stats event.
+type EventCPU struct {
+	Usage      EventCPUUsage   `json:"usage"`
+	Throttling EventThrottling `json:"throttling"`
+}
+
+// EventCPUUsage is the CPU usage in nanoseconds.
+type EventCPUUsage struct {
+	Total  uint64 `json:"total,omitempty"`
+	Kernel uint64 `json:"kernel"`
+	User   uint64 `json:"user"`
+}
+
+// EventThrottling are the CPU throttling statistics.
+// The ThrottledTime is in nanoseconds.
+type EventThrottling struct {
+	Periods          uint64 `json:"periods,omitempty"`
+	ThrottledPeriods uint64 `json:"throttledPeriods,omitempty"`
+	ThrottledTime    uint64 `json:"throttledTime,omitempty"`
+}
+
+// EventMemory are the memory statistics of a stats event.
+type EventMemory struct {
+	Usage EventMemoryEntry  `json:"usage"`
+	Swap  EventMemoryEntry  `json:"swap"`
+	Raw   map[string]uint64 `json:"raw,omitempty"`
+}
+
+// EventMemoryEntry is the usage and limit of a memory type in bytes.
+type EventMemoryEntry struct {
+	Limit uint64 `json:"limit"`
+	Usage uint64 `json:"usage,omitempty"`
+	Max   uint64 `json:"max,omitempty"`
+}
+
+// EventPids are the pids statistics of a stats event.
+type EventPids struct {
+	Current uint64 `json:"current,omitempty"`
+	Limit   uint64 `json:"limit,omitempty"`
+}
+
+// EventNetworkInterface are the statistics of a network interface.
+type EventNetworkInterface struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// newEventStats converts the container statistics to the runc events format.
+func newEventStats(s *Stats) *EventStats {
+	es := &EventStats{}
+	if cg := s.Cgroup; cg != nil {
+		es.CPU = EventCPU{
+			Usage: EventCPUUsage{
+				Total:  cg.CPU.UsageUsec * 1000,
+				Kernel: cg.CPU.SystemUsec * 1000,
+				User:   cg.CPU.UserUsec * 1000,
+			},
+			Throttling: EventThrottling{
+				Periods:          cg.CPU.NrPeriods,
+				ThrottledPeriods: cg.CPU.NrThrottled,
+				ThrottledTime:    cg.CPU.ThrottledUsec * 1000,
+			},
+		}
+		es.Memory = EventMemory{
+			Usage: EventMemoryEntry{Usage: cg.Memory.Current, Max: cg.Memory.Peak, Limit: cg.Memory.Limit},
+			Swap:  EventMemoryEntry{Usage: cg.Memory.Swap},
+			Raw:   cg.Memory.Stat,
+		}
+		es.Pids = EventPids{Current: cg.Pids.Current, Limit: cg.Pids.Limit}
+	}
+	for _, i := range s.Interfaces {
+		es.NetworkInterfaces = append(es.NetworkInterfaces, EventNetworkInterface(i))
+	}
+	return es
+}
+
+// StatsEvent returns an event with the current statistics of the container.
+func (rt *Runtime) StatsEvent(c *Container) (*Event, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Type: EventTypeStats, ID: c.ContainerID, Data: newEventStats(stats)}, nil
+}
+
+// Events emits a stats event for the container every interval, and an OOM event
+// whenever the OOM killer was invoked for the container cgroup (see Runtime.WatchOOM).
+// The returned channel is closed when the context is done or the container is stopped.
+func (rt *Runtime) Events(ctx context.Context, c *Container, interval time.Duration) (<-chan Event, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid events interval %s", interval)
+	}
+	if c.CgroupDir == "" {
+		return nil, fmt.Errorf("container has no cgroup")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ooms, err := rt.WatchOOM(ctx, c)
+	// seen is the oom_kill counter of this caller if OOM kills are polled.
+	polling := err != nil
+	var seen uint64
+	if polling {
+		// e.g cgroup v1 or the memory controller is not enabled
+		c.Log.Info().Msgf("polling OOM kills every interval: %s", err)
+		seen, _ = parseCgroupMemoryOOMKills(c.sysFS(), cgroups.memoryEventsFile(c.CgroupDir))
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer cancel()
+		defer close(events)
+		send := func(ev Event) bool {
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		tick := c.sysClock().After(interval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-ooms:
+				if !ok {
+					// the cgroup was removed
+					ooms = nil
+					continue
+				}
+				if !send(Event{Type: EventTypeOOM, ID: c.ContainerID}) {
+					return
+				}
+				continue
+			case <-tick:
+				tick = c.sysClock().After(interval)
+			}
+
+			if polling {
+				if ev, _ := rt.checkOOMKills(c, &seen); ev != nil {
+					if !send(Event{Type: EventTypeOOM, ID: c.ContainerID}) {
+						return
+					}
+				}
+			}
+
+			if state, err := c.ContainerState(); err != nil || state == specs.StateStopped {
+				return
+			}
+
+			ev, err := rt.StatsEvent(c)
+			if err != nil {
+				c.Log.Warn().Msgf("failed to read container stats: %s", err)
+				continue
+			}
+			if !send(*ev) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,36 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEventStats(t *testing.T) {
+	stats := &Stats{
+		Cgroup: &CgroupStats{
+			Memory: MemoryStats{Current: 4096, Peak: 8192, Limit: 1 << 20},
+			CPU:    CPUStats{UsageUsec: 3, UserUsec: 2, SystemUsec: 1},
+			Pids:   PidsStats{Current: 2},
+		},
+		Interfaces: []InterfaceStats{{Name: "eth0", RxBytes: 100, TxBytes: 50}},
+	}
+	es := newEventStats(stats)
+	require.Equal(t, EventCPUUsage{Total: 3000, Kernel: 1000, User: 2000}, es.CPU.Usage)
+	require.Equal(t, EventMemoryEntry{Usage: 4096, Max: 8192, Limit: 1 << 20}, es.Memory.Usage)
+	require.Equal(t, EventPids{Current: 2}, es.Pids)
+	require.Equal(t, []EventNetworkInterface{{Name: "eth0", RxBytes: 100, TxBytes: 50}}, es.NetworkInterfaces)
+
+	// The JSON format is compatible with `runc events`.
+	data, err := json.Marshal(Event{Type: EventTypeOOM, ID: "c1"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"oom","id":"c1"}`, string(data))
+
+	data, err = json.Marshal(Event{Type: EventTypeStats, ID: "c1", Data: newEventStats(&Stats{})})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"stats","id":"c1","data":{
+		"cpu":{"usage":{"kernel":0,"user":0},"throttling":{}},
+		"memory":{"usage":{"limit":0},"swap":{"limit":0}},
+		"pids":{}}}`, string(data))
+}
@@ -0,0 +1,96 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/creack/pty"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Exec executes the given process within the container
+// and waits for the process to exit. It returns the exit status of the process.
+// The container state must be either specs.StateCreated or specs.StateRunning.
+//
+// If proc.Terminal is true and opts.ConsoleSocket is set, a new pty is allocated
+// for the process and the pty master is sent to the console socket
+// (like the console socket for Runtime.Create).
+// Without a console socket the process inherits the stdio of the calling process.
+func (rt *Runtime) Exec(ctx context.Context, c *Container, proc *specs.Process, opts ExecOptions) (exitStatus int, err error) {
+	if err := checkExecState(c); err != nil {
+		return 0, err
+	}
+	tty, err := openExecConsole(ctx, proc, opts.ConsoleSocket)
+	if err != nil {
+		return 0, err
+	}
+	if tty != nil {
+		defer tty.Close()
+		opts.tty = tty
+	}
+	return c.Exec(proc, &opts)
+}
+
+// ExecDetached is like Exec but does not wait for the process to exit.
+// It returns the PID of the started process.
+func (rt *Runtime) ExecDetached(ctx context.Context, c *Container, proc *specs.Process, opts ExecOptions) (pid int, err error) {
+	if err := checkExecState(c); err != nil {
+		return 0, err
+	}
+	tty, err := openExecConsole(ctx, proc, opts.ConsoleSocket)
+	if err != nil {
+		return 0, err
+	}
+	if tty != nil {
+		// The process has its own reference to the pty slave.
+		defer tty.Close()
+		opts.tty = tty
+	}
+	return c.ExecDetached(proc, &opts)
+}
+
+func checkExecState(c *Container) error {
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != specs.StateCreated && state != specs.StateRunning {
+		return fmt.Errorf("invalid container state. expected %q or %q, but was %q", specs.StateCreated, specs.StateRunning, state)
+	}
+	return nil
+}
+
+// openExecConsole allocates a new pty if the process requests a terminal
+// and consoleSocket is set. The pty master is sent to the console socket
+// and the pty slave is returned. The returned file is nil if no pty is allocated.
+func openExecConsole(ctx context.Context, proc *specs.Process, consoleSocket string) (*os.File, error) {
+	if proc == nil || !proc.Terminal || consoleSocket == "" {
+		return nil, nil
+	}
+	sockFile, err := dialConsoleSocket(ctx, consoleSocket)
+	if err != nil {
+		return nil, err
+	}
+	defer sockFile.Close()
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate pty: %w", err)
+	}
+	defer ptmx.Close()
+
+	if size := proc.ConsoleSize; size != nil {
+		err := pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(size.Height), Cols: uint16(size.Width)})
+		if err != nil {
+			tty.Close()
+			return nil, fmt.Errorf("failed to set console size: %w", err)
+		}
+	}
+
+	if err := sendConsole(sockFile, ptmx); err != nil {
+		tty.Close()
+		return nil, err
+	}
+	return tty, nil
+}
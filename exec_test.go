@@ -0,0 +1,71 @@
+package lxcri
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/creack/pty"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestOpenExecConsoleNoTerminal(t *testing.T) {
+	tty, err := openExecConsole(context.Background(), &specs.Process{}, "/does/not/exist")
+	require.NoError(t, err)
+	require.Nil(t, tty)
+
+	tty, err = openExecConsole(context.Background(), &specs.Process{Terminal: true}, "")
+	require.NoError(t, err)
+	require.Nil(t, tty)
+}
+
+func TestOpenExecConsole(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "console.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: sock, Net: "unix"})
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan *os.File, 1)
+	go func() {
+		defer close(received)
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 32)
+		oob := make([]byte, unix.CmsgSpace(4))
+		_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return
+		}
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			return
+		}
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			return
+		}
+		received <- os.NewFile(uintptr(fds[0]), "ptmx")
+	}()
+
+	proc := &specs.Process{Terminal: true, ConsoleSize: &specs.Box{Height: 24, Width: 80}}
+	tty, err := openExecConsole(context.Background(), proc, sock)
+	require.NoError(t, err)
+	require.NotNil(t, tty)
+	defer tty.Close()
+
+	ptmx := <-received
+	require.NotNil(t, ptmx)
+	defer ptmx.Close()
+
+	rows, cols, err := pty.Getsize(tty)
+	require.NoError(t, err)
+	require.Equal(t, 24, rows)
+	require.Equal(t, 80, cols)
+}
@@ -0,0 +1,594 @@
+package lxcri
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Names of the entries in an exported container archive.
+const (
+	exportConfigFile = "lxcri.json"
+	exportStateFile  = "state.json"
+	exportSpecFile   = BundleConfigFile
+	exportRootfsDir  = "rootfs"
+)
+
+// Whiteout file names of the rootfs diff, as defined by the OCI image layer specification.
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// mountInfoFile is parsed to find the overlay upper directory of the rootfs.
+var mountInfoFile = "/proc/self/mountinfo"
+
+// ExportOptions are options for Runtime.Export.
+type ExportOptions struct {
+	// Rootfs adds the changes of the container rootfs to the archive.
+	// If the rootfs is an overlay mount, the upper directory is the diff.
+	// Otherwise the rootfs is compared with BaseRootfs.
+	Rootfs bool
+	// BaseRootfs is the lower (image) layer the rootfs is compared with,
+	// if the rootfs is not an overlay mount.
+	BaseRootfs string
+}
+
+// ExportedState is the runtime state of an exported container.
+type ExportedState struct {
+	CreatedAt time.Time
+	// Restarts is the number of times the container was restarted (see RestartPolicy).
+	Restarts int
+	// Exit is the termination state of the container process.
+	Exit *ExitState `json:",omitempty"`
+}
+
+// Export writes a gzip compressed tar archive of the stopped container to w.
+// The archive contains the (protected) container state, the unmodified
+// bundle spec and optionally the rootfs diff, which is a layer
+// (see the OCI image layer specification) on top of the base rootfs.
+// The container can be re-created from the archive with Runtime.Import.
+func (rt *Runtime) Export(c *Container, w io.Writer, opts ExportOptions) error {
+	state, err := c.ContainerState()
+	if err != nil {
+		return err
+	}
+	if state != specs.StateStopped {
+		return fmt.Errorf("container must be stopped (current state %s)", state)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	protected, err := rt.protectedState(c)
+	if err != nil {
+		return err
+	}
+	cfg, err := json.Marshal(protected)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, exportConfigFile, cfg); err != nil {
+		return err
+	}
+
+	exported := ExportedState{CreatedAt: c.CreatedAt}
+	if exported.Restarts, err = c.restartCount(); err != nil {
+		return fmt.Errorf("failed to read restart count: %w", err)
+	}
+	if exported.Exit, err = c.exitState(); err != nil {
+		return fmt.Errorf("failed to read exit state: %w", err)
+	}
+	stateData, err := json.Marshal(exported)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, exportStateFile, stateData); err != nil {
+		return err
+	}
+
+	// The spec in the container configuration is modified by the runtime.
+	// #nosec
+	spec, err := os.ReadFile(filepath.Join(c.BundlePath, BundleConfigFile))
+	if err != nil {
+		return fmt.Errorf("failed to read bundle spec: %w", err)
+	}
+	if err := writeTarFile(tw, exportSpecFile, spec); err != nil {
+		return err
+	}
+
+	if opts.Rootfs {
+		if err := writeRootfsDiff(tw, c.rootfsPath(), opts.BaseRootfs); err != nil {
+			return fmt.Errorf("failed to archive rootfs diff: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// ImportOptions are options for Runtime.Import.
+type ImportOptions struct {
+	// Rootfs is the rootfs of the imported container, which must contain
+	// the base rootfs of the exported container (e.g a new overlay mount of the same image).
+	// The rootfs diff is applied to it. The rootfs of the exported container is
+	// used if the archive does not contain a rootfs diff.
+	Rootfs string
+}
+
+// Import extracts the archive created by Runtime.Export to bundleDir,
+// applies the rootfs diff to ImportOptions.Rootfs and returns the
+// container configuration that can be used to re-create the container
+// with Runtime.Create, and the runtime state of the exported container.
+func (rt *Runtime) Import(r io.Reader, bundleDir string, opts ImportOptions) (*ContainerConfig, *ExportedState, error) {
+	if err := os.MkdirAll(bundleDir, 0755); err != nil {
+		return nil, nil, err
+	}
+	bundleDir, err := filepath.EvalSymlinks(bundleDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	rootfs := opts.Rootfs
+	if rootfs != "" {
+		if rootfs, err = filepath.EvalSymlinks(rootfs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gr.Close()
+
+	var cfg *ContainerConfig
+	var state *ExportedState
+	hasRootfs := false
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		name := filepath.Clean(hdr.Name)
+		switch {
+		case name == exportConfigFile:
+			c := &Container{ContainerConfig: new(ContainerConfig)}
+			if err := json.NewDecoder(tr).Decode(c); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode container state: %w", err)
+			}
+			cfg = c.ContainerConfig
+		case name == exportStateFile:
+			state = new(ExportedState)
+			if err := json.NewDecoder(tr).Decode(state); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode exported state: %w", err)
+			}
+		case name == exportSpecFile:
+			if err := extractTarEntry(tr, hdr, bundleDir, name); err != nil {
+				return nil, nil, err
+			}
+		case strings.HasPrefix(name, exportRootfsDir+"/"):
+			hasRootfs = true
+			if rootfs == "" {
+				return nil, nil, fmt.Errorf("the archive contains a rootfs diff but no rootfs to apply it to")
+			}
+			if err := applyTarEntry(tr, hdr, rootfs, strings.TrimPrefix(name, exportRootfsDir+"/")); err != nil {
+				return nil, nil, err
+			}
+		case name == exportRootfsDir:
+		default:
+			return nil, nil, fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+	}
+	if cfg == nil {
+		return nil, nil, fmt.Errorf("archive does not contain %s", exportConfigFile)
+	}
+
+	spec, err := specki.LoadSpecJSON(filepath.Join(bundleDir, BundleConfigFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	if hasRootfs || rootfs != "" {
+		if spec.Root == nil {
+			spec.Root = &specs.Root{}
+		}
+		spec.Root.Path = rootfs
+	}
+	cfg.Spec = spec
+	cfg.BundlePath = bundleDir
+	// The following settings are node specific.
+	cfg.ConsoleSocket = ""
+	cfg.CgroupDir = ""
+	cfg.MonitorCgroupDir = ""
+	cfg.ExternalCgroup = false
+	cfg.Log = rt.Log
+	return cfg, state, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// rootfsPath returns the absolute path of the container rootfs.
+func (c *Container) rootfsPath() string {
+	if filepath.IsAbs(c.Spec.Root.Path) {
+		return c.Spec.Root.Path
+	}
+	return filepath.Join(c.BundlePath, c.Spec.Root.Path)
+}
+
+// writeRootfsDiff adds the changes of the rootfs to the archive within exportRootfsDir.
+// The upper directory is archived if rootfs is an overlay mount,
+// otherwise rootfs is compared with the base rootfs.
+func writeRootfsDiff(tw *tar.Writer, rootfs string, base string) error {
+	rootfs, err := filepath.EvalSymlinks(rootfs)
+	if err != nil {
+		return err
+	}
+	upper, err := overlayUpperDir(mountInfoFile, rootfs)
+	if err != nil {
+		return err
+	}
+	if upper != "" {
+		return writeTarUpperDir(tw, upper, exportRootfsDir)
+	}
+	if base == "" {
+		return fmt.Errorf("rootfs %s is not an overlay mount and no base rootfs is given", rootfs)
+	}
+	return writeTarDiff(tw, base, rootfs, exportRootfsDir)
+}
+
+// overlayUpperDir returns the upper directory of the overlay filesystem
+// mounted at mountpoint, or an empty string if mountpoint is not an overlay mount.
+func overlayUpperDir(mountInfo string, mountpoint string) (string, error) {
+	// #nosec
+	data, err := os.ReadFile(mountInfo)
+	if err != nil {
+		return "", err
+	}
+	upper := ""
+	// e.g `36 35 0:31 / /rootfs rw,relatime - overlay overlay rw,lowerdir=/l,upperdir=/u,workdir=/w`
+	// The last mount at mountpoint is visible.
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || len(fields) < sep+4 || unescapeMountInfo(fields[4]) != mountpoint {
+			continue
+		}
+		upper = ""
+		if fields[sep+1] != "overlay" {
+			continue
+		}
+		for _, opt := range strings.Split(fields[sep+3], ",") {
+			if strings.HasPrefix(opt, "upperdir=") {
+				upper = unescapeMountInfo(strings.TrimPrefix(opt, "upperdir="))
+			}
+		}
+	}
+	return upper, nil
+}
+
+// unescapeMountInfo replaces the octal escape sequences (e.g `\040` for space)
+// of a path in /proc/self/mountinfo.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// writeTarUpperDir adds the overlay upper directory to the archive within prefix.
+// Overlay whiteouts (character devices 0:0) and opaque directories
+// are converted to whiteout files.
+func writeTarUpperDir(tw *tar.Writer, upper string, prefix string) error {
+	return filepath.Walk(upper, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upper, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(prefix, rel)
+		if isOverlayWhiteout(info) {
+			return writeTarFile(tw, filepath.Join(filepath.Dir(name), whiteoutPrefix+info.Name()), nil)
+		}
+		if err := writeTarEntry(tw, p, info, name); err != nil {
+			return err
+		}
+		if info.IsDir() && rel != "." && isOverlayOpaque(p) {
+			return writeTarFile(tw, filepath.Join(name, whiteoutOpaque), nil)
+		}
+		return nil
+	})
+}
+
+func isOverlayWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Rdev == 0
+}
+
+func isOverlayOpaque(dir string) bool {
+	buf := make([]byte, 1)
+	for _, attr := range []string{"trusted.overlay.opaque", "user.overlay.opaque"} {
+		if n, err := unix.Lgetxattr(dir, attr, buf); err == nil && n == 1 && buf[0] == 'y' {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTarDiff adds the files of dir that are new or changed compared with base
+// to the archive within prefix. Files removed from base are added as whiteout files.
+func writeTarDiff(tw *tar.Writer, base string, dir string, prefix string) error {
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		baseInfo, err := os.Lstat(filepath.Join(base, rel))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if baseInfo != nil && !fileChanged(baseInfo, info, filepath.Join(base, rel), p) {
+			return nil
+		}
+		return writeTarEntry(tw, p, info, filepath.Join(prefix, rel))
+	})
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(base, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		_, err = os.Lstat(filepath.Join(dir, rel))
+		if os.IsNotExist(err) {
+			err = writeTarFile(tw, filepath.Join(prefix, filepath.Dir(rel), whiteoutPrefix+info.Name()), nil)
+			if err == nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return err
+	})
+}
+
+// fileChanged returns true if the file type, permissions, ownership,
+// modification time, size or link target of the file differ.
+// Directories are compared without the modification time, because
+// it changes whenever a directory entry changes.
+func fileChanged(a os.FileInfo, b os.FileInfo, pathA string, pathB string) bool {
+	if a.Mode() != b.Mode() {
+		return true
+	}
+	sa, okA := a.Sys().(*syscall.Stat_t)
+	sb, okB := b.Sys().(*syscall.Stat_t)
+	if okA && okB && (sa.Uid != sb.Uid || sa.Gid != sb.Gid || sa.Rdev != sb.Rdev) {
+		return true
+	}
+	switch {
+	case a.IsDir():
+		return false
+	case a.Mode()&os.ModeSymlink != 0:
+		la, errA := os.Readlink(pathA)
+		lb, errB := os.Readlink(pathB)
+		return errA != nil || errB != nil || la != lb
+	default:
+		return a.Size() != b.Size() || !a.ModTime().Equal(b.ModTime())
+	}
+}
+
+// writeTarEntry adds the file p with the given name to the archive.
+// Hardlinks are archived as separate files.
+// Sockets are skipped, because they are created by the container processes.
+func writeTarEntry(tw *tar.Writer, p string, info os.FileInfo, name string) error {
+	if info.Mode()&os.ModeSocket != 0 {
+		return nil
+	}
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	// user and group names are resolved within the container
+	hdr.Uname = ""
+	hdr.Gname = ""
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	// #nosec
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// applyTarEntry applies the entry of a rootfs diff to name within dir.
+// Whiteout files remove the file (or the content of an opaque directory) from dir,
+// other entries replace existing files.
+func applyTarEntry(tr *tar.Reader, hdr *tar.Header, dir string, name string) error {
+	base := filepath.Base(name)
+	isWhiteout := base != whiteoutOpaque && strings.HasPrefix(base, whiteoutPrefix)
+	dst, err := tarEntryPath(dir, name)
+	if err != nil {
+		// a whiteout for a file in a missing directory is a noop
+		if isWhiteout && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to apply %s: %w", hdr.Name, err)
+	}
+	parent := filepath.Dir(dst)
+	if base == whiteoutOpaque {
+		entries, err := os.ReadDir(parent)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := os.RemoveAll(filepath.Join(parent, e.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if isWhiteout {
+		return os.RemoveAll(filepath.Join(parent, strings.TrimPrefix(base, whiteoutPrefix)))
+	}
+	if info, err := os.Lstat(dst); err == nil {
+		// existing directories are kept, the metadata is updated
+		if !(info.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+		}
+	}
+	return extractTarEntry(tr, hdr, dir, name)
+}
+
+// tarEntryPath returns the path of the archive entry name within dir.
+// The parent directory of the entry must not be reached through a symlink,
+// e.g created by a previous archive entry, that may point out of dir.
+func tarEntryPath(dir string, name string) (string, error) {
+	dst := filepath.Join(dir, name)
+	if dst == dir || !strings.HasPrefix(dst, dir+"/") {
+		return "", fmt.Errorf("path %q is not within %s", name, dir)
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(dst))
+	if err != nil {
+		return "", err
+	}
+	if parent != filepath.Dir(dst) {
+		return "", fmt.Errorf("parent directory of %q is a symlink", name)
+	}
+	return dst, nil
+}
+
+// extractTarEntry extracts the given archive entry to name within dir.
+// Ownership is only restored if the runtime runs as root.
+func extractTarEntry(tr *tar.Reader, hdr *tar.Header, dir string, name string) error {
+	dst, err := tarEntryPath(dir, name)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+	}
+
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		err = os.MkdirAll(dst, 0755)
+	case tar.TypeReg:
+		var f *os.File
+		// #nosec
+		f, err = os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		// #nosec
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	case tar.TypeSymlink:
+		err = os.Symlink(hdr.Linkname, dst)
+	case tar.TypeChar:
+		err = unix.Mknod(dst, unix.S_IFCHR|mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+	case tar.TypeBlock:
+		err = unix.Mknod(dst, unix.S_IFBLK|mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+	case tar.TypeFifo:
+		err = unix.Mkfifo(dst, mode)
+	default:
+		return fmt.Errorf("unsupported archive entry type %q for %s", hdr.Typeflag, hdr.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+	}
+	if os.Getuid() == 0 {
+		if err := unix.Lchown(dst, hdr.Uid, hdr.Gid); err != nil {
+			return fmt.Errorf("failed to chown %s: %w", hdr.Name, err)
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	// chmod after chown, because chown clears the setuid/setgid bits
+	if err := unix.Chmod(dst, mode); err != nil {
+		return fmt.Errorf("failed to chmod %s: %w", hdr.Name, err)
+	}
+	return nil
+}
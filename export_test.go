@@ -0,0 +1,189 @@
+package lxcri
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func extractTar(t *testing.T, data []byte, dir string) error {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		require.NoError(t, err)
+		if err := extractTarEntry(tr, hdr, dir, filepath.Clean(hdr.Name)); err != nil {
+			return err
+		}
+	}
+}
+
+func applyTar(t *testing.T, data []byte, dir string) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+		name := filepath.Clean(hdr.Name)
+		if name == exportRootfsDir {
+			continue
+		}
+		require.NoError(t, applyTarEntry(tr, hdr, dir, strings.TrimPrefix(name, exportRootfsDir+"/")))
+	}
+}
+
+func TestTarDiffRoundtrip(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "etc/conf.d"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "var/cache"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "etc/hostname"), []byte("base\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "etc/os-release"), []byte("ID=test\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "var/cache/data"), []byte("x"), 0644))
+
+	// the rootfs is a modified copy of base
+	rootfs := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "etc/conf.d"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "etc/hostname"), []byte("foo\n"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "etc/os-release"), []byte("ID=test\n"), 0644))
+	mtime := time.Unix(1600000000, 0)
+	require.NoError(t, os.Chtimes(filepath.Join(base, "etc/os-release"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(rootfs, "etc/os-release"), mtime, mtime))
+	require.NoError(t, os.Symlink("../hostname", filepath.Join(rootfs, "etc/conf.d/link")))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, writeTarDiff(tw, base, rootfs, exportRootfsDir))
+	require.NoError(t, tw.Close())
+
+	names := []string{}
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	// unchanged files are not archived, removed files are whiteouts
+	require.Equal(t, []string{"rootfs/etc/", "rootfs/etc/conf.d/", "rootfs/etc/conf.d/link", "rootfs/etc/hostname", "rootfs/.wh.var"}, names)
+
+	// the diff is applied to a copy of base
+	dst := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dst, "etc/conf.d"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dst, "var/cache"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "etc/hostname"), []byte("base\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "etc/os-release"), []byte("ID=test\n"), 0644))
+	applyTar(t, buf.Bytes(), dst)
+
+	data, err := os.ReadFile(filepath.Join(dst, "etc/hostname"))
+	require.NoError(t, err)
+	require.Equal(t, "foo\n", string(data))
+	_, err = os.Stat(filepath.Join(dst, "etc/os-release"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dst, "var"))
+	require.True(t, os.IsNotExist(err))
+
+	info, err := os.Stat(filepath.Join(dst, "etc/conf.d"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(dst, "etc/conf.d/link"))
+	require.NoError(t, err)
+	require.Equal(t, "../hostname", link)
+}
+
+func TestApplyTarEntryOpaque(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "rootfs/etc/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, writeTarFile(tw, "rootfs/etc/"+whiteoutOpaque, nil))
+	require.NoError(t, writeTarFile(tw, "rootfs/etc/hostname", []byte("foo\n")))
+	require.NoError(t, tw.Close())
+
+	dst := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dst, "etc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "etc/os-release"), nil, 0644))
+	applyTar(t, buf.Bytes(), dst)
+
+	entries, err := os.ReadDir(filepath.Join(dst, "etc"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "hostname", entries[0].Name())
+}
+
+func TestOverlayUpperDir(t *testing.T) {
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	data := `22 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw
+36 22 0:31 / /var/lib/my\040rootfs rw,relatime - overlay overlay rw,lowerdir=/l1:/l2,upperdir=/var/lib/upper\040dir,workdir=/w
+37 22 0:32 / /other rw,relatime - tmpfs tmpfs rw
+`
+	require.NoError(t, os.WriteFile(mountInfo, []byte(data), 0644))
+
+	upper, err := overlayUpperDir(mountInfo, "/var/lib/my rootfs")
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/upper dir", upper)
+
+	upper, err = overlayUpperDir(mountInfo, "/other")
+	require.NoError(t, err)
+	require.Empty(t, upper)
+}
+
+func TestExtractTarEntrySymlinkParent(t *testing.T) {
+	outside := t.TempDir()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "rootfs/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "rootfs/link", Typeflag: tar.TypeSymlink, Linkname: outside}))
+	require.NoError(t, writeTarFile(tw, "rootfs/link/file", []byte("x")))
+	require.NoError(t, tw.Close())
+
+	require.Error(t, extractTar(t, buf.Bytes(), t.TempDir()))
+	_, err := os.Stat(filepath.Join(outside, "file"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestApplyTarEntrySymlinkParent(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "keep"), nil, 0644))
+
+	// A hostile archive that replaces a directory with a symlink to the host
+	// and removes or replaces files within it.
+	names := []string{
+		"rootfs/link/" + whiteoutOpaque,
+		"rootfs/link/" + whiteoutPrefix + "keep",
+		"rootfs/link/keep",
+	}
+	for _, name := range names {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "rootfs/link", Typeflag: tar.TypeSymlink, Linkname: outside}))
+		require.NoError(t, writeTarFile(tw, name, []byte("x")))
+		require.NoError(t, tw.Close())
+
+		dst := t.TempDir()
+		tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		require.NoError(t, applyTarEntry(tr, hdr, dst, "link"))
+		hdr, err = tr.Next()
+		require.NoError(t, err)
+		require.Error(t, applyTarEntry(tr, hdr, dst, strings.TrimPrefix(hdr.Name, exportRootfsDir+"/")), name)
+
+		data, err := os.ReadFile(filepath.Join(outside, "keep"))
+		require.NoError(t, err, name)
+		require.Empty(t, data)
+	}
+}
@@ -0,0 +1,96 @@
+package lxcri
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// StartFailureReason identifies a known cause of a container start failure.
+type StartFailureReason string
+
+// Known start failure reasons.
+const (
+	// FailureApparmorProfile means that the apparmor profile
+	// of the container process is not loaded.
+	FailureApparmorProfile StartFailureReason = "ApparmorProfileNotFound"
+	// FailureCgroupController means that a resource limit could not be set,
+	// because the cgroup controller is not available (or not delegated).
+	FailureCgroupController StartFailureReason = "CgroupControllerMissing"
+	// FailureIDMap means that the user namespace ID mappings could not be written.
+	FailureIDMap StartFailureReason = "IDMapDenied"
+	// FailureDevpts means that a new devpts instance could not be mounted.
+	FailureDevpts StartFailureReason = "DevptsMountFailed"
+)
+
+// StartFailure is a known cause of a container start failure,
+// identified from the liblxc log or the monitor output.
+type StartFailure struct {
+	Reason StartFailureReason
+	// Message describes the failure.
+	Message string
+	// Hint describes how the failure can be fixed.
+	Hint string
+	// Line is the log line that identified the failure.
+	Line string
+}
+
+func (f *StartFailure) Error() string {
+	return fmt.Sprintf("%s: %s (hint: %s)", f.Reason, f.Message, f.Hint)
+}
+
+// startFailureSignatures match liblxc log messages of known start failures.
+// The first matching signature wins.
+var startFailureSignatures = []struct {
+	pattern *regexp.Regexp
+	failure StartFailure
+}{
+	{
+		regexp.MustCompile(`(?i)failed to (change|write) apparmor profile`),
+		StartFailure{
+			Reason:  FailureApparmorProfile,
+			Message: "the apparmor profile of the container process is not available",
+			Hint:    "load the profile with apparmor_parser or change the apparmor profile of the container",
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)(failed to setup (cgroup )?limit|failed to (enable|initialize) .*controller)`),
+		StartFailure{
+			Reason:  FailureCgroupController,
+			Message: "a cgroup resource limit could not be applied",
+			Hint:    "enable the cgroup controller in cgroup.subtree_control of the parent cgroups or remove the resource limit",
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)(failed to write (id )?mapping|new[ug]idmap .*failed|failed to set up id mapping)`),
+		StartFailure{
+			Reason:  FailureIDMap,
+			Message: "the user namespace ID mappings could not be written",
+			Hint:    "check that the ID ranges are delegated to the runtime user in /etc/subuid and /etc/subgid and that newuidmap/newgidmap are installed",
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)(failed to (mount|setup) (new )?devpts|devpts.*newinstance)`),
+		StartFailure{
+			Reason:  FailureDevpts,
+			Message: "a new devpts instance could not be mounted",
+			Hint:    "check the devpts mount options (e.g gid and ptmxmode) and that the kernel supports multiple devpts instances",
+		},
+	},
+}
+
+// classifyStartFailure returns the known start failure for the first log line
+// that matches a start failure signature, or nil if no line matches.
+func classifyStartFailure(lines ...[]string) *StartFailure {
+	for _, l := range lines {
+		for _, line := range l {
+			for _, sig := range startFailureSignatures {
+				if sig.pattern.MatchString(line) {
+					f := sig.failure
+					f.Line = line
+					return &f
+				}
+			}
+		}
+	}
+	return nil
+}
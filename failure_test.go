@@ -0,0 +1,24 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyStartFailure(t *testing.T) {
+	tests := map[string]StartFailureReason{
+		`lxc c1 20210101 ERROR apparmor - lsm/apparmor.c:apparmor_process_label_set_at:1110 - No such file or directory - Failed to write AppArmor profile "foo" to 9`: FailureApparmorProfile,
+		`lxc c1 20210101 ERROR cgfsng - cgroups/cgfsng.c:__cg_unified_setup_limits:2987 - No such file or directory - Failed to setup limit "hugetlb.2MB.max"`:         FailureCgroupController,
+		`lxc c1 20210101 ERROR conf - conf.c:lxc_map_ids:3389 - newuidmap failed to write mapping "newuidmap: uid range [0-65536) -> [100000-165536) not allowed"`:     FailureIDMap,
+		`lxc c1 20210101 ERROR conf - conf.c:lxc_setup_devpts:1581 - Invalid argument - Failed to mount new devpts instance`:                                           FailureDevpts,
+	}
+	for line, reason := range tests {
+		f := classifyStartFailure(nil, []string{"unrelated", line})
+		require.NotNil(t, f, line)
+		require.Equal(t, reason, f.Reason)
+		require.Equal(t, line, f.Line)
+	}
+
+	require.Nil(t, classifyStartFailure([]string{"lxc c1 20210101 ERROR start - start.c:1 - failed"}))
+}
@@ -0,0 +1,57 @@
+package lxcri
+
+import (
+	"sort"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// OCIFeatures is the OCI runtime features document.
+// It describes the features implemented by the runtime.
+// See https://github.com/opencontainers/runtime-spec/blob/main/features.md
+type OCIFeatures struct {
+	OCIVersionMin string            `json:"ociVersionMin,omitempty"`
+	OCIVersionMax string            `json:"ociVersionMax,omitempty"`
+	Hooks         []string          `json:"hooks,omitempty"`
+	MountOptions  []string          `json:"mountOptions,omitempty"`
+	Linux         *OCILinuxFeatures `json:"linux,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// OCILinuxFeatures are the Linux specific features of the OCI runtime features document.
+type OCILinuxFeatures struct {
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// mountOptions are the mount options handled by liblxc.
+var mountOptions = []string{
+	"async", "atime", "bind", "defaults", "dev", "diratime", "dirsync", "exec",
+	"iversion", "lazytime", "loud", "mand", "noatime", "nodev", "nodiratime", "noexec",
+	"noiversion", "nolazytime", "nomand", "norelatime", "nostrictatime", "nosuid",
+	"private", "rbind", "relatime", "remount", "ro", "rprivate", "rshared", "rslave",
+	"runbindable", "rw", "shared", "silent", "slave", "strictatime", "suid", "sync",
+	"unbindable",
+}
+
+// OCIFeatures returns the features document for the runtime.
+// Runtime.Init must be called before, because some features
+// depend on the host kernel.
+func (rt *Runtime) OCIFeatures() *OCIFeatures {
+	f := &OCIFeatures{
+		OCIVersionMin: "1.0.0",
+		OCIVersionMax: specs.Version,
+		Hooks:         []string{"prestart", "createRuntime", "createContainer", "startContainer", "poststart", "poststop"},
+		MountOptions:  append([]string{}, mountOptions...),
+		Linux:         &OCILinuxFeatures{},
+	}
+	if rt.mountSetattr {
+		f.MountOptions = append(f.MountOptions, "rro")
+	}
+	sort.Strings(f.MountOptions)
+
+	for t := range namespaceMap {
+		f.Linux.Namespaces = append(f.Linux.Namespaces, string(t))
+	}
+	sort.Strings(f.Linux.Namespaces)
+	return f
+}
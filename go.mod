@@ -5,9 +5,9 @@ require (
 	github.com/creack/pty v1.1.11
 	github.com/drachenfels-de/gocapability v0.0.0-20210413092208-755d79b01352
 	github.com/kr/pretty v0.2.1 // indirect
-	github.com/opencontainers/runtime-spec v1.0.3-0.20200929063507-e6143ca7d51d
+	github.com/opencontainers/runtime-spec v1.1.0
 	github.com/rs/zerolog v1.20.0
-	github.com/stretchr/testify v1.6.1
+	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli/v2 v2.3.0
 	golang.org/x/sys v0.0.0-20210228012217-479acdf4ea46
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
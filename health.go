@@ -0,0 +1,137 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// healthMinFreeRatio is the minimum ratio of available blocks
+// on the filesystem of the runtime root.
+var healthMinFreeRatio = 0.05
+
+// HealthCheck is the result of a single runtime health check.
+type HealthCheck struct {
+	Name    string
+	Healthy bool
+	Message string `json:",omitempty"`
+}
+
+// HealthReport is the health of the runtime returned by Runtime.Healthy.
+// It is meant to be consumed by node monitoring agents (e.g node-problem-detector).
+type HealthReport struct {
+	// Healthy is true if all checks are healthy.
+	Healthy bool
+	Checks  []HealthCheck
+	// Containers is the number of containers in the runtime root.
+	Containers int
+	// Monitors is the number of running monitor processes (see ExecStart) for the runtime root.
+	// Monitors may be less than Containers (stopped containers), but a greater
+	// number of monitors indicates leaked monitor processes.
+	Monitors int
+	// FreeBytes is the available space on the filesystem of the runtime root.
+	FreeBytes uint64
+}
+
+func (r *HealthReport) add(name string, err error) {
+	check := HealthCheck{Name: name, Healthy: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+		r.Healthy = false
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// Healthy checks the health of the runtime:
+// * the cgroup root is a mounted cgroup filesystem
+// * the runtime executables can be executed and match Runtime.LibexecHashes
+// * the space available on the filesystem of the runtime root
+// * the number of monitor processes does not exceed the number of containers
+func (rt *Runtime) Healthy() *HealthReport {
+	r := &HealthReport{Healthy: true}
+
+	r.add("cgroup", checkCgroupRoot())
+	r.add("libexec", rt.checkLibexec())
+
+	free, err := checkFreeSpace(rt.Root, healthMinFreeRatio)
+	r.FreeBytes = free
+	r.add("disk", err)
+
+	ids, err := rt.List()
+	if err == nil {
+		r.Containers = len(ids)
+		r.Monitors, err = countMonitors("/proc", rt.libexec(ExecStart), rt.Root)
+	}
+	if err == nil && r.Monitors > r.Containers {
+		err = fmt.Errorf("%d monitor processes for %d containers", r.Monitors, r.Containers)
+	}
+	r.add("monitors", err)
+	return r
+}
+
+// checkLibexec checks that the runtime executables can be executed
+// and that their SHA-256 hash matches the expected hash in Runtime.LibexecHashes.
+func (rt *Runtime) checkLibexec() error {
+	for _, name := range []string{ExecStart, ExecInit, ExecHook, ExecHookBuiltin} {
+		p := rt.libexec(name)
+		if err := canExecute(p); err != nil {
+			return err
+		}
+		expected, ok := rt.LibexecHashes[name]
+		if !ok {
+			continue
+		}
+		hash, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		if hash != expected {
+			return fmt.Errorf("hash of %q is %s but expected %s", p, hash, expected)
+		}
+	}
+	return nil
+}
+
+// checkFreeSpace returns the available space on the filesystem of dir,
+// and an error if the ratio of available blocks is lower than minRatio.
+func checkFreeSpace(dir string, minRatio float64) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return 0, fmt.Errorf("statfs %q failed: %w", dir, err)
+	}
+	// #nosec
+	free := stat.Bavail * uint64(stat.Bsize)
+	if stat.Blocks > 0 && float64(stat.Bavail)/float64(stat.Blocks) < minRatio {
+		return free, fmt.Errorf("available space on %q is below %.0f%% (%d bytes)", dir, minRatio*100, free)
+	}
+	return free, nil
+}
+
+// countMonitors returns the number of running monitor processes (exe)
+// for the given runtime root. See Runtime.runStartCmd for the monitor arguments.
+func countMonitors(procDir string, exe string, root string) (int, error) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		// The process may exit while /proc is read.
+		data, err := os.ReadFile(filepath.Join(procDir, e.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(string(data), "\x00")
+		if len(args) >= 3 && args[0] == exe && args[2] == root {
+			n++
+		}
+	}
+	return n, nil
+}
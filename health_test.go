@@ -0,0 +1,55 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountMonitors(t *testing.T) {
+	proc := t.TempDir()
+	cmdlines := map[string]string{
+		"1":    "/sbin/init\x00",
+		"100":  "/usr/libexec/lxcri/lxcri-start\x00c1\x00/run/lxcri\x00/run/lxcri/c1/config\x00",
+		"101":  "/usr/libexec/lxcri/lxcri-start\x00c2\x00/run/lxcri\x00/run/lxcri/c2/config\x00",
+		"102":  "/usr/libexec/lxcri/lxcri-start\x00c3\x00/run/other\x00/run/other/c3/config\x00",
+		"self": "/usr/libexec/lxcri/lxcri-start\x00c1\x00/run/lxcri\x00/run/lxcri/c1/config\x00",
+	}
+	for pid, cmdline := range cmdlines {
+		require.NoError(t, os.Mkdir(filepath.Join(proc, pid), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(proc, pid, "cmdline"), []byte(cmdline), 0644))
+	}
+	n, err := countMonitors(proc, "/usr/libexec/lxcri/lxcri-start", "/run/lxcri")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	free, err := checkFreeSpace(dir, 0)
+	require.NoError(t, err)
+	require.Greater(t, free, uint64(0))
+
+	_, err = checkFreeSpace(dir, 1.1)
+	require.Error(t, err)
+}
+
+func TestCheckLibexec(t *testing.T) {
+	rt := &Runtime{LibexecDir: t.TempDir()}
+	require.Error(t, rt.checkLibexec())
+
+	for _, name := range []string{ExecStart, ExecInit, ExecHook, ExecHookBuiltin} {
+		require.NoError(t, os.WriteFile(filepath.Join(rt.LibexecDir, name), []byte("#!/bin/sh\n"), 0755))
+	}
+	require.NoError(t, rt.checkLibexec())
+
+	hash, err := hashFile(filepath.Join(rt.LibexecDir, ExecStart))
+	require.NoError(t, err)
+	rt.LibexecHashes = map[string]string{ExecStart: hash}
+	require.NoError(t, rt.checkLibexec())
+
+	rt.LibexecHashes[ExecInit] = hash[1:] + "0"
+	require.Error(t, rt.checkLibexec())
+}
@@ -11,18 +11,17 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func createFifo(dst string, mode uint32) error {
-	if err := unix.Mkfifo(dst, mode); err != nil {
-		return errorf("mkfifo dst:%s failed: %w", dst, err)
+func createSyncDir(dst string, mode os.FileMode) error {
+	if err := os.MkdirAll(dst, mode); err != nil {
+		return errorf("failed to create sync dir %s: %w", dst, err)
 	}
-	// lxcri-init must be able to write to the fifo.
+	// lxcri-init must be able to create the init socket within the sync dir.
 	// Init process UID/GID can be different from runtime process UID/GID
 	// liblxc changes the owner of the runtime directory to the effective container UID.
 	// access to the files is protected by the runtimeDir
-	// because umask (0022) affects unix.Mkfifo, a separate chmod is required
-	// FIXME if container UID equals os.GetUID() and spec.
-	if err := unix.Chmod(dst, mode); err != nil {
-		return errorf("chmod mkfifo failed: %w", err)
+	// because umask (0022) affects os.MkdirAll, a separate chmod is required
+	if err := unix.Chmod(dst, uint32(mode)); err != nil {
+		return errorf("chmod sync dir failed: %w", err)
 	}
 	return nil
 }
@@ -47,15 +46,27 @@ func configureInit(rt *Runtime, c *Container) error {
 		return err
 	}
 
+	mode := os.FileMode(0777)
 	if runAsRuntimeUser(c.Spec) {
-		if err := createFifo(c.syncFifoPath(), 0600); err != nil {
-			return fmt.Errorf("failed to create sync fifo: %w", err)
-		}
-	} else {
-		if err := createFifo(c.syncFifoPath(), 0666); err != nil {
-			return fmt.Errorf("failed to create sync fifo: %w", err)
+		mode = 0700
+	}
+	if err := createSyncDir(c.syncDirPath(), mode); err != nil {
+		return err
+	}
+	if c.ephemeralDir != c.runtimeDir {
+		// The mountpoint for the sync dir must exist within the
+		// read-only bind mounted runtime directory.
+		if err := os.MkdirAll(c.RuntimePath("sync"), 0755); err != nil {
+			return errorf("failed to create sync dir mountpoint: %w", err)
 		}
 	}
+	// lxcri-init creates the init socket within the sync dir.
+	c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+		Source:      c.syncDirPath(),
+		Destination: strings.TrimLeft(filepath.Join(initDir, "sync"), "/"),
+		Type:        "bind",
+		Options:     []string{"bind", "nodev", "nosuid", "noexec"},
+	})
 
 	if err := configureInitUser(c); err != nil {
 		return err
@@ -0,0 +1,116 @@
+// Package cpuaffinity parses and applies the initial CPU affinity
+// of the container processes. See `man 2 sched_setaffinity`.
+package cpuaffinity
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Annotation is the container spec annotation that defines the initial
+// CPU affinity of the container init and exec processes, like
+// `process.execCPUAffinity.initial` of newer runtime spec versions.
+// The value is a CPU list like `0-3,8` or the keyword `cpuset`,
+// which uses the CPUs of the container cpuset (Spec.Linux.Resources.CPU.Cpus).
+const Annotation = "org.linuxcontainers.lxcri.ExecCPUAffinity"
+
+// Cpuset is the annotation value that selects the CPUs of the container cpuset.
+const Cpuset = "cpuset"
+
+// Parse parses a CPU list like `0-3,8`.
+func Parse(s string) (*unix.CPUSet, error) {
+	set := new(unix.CPUSet)
+	set.Zero()
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu %q: %w", bounds[0], err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cpu %q: %w", bounds[1], err)
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid cpu range %q", r)
+		}
+		// CPUSet is limited to 1024 CPUs (CPU_SETSIZE)
+		if last >= 1024 {
+			return nil, fmt.Errorf("cpu %d exceeds the maximum of 1023", last)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			set.Set(int(cpu))
+		}
+	}
+	if set.Count() == 0 {
+		return nil, fmt.Errorf("empty cpu list %q", s)
+	}
+	return set, nil
+}
+
+// FromSpec returns the CPU affinity defined by the spec annotation.
+// The returned CPUSet is nil if the annotation is not set.
+func FromSpec(spec *specs.Spec) (*unix.CPUSet, error) {
+	val, ok := spec.Annotations[Annotation]
+	if !ok {
+		return nil, nil
+	}
+	if val == Cpuset {
+		if spec.Linux == nil || spec.Linux.Resources == nil ||
+			spec.Linux.Resources.CPU == nil || spec.Linux.Resources.CPU.Cpus == "" {
+			return nil, fmt.Errorf("annotation %s=%s requires a cpuset (linux.resources.cpu.cpus)", Annotation, Cpuset)
+		}
+		val = spec.Linux.Resources.CPU.Cpus
+	}
+	set, err := Parse(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotation %s: %w", Annotation, err)
+	}
+	return set, nil
+}
+
+// Set sets the CPU affinity of the calling thread.
+// The affinity is inherited by child processes and preserved across execve.
+// The caller must lock the goroutine to the OS thread (runtime.LockOSThread).
+func Set(set *unix.CPUSet) error {
+	if err := unix.SchedSetaffinity(0, set); err != nil {
+		return fmt.Errorf("sched_setaffinity failed: %w", err)
+	}
+	return nil
+}
+
+// Run calls fn with the CPU affinity of the calling thread set to the given CPUs,
+// so processes forked by fn inherit the affinity. The affinity of the thread
+// is restored afterwards. fn is called directly if set is nil.
+func Run(set *unix.CPUSet, fn func() error) error {
+	if set == nil {
+		return fn()
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var prev unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &prev); err != nil {
+		return fmt.Errorf("sched_getaffinity failed: %w", err)
+	}
+	if err := Set(set); err != nil {
+		return err
+	}
+	err := fn()
+	if err := Set(&prev); err != nil {
+		return err
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package cpuaffinity
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParse(t *testing.T) {
+	set, err := Parse("0-2,5")
+	require.NoError(t, err)
+	require.Equal(t, 4, set.Count())
+	require.True(t, set.IsSet(5))
+	require.False(t, set.IsSet(3))
+
+	for _, s := range []string{"", "a", "3-1", "1024", "0,-1"} {
+		_, err := Parse(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestFromSpec(t *testing.T) {
+	spec := &specs.Spec{Annotations: map[string]string{}}
+	set, err := FromSpec(spec)
+	require.NoError(t, err)
+	require.Nil(t, set)
+
+	spec.Annotations[Annotation] = Cpuset
+	_, err = FromSpec(spec)
+	require.Error(t, err)
+
+	spec.Linux = &specs.Linux{Resources: &specs.LinuxResources{CPU: &specs.LinuxCPU{Cpus: "2-3"}}}
+	set, err = FromSpec(spec)
+	require.NoError(t, err)
+	require.Equal(t, 2, set.Count())
+	require.True(t, set.IsSet(2))
+}
+
+func TestRun(t *testing.T) {
+	var current unix.CPUSet
+	require.NoError(t, unix.SchedGetaffinity(0, &current))
+	cpu := -1
+	for i := 0; i < 1024; i++ {
+		if current.IsSet(i) {
+			cpu = i
+			break
+		}
+	}
+	require.NotEqual(t, -1, cpu)
+
+	set := new(unix.CPUSet)
+	set.Set(cpu)
+	err := Run(set, func() error {
+		var s unix.CPUSet
+		require.NoError(t, unix.SchedGetaffinity(0, &s))
+		require.Equal(t, 1, s.Count())
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,140 @@
+// Package handshake implements the synchronization protocol between
+// the runtime and the container init process (lxcri-init).
+//
+// The init process listens on a unix socket within the container runtime directory.
+// An abstract unix socket can not be used, because it is bound to the network
+// namespace of the container.
+//
+//  1. `create` connects to the socket and receives either MsgReady or MsgError.
+//  2. `start` connects to the socket and sends MsgStart (with the container secrets).
+//     The init process creates the secrets, runs the startContainer hooks
+//     and replies with MsgExec (or MsgError) before it calls execve.
+//     The connection is closed on successful execve (close-on-exec), otherwise
+//     a MsgError is sent.
+package handshake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// Version is the protocol version.
+// It must be incremented on incompatible changes.
+const Version = 2
+
+// SocketName is the name of the init socket within the sync directory.
+const SocketName = "init.sock"
+
+// MessageType is the type of a Message.
+type MessageType string
+
+// Message types exchanged between the runtime and the init process.
+const (
+	// MsgReady is sent by init when it is ready to start the container process.
+	MsgReady MessageType = "ready"
+	// MsgStart is sent by the runtime to start the container process.
+	MsgStart MessageType = "start"
+	// MsgExec is sent by init right before the container process is executed.
+	MsgExec MessageType = "exec"
+	// MsgError is sent by init if it fails.
+	MsgError MessageType = "error"
+)
+
+// Message is a single protocol message.
+type Message struct {
+	Version int         `json:"version"`
+	Type    MessageType `json:"type"`
+	// Errno is the system error number if Type is MsgError (optional).
+	Errno int `json:"errno,omitempty"`
+	// Error is the error message if Type is MsgError.
+	Error string `json:"error,omitempty"`
+	// Env are environment variables (secrets) that are added
+	// to the container process environment (MsgStart only).
+	Env []string `json:"env,omitempty"`
+	// Files are files (secrets) that are created by init in the
+	// container secrets directory (MsgStart only).
+	Files map[string][]byte `json:"files,omitempty"`
+}
+
+// InitError is the error reported by the init process.
+type InitError struct {
+	Errno unix.Errno
+	Msg   string
+}
+
+func (e *InitError) Error() string {
+	if e.Errno != 0 {
+		return fmt.Sprintf("init failed: %s (errno %d)", e.Msg, e.Errno)
+	}
+	return "init failed: " + e.Msg
+}
+
+// Unwrap returns the system error number if available.
+func (e *InitError) Unwrap() error {
+	if e.Errno != 0 {
+		return e.Errno
+	}
+	return nil
+}
+
+// NewMessage returns a new message of the given type.
+func NewMessage(t MessageType) Message {
+	return Message{Version: Version, Type: t}
+}
+
+// NewError returns a MsgError message for the given error.
+func NewError(err error) Message {
+	msg := NewMessage(MsgError)
+	msg.Error = err.Error()
+	var errno unix.Errno
+	if errors.As(err, &errno) {
+		msg.Errno = int(errno)
+	}
+	return msg
+}
+
+// Send writes the JSON encoded message to conn.
+func Send(conn net.Conn, msg Message) error {
+	return json.NewEncoder(conn).Encode(msg)
+}
+
+// Receive reads the next message from dec.
+// An InitError is returned if the message type is MsgError.
+// io.EOF is returned if the connection was closed.
+func Receive(dec *json.Decoder) (*Message, error) {
+	msg := new(Message)
+	if err := dec.Decode(msg); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+	if msg.Version != Version {
+		return msg, fmt.Errorf("protocol version mismatch (expected %d but was %d)", Version, msg.Version)
+	}
+	if msg.Type == MsgError {
+		return msg, &InitError{Errno: unix.Errno(msg.Errno), Msg: msg.Error}
+	}
+	return msg, nil
+}
+
+// Expect reads the next message from dec and returns an error
+// if the message type is not the expected type.
+func Expect(dec *json.Decoder, t MessageType) error {
+	msg, err := Receive(dec)
+	if err == io.EOF {
+		return fmt.Errorf("connection closed while waiting for %q", t)
+	}
+	if err != nil {
+		return err
+	}
+	if msg.Type != t {
+		return fmt.Errorf("unexpected message %q (expected %q)", msg.Type, t)
+	}
+	return nil
+}
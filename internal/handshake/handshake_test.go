@@ -0,0 +1,35 @@
+package handshake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestHandshake(t *testing.T) {
+	a, b := net.Pipe()
+
+	go func() {
+		_ = Send(a, NewMessage(MsgReady))
+		_ = Send(a, NewError(fmt.Errorf("exec failed: %w", unix.ENOENT)))
+		a.Close()
+	}()
+
+	dec := json.NewDecoder(b)
+	require.NoError(t, Expect(dec, MsgReady))
+
+	_, err := Receive(dec)
+	var initErr *InitError
+	require.True(t, errors.As(err, &initErr))
+	require.True(t, errors.Is(err, unix.ENOENT))
+	require.Equal(t, "exec failed: no such file or directory", initErr.Msg)
+
+	_, err = Receive(dec)
+	require.Equal(t, io.EOF, err)
+}
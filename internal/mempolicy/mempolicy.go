@@ -0,0 +1,130 @@
+// Package mempolicy parses and applies NUMA memory policies.
+// See `man 2 set_mempolicy` and `man 7 numa`.
+package mempolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Annotation is the container spec annotation that defines the memory policy
+// of the container process. The format is `<mode>[:<nodes>]`,
+// where nodes is a comma separated list of NUMA nodes and node ranges.
+// e.g `interleave:0-3` or `bind:0,2`
+const Annotation = "org.linuxcontainers.lxcri.MemoryPolicy"
+
+// Memory policy modes from linux/mempolicy.h
+const (
+	ModeDefault    = 0
+	ModePreferred  = 1
+	ModeBind       = 2
+	ModeInterleave = 3
+	ModeLocal      = 4
+)
+
+var modes = map[string]int{
+	"default":    ModeDefault,
+	"preferred":  ModePreferred,
+	"bind":       ModeBind,
+	"interleave": ModeInterleave,
+	"local":      ModeLocal,
+}
+
+// Policy is a NUMA memory policy.
+type Policy struct {
+	Mode  int
+	Nodes []uint
+}
+
+// Parse parses the memory policy from the given string.
+func Parse(s string) (*Policy, error) {
+	vals := strings.SplitN(s, ":", 2)
+	mode, ok := modes[vals[0]]
+	if !ok {
+		return nil, fmt.Errorf("invalid memory policy mode %q", vals[0])
+	}
+	p := &Policy{Mode: mode}
+	if len(vals) == 2 {
+		nodes, err := parseNodes(vals[1])
+		if err != nil {
+			return nil, err
+		}
+		p.Nodes = nodes
+	}
+
+	switch p.Mode {
+	case ModeDefault, ModeLocal:
+		if len(p.Nodes) > 0 {
+			return nil, fmt.Errorf("memory policy %q does not accept nodes", vals[0])
+		}
+	case ModeBind, ModeInterleave:
+		if len(p.Nodes) == 0 {
+			return nil, fmt.Errorf("memory policy %q requires nodes", vals[0])
+		}
+	}
+	return p, nil
+}
+
+// parseNodes parses a node list like `0-3,5`
+func parseNodes(s string) ([]uint, error) {
+	var nodes []uint
+	for _, r := range strings.Split(s, ",") {
+		if r == "" {
+			continue
+		}
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node %q: %w", bounds[0], err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node %q: %w", bounds[1], err)
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid node range %q", r)
+		}
+		for n := first; n <= last; n++ {
+			nodes = append(nodes, uint(n))
+		}
+	}
+	return nodes, nil
+}
+
+// nodemask returns the nodes as bitmask.
+func (p *Policy) nodemask() []uint64 {
+	var mask []uint64
+	for _, n := range p.Nodes {
+		i := int(n / 64)
+		for len(mask) <= i {
+			mask = append(mask, 0)
+		}
+		mask[i] |= 1 << (n % 64)
+	}
+	return mask
+}
+
+// Set sets the memory policy of the calling thread.
+// The memory policy is inherited by child processes and preserved across execve.
+func Set(p *Policy) error {
+	mask := p.nodemask()
+	var maskp uintptr
+	var maxnode uintptr
+	if len(mask) > 0 {
+		maskp = uintptr(unsafe.Pointer(&mask[0]))
+		// The kernel ignores the last bit of maxnode (like numactl does, add one).
+		maxnode = uintptr(len(mask)*64 + 1)
+	}
+	_, _, errno := unix.Syscall(unix.SYS_SET_MEMPOLICY, uintptr(p.Mode), maskp, maxnode)
+	if errno != 0 {
+		return fmt.Errorf("set_mempolicy failed: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package mempolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse("interleave:0-2,5")
+	require.NoError(t, err)
+	require.Equal(t, ModeInterleave, p.Mode)
+	require.Equal(t, []uint{0, 1, 2, 5}, p.Nodes)
+	require.Equal(t, []uint64{0x27}, p.nodemask())
+
+	p, err = Parse("bind:64")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1}, p.nodemask())
+
+	p, err = Parse("local")
+	require.NoError(t, err)
+	require.Equal(t, ModeLocal, p.Mode)
+
+	_, err = Parse("bind")
+	require.Error(t, err)
+
+	_, err = Parse("local:1")
+	require.Error(t, err)
+
+	_, err = Parse("interleave:3-1")
+	require.Error(t, err)
+
+	_, err = Parse("spread:1")
+	require.Error(t, err)
+}
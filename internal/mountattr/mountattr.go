@@ -0,0 +1,63 @@
+// Package mountattr provides the mount_setattr(2) system call,
+// which is not available in golang.org/x/sys/unix yet.
+package mountattr
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The system call number is the same for all architectures.
+// See `man 2 mount_setattr`, available since Linux 5.12.
+const sysMountSetattr = 442
+
+// Flags from linux/mount.h and linux/fcntl.h
+const (
+	// AttrRdonly is MOUNT_ATTR_RDONLY
+	AttrRdonly = 0x00000001
+	// AtRecursive is AT_RECURSIVE
+	AtRecursive = 0x8000
+)
+
+// MountAttr is the struct mount_attr from linux/mount.h
+type MountAttr struct {
+	AttrSet     uint64
+	AttrClr     uint64
+	Propagation uint64
+	UsernsFd    uint64
+}
+
+// MountSetattr calls mount_setattr(2) with the given arguments.
+func MountSetattr(dirfd int, path string, flags uint, attr *MountAttr) error {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall6(sysMountSetattr, uintptr(dirfd), uintptr(unsafe.Pointer(p)),
+		uintptr(flags), uintptr(unsafe.Pointer(attr)), unsafe.Sizeof(*attr), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// SetReadonlyRecursive makes the mount at path and all submounts read-only.
+func SetReadonlyRecursive(path string) error {
+	attr := MountAttr{AttrSet: AttrRdonly}
+	return MountSetattr(unix.AT_FDCWD, path, AtRecursive, &attr)
+}
+
+// ClearReadonly makes the mount at path writable.
+// The submounts are not changed.
+func ClearReadonly(path string) error {
+	attr := MountAttr{AttrClr: AttrRdonly}
+	return MountSetattr(unix.AT_FDCWD, path, 0, &attr)
+}
+
+// Supported returns true if the kernel implements mount_setattr(2).
+func Supported() bool {
+	// An invalid file descriptor returns EBADF if the system call is implemented.
+	err := MountSetattr(-1, "", 0, &MountAttr{})
+	return err != unix.ENOSYS
+}
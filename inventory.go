@@ -0,0 +1,218 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// HostInventory describes the host resources that are relevant
+// to decide whether (and how) containers can be run with lxcri.
+type HostInventory struct {
+	Kernel         string
+	LXCVersion     string
+	Cgroup         CgroupInventory
+	UserNamespaces UserNamespaceInventory
+	Hugepages      []HugepagePool    `json:",omitempty"`
+	Devices        []DeviceInventory `json:",omitempty"`
+	Security       SecurityInventory
+}
+
+// CgroupInventory describes the cgroup hierarchy used by the runtime.
+type CgroupInventory struct {
+	Root string
+	// Version is the cgroup version of the controllers.
+	// With cgroup v1 (legacy or hybrid mode) Controllers and SubtreeControl are empty.
+	Version int
+	// Controllers are the controllers available in the cgroup root.
+	Controllers []string `json:",omitempty"`
+	// SubtreeControl are the controllers enabled for the child cgroups.
+	SubtreeControl []string `json:",omitempty"`
+}
+
+// UserNamespaceInventory describes the user namespace limits of the host.
+type UserNamespaceInventory struct {
+	// MaxUserNamespaces is the value of /proc/sys/user/max_user_namespaces.
+	MaxUserNamespaces uint64
+	// UnprivilegedClone is the value of /proc/sys/kernel/unprivileged_userns_clone.
+	// It is nil if the kernel does not provide the setting.
+	UnprivilegedClone *bool `json:",omitempty"`
+}
+
+// HugepagePool is a pool of hugepages with the same page size.
+type HugepagePool struct {
+	// Size is the page size as used by the cgroup hugetlb controller e.g `2MB`
+	Size  string
+	Total uint64
+	Free  uint64
+}
+
+// DeviceInventory is a device that is usually passed through to containers.
+type DeviceInventory struct {
+	Path  string
+	Class string
+	Type  string
+	Major int64
+	Minor int64
+}
+
+// SecurityInventory describes the status of the linux security modules.
+type SecurityInventory struct {
+	AppArmor bool
+	// SELinux is one of `enforcing`, `permissive` or `disabled`
+	SELinux string
+}
+
+// inventoryDevices are the glob patterns for devices (mostly GPUs)
+// that are passed through to containers, mapped to their device class.
+var inventoryDevices = map[string]string{
+	"/dev/dri/card*":         "gpu",
+	"/dev/dri/renderD*":      "gpu",
+	"/dev/nvidia[0-9]*":      "gpu",
+	"/dev/nvidiactl":         "gpu",
+	"/dev/nvidia-uvm":        "gpu",
+	"/dev/kfd":               "gpu",
+	"/dev/fuse":              "fuse",
+	"/dev/kvm":               "kvm",
+	"/dev/net/tun":           "net",
+	"/dev/vhost-net":         "net",
+	"/dev/infiniband/*":      "infiniband",
+	"/dev/vfio/[0-9]*":       "vfio",
+	"/dev/sgx_enclave":       "sgx",
+	"/dev/sgx_provision":     "sgx",
+	"/dev/accel/accel[0-9]*": "accelerator",
+}
+
+// Inventory returns the inventory of host resources.
+// Runtime.Init must be called before, because the cgroup root
+// is detected by Runtime.Init.
+func (rt *Runtime) Inventory() (*HostInventory, error) {
+	inv := &HostInventory{
+		LXCVersion: lxc.Version(),
+		Cgroup:     CgroupInventory{Root: cgroupRoot, Version: cgroups.version()},
+	}
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return nil, errorf("uname failed: %w", err)
+	}
+	inv.Kernel = nullTerminatedString(uts.Release[:])
+
+	inv.Cgroup.Controllers = readFields(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	inv.Cgroup.SubtreeControl = readFields(filepath.Join(cgroupRoot, "cgroup.subtree_control"))
+
+	if n, err := readUint("/proc/sys/user/max_user_namespaces"); err == nil {
+		inv.UserNamespaces.MaxUserNamespaces = n
+	}
+	if n, err := readUint("/proc/sys/kernel/unprivileged_userns_clone"); err == nil {
+		enabled := n != 0
+		inv.UserNamespaces.UnprivilegedClone = &enabled
+	}
+
+	pools, err := readHugepagePools("/sys/kernel/mm/hugepages")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errorf("failed to read hugepage pools: %w", err)
+	}
+	inv.Hugepages = pools
+
+	inv.Devices = findDevices(inventoryDevices)
+
+	if data, err := os.ReadFile("/sys/module/apparmor/parameters/enabled"); err == nil {
+		inv.Security.AppArmor = strings.TrimSpace(string(data)) == "Y"
+	}
+	inv.Security.SELinux = "disabled"
+	if n, err := readUint("/sys/fs/selinux/enforce"); err == nil {
+		inv.Security.SELinux = "permissive"
+		if n == 1 {
+			inv.Security.SELinux = "enforcing"
+		}
+	}
+	return inv, nil
+}
+
+// readFields returns the whitespace separated fields of the given file.
+// Nil is returned if the file can not be read.
+func readFields(filename string) []string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+func readUint(filename string) (uint64, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readHugepagePools reads the hugepage pools from the given sysfs directory
+// e.g /sys/kernel/mm/hugepages/hugepages-2048kB
+func readHugepagePools(dir string) ([]HugepagePool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var pools []HugepagePool
+	for _, e := range entries {
+		s := strings.TrimPrefix(e.Name(), "hugepages-")
+		if s == e.Name() || !strings.HasSuffix(s, "kB") {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(s, "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		pool := HugepagePool{Size: hugepageSizeString(kb)}
+		if pool.Total, err = readUint(filepath.Join(dir, e.Name(), "nr_hugepages")); err != nil {
+			return nil, err
+		}
+		if pool.Free, err = readUint(filepath.Join(dir, e.Name(), "free_hugepages")); err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// hugepageSizeString formats the page size like the cgroup hugetlb controller
+// (e.g `hugetlb.2MB.max`).
+func hugepageSizeString(kb uint64) string {
+	switch {
+	case kb >= 1<<20 && kb%(1<<20) == 0:
+		return strconv.FormatUint(kb>>20, 10) + "GB"
+	case kb >= 1<<10 && kb%(1<<10) == 0:
+		return strconv.FormatUint(kb>>10, 10) + "MB"
+	default:
+		return strconv.FormatUint(kb, 10) + "KB"
+	}
+}
+
+// findDevices returns the device files matching the given glob patterns.
+func findDevices(patterns map[string]string) []DeviceInventory {
+	var devices []DeviceInventory
+	for pattern, class := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, p := range matches {
+			dev, err := hostDevice(p)
+			if err != nil {
+				continue
+			}
+			devices = append(devices, DeviceInventory{
+				Path: p, Class: class, Type: dev.Type, Major: dev.Major, Minor: dev.Minor,
+			})
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Path < devices[j].Path })
+	return devices
+}
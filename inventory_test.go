@@ -0,0 +1,37 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHugepagePools(t *testing.T) {
+	dir := t.TempDir()
+	pools := map[string][2]string{
+		"hugepages-2048kB":    {"64", "32"},
+		"hugepages-1048576kB": {"2", "0"},
+	}
+	for name, v := range pools {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.Mkdir(p, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(p, "nr_hugepages"), []byte(v[0]+"\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(p, "free_hugepages"), []byte(v[1]+"\n"), 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "unrelated"), 0755))
+
+	res, err := readHugepagePools(dir)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []HugepagePool{
+		{Size: "2MB", Total: 64, Free: 32},
+		{Size: "1GB", Total: 2, Free: 0},
+	}, res)
+}
+
+func TestHugepageSizeString(t *testing.T) {
+	require.Equal(t, "64KB", hugepageSizeString(64))
+	require.Equal(t, "2MB", hugepageSizeString(2048))
+	require.Equal(t, "1GB", hugepageSizeString(1048576))
+}
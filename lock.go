@@ -0,0 +1,156 @@
+package lxcri
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"golang.org/x/sys/unix"
+)
+
+// Concurrency contract
+//
+// Multiple processes (e.g the CLI, a shim and a metrics agent) may use
+// Runtime instances that share the same Runtime.Root concurrently.
+//
+// * Operations that change the container state (Runtime.Create, Runtime.Start
+//   and Runtime.Delete) hold an exclusive advisory lock (flock(2)) on the
+//   container runtime directory. Concurrent state changes of the same container
+//   are serialized, changes of different containers do not block each other.
+// * Runtime.Create fails with ErrExist if the container runtime directory exists.
+//   The runtime directory is locked before it is created (renamed from a
+//   temporary directory), so it is never visible to Runtime.Delete unlocked.
+// * Read operations (Runtime.Load, Runtime.List, Container.State ...) are lock-free.
+//   The container state (lxcri.json) is written atomically, so readers either see
+//   the complete state or no state at all (the container is still being created).
+// * The runtime root is locked exclusively while the resource
+//   reservations are checked and the reservation of the new container
+//   is recorded (see Runtime.ResourceLimits).
+//
+// Advisory locks are only reliable if Runtime.Root is on a local filesystem.
+
+// flockDir acquires the advisory lock how (unix.LOCK_EX or unix.LOCK_SH) on the given directory.
+// The lock is held until the returned unlock function is called.
+// An error that matches os.ErrNotExist is returned if dir was removed (or replaced
+// by a different directory) while waiting for the lock.
+func flockDir(dir string, how int) (unlock func(), err error) {
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	unlock = func() {
+		// the lock is released when the file descriptor is closed
+		unix.Close(fd)
+	}
+	if err := unix.Flock(fd, how); err != nil {
+		unlock()
+		return nil, &os.PathError{Op: "flock", Path: dir, Err: err}
+	}
+	// The lock is held on the inode, ensure that dir still refers to it.
+	var locked, current unix.Stat_t
+	if err := unix.Fstat(fd, &locked); err != nil {
+		unlock()
+		return nil, &os.PathError{Op: "fstat", Path: dir, Err: err}
+	}
+	if err := unix.Stat(dir, &current); err != nil {
+		unlock()
+		return nil, &os.PathError{Op: "stat", Path: dir, Err: err}
+	}
+	if locked.Dev != current.Dev || locked.Ino != current.Ino {
+		unlock()
+		return nil, &os.PathError{Op: "flock", Path: dir, Err: unix.ENOENT}
+	}
+	return unlock, nil
+}
+
+// lockContainer acquires the exclusive lock on the container runtime directory.
+// ErrNotExist is returned if the runtime directory does not exist,
+// or if it was deleted (and possibly re-created) while waiting for the lock.
+func (rt *Runtime) lockContainer(containerID string) (unlock func(), err error) {
+	if err := rt.checkContainerID(containerID); err != nil {
+		return nil, errorf("failed to lock container: %w", err)
+	}
+	dir := rt.runtimeDir(containerID)
+	unlock, err = flockDir(dir, unix.LOCK_EX)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, errorf("failed to lock container: %w", err)
+	}
+	return unlock, nil
+}
+
+// createDirLocked creates the directory dir and returns with the exclusive lock
+// held on it. The directory is created and locked with a temporary (hidden) name
+// in the same parent directory, initialized by the prepare function, and renamed
+// to dir, which must not exist (like os.Mkdir). ErrExist is returned if dir exists.
+func createDirLocked(dir string, perm os.FileMode, prepare func(tmp string) error) (unlock func(), err error) {
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	unlockTmp, err := flockDir(tmp, unix.LOCK_EX)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			unlockTmp()
+			os.RemoveAll(tmp)
+		}
+	}()
+	if err := os.Chmod(tmp, perm); err != nil {
+		return nil, err
+	}
+	if err := prepare(tmp); err != nil {
+		return nil, err
+	}
+	// Unlike rename(2) without flags, an existing empty directory is not replaced.
+	err = unix.Renameat2(unix.AT_FDCWD, tmp, unix.AT_FDCWD, dir, unix.RENAME_NOREPLACE)
+	if err == unix.EEXIST {
+		return nil, ErrExist
+	}
+	if err != nil {
+		return nil, &os.LinkError{Op: "rename", Old: tmp, New: dir, Err: err}
+	}
+	return unlockTmp, nil
+}
+
+// encodeJSONFileAtomic writes the JSON encoded value v to a temporary file,
+// which is hard-linked to filename. Readers never see a partially written file.
+// Like O_EXCL an error is returned if filename already exists.
+func encodeJSONFileAtomic(filename string, v interface{}, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := specki.EncodeJSONFile(tmp, v, os.O_EXCL|os.O_CREATE|os.O_SYNC, perm); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, filename); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
+
+// replaceJSONFileAtomic is like encodeJSONFileAtomic,
+// but an existing filename is replaced.
+func replaceJSONFileAtomic(filename string, v interface{}, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := specki.EncodeJSONFile(tmp, v, os.O_EXCL|os.O_CREATE|os.O_SYNC, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
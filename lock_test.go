@@ -0,0 +1,112 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestLockContainer(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	_, err := rt.lockContainer("c1")
+	require.Equal(t, ErrNotExist, err)
+
+	require.NoError(t, os.Mkdir(filepath.Join(rt.Root, "c1"), 0755))
+	unlock, err := rt.lockContainer("c1")
+	require.NoError(t, err)
+
+	// the lock is exclusive
+	fd, err := unix.Open(filepath.Join(rt.Root, "c1"), unix.O_RDONLY|unix.O_DIRECTORY, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	require.Equal(t, unix.EWOULDBLOCK, unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB))
+
+	unlock()
+	require.NoError(t, unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB))
+}
+
+func TestLockContainerReplaced(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	dir := filepath.Join(rt.Root, "c1")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	unlock, err := rt.lockContainer("c1")
+	require.NoError(t, err)
+
+	errc := make(chan error, 1)
+	go func() {
+		unlock, err := rt.lockContainer("c1")
+		if err == nil {
+			unlock()
+		}
+		errc <- err
+	}()
+
+	// Wait until the waiter has opened the old directory.
+	time.Sleep(100 * time.Millisecond)
+	// The directory is deleted and re-created by another Create.
+	require.NoError(t, os.Remove(dir))
+	require.NoError(t, os.Mkdir(dir, 0755))
+	unlock()
+	require.Equal(t, ErrNotExist, <-errc)
+}
+
+func TestEncodeJSONFileAtomic(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, encodeJSONFileAtomic(p, map[string]int{"a": 1}, 0640))
+
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.Equal(t, "{\"a\":1}\n", string(data))
+	_, err = os.Stat(p + ".tmp")
+	require.True(t, os.IsNotExist(err))
+
+	// like O_EXCL the file is not replaced
+	require.Error(t, encodeJSONFileAtomic(p, map[string]int{"a": 2}, 0640))
+}
+
+func TestReplaceJSONFileAtomic(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, encodeJSONFileAtomic(p, map[string]int{"a": 1}, 0640))
+	require.NoError(t, replaceJSONFileAtomic(p, map[string]int{"a": 2}, 0640))
+
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.Equal(t, "{\"a\":2}\n", string(data))
+	_, err = os.Stat(p + ".tmp")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCreateDirLocked(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	dir := filepath.Join(rt.Root, "c1")
+	unlock, err := createDirLocked(dir, 0750, func(tmp string) error {
+		return os.WriteFile(filepath.Join(tmp, "file"), nil, 0600)
+	})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+
+	// the directory is locked when it becomes visible
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	require.Equal(t, unix.EWOULDBLOCK, unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB))
+	unlock()
+
+	// an existing (empty) directory is not replaced
+	_, err = createDirLocked(dir, 0750, func(string) error { return nil })
+	require.Equal(t, ErrExist, err)
+	require.NoError(t, os.RemoveAll(dir))
+	require.NoError(t, os.Mkdir(dir, 0750))
+	_, err = createDirLocked(dir, 0750, func(string) error { return nil })
+	require.Equal(t, ErrExist, err)
+
+	// the temporary directories are removed
+	ids, err := os.ReadDir(rt.Root)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+}
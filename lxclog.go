@@ -0,0 +1,254 @@
+package lxcri
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// LogOptions select the liblxc log lines returned by Container.ReadLog.
+type LogOptions struct {
+	// Level is the minimum liblxc log level (e.g warn).
+	// Lines of all levels are returned if Level is empty.
+	Level string
+	// Tail is the number of lines returned from the end of the existing log.
+	// All lines are returned if Tail is negative.
+	Tail int
+	// Follow waits for new lines (like `tail -f`) until the context is done.
+	Follow bool
+}
+
+// liblxc log levels as written to the log file.
+var containerLogLevels = map[string]bool{
+	"trace": true, "debug": true, "info": true, "notice": true, "warn": true,
+	"error": true, "crit": true, "alert": true, "fatal": true,
+}
+
+// ReadLog calls fn for every line of the container in the liblxc log file.
+// Lines of other containers (e.g if the log file is shared) are skipped.
+// With LogOptions.Follow the log file is watched with inotify for new lines.
+// If the log file is rotated or truncated, it is read again from the start.
+func (c *Container) ReadLog(ctx context.Context, opts LogOptions, fn func(line string)) error {
+	if opts.Level != "" && !containerLogLevels[strings.ToLower(opts.Level)] {
+		return fmt.Errorf("invalid log level %q", opts.Level)
+	}
+	if c.LogFile == "" {
+		return fmt.Errorf("container has no log file")
+	}
+	fi, err := os.Stat(c.LogFile)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("log file %s is not a regular file", c.LogFile)
+	}
+
+	r := &lxcLogReader{containerID: c.ContainerID, level: opts.Level}
+
+	var watch *os.File
+	var fd, wd int
+	if opts.Follow {
+		// Add the watch before the file is read, so no write is missed.
+		fd, err = unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+		if err != nil {
+			return fmt.Errorf("inotify_init1 failed: %w", err)
+		}
+		// The file is pollable, so a pending read returns when the file is closed.
+		watch = os.NewFile(uintptr(fd), "inotify")
+		defer watch.Close()
+		if wd, err = addLogWatch(fd, c.LogFile); err != nil {
+			return err
+		}
+	}
+
+	if err := r.open(c.LogFile); err != nil {
+		return err
+	}
+	defer r.close()
+
+	var tail []string
+	err = r.readLines(func(line string) {
+		if opts.Tail < 0 {
+			fn(line)
+			return
+		}
+		tail = append(tail, line)
+		if len(tail) > opts.Tail {
+			tail = tail[1:]
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range tail {
+		fn(line)
+	}
+	if !opts.Follow {
+		return nil
+	}
+
+	go func() {
+		<-ctx.Done()
+		watch.Close()
+	}()
+	buf := make([]byte, unix.SizeofInotifyEvent*64)
+	for {
+		n, err := watch.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read inotify events: %w", err)
+		}
+		rotated := false
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if int(ev.Wd) == wd {
+				rotated = rotated || ev.Mask&(unix.IN_MOVE_SELF|unix.IN_DELETE_SELF) != 0
+			}
+			offset += unix.SizeofInotifyEvent + int(ev.Len)
+		}
+		// Read the remaining lines of a rotated file before the new file is opened.
+		if err := r.readLines(fn); err != nil {
+			return err
+		}
+		if rotated {
+			// #nosec
+			unix.InotifyRmWatch(fd, uint32(wd))
+			perr := pollUntil(ctx, c.sysClock(), 0, 100*time.Millisecond, func() (bool, error) {
+				wd, err = addLogWatch(fd, c.LogFile)
+				// the new log file is not created yet
+				return !errors.Is(err, unix.ENOENT), nil
+			})
+			if perr != nil {
+				return nil
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			r.close()
+			if err := r.open(c.LogFile); err != nil {
+				return err
+			}
+		} else if truncated, err := r.truncated(); err != nil {
+			return err
+		} else if truncated {
+			if err := r.rewind(); err != nil {
+				return err
+			}
+		}
+		if err := r.readLines(fn); err != nil {
+			return err
+		}
+	}
+}
+
+// addLogWatch watches the log file for writes and rotation.
+func addLogWatch(fd int, filename string) (int, error) {
+	mask := uint32(unix.IN_MODIFY | unix.IN_MOVE_SELF | unix.IN_DELETE_SELF)
+	wd, err := unix.InotifyAddWatch(fd, filename, mask)
+	if err != nil {
+		return -1, fmt.Errorf("failed to watch %s: %w", filename, err)
+	}
+	return wd, nil
+}
+
+// lxcLogReader reads the liblxc log lines of a container.
+type lxcLogReader struct {
+	containerID string
+	level       string
+
+	f       *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+}
+
+func (r *lxcLogReader) open(filename string) error {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.reader = bufio.NewReader(f)
+	r.offset = 0
+	r.partial = ""
+	return nil
+}
+
+func (r *lxcLogReader) close() {
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
+
+// truncated returns true if the file is smaller than the read offset.
+func (r *lxcLogReader) truncated() (bool, error) {
+	fi, err := r.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return fi.Size() < r.offset, nil
+}
+
+func (r *lxcLogReader) rewind() error {
+	if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r.reader.Reset(r.f)
+	r.offset = 0
+	r.partial = ""
+	return nil
+}
+
+// readLines calls fn for each complete line until the end of the file.
+// An incomplete line at the end of the file is kept until it is completed.
+func (r *lxcLogReader) readLines(fn func(line string)) error {
+	for {
+		line, err := r.reader.ReadString('\n')
+		r.offset += int64(len(line))
+		if err == io.EOF {
+			r.partial += line
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+		line = strings.TrimSuffix(r.partial+line, "\n")
+		r.partial = ""
+		if r.matches(line) {
+			fn(line)
+		}
+	}
+}
+
+// matches returns true if the line is a liblxc log line of the container
+// with at least the minimum log level, e.g
+// `lxc c1 20210101120000.000 ERROR start - start.c:1 - failed`
+func (r *lxcLogReader) matches(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "lxc" || fields[1] != r.containerID {
+		return false
+	}
+	if r.level == "" {
+		return true
+	}
+	level := strings.ToLower(fields[3])
+	if !containerLogLevels[level] {
+		return false
+	}
+	return parseContainerLogLevel(level) >= parseContainerLogLevel(r.level)
+}
@@ -0,0 +1,103 @@
+package lxcri
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testLxcLog = `lxc c1 20210101 DEBUG conf - conf.c:1 - debug 1
+lxc c2 20210101 ERROR start - start.c:1 - other container
+lxc c1 20210101 WARN start - start.c:1 - warn 1
+not a liblxc log line
+lxc c1 20210101 ERROR start - start.c:1 - error 1
+`
+
+func readLogLines(t *testing.T, c *Container, opts LogOptions) []string {
+	var lines []string
+	err := c.ReadLog(context.Background(), opts, func(line string) {
+		lines = append(lines, line)
+	})
+	require.NoError(t, err)
+	return lines
+}
+
+func TestReadLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "lxc.log")
+	require.NoError(t, os.WriteFile(logFile, []byte(testLxcLog), 0600))
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1", LogFile: logFile}}
+
+	lines := readLogLines(t, c, LogOptions{Tail: -1})
+	require.Equal(t, []string{
+		"lxc c1 20210101 DEBUG conf - conf.c:1 - debug 1",
+		"lxc c1 20210101 WARN start - start.c:1 - warn 1",
+		"lxc c1 20210101 ERROR start - start.c:1 - error 1",
+	}, lines)
+
+	lines = readLogLines(t, c, LogOptions{Tail: -1, Level: "warn"})
+	require.Equal(t, []string{
+		"lxc c1 20210101 WARN start - start.c:1 - warn 1",
+		"lxc c1 20210101 ERROR start - start.c:1 - error 1",
+	}, lines)
+
+	lines = readLogLines(t, c, LogOptions{Tail: 1})
+	require.Equal(t, []string{"lxc c1 20210101 ERROR start - start.c:1 - error 1"}, lines)
+
+	lines = readLogLines(t, c, LogOptions{Tail: 0})
+	require.Empty(t, lines)
+
+	err := c.ReadLog(context.Background(), LogOptions{Level: "verbose"}, func(string) {})
+	require.Error(t, err)
+}
+
+func TestReadLogFollow(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "lxc.log")
+	require.NoError(t, os.WriteFile(logFile, []byte(testLxcLog), 0600))
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1", LogFile: logFile}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	lines := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.ReadLog(ctx, LogOptions{Tail: 0, Level: "error", Follow: true}, func(line string) {
+			lines <- line
+		})
+	}()
+	nextLine := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case err := <-done:
+			t.Fatalf("ReadLog returned: %v", err)
+		}
+		return ""
+	}
+
+	// wait until the watch is added
+	time.Sleep(time.Millisecond * 100)
+
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	// incomplete lines are not returned until completed
+	_, err = f.WriteString("lxc c1 20210101 ERROR start - start.c:1 - ")
+	require.NoError(t, err)
+	_, err = f.WriteString("error 2\nlxc c1 20210101 INFO start - start.c:1 - info 2\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, "lxc c1 20210101 ERROR start - start.c:1 - error 2", nextLine())
+
+	// rotate the log file
+	require.NoError(t, os.Rename(logFile, logFile+".1"))
+	require.NoError(t, os.WriteFile(logFile, []byte("lxc c1 20210101 FATAL start - start.c:1 - fatal 3\n"), 0600))
+	require.Equal(t, "lxc c1 20210101 FATAL start - start.c:1 - fatal 3", nextLine())
+
+	cancel()
+	require.NoError(t, <-done)
+	require.Empty(t, lines)
+}
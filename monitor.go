@@ -0,0 +1,91 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// monitorProcess reaps the monitor process started by this runtime process.
+// The exit status of the monitor is only available to the parent process,
+// and it is lost if the monitor is reaped elsewhere (e.g by isMonitorRunning).
+type monitorProcess struct {
+	done  chan struct{}
+	state *os.ProcessState
+	err   error
+}
+
+// startMonitorReaper waits for the monitor process p in a goroutine.
+func startMonitorReaper(p *os.Process) *monitorProcess {
+	m := &monitorProcess{done: make(chan struct{})}
+	go func() {
+		m.state, m.err = p.Wait()
+		close(m.done)
+	}()
+	return m
+}
+
+func (m *monitorProcess) exited() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// MonitorExitError is returned by Runtime.Create (wrapped into a StartError)
+// if the monitor process exits before the container init process is ready.
+// The StartError contains the captured monitor stderr (see StartError.MonitorOutput).
+type MonitorExitError struct {
+	// State is the state of the exited monitor process.
+	// It is nil if the monitor process could not be waited for.
+	State *os.ProcessState
+}
+
+func (e *MonitorExitError) Error() string {
+	if e.State == nil {
+		return "monitor process exited"
+	}
+	return "monitor process exited: " + e.State.String()
+}
+
+// ExitCode returns the exit code of the monitor process,
+// or -1 if the monitor process was killed by a signal or the state is unknown.
+func (e *MonitorExitError) ExitCode() int {
+	if e.State == nil {
+		return -1
+	}
+	return e.State.ExitCode()
+}
+
+// cancelOnMonitorExit returns a context that is cancelled when the
+// monitor process exits, so waiting for the container init is
+// aborted immediately.
+func (c *Container) cancelOnMonitorExit(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if c.monitor == nil {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-c.monitor.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// createError distinguishes an exited monitor process
+// from a timeout while waiting for the container init process.
+func (c *Container) createError(err error) error {
+	if c.monitor != nil && c.monitor.exited() {
+		return &MonitorExitError{State: c.monitor.state}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s", ErrInitTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorExitError(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "exit 3")
+	require.NoError(t, cmd.Start())
+
+	c := &Container{ContainerConfig: &ContainerConfig{Log: zerolog.Nop()}, Pid: cmd.Process.Pid}
+	c.monitor = startMonitorReaper(cmd.Process)
+
+	ctx, cancel := c.cancelOnMonitorExit(context.Background())
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("context not cancelled on monitor exit")
+	}
+	require.False(t, c.isMonitorRunning())
+
+	err := c.createError(ctx.Err())
+	var exitErr *MonitorExitError
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, 3, exitErr.ExitCode())
+	require.Equal(t, "monitor process exited: exit status 3", err.Error())
+}
+
+func TestInitTimeoutError(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	c := &Container{ContainerConfig: &ContainerConfig{Log: zerolog.Nop()}, Pid: cmd.Process.Pid}
+	c.monitor = startMonitorReaper(cmd.Process)
+	require.True(t, c.isMonitorRunning())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err := c.createError(ctx.Err())
+	require.True(t, errors.Is(err, ErrInitTimeout))
+}
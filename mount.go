@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 )
 
 func removeMountOptions(rt *Runtime, fs string, opts []string, unsupported ...string) []string {
@@ -28,6 +31,17 @@ func removeMountOptions(rt *Runtime, fs string, opts []string, unsupported ...st
 	return supported
 }
 
+func replaceMountOption(opts []string, old string, new string) []string {
+	replaced := make([]string, 0, len(opts))
+	for _, o := range opts {
+		if o == old {
+			o = new
+		}
+		replaced = append(replaced, o)
+	}
+	return replaced
+}
+
 func filterMountOptions(rt *Runtime, fs string, opts []string) []string {
 	switch fs {
 	case "sysfs":
@@ -42,30 +56,175 @@ func filterMountOptions(rt *Runtime, fs string, opts []string) []string {
 	return opts
 }
 
+// mountDepth returns the number of path elements of the given mount destination.
+func mountDepth(dst string) int {
+	p := strings.Trim(filepath.Clean("/"+dst), "/")
+	if p == "" {
+		return 0
+	}
+	return strings.Count(p, "/") + 1
+}
+
+// sortMounts sorts the given mounts by the depth of the mount destination.
+// The sort is stable, so mounts with the same depth keep their order.
+// Parent mounts (e.g an emptyDir volume at /var/lib) are mounted before
+// nested mounts (e.g /var/lib/foo), which would be shadowed otherwise.
+func sortMounts(mounts []specs.Mount) {
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return mountDepth(mounts[i].Destination) < mountDepth(mounts[j].Destination)
+	})
+}
+
+// isPathPrefix returns true if p equals prefix or
+// if p is a path below the directory prefix.
+func isPathPrefix(p string, prefix string) bool {
+	return p == prefix || strings.HasPrefix(p, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// isBelowAny returns true if p is nested below any of the given directories.
+func isBelowAny(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if p != dir && isPathPrefix(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentBindMount returns the bind mount from mounts with the longest destination
+// path that contains the given destination dst, or nil if there is none.
+func parentBindMount(mounts []specs.Mount, dst string) *specs.Mount {
+	var parent *specs.Mount
+	for i, m := range mounts {
+		if m.Destination == dst || !isPathPrefix(dst, m.Destination) {
+			continue
+		}
+		if parent == nil || len(m.Destination) > len(parent.Destination) {
+			parent = &mounts[i]
+		}
+	}
+	return parent
+}
+
+// maxSymlinks is the maximum number of symlinks that are followed
+// when a path is resolved (like MAXSYMLINKS in the kernel).
+const maxSymlinks = 40
+
+// resolveNestedMountDestination resolves the mount destination dst within the container
+// view of the rootfs, where the given bind mounts shadow the rootfs.
+// Symlinks are resolved like within the container: Absolute symlinks are relative
+// to the container root and relative symlinks are relative to the directory
+// of the symlink, where `..` can not escape the container root.
+// The resolved destination is returned as path within rootfs.
+func resolveNestedMountDestination(rootfs string, mounts []specs.Mount, dst string) (string, error) {
+	// hostPath returns the host path of the container path p.
+	hostPath := func(p string) string {
+		var mount *specs.Mount
+		for i, m := range mounts {
+			if isPathPrefix(p, m.Destination) && (mount == nil || len(m.Destination) > len(mount.Destination)) {
+				mount = &mounts[i]
+			}
+		}
+		if mount == nil {
+			return filepath.Join(rootfs, p)
+		}
+		return filepath.Join(mount.Source, strings.TrimPrefix(p, mount.Destination))
+	}
+
+	current := "/"
+	remaining := strings.Split(dst, "/")
+	links := 0
+	for len(remaining) > 0 {
+		entry := remaining[0]
+		remaining = remaining[1:]
+		if entry == "" || entry == "." {
+			continue
+		}
+		// The path is cleaned lexically, `..` stays within the container root.
+		next := filepath.Join(current, entry)
+		info, err := os.Lstat(hostPath(next))
+		if err != nil {
+			// A missing path element is not an error for the caller, the remaining
+			// elements are created by liblxc (create=dir|file).
+			return filepath.Join(rootfs, next, filepath.Join(remaining...)), err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return filepath.Join(rootfs, next), fmt.Errorf("failed to resolve mount destination %s: %w", dst, unix.ELOOP)
+		}
+		target, err := os.Readlink(hostPath(next))
+		if err != nil {
+			return filepath.Join(rootfs, next), err
+		}
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+	return filepath.Join(rootfs, current), nil
+}
+
 func configureMounts(rt *Runtime, c *Container) error {
 	// excplicitly disable auto-mounting
 	if err := c.setConfigItem("lxc.mount.auto", ""); err != nil {
 		return err
 	}
 
+	sortMounts(c.Spec.Mounts)
+
+	// bind mounts with a directory as source that are already configured
+	bindDirs := make([]specs.Mount, 0, len(c.Spec.Mounts))
+	// resolved destinations of the recursive read-only mounts
+	var rroDirs []string
+
 	for i := range c.Spec.Mounts {
 		ms := c.Spec.Mounts[i]
+		dst := filepath.Clean("/" + ms.Destination)
+		if err := applyMountPolicy(rt, c, &ms); err != nil {
+			return err
+		}
+
 		if ms.Type == "cgroup" {
-			// TODO check if hieararchy is cgroup v2 only (unified mode)
-			ms.Type = "cgroup2"
-			ms.Source = "cgroup2"
 			// cgroup filesystem is automounted even with lxc.rootfs.managed = 0
 			// from 'man lxc.container.conf':
 			// If cgroup namespaces are enabled, then any cgroup auto-mounting request will be ignored,
 			// since the container can mount the filesystems itself, and automounting can confuse the container.
+			if err := translateCgroupMount(c, &ms); err != nil {
+				return err
+			}
+		}
+
+		if rt.CopyResolvConf && ms.Type == "bind" && dst == "/etc/resolv.conf" && isNamespaceEnabled(c.Spec, specs.UserNamespace) {
+			src, err := copyResolvConf(c, ms.Source)
+			if err != nil {
+				return err
+			}
+			ms.Source = src
 		}
 
-		// TODO replace with symlink.FollowSymlinkInScope(filepath.Join(rootfs, "/etc/passwd"), rootfs) ?
-		// "github.com/docker/docker/pkg/symlink"
-		mountDest, err := resolveMountDestination(c.Spec.Root.Path, ms.Destination)
-		// Intermediate path resolution failed. This is not an error, since
-		// the remaining directories / files are automatically created (create=dir|file)
-		rt.Log.Trace().Err(err).Str("file", ms.Destination).Str("target", mountDest).Msg("resolve mount destination")
+		var mountDest string
+		var err error
+		parent := parentBindMount(bindDirs, dst)
+		if parent != nil {
+			// The destination is shadowed by a previous bind mount.
+			// Path resolution must continue within the bind mount source.
+			mountDest, err = resolveNestedMountDestination(c.Spec.Root.Path, bindDirs, dst)
+			rt.Log.Trace().Err(err).Str("file", dst).Str("parent", parent.Destination).Str("target", mountDest).Msg("resolve nested mount destination")
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else {
+			// TODO replace with symlink.FollowSymlinkInScope(filepath.Join(rootfs, "/etc/passwd"), rootfs) ?
+			// "github.com/docker/docker/pkg/symlink"
+			mountDest, err = resolveMountDestination(c.Spec.Root.Path, ms.Destination)
+			// Intermediate path resolution failed. This is not an error, since
+			// the remaining directories / files are automatically created (create=dir|file)
+			rt.Log.Trace().Err(err).Str("file", ms.Destination).Str("target", mountDest).Msg("resolve mount destination")
+		}
 
 		// Check whether the resolved destination of the target link escapes the rootfs.
 		if !strings.HasPrefix(mountDest, c.Spec.Root.Path) {
@@ -75,12 +234,35 @@ func configureMounts(rt *Runtime, c *Container) error {
 
 		ms.Destination = mountDest
 
-		if err := createMountDestination(c, &ms); err != nil {
+		// Nested mount destinations are created by liblxc (create=dir|file)
+		// within the parent mount and not within the (readonly) rootfs.
+		if err := createMountDestination(c, &ms, parent == nil); err != nil {
 			return err
 		}
 
+		if ms.Type == "bind" {
+			if info, err := os.Stat(ms.Source); err == nil && info.IsDir() {
+				bindDirs = append(bindDirs, specs.Mount{Source: filepath.Clean(ms.Source), Destination: dst})
+			}
+		}
+
 		ms.Options = filterMountOptions(rt, ms.Type, ms.Options)
 
+		if specki.HasMountOption(ms.Options, "rro") {
+			if !rt.mountSetattr {
+				return fmt.Errorf("recursive read-only mount %s requires mount_setattr (kernel >= 5.12)", dst)
+			}
+			// liblxc does not know about rro. The mount is made read-only recursively
+			// by the builtin hook (cmd/lxcri-hook-builtin) using the resolved destination.
+			ms.Options = replaceMountOption(ms.Options, "rro", "ro")
+			c.Spec.Mounts[i].Destination = strings.TrimPrefix(mountDest, c.Spec.Root.Path)
+			rroDirs = append(rroDirs, c.Spec.Mounts[i].Destination)
+		} else if !specki.HasMountOption(ms.Options, "ro") && isBelowAny(strings.TrimPrefix(mountDest, c.Spec.Root.Path), rroDirs) {
+			// The builtin hook makes nested writable mounts writable again,
+			// after the parent mount was made read-only recursively.
+			c.Spec.Mounts[i].Destination = strings.TrimPrefix(mountDest, c.Spec.Root.Path)
+		}
+
 		mnt := fmt.Sprintf("%s %s %s %s", ms.Source, ms.Destination, ms.Type, strings.Join(ms.Options, ","))
 
 		if err := c.setConfigItem("lxc.mount.entry", mnt); err != nil {
@@ -90,6 +272,36 @@ func configureMounts(rt *Runtime, c *Container) error {
 	return nil
 }
 
+// copyResolvConf copies the given resolv.conf into the container runtime directory
+// and returns the path of the copy.
+// The source file (or one of its parent directories) may not be accessible
+// by the container root user if user namespaces are enabled.
+// The copy is world readable and owned by the container root user.
+func copyResolvConf(c *Container, src string) (string, error) {
+	// #nosec
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to read resolv.conf: %w", err)
+	}
+	dst := c.RuntimePath("resolv.conf")
+	// #nosec
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to copy resolv.conf: %w", err)
+	}
+	// umask may affect the permissions
+	if err := unix.Chmod(dst, 0644); err != nil {
+		return "", fmt.Errorf("failed to chmod resolv.conf: %w", err)
+	}
+	if os.Getuid() == 0 {
+		uid := specki.UnmapContainerID(0, c.Spec.Linux.UIDMappings)
+		gid := specki.UnmapContainerID(0, c.Spec.Linux.GIDMappings)
+		if err := unix.Chown(dst, int(uid), int(gid)); err != nil {
+			return "", fmt.Errorf("failed to chown resolv.conf: %w", err)
+		}
+	}
+	return dst, nil
+}
+
 // createMountDestination creates non-existent mount destination paths.
 // This is required if rootfs is mounted readonly.
 // When the source is a file that should be bind mounted a destination file is created.
@@ -99,7 +311,7 @@ func configureMounts(rt *Runtime, c *Container) error {
 // TODO check whether this is  desired behaviour in lxc ?
 // Shouldn't the rootfs should be mounted readonly after all mounts destination directories have been created ?
 // https://github.com/lxc/lxc/issues/1702
-func createMountDestination(c *Container, ms *specs.Mount) error {
+func createMountDestination(c *Container, ms *specs.Mount, inRootfs bool) error {
 	info, err := os.Stat(ms.Source)
 
 	// source for bind mount must exist
@@ -114,26 +326,55 @@ func createMountDestination(c *Container, ms *specs.Mount) error {
 
 	if err != nil || info.IsDir() {
 		ms.Options = append(ms.Options, "create=dir")
-		if c.Spec.Root.Readonly {
+		if c.Spec.Root.Readonly && inRootfs {
 			return os.MkdirAll(ms.Destination, 0755)
 		}
 		return nil
 	}
 
+	// The source is a regular file, a unix socket, a FIFO or a device node.
+	// All of them are bind mounted onto a regular file.
 	ms.Options = append(ms.Options, "create=file")
+	if !inRootfs {
+		return nil
+	}
 	if c.Spec.Root.Readonly {
 		if err := os.MkdirAll(filepath.Dir(ms.Destination), 0755); err != nil {
 			return fmt.Errorf("failed to create mount destination dir: %w", err)
 		}
-		f, err := os.OpenFile(ms.Destination, os.O_CREATE, 0755)
-		if err != nil {
-			return fmt.Errorf("failed to create file mountpoint: %w", err)
-		}
-		return f.Close()
+		return createMountpointFile(ms.Destination)
+	}
+	// Fail early, because liblxc can not mount a file onto a directory.
+	dst, err := os.Lstat(ms.Destination)
+	if err == nil && dst.IsDir() {
+		return fmt.Errorf("can not mount %s %s onto directory %s", info.Mode().Type(), ms.Source, ms.Destination)
 	}
 	return nil
 }
 
+// createMountpointFile creates an empty regular file at dst,
+// which is used as mountpoint for a non-directory bind mount.
+// An existing non-directory file at dst is used as is. It is never opened,
+// since opening a FIFO blocks and opening a unix socket fails.
+func createMountpointFile(dst string) error {
+	info, err := os.Lstat(dst)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("file mountpoint %s is a directory", dst)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	// #nosec
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file mountpoint: %w", err)
+	}
+	return f.Close()
+}
+
 func resolvePathRelative(rootfs string, currentPath string, subPath string) (string, error) {
 	p := filepath.Join(currentPath, subPath)
 
@@ -6,7 +6,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestResolveMountDestination_absolute(t *testing.T) {
@@ -81,3 +83,122 @@ func TestFilterMountOptions(t *testing.T) {
 	out = filterMountOptions(&rt, "nosuchfs", opts)
 	require.Equal(t, opts, out)
 }
+
+func TestSortMounts(t *testing.T) {
+	mounts := []specs.Mount{
+		{Destination: "/var/lib/foo"},
+		{Destination: "/proc"},
+		{Destination: "/var/lib"},
+		{Destination: "/dev/pts"},
+		{Destination: "/dev"},
+		{Destination: ".lxcri"},
+	}
+	sortMounts(mounts)
+
+	var dst []string
+	for _, m := range mounts {
+		dst = append(dst, m.Destination)
+	}
+	require.Equal(t, []string{"/proc", "/dev", ".lxcri", "/var/lib", "/dev/pts", "/var/lib/foo"}, dst)
+}
+
+func TestResolveNestedMountDestination(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	rootfs := filepath.Join(tmpdir, "rootfs")
+	volume := filepath.Join(tmpdir, "volume")
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "etc"), 0750))
+	require.NoError(t, os.MkdirAll(filepath.Join(volume, "real"), 0750))
+	// absolute links are resolved relative to the container root
+	require.NoError(t, os.Symlink("/real", filepath.Join(volume, "link")))
+	require.NoError(t, os.Symlink("/var/lib/real", filepath.Join(volume, "abs")))
+	// relative links are resolved relative to the link within the container
+	require.NoError(t, os.Symlink("real", filepath.Join(volume, "rel")))
+	require.NoError(t, os.Symlink("../../etc", filepath.Join(volume, "up")))
+	require.NoError(t, os.Symlink("../../../../..", filepath.Join(volume, "escape")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(volume, "loop")))
+
+	mounts := []specs.Mount{{Source: volume, Destination: "/var/lib"}}
+
+	parent := parentBindMount(mounts, "/var/lib/link/foo")
+	require.NotNil(t, parent)
+	require.Nil(t, parentBindMount(mounts, "/var/libfoo"))
+	require.Nil(t, parentBindMount(mounts, "/var/lib"))
+
+	p, err := resolveNestedMountDestination(rootfs, mounts, "/var/lib/link/foo")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Equal(t, filepath.Join(rootfs, "/real/foo"), p)
+
+	p, err = resolveNestedMountDestination(rootfs, mounts, "/var/lib/abs")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(rootfs, "/var/lib/real"), p)
+
+	p, err = resolveNestedMountDestination(rootfs, mounts, "/var/lib/rel/foo")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Equal(t, filepath.Join(rootfs, "/var/lib/real/foo"), p)
+
+	p, err = resolveNestedMountDestination(rootfs, mounts, "/var/lib/up")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(rootfs, "/etc"), p)
+
+	p, err = resolveNestedMountDestination(rootfs, mounts, "/var/lib/escape/etc")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(rootfs, "/etc"), p)
+
+	_, err = resolveNestedMountDestination(rootfs, mounts, "/var/lib/loop")
+	require.ErrorIs(t, err, unix.ELOOP)
+}
+
+func TestCreateMountpointFile(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	p := filepath.Join(tmpdir, "file")
+	require.NoError(t, createMountpointFile(p))
+	info, err := os.Stat(p)
+	require.NoError(t, err)
+	require.True(t, info.Mode().IsRegular())
+
+	// an existing fifo must not be opened (this would block)
+	fifo := filepath.Join(tmpdir, "fifo")
+	require.NoError(t, unix.Mkfifo(fifo, 0600))
+	require.NoError(t, createMountpointFile(fifo))
+
+	require.Error(t, createMountpointFile(tmpdir))
+}
+
+func TestCopyResolvConf(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "resolv.conf.orig")
+	require.NoError(t, os.WriteFile(src, []byte("nameserver 127.0.0.1\n"), 0600))
+
+	c := &Container{
+		ContainerConfig: &ContainerConfig{Spec: &specs.Spec{Linux: &specs.Linux{}}},
+		runtimeDir:      tmpdir,
+	}
+	dst, err := copyResolvConf(c, src)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(tmpdir, "resolv.conf"), dst)
+
+	info, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "nameserver 127.0.0.1\n", string(data))
+}
+
+func TestIsBelowAny(t *testing.T) {
+	dirs := []string{"/data", "/srv/www"}
+	require.True(t, isBelowAny("/data/logs", dirs))
+	require.True(t, isBelowAny("/srv/www/static", dirs))
+	require.False(t, isBelowAny("/data", dirs))
+	require.False(t, isBelowAny("/database", dirs))
+	require.True(t, isBelowAny("/tmp", []string{"/"}))
+}
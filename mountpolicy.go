@@ -0,0 +1,128 @@
+package lxcri
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// MountPolicyAction is the action taken for a bind mount
+// with a source denied by the MountPolicy.
+type MountPolicyAction string
+
+const (
+	// MountPolicyReject refuses to create a container with a denied bind mount.
+	MountPolicyReject MountPolicyAction = "reject"
+	// MountPolicyReadOnly makes a denied bind mount read-only.
+	MountPolicyReadOnly MountPolicyAction = "readonly"
+	// MountPolicyLog only logs the policy violation.
+	MountPolicyLog MountPolicyAction = "log"
+)
+
+// DefaultDeniedMountSources are the host paths that are denied by default.
+var DefaultDeniedMountSources = []string{"/", "/proc", "/sys", "/var/run/crio"}
+
+// MountPolicy restricts the host paths that can be bind mounted into a container.
+type MountPolicy struct {
+	// DeniedSources are the host paths that must not be bind mounted.
+	// A path also denies all paths below it, except for "/"
+	// which only denies the host root directory itself.
+	// DefaultDeniedMountSources are used if DeniedSources is nil.
+	// Empty paths are ignored, so a single empty path disables the policy.
+	DeniedSources []string `json:",omitempty"`
+	// Action is the action for a denied bind mount.
+	// The default action is MountPolicyReject.
+	Action MountPolicyAction `json:",omitempty"`
+}
+
+func (p *MountPolicy) setDefaults() {
+	if p.DeniedSources == nil {
+		p.DeniedSources = DefaultDeniedMountSources
+	}
+	denied := make([]string, 0, len(p.DeniedSources))
+	for _, src := range p.DeniedSources {
+		if src != "" {
+			denied = append(denied, src)
+		}
+	}
+	p.DeniedSources = denied
+	if p.Action == "" {
+		p.Action = MountPolicyReject
+	}
+}
+
+func (p *MountPolicy) validate() error {
+	switch p.Action {
+	case MountPolicyReject, MountPolicyReadOnly, MountPolicyLog:
+	default:
+		return fmt.Errorf("invalid mount policy action %q", p.Action)
+	}
+	for _, src := range p.DeniedSources {
+		if !filepath.IsAbs(src) {
+			return fmt.Errorf("denied mount source %q is not an absolute path", src)
+		}
+	}
+	return nil
+}
+
+func isBindMount(ms specs.Mount) bool {
+	return ms.Type == "bind" || specki.HasMountOption(ms.Options, "bind") || specki.HasMountOption(ms.Options, "rbind")
+}
+
+// evalPath returns the path with all symlinks resolved (e.g /var/run -> /run),
+// or the cleaned path if it can not be resolved.
+func evalPath(p string) string {
+	if resolved, err := filepath.EvalSymlinks(p); err == nil {
+		return resolved
+	}
+	return filepath.Clean(p)
+}
+
+// deniedMountSource returns the denied source that matches the given mount source.
+func deniedMountSource(denied []string, src string) (string, bool) {
+	src = evalPath(src)
+	for _, d := range denied {
+		p := evalPath(d)
+		if p == "/" {
+			if src == "/" {
+				return d, true
+			}
+			continue
+		}
+		if isPathPrefix(src, p) {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// applyMountPolicy checks the bind mount ms against the mount policy.
+// It returns an error if the mount source is denied and the policy action
+// is MountPolicyReject, and makes the mount read-only for MountPolicyReadOnly.
+func applyMountPolicy(rt *Runtime, c *Container, ms *specs.Mount) error {
+	if !isBindMount(*ms) {
+		return nil
+	}
+	denied, ok := deniedMountSource(rt.MountPolicy.DeniedSources, ms.Source)
+	if !ok {
+		return nil
+	}
+	c.Log.Warn().Str("event", "mount-policy-violation").
+		Str("source", ms.Source).Str("destination", ms.Destination).
+		Str("denied", denied).Str("action", string(rt.MountPolicy.Action)).
+		Msg("bind mount source is denied by mount policy")
+
+	switch rt.MountPolicy.Action {
+	case MountPolicyReadOnly:
+		ms.Options = removeMountOptions(rt, ms.Type, ms.Options, "rw")
+		if !specki.HasMountOption(ms.Options, "ro") && !specki.HasMountOption(ms.Options, "rro") {
+			ms.Options = append(ms.Options, "ro")
+		}
+	case MountPolicyLog:
+	default:
+		return fmt.Errorf("bind mount source %s for %s is denied by mount policy (%s)", ms.Source, ms.Destination, denied)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeniedMountSource(t *testing.T) {
+	denied := []string{"/", "/proc", "/sys"}
+
+	d, ok := deniedMountSource(denied, "/")
+	require.True(t, ok)
+	require.Equal(t, "/", d)
+
+	d, ok = deniedMountSource(denied, "/proc/sys/")
+	require.True(t, ok)
+	require.Equal(t, "/proc", d)
+
+	_, ok = deniedMountSource(denied, "/process")
+	require.False(t, ok)
+
+	_, ok = deniedMountSource(denied, "/var/lib/data")
+	require.False(t, ok)
+
+	// symlinks are resolved
+	tmpDir := t.TempDir()
+	link := filepath.Join(tmpDir, "link")
+	require.NoError(t, os.Symlink("/sys/fs", link))
+	d, ok = deniedMountSource(denied, link)
+	require.True(t, ok)
+	require.Equal(t, "/sys", d)
+}
+
+func TestApplyMountPolicy(t *testing.T) {
+	rt := &Runtime{Log: zerolog.Nop()}
+	rt.MountPolicy.setDefaults()
+	require.NoError(t, rt.MountPolicy.validate())
+	c := &Container{ContainerConfig: &ContainerConfig{Log: zerolog.Nop()}}
+
+	ms := specs.Mount{Source: "/proc", Destination: "/host/proc", Type: "bind", Options: []string{"rbind", "rw"}}
+	require.Error(t, applyMountPolicy(rt, c, &ms))
+
+	// not a bind mount
+	ms = specs.Mount{Source: "proc", Destination: "/proc", Type: "proc"}
+	require.NoError(t, applyMountPolicy(rt, c, &ms))
+
+	rt.MountPolicy.Action = MountPolicyReadOnly
+	ms = specs.Mount{Source: "/", Destination: "/host", Type: "none", Options: []string{"rbind", "rw"}}
+	require.NoError(t, applyMountPolicy(rt, c, &ms))
+	require.Equal(t, []string{"rbind", "ro"}, ms.Options)
+
+	rt.MountPolicy.Action = MountPolicyLog
+	ms = specs.Mount{Source: "/sys", Destination: "/sys", Type: "bind", Options: []string{"rw"}}
+	require.NoError(t, applyMountPolicy(rt, c, &ms))
+	require.Equal(t, []string{"rw"}, ms.Options)
+}
+
+func TestMountPolicyDisabled(t *testing.T) {
+	p := MountPolicy{DeniedSources: []string{""}}
+	p.setDefaults()
+	require.NoError(t, p.validate())
+	require.Empty(t, p.DeniedSources)
+
+	p = MountPolicy{Action: "unknown"}
+	p.setDefaults()
+	require.Error(t, p.validate())
+}
@@ -116,8 +116,13 @@ func isNamespaceSharedWithRuntime(ns *specs.LinuxNamespace) (bool, error) {
 		return false, err
 	}
 
+	n, ok := namespaceMap[ns.Type]
+	if !ok {
+		return false, fmt.Errorf("unsupported namespace %s", ns.Type)
+	}
+
 	var stat1 unix.Stat_t
-	err = unix.Stat("/proc/self/ns/pid", &stat1)
+	err = unix.Stat("/proc/self/ns/"+n.Name, &stat1)
 	if err != nil {
 		return false, err
 	}
@@ -126,8 +131,10 @@ func isNamespaceSharedWithRuntime(ns *specs.LinuxNamespace) (bool, error) {
 	return sameNS, nil
 }
 
+// setUTSName sets the hostname and the domainname (if not empty)
+// in the given UTS namespace.
 // lxc does not set the hostname on shared namespaces
-func setHostname(nsPath string, hostname string) error {
+func setUTSName(nsPath string, hostname string, domainname string) error {
 	// setns only affects the current thread
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -153,9 +160,15 @@ func setHostname(nsPath string, hostname string) error {
 	if err != nil {
 		return fmt.Errorf("failed to switch to UTS namespace %s: %w", nsPath, err)
 	}
-	err = unix.Sethostname([]byte(hostname))
-	if err != nil {
-		return fmt.Errorf("unix.Sethostname failed: %w", err)
+	if hostname != "" {
+		if err := unix.Sethostname([]byte(hostname)); err != nil {
+			return fmt.Errorf("unix.Sethostname failed: %w", err)
+		}
+	}
+	if domainname != "" {
+		if err := unix.Setdomainname([]byte(domainname)); err != nil {
+			return fmt.Errorf("unix.Setdomainname failed: %w", err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,33 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinedUTSNamespace(t *testing.T) {
+	spec := &specs.Spec{Linux: &specs.Linux{}}
+
+	// shared with the runtime
+	p, err := joinedUTSNamespace(spec)
+	require.NoError(t, err)
+	require.Empty(t, p)
+
+	// new namespace
+	spec.Linux.Namespaces = []specs.LinuxNamespace{{Type: specs.UTSNamespace}}
+	p, err = joinedUTSNamespace(spec)
+	require.NoError(t, err)
+	require.Empty(t, p)
+
+	// joined namespace of the runtime
+	spec.Linux.Namespaces[0].Path = "/proc/self/ns/uts"
+	p, err = joinedUTSNamespace(spec)
+	require.NoError(t, err)
+	require.Empty(t, p)
+
+	spec.Linux.Namespaces[0].Path = "/proc/self/ns/nonexistent"
+	_, err = joinedUTSNamespace(spec)
+	require.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package lxcri
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Policies for a rootfs on a network filesystem (see Runtime.NetworkRootfs).
+const (
+	// NetworkRootfsWarn creates the container in degraded mode
+	// and logs a warning with the known limitations.
+	NetworkRootfsWarn = ""
+	// NetworkRootfsDeny fails to create the container.
+	NetworkRootfsDeny = "deny"
+)
+
+// networkFilesystems maps the statfs(2) magic numbers
+// of network filesystems to the filesystem name.
+var networkFilesystems = map[int64]string{
+	unix.NFS_SUPER_MAGIC: "nfs",
+	0xff534d42:           "cifs",
+	0xfe534d42:           "smb2",
+	0x00c36400:           "ceph",
+	unix.V9FS_MAGIC:      "9p",
+	0x5346414f:           "afs",
+	0x47504653:           "gpfs",
+	0x0bd00bd0:           "lustre",
+}
+
+// networkFilesystem returns the name of the network filesystem
+// the given path is located on, or an empty string if the path
+// is not on a (known) network filesystem.
+func networkFilesystem(path string) (string, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return "", fmt.Errorf("statfs failed for %q: %w", path, err)
+	}
+	return networkFilesystems[int64(stat.Type)], nil
+}
+
+// checkNetworkRootfs detects a rootfs on a network filesystem and applies
+// the Runtime.NetworkRootfs policy. The network filesystem is recorded in
+// ContainerConfig.NetworkRootfs, so the degraded mode is visible in the container state.
+func checkNetworkRootfs(rt *Runtime, c *Container, rootfs string) error {
+	fsName, err := networkFilesystem(rootfs)
+	if err != nil {
+		return err
+	}
+	if fsName == "" {
+		return nil
+	}
+	if rt.NetworkRootfs == NetworkRootfsDeny {
+		return fmt.Errorf("rootfs %q on network filesystem %s is not supported", rootfs, fsName)
+	}
+	if rt.NetworkRootfs != NetworkRootfsWarn {
+		return fmt.Errorf("invalid network rootfs policy %q", rt.NetworkRootfs)
+	}
+	c.NetworkRootfs = fsName
+	c.Log.Warn().Str("fs", fsName).Str("rootfs", rootfs).
+		Msg("rootfs is on a network filesystem - container runs in degraded mode")
+
+	// ID mapped mounts are not supported by network filesystems.
+	if c.RootfsShift != RootfsShiftNone {
+		return fmt.Errorf("rootfs shift %q is not supported on network filesystem %s", c.RootfsShift, fsName)
+	}
+	// Device nodes are created in the rootfs /dev if it is not a separate mount.
+	// mknod is usually denied on network filesystems (e.g NFS root squashing).
+	hasDev := false
+	for _, m := range c.Spec.Mounts {
+		if filepath.Clean("/"+m.Destination) == "/dev" {
+			hasDev = true
+			break
+		}
+	}
+	if !hasDev && len(c.Spec.Linux.Devices) > 0 {
+		c.Log.Warn().Str("fs", fsName).Msg("/dev is not a separate mount - device nodes may be bind mounted because mknod is not supported")
+	}
+	return nil
+}
+
+// checkNetworkRuntimeRoot logs a warning if the runtime root is located on a
+// network filesystem, because exclusive file creation (O_EXCL)
+// and file locks (used by liblxc and the runtime) may be unreliable.
+func checkNetworkRuntimeRoot(rt *Runtime) {
+	fsName, err := networkFilesystem(rt.Root)
+	if err != nil || fsName == "" {
+		return
+	}
+	rt.Log.Warn().Str("fs", fsName).Str("root", rt.Root).
+		Msg("runtime root is on a network filesystem - exclusive file creation and file locks may be unreliable")
+}
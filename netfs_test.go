@@ -0,0 +1,27 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNetworkRootfsLocal(t *testing.T) {
+	rootfs := t.TempDir()
+	fsName, err := networkFilesystem(rootfs)
+	require.NoError(t, err)
+	require.Empty(t, fsName)
+
+	rt := &Runtime{NetworkRootfs: NetworkRootfsDeny}
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{Linux: &specs.Linux{}},
+		Log:  zerolog.Nop(),
+	}}
+	require.NoError(t, checkNetworkRootfs(rt, c, rootfs))
+	require.Empty(t, c.NetworkRootfs)
+
+	_, err = networkFilesystem(rootfs + "/missing")
+	require.Error(t, err)
+}
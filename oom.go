@@ -0,0 +1,189 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// oomKillsFile records the highest oom_kill counter of the container cgroup
+// seen by any Runtime.WatchOOM. It preserves the OOM kill state
+// when the container cgroup is removed (see State.OOMKills).
+// The file is only a record, events are emitted per watcher.
+const oomKillsFile = "oom_kills"
+
+// OOMEvent is emitted by Runtime.WatchOOM when processes
+// in the container cgroup were killed by the OOM killer.
+type OOMEvent struct {
+	ContainerID string
+	// Kills is the total number of processes killed by the OOM killer.
+	Kills uint64
+	Time  time.Time
+}
+
+// WatchOOM watches the cgroup2 memory.events file of the container cgroup with inotify
+// and emits an event whenever the oom_kill counter increases.
+// Every watcher compares the counter with the value seen when the watch was started,
+// so several processes sharing the runtime root can watch the same container.
+// The counter is recorded in the container runtime directory (see State.OOMKills).
+// The returned channel is closed when the context is done or the cgroup is removed.
+func (rt *Runtime) WatchOOM(ctx context.Context, c *Container) (<-chan OOMEvent, error) {
+	if c.CgroupDir == "" {
+		return nil, fmt.Errorf("container has no cgroup")
+	}
+	// cgroup v1 requires an eventfd registered with cgroup.event_control
+	if cgroups.version() != 2 {
+		return nil, fmt.Errorf("OOM watch requires cgroup2")
+	}
+	memoryEvents := cgroups.memoryEventsFile(c.CgroupDir)
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, errorf("inotify_init1 failed: %w", err)
+	}
+	// The file is pollable, so a pending read returns when the file is closed.
+	f := os.NewFile(uintptr(fd), "inotify")
+	if _, err := unix.InotifyAddWatch(fd, memoryEvents, unix.IN_MODIFY); err != nil {
+		f.Close()
+		return nil, errorf("failed to watch %s: %w", memoryEvents, err)
+	}
+	// OOM kills that happened before the watch was added are not emitted.
+	seen, err := parseCgroupMemoryOOMKills(c.sysFS(), memoryEvents)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	events := make(chan OOMEvent)
+	go func() {
+		defer close(events)
+		go func() {
+			<-ctx.Done()
+			f.Close()
+		}()
+
+		buf := make([]byte, unix.SizeofInotifyEvent*64)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					c.Log.Warn().Msgf("failed to read inotify events: %s", err)
+				}
+				return
+			}
+			removed := false
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				removed = removed || ev.Mask&unix.IN_IGNORED != 0
+				offset += unix.SizeofInotifyEvent + int(ev.Len)
+			}
+
+			ev, err := rt.checkOOMKills(c, &seen)
+			if err != nil && !os.IsNotExist(err) {
+				c.Log.Warn().Msgf("failed to check OOM kills: %s", err)
+			}
+			if ev != nil {
+				select {
+				case events <- *ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if removed {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// checkOOMKills compares the oom_kill counter of the container cgroup
+// with the counter seen by the caller and updates seen if it has increased.
+// It returns an OOMEvent if the counter has increased.
+func (rt *Runtime) checkOOMKills(c *Container, seen *uint64) (*OOMEvent, error) {
+	n, err := parseCgroupMemoryOOMKills(c.sysFS(), cgroups.memoryEventsFile(c.CgroupDir))
+	if err != nil {
+		return nil, err
+	}
+	if n <= *seen {
+		return nil, nil
+	}
+	*seen = n
+	c.Log.Warn().Uint64("oom_kills", n).Msg("container processes killed by the OOM killer")
+	if err := rt.recordOOMKills(c, n); err != nil {
+		c.Log.Warn().Msgf("failed to record OOM kills: %s", err)
+	}
+	return &OOMEvent{ContainerID: c.ContainerID, Kills: n, Time: c.sysClock().Now()}, nil
+}
+
+// recordOOMKills atomically replaces the recorded oom_kill counter,
+// if n is higher than the recorded counter.
+func (rt *Runtime) recordOOMKills(c *Container, n uint64) error {
+	recorded, err := c.recordedOOMKills()
+	if err != nil {
+		return err
+	}
+	if n <= recorded {
+		return nil
+	}
+	f, err := os.CreateTemp(c.RuntimePath(), oomKillsFile+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.WriteString(strconv.FormatUint(n, 10) + "\n")
+	if err == nil {
+		err = f.Chmod(rt.FileModes.PrivateFileMode)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := rt.chgrp(tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.RuntimePath(oomKillsFile))
+}
+
+// recordedOOMKills returns the oom_kill counter recorded by recordOOMKills.
+func (c *Container) recordedOOMKills() (uint64, error) {
+	// #nosec
+	data, err := os.ReadFile(c.RuntimePath(oomKillsFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// oomKills returns the number of processes in the container cgroup
+// that were killed by the OOM killer. The recorded counter is used
+// if the cgroup was already removed.
+func (c *Container) oomKills() (uint64, error) {
+	recorded, err := c.recordedOOMKills()
+	if err != nil {
+		return 0, err
+	}
+	if c.CgroupDir == "" {
+		return recorded, nil
+	}
+	n, err := parseCgroupMemoryOOMKills(c.sysFS(), cgroups.memoryEventsFile(c.CgroupDir))
+	if err != nil && !os.IsNotExist(err) {
+		return recorded, err
+	}
+	if n > recorded {
+		return n, nil
+	}
+	return recorded, nil
+}
@@ -0,0 +1,61 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOOMKills(t *testing.T) {
+	memoryEvents := filepath.Join(cgroupRoot, "test", "memory.events")
+	mfs := &memFS{files: map[string][]byte{
+		memoryEvents: []byte("low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n"),
+	}}
+	c := &Container{
+		ContainerConfig: &ContainerConfig{
+			ContainerID: "c1",
+			CgroupDir:   "test",
+			Log:         zerolog.Nop(),
+		},
+		runtimeDir: t.TempDir(),
+		clock:      &fakeClock{now: time.Unix(0, 0)},
+		fs:         mfs,
+	}
+
+	rt := &Runtime{FileModes: RuntimeFileModes{PrivateFileMode: 0440}}
+
+	var seen uint64
+	ev, err := rt.checkOOMKills(c, &seen)
+	require.NoError(t, err)
+	require.Nil(t, ev)
+
+	mfs.files[memoryEvents] = []byte("low 0\nhigh 0\nmax 3\noom 2\noom_kill 2\n")
+	ev, err = rt.checkOOMKills(c, &seen)
+	require.NoError(t, err)
+	require.Equal(t, &OOMEvent{ContainerID: "c1", Kills: 2, Time: time.Unix(0, 0)}, ev)
+
+	// no event if the counter did not change
+	ev, err = rt.checkOOMKills(c, &seen)
+	require.NoError(t, err)
+	require.Nil(t, ev)
+
+	// another watcher with its own counter gets the event as well
+	var other uint64
+	ev, err = rt.checkOOMKills(c, &other)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), ev.Kills)
+
+	info, err := os.Stat(c.RuntimePath(oomKillsFile))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0440), info.Mode().Perm())
+
+	// the recorded counter is used when the cgroup is removed
+	delete(mfs.files, memoryEvents)
+	n, err := c.oomKills()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+}
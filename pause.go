@@ -0,0 +1,83 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// StatePaused is the state of a running container with a frozen cgroup.
+// It is not defined by the OCI runtime spec, but reported by runc and
+// expected by CRI-O for paused containers.
+const StatePaused specs.ContainerState = "paused"
+
+// Pause freezes all processes of the running container.
+func (rt *Runtime) Pause(ctx context.Context, c *Container) error {
+	unlock, err := rt.lockContainer(c.ContainerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != specs.StateRunning {
+		return fmt.Errorf("invalid container state. expected %q, but was %q", specs.StateRunning, state)
+	}
+	c.Log.Info().Msg("pause container")
+	return c.freeze(ctx, true)
+}
+
+// Resume thaws all processes of the paused container.
+func (rt *Runtime) Resume(ctx context.Context, c *Container) error {
+	unlock, err := rt.lockContainer(c.ContainerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != StatePaused {
+		return fmt.Errorf("invalid container state. expected %q, but was %q", StatePaused, state)
+	}
+	c.Log.Info().Msg("resume container")
+	return c.freeze(ctx, false)
+}
+
+// canFreezeCgroup returns true if the container cgroup can be frozen directly.
+// The monitor process must not be frozen along with the container processes,
+// because it handles the liblxc commands (e.g the container state query).
+func (c *Container) canFreezeCgroup() bool {
+	return c.CgroupDir != "" && c.MonitorCgroupDir != "" && !c.isMonitorInContainerCgroup()
+}
+
+// freeze freezes (or thaws) the container cgroup and waits until
+// the cgroup is frozen (or thawed). If the monitor process is a member
+// of the container cgroup the liblxc Freeze/Unfreeze commands are used,
+// which only freeze the container payload cgroup.
+func (c *Container) freeze(ctx context.Context, freeze bool) error {
+	if !c.canFreezeCgroup() {
+		if freeze {
+			return c.LinuxContainer.Freeze()
+		}
+		return c.LinuxContainer.Unfreeze()
+	}
+
+	return freezeCgroup(ctx, c, c.CgroupDir, freeze)
+}
+
+// isPaused returns true if the container is frozen.
+// The liblxc state s is used if the container cgroup can not be frozen directly.
+func (c *Container) isPaused(s lxc.State) (bool, error) {
+	if !c.canFreezeCgroup() {
+		return s == lxc.FROZEN, nil
+	}
+	return cgroups.isFrozen(c.sysFS(), c.CgroupDir)
+}
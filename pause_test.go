@@ -0,0 +1,65 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+func TestFreezeCgroup(t *testing.T) {
+	freezeFile := filepath.Join(cgroupRoot, "test", "cgroup.freeze")
+	eventsFile := filepath.Join(cgroupRoot, "test", "cgroup.events")
+	mfs := &memFS{files: map[string][]byte{
+		freezeFile: []byte("0"),
+		eventsFile: []byte("populated 1\nfrozen 0\n"),
+	}}
+	// The kernel updates the frozen event after the cgroup is frozen.
+	mfs.onRead = func(name string, n int) {
+		if name == eventsFile && n > 1 {
+			mfs.files[name] = []byte(fmt.Sprintf("populated 1\nfrozen %s\n", mfs.files[freezeFile]))
+		}
+	}
+	c := &Container{
+		ContainerConfig: &ContainerConfig{
+			CgroupDir:        "test",
+			MonitorCgroupDir: "lxcri-monitor.slice/test.scope",
+			Log:              zerolog.Nop(),
+		},
+		clock: &fakeClock{now: time.Unix(0, 0)},
+		fs:    mfs,
+	}
+	require.True(t, c.canFreezeCgroup())
+
+	paused, err := c.isPaused(lxc.RUNNING)
+	require.NoError(t, err)
+	require.False(t, paused)
+
+	require.NoError(t, c.freeze(context.Background(), true))
+	paused, err = c.isPaused(lxc.RUNNING)
+	require.NoError(t, err)
+	require.True(t, paused)
+
+	require.NoError(t, c.freeze(context.Background(), false))
+	paused, err = c.isPaused(lxc.RUNNING)
+	require.NoError(t, err)
+	require.False(t, paused)
+}
+
+func TestCanFreezeCgroup(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "test", MonitorCgroupDir: "test/lxcri-monitor"}}
+	require.False(t, c.canFreezeCgroup())
+
+	// the liblxc state is used if the monitor is in the container cgroup
+	paused, err := c.isPaused(lxc.FROZEN)
+	require.NoError(t, err)
+	require.True(t, paused)
+
+	c.MonitorCgroupDir = ""
+	require.False(t, c.canFreezeCgroup())
+}
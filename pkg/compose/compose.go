@@ -0,0 +1,361 @@
+// Package compose brings up and tears down a set of containers
+// defined in a simple YAML file, using the lxcri Runtime API.
+// It is intended for standalone deployments without Kubernetes.
+//
+// Example:
+//
+//	name: myapp
+//	containers:
+//	  db:
+//	    bundle: /var/lib/myapp/db
+//	  web:
+//	    bundle: /var/lib/myapp/web
+//	    depends_on: [db]
+//	    share:
+//	      network: db
+//	    restart: on-failure:3
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultStopTimeout is the default time in seconds to wait for
+// a container to stop after SIGTERM, before it is killed.
+const DefaultStopTimeout = 10
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9-_]*$`)
+
+// nsFiles maps the namespace type to the namespace file in /proc/<pid>/ns
+var nsFiles = map[specs.LinuxNamespaceType]string{
+	specs.CgroupNamespace:  "cgroup",
+	specs.IPCNamespace:     "ipc",
+	specs.MountNamespace:   "mnt",
+	specs.NetworkNamespace: "net",
+	specs.PIDNamespace:     "pid",
+	specs.UserNamespace:    "user",
+	specs.UTSNamespace:     "uts",
+}
+
+// Project is a set of containers that are managed together.
+type Project struct {
+	// Name is the project name. It is used as prefix for the container IDs.
+	Name string `json:"name"`
+	// CgroupParent is the cgroup directory (relative to the cgroup root)
+	// for containers without cgroupsPath in their spec.
+	CgroupParent string `json:"cgroup_parent,omitempty"`
+	// StopTimeout is the time in seconds to wait for a container to stop
+	// after SIGTERM, before it is killed. Defaults to DefaultStopTimeout.
+	StopTimeout uint `json:"stop_timeout,omitempty"`
+	// Containers maps the container name to the container definition.
+	Containers map[string]*Container `json:"containers"`
+}
+
+// Container is the definition of a single container within a Project.
+type Container struct {
+	// Bundle is the path to the OCI bundle.
+	Bundle string `json:"bundle"`
+	// DependsOn are the names of the containers that must be
+	// started before this container.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Share maps a namespace type (e.g network) to the name of the container
+	// whose namespace is joined. The container implicitly depends on it.
+	Share map[specs.LinuxNamespaceType]string `json:"share,omitempty"`
+	// Restart is the restart policy (see lxcri.ParseRestartPolicy).
+	Restart string `json:"restart,omitempty"`
+}
+
+// Load loads and validates the project from the given YAML file.
+func Load(filename string) (*Project, error) {
+	// #nosec
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates the project from the given YAML data.
+func Parse(data []byte) (*Project, error) {
+	p := new(Project)
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse project: %w", err)
+	}
+	if p.StopTimeout == 0 {
+		p.StopTimeout = DefaultStopTimeout
+	}
+	if _, err := p.Order(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ContainerID returns the runtime container ID for the given container name.
+func (p *Project) ContainerID(name string) string {
+	return p.Name + "-" + name
+}
+
+func (p *Project) dependencies(name string) []string {
+	c := p.Containers[name]
+	deps := append([]string{}, c.DependsOn...)
+	for _, dep := range c.Share {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// Order validates the project and returns the container names in start order.
+// Containers are ordered by their dependencies and by name.
+func (p *Project) Order() ([]string, error) {
+	if !namePattern.MatchString(p.Name) {
+		return nil, fmt.Errorf("invalid project name %q", p.Name)
+	}
+	if len(p.Containers) == 0 {
+		return nil, fmt.Errorf("project %q has no containers", p.Name)
+	}
+
+	names := make([]string, 0, len(p.Containers))
+	for name, c := range p.Containers {
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid container name %q", name)
+		}
+		if c == nil || c.Bundle == "" {
+			return nil, fmt.Errorf("container %q: missing bundle", name)
+		}
+		for ns := range c.Share {
+			if _, ok := nsFiles[ns]; !ok {
+				return nil, fmt.Errorf("container %q: invalid namespace type %q", name, ns)
+			}
+		}
+		if c.Restart != "" {
+			if _, err := lxcri.ParseRestartPolicy(c.Restart); err != nil {
+				return nil, fmt.Errorf("container %q: %w", name, err)
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(names))
+	order := make([]string, 0, len(names))
+
+	var visit func(name string, from string) error
+	visit = func(name string, from string) error {
+		if _, ok := p.Containers[name]; !ok {
+			return fmt.Errorf("container %q: unknown dependency %q", from, name)
+		}
+		switch marks[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("container %q: dependency cycle", name)
+		}
+		marks[name] = visiting
+		for _, dep := range p.dependencies(name) {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Up creates and starts all containers of the project in dependency order.
+// If a container fails to start, the containers created by this call are torn down.
+// Containers that already exist are not touched, Up fails with lxcri.ErrExist
+// if a container of the project already exists (e.g the project is already up).
+func Up(ctx context.Context, rt *lxcri.Runtime, p *Project) error {
+	order, err := p.Order()
+	if err != nil {
+		return err
+	}
+
+	var created []string
+	for _, name := range order {
+		ok, err := up(ctx, rt, p, name)
+		if ok {
+			created = append(created, name)
+		}
+		if err != nil {
+			rt.Log.Error().Err(err).Str("container", name).Msg("failed to bring up container")
+			if err := down(ctx, rt, p, created); err != nil {
+				rt.Log.Error().Err(err).Msg("failed to tear down project")
+			}
+			return fmt.Errorf("container %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// up creates and starts the container name.
+// created is true if the container was created by this call,
+// even if it failed to start.
+func up(ctx context.Context, rt *lxcri.Runtime, p *Project, name string) (created bool, err error) {
+	def := p.Containers[name]
+	spec, err := specki.LoadSpecJSON(filepath.Join(def.Bundle, lxcri.BundleConfigFile))
+	if err != nil {
+		return false, fmt.Errorf("failed to load container spec from bundle: %w", err)
+	}
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+
+	id := p.ContainerID(name)
+	if spec.Linux.CgroupsPath == "" && p.CgroupParent != "" {
+		spec.Linux.CgroupsPath = filepath.Join(p.CgroupParent, id)
+	}
+
+	for nsType, other := range def.Share {
+		// The init process of the dependency may have been restarted
+		// by the monitor process, so the current init PID is used.
+		pid, err := initPid(rt, p.ContainerID(other))
+		if err != nil {
+			return false, fmt.Errorf("failed to share %s namespace of container %q: %w", nsType, other, err)
+		}
+		joinNamespace(spec, nsType, fmt.Sprintf("/proc/%d/ns/%s", pid, nsFiles[nsType]))
+	}
+
+	cfg := &lxcri.ContainerConfig{
+		Spec:        spec,
+		ContainerID: id,
+		BundlePath:  def.Bundle,
+		Log:         rt.Log.With().Str("container", id).Logger(),
+	}
+	if def.Restart != "" {
+		cfg.RestartPolicy, err = lxcri.ParseRestartPolicy(def.Restart)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	c, err := rt.Create(ctx, cfg)
+	if c != nil {
+		defer c.Release()
+	}
+	// The runtime directory of an existing container belongs to another Up call.
+	if errors.Is(err, lxcri.ErrExist) {
+		return false, err
+	}
+	if err != nil {
+		return true, err
+	}
+	return true, rt.Start(ctx, c)
+}
+
+// initPid returns the PID of the running init process of the container.
+func initPid(rt *lxcri.Runtime, id string) (int, error) {
+	c, err := rt.Load(id)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Release()
+	pid := c.LinuxContainer.InitPid()
+	if pid < 1 {
+		return 0, fmt.Errorf("container %q is not running", id)
+	}
+	return pid, nil
+}
+
+// joinNamespace sets the path of the given namespace type in the spec.
+func joinNamespace(spec *specs.Spec, nsType specs.LinuxNamespaceType, path string) {
+	for i, ns := range spec.Linux.Namespaces {
+		if ns.Type == nsType {
+			spec.Linux.Namespaces[i].Path = path
+			return
+		}
+	}
+	spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: nsType, Path: path})
+}
+
+// Down stops and deletes all containers of the project in reverse dependency order.
+// Containers that do not exist are ignored.
+func Down(ctx context.Context, rt *lxcri.Runtime, p *Project) error {
+	order, err := p.Order()
+	if err != nil {
+		return err
+	}
+	return down(ctx, rt, p, order)
+}
+
+func down(ctx context.Context, rt *lxcri.Runtime, p *Project, order []string) error {
+	var firstErr error
+	for i := len(order) - 1; i >= 0; i-- {
+		id := p.ContainerID(order[i])
+		if err := stop(ctx, rt, id, time.Duration(p.StopTimeout)*time.Second); err != nil {
+			rt.Log.Warn().Err(err).Str("container", id).Msg("failed to stop container")
+		}
+		err := rt.Delete(ctx, id, true)
+		if err != nil && !errors.Is(err, lxcri.ErrNotExist) && firstErr == nil {
+			firstErr = fmt.Errorf("failed to delete container %q: %w", id, err)
+		}
+	}
+	return firstErr
+}
+
+// stop sends SIGTERM to the container and waits until it is stopped.
+func stop(ctx context.Context, rt *lxcri.Runtime, id string, timeout time.Duration) error {
+	c, err := rt.Load(id)
+	if errors.Is(err, lxcri.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+
+	state, err := c.ContainerState()
+	if err != nil {
+		return err
+	}
+	if state == specs.StateStopped {
+		return nil
+	}
+	if err := rt.Kill(ctx, c, unix.SIGTERM); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		state, err := c.ContainerState()
+		if err != nil {
+			return err
+		}
+		if state == specs.StateStopped {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package compose
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`
+name: myapp
+containers:
+  web:
+    bundle: /bundles/web
+    depends_on: [cache]
+    share:
+      network: db
+    restart: on-failure:3
+  db:
+    bundle: /bundles/db
+  cache:
+    bundle: /bundles/cache
+`))
+	require.NoError(t, err)
+	require.Equal(t, uint(DefaultStopTimeout), p.StopTimeout)
+	require.Equal(t, "myapp-web", p.ContainerID("web"))
+
+	order, err := p.Order()
+	require.NoError(t, err)
+	require.Equal(t, []string{"cache", "db", "web"}, order)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		// unknown field
+		"name: a\ncontainers:\n  c1:\n    bundle: /b\n    foo: bar\n",
+		// missing bundle
+		"name: a\ncontainers:\n  c1: {}\n",
+		// unknown dependency
+		"name: a\ncontainers:\n  c1:\n    bundle: /b\n    depends_on: [c2]\n",
+		// cycle
+		"name: a\ncontainers:\n  c1:\n    bundle: /b\n    depends_on: [c2]\n  c2:\n    bundle: /b\n    share: {ipc: c1}\n",
+		// invalid namespace
+		"name: a\ncontainers:\n  c1:\n    bundle: /b\n    share: {foo: c2}\n  c2:\n    bundle: /b\n",
+		// invalid restart policy
+		"name: a\ncontainers:\n  c1:\n    bundle: /b\n    restart: sometimes\n",
+		// invalid name
+		"name: A\ncontainers:\n  c1:\n    bundle: /b\n",
+	} {
+		_, err := Parse([]byte(data))
+		require.Error(t, err, data)
+	}
+}
+
+func TestJoinNamespace(t *testing.T) {
+	spec := &specs.Spec{Linux: &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{{Type: specs.NetworkNamespace}},
+	}}
+	joinNamespace(spec, specs.NetworkNamespace, "/proc/1/ns/net")
+	joinNamespace(spec, specs.IPCNamespace, "/proc/1/ns/ipc")
+	require.Equal(t, []specs.LinuxNamespace{
+		{Type: specs.NetworkNamespace, Path: "/proc/1/ns/net"},
+		{Type: specs.IPCNamespace, Path: "/proc/1/ns/ipc"},
+	}, spec.Linux.Namespaces)
+}
@@ -0,0 +1,153 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// JournalSocket is the socket of the journald native protocol.
+// See https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+var JournalSocket = "/run/systemd/journal/socket"
+
+// journalFields maps zerolog fields to journald fields.
+// Fields that are not mapped are converted to upper case.
+var journalFields = map[string]string{
+	"cid": "CONTAINER_ID",
+	"cmd": "OPERATION",
+	"op":  "OPERATION",
+	"c":   "CODE_LINE",
+	"t":   "", // journald records the timestamp
+}
+
+// journalPriority maps zerolog levels to syslog priorities.
+var journalPriority = map[string]string{
+	zerolog.TraceLevel.String(): "7",
+	zerolog.DebugLevel.String(): "7",
+	zerolog.InfoLevel.String():  "6",
+	zerolog.WarnLevel.String():  "4",
+	zerolog.ErrorLevel.String(): "3",
+	zerolog.FatalLevel.String(): "2",
+	zerolog.PanicLevel.String(): "0",
+}
+
+// JournalWriter is a zerolog writer that sends the JSON encoded
+// log entries as structured entries to journald.
+type JournalWriter struct {
+	conn *net.UnixConn
+	// Identifier is the SYSLOG_IDENTIFIER of the entries.
+	Identifier string
+}
+
+// NewJournalWriter connects to the journald socket.
+func NewJournalWriter(identifier string) (*JournalWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: JournalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return &JournalWriter{conn: conn, Identifier: identifier}, nil
+}
+
+// Write sends the given JSON encoded log entry to journald.
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	data, err := journalEntry(p, w.Identifier)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.conn.Write(data); err != nil {
+		return 0, fmt.Errorf("failed to write to journald: %w", err)
+	}
+	return len(p), nil
+}
+
+// Close closes the journald connection.
+func (w *JournalWriter) Close() error {
+	return w.conn.Close()
+}
+
+// journalEntry converts the JSON encoded zerolog entry
+// into the journald native protocol format.
+func journalEntry(p []byte, identifier string) ([]byte, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return nil, fmt.Errorf("invalid log entry: %w", err)
+	}
+	var buf bytes.Buffer
+	if identifier != "" {
+		writeJournalField(&buf, "SYSLOG_IDENTIFIER", identifier)
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fields[k]
+		var val string
+		if s, ok := v.(string); ok {
+			val = s
+		} else {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			val = string(b)
+		}
+		switch k {
+		case zerolog.MessageFieldName:
+			writeJournalField(&buf, "MESSAGE", val)
+		case zerolog.LevelFieldName:
+			if prio, ok := journalPriority[val]; ok {
+				writeJournalField(&buf, "PRIORITY", prio)
+			}
+		default:
+			name, ok := journalFields[k]
+			if !ok {
+				name = journalFieldName(k)
+			}
+			if name != "" {
+				writeJournalField(&buf, name, val)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// journalFieldName returns a valid journald field name, which consists of
+// upper case letters, digits and underscores and does not start with an underscore.
+func journalFieldName(k string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+	return strings.TrimLeft(name, "_0123456789")
+}
+
+// writeJournalField writes the field in the native protocol format.
+// Values with newlines are written with an explicit length.
+func writeJournalField(buf *bytes.Buffer, name string, val string) {
+	buf.WriteString(name)
+	if !strings.Contains(val, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(val)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	// #nosec
+	binary.Write(buf, binary.LittleEndian, uint64(len(val)))
+	buf.WriteString(val)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,25 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalEntry(t *testing.T) {
+	data, err := journalEntry([]byte(`{"l":"warn","cmd":"create","cid":"abc","pid":42,"c":"create.go:12","t":"2021-01-01T00:00:00Z","m":"hello"}`), "lxcri")
+	require.NoError(t, err)
+	require.Equal(t, "SYSLOG_IDENTIFIER=lxcri\nCODE_LINE=create.go:12\nCONTAINER_ID=abc\nOPERATION=create\nPRIORITY=4\nMESSAGE=hello\nPID=42\n", string(data))
+
+	data, err = journalEntry([]byte(`{"m":"a\nb"}`), "")
+	require.NoError(t, err)
+	require.Equal(t, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", string(data))
+
+	_, err = journalEntry([]byte(`{`), "")
+	require.Error(t, err)
+}
+
+func TestJournalFieldName(t *testing.T) {
+	require.Equal(t, "EXIT_CODE", journalFieldName("exit-code"))
+	require.Equal(t, "FOO", journalFieldName("_1foo"))
+}
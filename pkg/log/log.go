@@ -70,3 +70,40 @@ func NewLogger(out io.Writer, level zerolog.Level) zerolog.Context {
 func ConsoleLogger(color bool, level zerolog.Level) zerolog.Logger {
 	return zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout, NoColor: !color}).Level(level).With().Timestamp().Caller().Logger()
 }
+
+// Sampling limits the number of debug and trace log entries.
+// Entries with a higher level are never dropped.
+type Sampling struct {
+	// Burst is the number of entries per Period that are always logged.
+	Burst uint32 `json:",omitempty"`
+	// Period is the duration of a sampling period (default is one second).
+	Period time.Duration `json:",omitempty"`
+	// Every logs every n-th entry after Burst is exceeded.
+	// If Every is zero the remaining entries of the period are dropped.
+	Every uint32 `json:",omitempty"`
+}
+
+// Enabled returns true if sampling is configured.
+func (s Sampling) Enabled() bool {
+	return s.Burst > 0 || s.Every > 0
+}
+
+// Sample returns a copy of the given logger that samples
+// debug and trace entries as configured by s.
+// The logger is returned unmodified if sampling is not enabled.
+func Sample(l zerolog.Logger, s Sampling) zerolog.Logger {
+	if !s.Enabled() {
+		return l
+	}
+	period := s.Period
+	if period == 0 {
+		period = time.Second
+	}
+	// A BurstSampler without NextSampler drops all entries that exceed the burst.
+	var next zerolog.Sampler
+	if s.Every > 0 {
+		next = &zerolog.BasicSampler{N: s.Every}
+	}
+	sampler := &zerolog.BurstSampler{Burst: s.Burst, Period: period, NextSampler: next}
+	return l.Sample(zerolog.LevelSampler{TraceSampler: sampler, DebugSampler: sampler})
+}
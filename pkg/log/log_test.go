@@ -0,0 +1,28 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSample(t *testing.T) {
+	var buf bytes.Buffer
+	l := Sample(NewLogger(&buf, DebugLevel).Logger(), Sampling{Burst: 2})
+	for i := 0; i < 5; i++ {
+		l.Debug().Int("i", i).Msg("debug")
+		l.Info().Int("i", i).Msg("info")
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// 2 debug entries within the burst and all info entries
+	require.Len(t, lines, 7)
+
+	buf.Reset()
+	l = Sample(NewLogger(&buf, DebugLevel).Logger(), Sampling{})
+	for i := 0; i < 5; i++ {
+		l.Debug().Int("i", i).Msg("debug")
+	}
+	require.Len(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), 5)
+}
@@ -0,0 +1,118 @@
+package specki
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// MergePatch applies the JSON merge patch (RFC 7386) to the given spec
+// and returns the patched spec. The given spec is not modified.
+// Arrays are replaced as a whole, use SpecPatch to merge mounts,
+// environment variables and devices.
+func MergePatch(spec *specs.Spec, patch []byte) (*specs.Spec, error) {
+	base, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize spec: %w", err)
+	}
+	var doc, p interface{}
+	if err := json.Unmarshal(base, &doc); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	merged, err := json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return nil, err
+	}
+	patched := new(specs.Spec)
+	if err := json.Unmarshal(merged, patched); err != nil {
+		return nil, fmt.Errorf("invalid patched spec: %w", err)
+	}
+	return patched, nil
+}
+
+// mergePatch implements the MergePatch function of RFC 7386.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// SpecPatch is a partial spec that is merged into a base spec by Apply.
+// Unlike a JSON merge patch, list elements are merged by their key.
+type SpecPatch struct {
+	// Env are the process environment variables (KEY=VALUE).
+	// Variables with the same key are replaced.
+	Env []string `json:"env,omitempty"`
+	// Mounts with the same destination are replaced.
+	Mounts []specs.Mount `json:"mounts,omitempty"`
+	// Devices with the same path are replaced.
+	Devices []specs.LinuxDevice `json:"devices,omitempty"`
+}
+
+// Apply merges the patch into the given spec.
+func (p *SpecPatch) Apply(spec *specs.Spec) error {
+	if len(p.Env) > 0 {
+		if spec.Process == nil {
+			return fmt.Errorf("spec has no process")
+		}
+		for _, kv := range p.Env {
+			spec.Process.Env, _ = Setenv(spec.Process.Env, kv, true)
+		}
+	}
+
+	for _, m := range p.Mounts {
+		if m.Destination == "" {
+			return fmt.Errorf("mount without destination")
+		}
+		replaced := false
+		for i := range spec.Mounts {
+			if filepath.Clean(spec.Mounts[i].Destination) == filepath.Clean(m.Destination) {
+				spec.Mounts[i] = m
+				replaced = true
+			}
+		}
+		if !replaced {
+			spec.Mounts = append(spec.Mounts, m)
+		}
+	}
+
+	if len(p.Devices) > 0 {
+		if spec.Linux == nil {
+			spec.Linux = new(specs.Linux)
+		}
+		for _, dev := range p.Devices {
+			if dev.Path == "" {
+				return fmt.Errorf("device without path")
+			}
+			replaced := false
+			for i := range spec.Linux.Devices {
+				if spec.Linux.Devices[i].Path == dev.Path {
+					spec.Linux.Devices[i] = dev
+					replaced = true
+				}
+			}
+			if !replaced {
+				spec.Linux.Devices = append(spec.Linux.Devices, dev)
+			}
+		}
+	}
+	return nil
+}
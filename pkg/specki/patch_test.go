@@ -0,0 +1,50 @@
+package specki
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	spec := NewSpec("/rootfs", "/bin/sh")
+	spec.Hostname = "foo"
+	spec.Annotations = map[string]string{"a": "1", "b": "2"}
+
+	patched, err := MergePatch(spec, []byte(`{"hostname":null,"annotations":{"a":null,"c":"3"},"process":{"cwd":"/tmp"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "", patched.Hostname)
+	require.Equal(t, map[string]string{"b": "2", "c": "3"}, patched.Annotations)
+	require.Equal(t, "/tmp", patched.Process.Cwd)
+	require.Equal(t, spec.Process.Args, patched.Process.Args)
+	// the spec is not modified
+	require.Equal(t, "foo", spec.Hostname)
+
+	_, err = MergePatch(spec, []byte(`{"process":`))
+	require.Error(t, err)
+}
+
+func TestSpecPatchApply(t *testing.T) {
+	spec := NewSpec("/rootfs", "/bin/sh")
+	spec.Process.Env = []string{"PATH=/bin", "FOO=bar"}
+	spec.Mounts = []specs.Mount{{Destination: "/data", Source: "/a", Type: "bind"}}
+	spec.Linux.Devices = nil
+
+	p := SpecPatch{
+		Env:     []string{"FOO=baz", "NEW=1"},
+		Mounts:  []specs.Mount{{Destination: "/data/", Source: "/b", Type: "bind"}, {Destination: "/cache", Type: "tmpfs"}},
+		Devices: []specs.LinuxDevice{{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 229}},
+	}
+	require.NoError(t, p.Apply(spec))
+	require.Equal(t, []string{"PATH=/bin", "FOO=baz", "NEW=1"}, spec.Process.Env)
+	require.Len(t, spec.Mounts, 2)
+	require.Equal(t, "/b", spec.Mounts[0].Source)
+	require.Equal(t, "/cache", spec.Mounts[1].Destination)
+	require.Len(t, spec.Linux.Devices, 1)
+
+	p = SpecPatch{Devices: []specs.LinuxDevice{{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 230}}}
+	require.NoError(t, p.Apply(spec))
+	require.Len(t, spec.Linux.Devices, 1)
+	require.Equal(t, int64(230), spec.Linux.Devices[0].Minor)
+}
@@ -0,0 +1,264 @@
+package specki
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// seccompActions are the seccomp actions defined by the runtime spec.
+var seccompActions = map[specs.LinuxSeccompAction]bool{
+	specs.ActKill:  true,
+	specs.ActTrap:  true,
+	specs.ActErrno: true,
+	specs.ActTrace: true,
+	specs.ActAllow: true,
+	specs.ActLog:   true,
+}
+
+// seccompOperators are the argument comparison operators defined by the runtime spec.
+var seccompOperators = map[specs.LinuxSeccompOperator]bool{
+	specs.OpNotEqual:     true,
+	specs.OpLessThan:     true,
+	specs.OpLessEqual:    true,
+	specs.OpEqualTo:      true,
+	specs.OpGreaterEqual: true,
+	specs.OpGreaterThan:  true,
+	specs.OpMaskedEqual:  true,
+}
+
+// maxSyscallArgs is the number of syscall arguments that can be compared.
+const maxSyscallArgs = 6
+
+// SeccompIssue is a problem found by LintSeccomp.
+type SeccompIssue struct {
+	// Syscall is the syscall name the issue refers to (if any).
+	Syscall string `json:",omitempty"`
+	Message string
+}
+
+func (i SeccompIssue) String() string {
+	if i.Syscall == "" {
+		return i.Message
+	}
+	return i.Syscall + ": " + i.Message
+}
+
+// LoadSeccompJSON reads the JSON encoded seccomp profile from the given path.
+// This is a convenience function for the cli.
+func LoadSeccompJSON(p string) (*specs.LinuxSeccomp, error) {
+	seccomp := new(specs.LinuxSeccomp)
+	err := DecodeJSONFile(p, seccomp)
+	return seccomp, err
+}
+
+// LintSeccomp validates the given seccomp profile and returns the issues found.
+// Syscalls are reported as unknown if isKnownSyscall is not nil
+// and returns false for the syscall name.
+func LintSeccomp(seccomp *specs.LinuxSeccomp, isKnownSyscall func(name string) bool) []SeccompIssue {
+	var issues []SeccompIssue
+	if !seccompActions[seccomp.DefaultAction] {
+		issues = append(issues, SeccompIssue{Message: fmt.Sprintf("invalid default action %q", seccomp.DefaultAction)})
+	}
+
+	seen := make(map[string]string)
+	for i, sc := range seccomp.Syscalls {
+		if len(sc.Names) == 0 {
+			issues = append(issues, SeccompIssue{Message: fmt.Sprintf("syscall rule %d has no names", i)})
+		}
+		if !seccompActions[sc.Action] {
+			issues = append(issues, SeccompIssue{Message: fmt.Sprintf("syscall rule %d has invalid action %q", i, sc.Action)})
+		}
+		if sc.ErrnoRet != nil && sc.Action != specs.ActErrno && sc.Action != specs.ActTrace {
+			issues = append(issues, SeccompIssue{Message: fmt.Sprintf("syscall rule %d: errnoRet is ignored for action %q", i, sc.Action)})
+		}
+		for _, arg := range sc.Args {
+			if arg.Index >= maxSyscallArgs {
+				issues = append(issues, SeccompIssue{Message: fmt.Sprintf("syscall rule %d: invalid argument index %d", i, arg.Index)})
+			}
+			if !seccompOperators[arg.Op] {
+				issues = append(issues, SeccompIssue{Message: fmt.Sprintf("syscall rule %d: invalid argument operator %q", i, arg.Op)})
+			}
+		}
+		rule := seccompRule(sc)
+		for _, name := range sc.Names {
+			if name == "" {
+				issues = append(issues, SeccompIssue{Message: fmt.Sprintf("syscall rule %d has an empty name", i)})
+				continue
+			}
+			// Rules with arguments may be split across multiple entries.
+			if prev, ok := seen[name]; ok && len(sc.Args) == 0 && prev != rule {
+				issues = append(issues, SeccompIssue{Syscall: name, Message: fmt.Sprintf("conflicting rules %q and %q", prev, rule)})
+			}
+			seen[name] = rule
+			if isKnownSyscall != nil && !isKnownSyscall(name) {
+				issues = append(issues, SeccompIssue{Syscall: name, Message: "unknown syscall"})
+			}
+		}
+	}
+	return issues
+}
+
+// seccompRule returns a string representation of the action and arguments of sc.
+func seccompRule(sc specs.LinuxSyscall) string {
+	s := string(sc.Action)
+	if sc.ErrnoRet != nil {
+		s += fmt.Sprintf("(%d)", *sc.ErrnoRet)
+	}
+	for _, arg := range sc.Args {
+		s += fmt.Sprintf(" [%d,%d,%s,%d]", arg.Index, arg.Value, arg.Op, arg.ValueTwo)
+	}
+	return s
+}
+
+// seccompRules returns the rules of all syscalls by syscall name.
+func seccompRules(seccomp *specs.LinuxSeccomp) map[string][]string {
+	rules := make(map[string][]string)
+	for _, sc := range seccomp.Syscalls {
+		rule := seccompRule(sc)
+		for _, name := range sc.Names {
+			rules[name] = append(rules[name], rule)
+		}
+	}
+	for _, r := range rules {
+		sort.Strings(r)
+	}
+	return rules
+}
+
+// SeccompDiff describes the differences between two seccomp profiles.
+type SeccompDiff struct {
+	// DefaultAction is set to the default actions of both profiles if they differ.
+	DefaultAction []specs.LinuxSeccompAction `json:",omitempty"`
+	// Added are the syscalls that only have rules in the second profile.
+	Added []string `json:",omitempty"`
+	// Removed are the syscalls that only have rules in the first profile.
+	Removed []string `json:",omitempty"`
+	// Changed are the syscalls with different rules.
+	Changed []string `json:",omitempty"`
+}
+
+// Empty returns true if the profiles are equivalent.
+func (d *SeccompDiff) Empty() bool {
+	return len(d.DefaultAction) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffSeccomp compares the syscall rules of two seccomp profiles.
+// The order of the rules is not significant.
+func DiffSeccomp(a, b *specs.LinuxSeccomp) *SeccompDiff {
+	d := &SeccompDiff{}
+	if a.DefaultAction != b.DefaultAction {
+		d.DefaultAction = []specs.LinuxSeccompAction{a.DefaultAction, b.DefaultAction}
+	}
+	rulesA, rulesB := seccompRules(a), seccompRules(b)
+	for name, ra := range rulesA {
+		rb, ok := rulesB[name]
+		if !ok {
+			d.Removed = append(d.Removed, name)
+			continue
+		}
+		if strings.Join(ra, "\n") != strings.Join(rb, "\n") {
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for name := range rulesB {
+		if _, ok := rulesA[name]; !ok {
+			d.Added = append(d.Added, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
+
+// ReadSyscallNames reads the syscall names from a kernel syscall header
+// (e.g /usr/include/asm/unistd_64.h) with lines like `#define __NR_read 0`.
+func ReadSyscallNames(r io.Reader) (map[string]bool, error) {
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "#define" && strings.HasPrefix(fields[1], "__NR_") {
+			names[strings.TrimPrefix(fields[1], "__NR_")] = true
+		}
+	}
+	return names, scanner.Err()
+}
+
+// ReadSyscallTable reads the syscall numbers from a kernel syscall header
+// (e.g /usr/include/asm/unistd_64.h) and returns the syscall names by number.
+// Definitions that are not a plain number (e.g `(__NR_SYSCALL_BASE + 1)`) are skipped.
+func ReadSyscallTable(r io.Reader) (map[int]string, error) {
+	table := make(map[int]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "#define" || !strings.HasPrefix(fields[1], "__NR_") {
+			continue
+		}
+		n, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		table[n] = strings.TrimPrefix(fields[1], "__NR_")
+	}
+	return table, scanner.Err()
+}
+
+// SeccompAuditRecord is a syscall that was logged by the kernel,
+// because of the seccomp action SCMP_ACT_LOG.
+type SeccompAuditRecord struct {
+	Pid     int
+	Arch    string
+	Syscall int
+}
+
+// ParseSeccompAuditRecord parses an audit record of type SECCOMP (1326)
+// from the audit log or the kernel log, e.g
+// `type=SECCOMP msg=audit(1618231234.123:42): ... pid=123 comm="sh" ... arch=c000003e syscall=59 compat=0 ip=0x7f code=0x7ffc0000`
+// It returns false if the line is not a SECCOMP record.
+func ParseSeccompAuditRecord(line string) (SeccompAuditRecord, bool) {
+	var rec SeccompAuditRecord
+	if !strings.Contains(line, "type=SECCOMP") && !strings.Contains(line, "type=1326") {
+		return rec, false
+	}
+	var hasPid, hasSyscall bool
+	for _, f := range strings.Fields(line) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var err error
+		switch kv[0] {
+		case "pid":
+			rec.Pid, err = strconv.Atoi(kv[1])
+			hasPid = err == nil
+		case "arch":
+			rec.Arch = kv[1]
+		case "syscall":
+			rec.Syscall, err = strconv.Atoi(kv[1])
+			hasSyscall = err == nil
+		}
+	}
+	return rec, hasPid && hasSyscall
+}
+
+// SeccompAllowProfile returns a seccomp profile that only allows the given syscalls.
+// All other syscalls fail with EPERM.
+func SeccompAllowProfile(syscalls []string, archs []specs.Arch) *specs.LinuxSeccomp {
+	names := append([]string(nil), syscalls...)
+	sort.Strings(names)
+	return &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: archs,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: names, Action: specs.ActAllow},
+		},
+	}
+}
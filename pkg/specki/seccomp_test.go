@@ -0,0 +1,97 @@
+package specki
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintSeccomp(t *testing.T) {
+	errno := uint(1)
+	seccomp := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"read", "write"}, Action: specs.ActAllow},
+			{Names: []string{"write"}, Action: specs.ActErrno, ErrnoRet: &errno},
+			{Names: []string{"frobnicate"}, Action: "SCMP_ACT_FOO"},
+			{Names: []string{"personality"}, Action: specs.ActAllow,
+				Args: []specs.LinuxSeccompArg{{Index: 6, Value: 8, Op: "SCMP_CMP_FOO"}},
+			},
+		},
+	}
+	known := map[string]bool{"read": true, "write": true, "personality": true}
+	issues := LintSeccomp(seccomp, func(name string) bool { return known[name] })
+	msgs := make([]string, len(issues))
+	for i, issue := range issues {
+		msgs[i] = issue.String()
+	}
+	require.Equal(t, []string{
+		`write: conflicting rules "SCMP_ACT_ALLOW" and "SCMP_ACT_ERRNO(1)"`,
+		`syscall rule 2 has invalid action "SCMP_ACT_FOO"`,
+		`frobnicate: unknown syscall`,
+		`syscall rule 3: invalid argument index 6`,
+		`syscall rule 3: invalid argument operator "SCMP_CMP_FOO"`,
+	}, msgs)
+}
+
+func TestDiffSeccomp(t *testing.T) {
+	a := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"read", "write", "open"}, Action: specs.ActAllow},
+		},
+	}
+	b := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"write"}, Action: specs.ActAllow},
+			{Names: []string{"read"}, Action: specs.ActLog},
+			{Names: []string{"openat"}, Action: specs.ActAllow},
+		},
+	}
+	require.True(t, DiffSeccomp(a, a).Empty())
+
+	d := DiffSeccomp(a, b)
+	require.Nil(t, d.DefaultAction)
+	require.Equal(t, []string{"openat"}, d.Added)
+	require.Equal(t, []string{"open"}, d.Removed)
+	require.Equal(t, []string{"read"}, d.Changed)
+}
+
+func TestReadSyscallNames(t *testing.T) {
+	header := "#ifndef _ASM_UNISTD_64_H\n#define _ASM_UNISTD_64_H\n#define __NR_read 0\n#define __NR_write 1\n"
+	names, err := ReadSyscallNames(strings.NewReader(header))
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"read": true, "write": true}, names)
+}
+
+func TestReadSyscallTable(t *testing.T) {
+	header := "#define __NR_read 0\n#define __NR_write 1\n#define __NR_foo (__NR_SYSCALL_BASE + 2)\n"
+	table, err := ReadSyscallTable(strings.NewReader(header))
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{0: "read", 1: "write"}, table)
+}
+
+func TestParseSeccompAuditRecord(t *testing.T) {
+	line := `type=SECCOMP msg=audit(1618231234.123:42): auid=4294967295 uid=0 gid=0 ses=4294967295 pid=123 comm="sh" exe="/bin/sh" sig=0 arch=c000003e syscall=59 compat=0 ip=0x7f0c code=0x7ffc0000`
+	rec, ok := ParseSeccompAuditRecord(line)
+	require.True(t, ok)
+	require.Equal(t, SeccompAuditRecord{Pid: 123, Arch: "c000003e", Syscall: 59}, rec)
+
+	// kernel log format
+	line = `audit: type=1326 audit(1618231234.123:42): auid=4294967295 uid=0 gid=0 ses=4294967295 pid=7 comm="ls" exe="/bin/ls" sig=0 arch=c000003e syscall=0 compat=0 ip=0x7f code=0x7ffc0000`
+	rec, ok = ParseSeccompAuditRecord(line)
+	require.True(t, ok)
+	require.Equal(t, 0, rec.Syscall)
+
+	_, ok = ParseSeccompAuditRecord(`type=SYSCALL msg=audit(1618231234.123:43): arch=c000003e syscall=59 pid=1`)
+	require.False(t, ok)
+}
+
+func TestSeccompAllowProfile(t *testing.T) {
+	p := SeccompAllowProfile([]string{"write", "read"}, []specs.Arch{specs.ArchX86_64})
+	require.Equal(t, specs.ActErrno, p.DefaultAction)
+	require.Equal(t, []specs.LinuxSyscall{{Names: []string{"read", "write"}, Action: specs.ActAllow}}, p.Syscalls)
+}
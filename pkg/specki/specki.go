@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 )
 
 // UnmapContainerID returns the (user/group) ID to which the given
@@ -38,8 +40,39 @@ func UnmapContainerID(id uint32, idmaps []specs.LinuxIDMapping) uint32 {
 	return id
 }
 
+// HookError is the error of a failed hook.
+type HookError struct {
+	// Index is the index of the hook in the list of hooks.
+	Index int
+	// Path is the hook executable.
+	Path string
+	Err  error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("hook[%d] %s failed: %s", e.Index, e.Path, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// HooksError is returned by RunHooks if one or more hooks failed.
+type HooksError []*HookError
+
+func (e HooksError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
 // RunHooks calls RunHook for each of the given runtime hooks.
 // The given runtime state is serialized as JSON and passed to each RunHook call.
+// If continueOnError is true, the remaining hooks are run if a hook fails
+// and the failures are returned as HooksError.
+// Hooks are not run after the given context is done.
 func RunHooks(ctx context.Context, state *specs.State, hooks []specs.Hook, continueOnError bool) error {
 	if len(hooks) == 0 {
 		return nil
@@ -48,7 +81,12 @@ func RunHooks(ctx context.Context, state *specs.State, hooks []specs.Hook, conti
 	if err != nil {
 		return fmt.Errorf("failed to serialize spec state: %w", err)
 	}
+	var errs HooksError
 	for i, h := range hooks {
+		if ctx.Err() != nil {
+			errs = append(errs, &HookError{Index: i, Path: h.Path, Err: fmt.Errorf("not started: %w", ctx.Err())})
+			continue
+		}
 		fmt.Printf("running hook[%d] path:%s\n", i, h.Path)
 		err := RunHook(ctx, stateJSON, h)
 		if err != nil {
@@ -56,8 +94,12 @@ func RunHooks(ctx context.Context, state *specs.State, hooks []specs.Hook, conti
 			if !continueOnError {
 				return err
 			}
+			errs = append(errs, &HookError{Index: i, Path: h.Path, Err: err})
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -71,7 +113,11 @@ func RunHook(ctx context.Context, stateJSON []byte, hook specs.Hook) error {
 		defer cancel()
 		ctx = hookCtx
 	}
-	cmd := exec.CommandContext(ctx, hook.Path, hook.Args...)
+	cmd := exec.CommandContext(ctx, hook.Path)
+	// Hook.Args has the same semantics as execv, Args[0] is the program name.
+	if len(hook.Args) > 0 {
+		cmd.Args = hook.Args
+	}
 	cmd.Env = hook.Env
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
@@ -82,11 +128,20 @@ func RunHook(ctx context.Context, stateJSON []byte, hook specs.Hook) error {
 	if err := cmd.Start(); err != nil {
 		return err
 	}
-	if _, err := io.Copy(in, bytes.NewReader(stateJSON)); err != nil {
-		return err
+	// A hook is not required to read the state,
+	// so EPIPE is ignored if it exits before the state is written.
+	if _, err := io.Copy(in, bytes.NewReader(stateJSON)); err != nil && !errors.Is(err, unix.EPIPE) {
+		in.Close()
+		// #nosec
+		cmd.Wait()
+		return fmt.Errorf("failed to write state to hook: %w", err)
 	}
 	in.Close()
-	return cmd.Wait()
+	err = cmd.Wait()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s: %w", err, ctx.Err())
+	}
+	return err
 }
 
 // DecodeJSONFile reads the next JSON-encoded value from
@@ -145,10 +200,9 @@ func modep(m os.FileMode) *os.FileMode {
 	return &m
 }
 
-// FIXME runtime mandates that /dev/ptmx should be bind mount from host - why ?
-// `man 2 mount` | devpts
-// ` To use this option effectively, /dev/ptmx must be a symbolic link to pts/ptmx.
-// See Documentation/filesystems/devpts.txt in the Linux kernel source tree for details.`
+// NOTE /dev/ptmx is not an essential device. The runtime spec requires
+// /dev/ptmx to be a bind mount or symlink of /dev/pts/ptmx of the new
+// devpts instance (see lxcri#configurePtmx).
 
 var (
 	// EssentialDevices is the minimum set of device files that must exist in an OCI compliant container.
@@ -162,6 +216,33 @@ var (
 		specs.LinuxDevice{Type: "c", Major: 5, Minor: 0, FileMode: modep(0666), Path: "/dev/tty"},
 	}
 
+	// DefaultMaskedPaths are the paths masked by CRI-O (and the moby/containerd defaults)
+	// if the container does not define them.
+	DefaultMaskedPaths = []string{
+		"/proc/acpi",
+		"/proc/kcore",
+		"/proc/keys",
+		"/proc/latency_stats",
+		"/proc/timer_list",
+		"/proc/timer_stats",
+		"/proc/sched_debug",
+		"/proc/scsi",
+		"/sys/firmware",
+		"/sys/dev/block",
+		"/sys/devices/virtual/powercap",
+	}
+
+	// DefaultReadonlyPaths are the paths mounted read-only by CRI-O
+	// (and the moby/containerd defaults) if the container does not define them.
+	DefaultReadonlyPaths = []string{
+		"/proc/asound",
+		"/proc/bus",
+		"/proc/fs",
+		"/proc/irq",
+		"/proc/sys",
+		"/proc/sysrq-trigger",
+	}
+
 	// EssentialDevicesAllow are the cgroup device permissions required for EssentialDevices.
 	EssentialDevicesAllow = []specs.LinuxDeviceCgroup{
 		specs.LinuxDeviceCgroup{Allow: true, Type: "c", Major: int64p(1), Minor: int64p(3), Access: "rwm"}, // null
@@ -346,6 +427,16 @@ func Setenv(env []string, val string, overwrite bool) ([]string, bool) {
 	return append(env, val), false
 }
 
+// HasMountOption returns true if opts contains the mount option opt.
+func HasMountOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
 // BindMount returns a specs.Mount to bind mount src to dest.
 // The given mount options opts are merged with the predefined options
 // ("bind", "nosuid", "nodev", "relatime")
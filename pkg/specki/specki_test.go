@@ -0,0 +1,50 @@
+package specki
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHooks(t *testing.T) {
+	timeout := 1
+	hooks := []specs.Hook{
+		{Path: "/bin/sh", Args: []string{"sh", "-c", "exit 1"}},
+		{Path: "/bin/sh", Args: []string{"sh", "-c", "cat > /dev/null"}},
+		{Path: "/bin/sh", Args: []string{"sh", "-c", "sleep 10"}, Timeout: &timeout},
+	}
+	state := &specs.State{ID: "test"}
+
+	err := RunHooks(context.Background(), state, hooks, false)
+	require.Error(t, err)
+	var herrs HooksError
+	require.False(t, errors.As(err, &herrs))
+
+	err = RunHooks(context.Background(), state, hooks, true)
+	require.True(t, errors.As(err, &herrs))
+	require.Len(t, herrs, 2)
+	require.Equal(t, 0, herrs[0].Index)
+	require.Equal(t, 2, herrs[1].Index)
+	require.True(t, errors.Is(herrs[1], context.DeadlineExceeded))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = RunHooks(ctx, state, hooks[1:2], true)
+	require.True(t, errors.As(err, &herrs))
+	require.True(t, errors.Is(herrs[0], context.Canceled))
+}
+
+func TestRunHookArgs(t *testing.T) {
+	// Args[0] is the program name and not passed as argument.
+	hook := specs.Hook{Path: "/bin/sh", Args: []string{"sh", "-c", `test $# -eq 0 && test "$0" = sh`}}
+	require.NoError(t, RunHook(context.Background(), []byte("{}"), hook))
+
+	// The hook does not read the state from stdin.
+	state := bytes.Repeat([]byte(" "), 1<<20)
+	hook = specs.Hook{Path: "/bin/sh", Args: []string{"sh", "-c", "exit 0"}}
+	require.NoError(t, RunHook(context.Background(), state, hook))
+}
@@ -0,0 +1,361 @@
+package lxcri
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// postmortemLogSize is the maximum number of bytes read from the end of the liblxc log file.
+	postmortemLogSize = 64 * 1024
+	// postmortemLogLines is the maximum number of liblxc log lines added to a StartError.
+	postmortemLogLines = 20
+	// postmortemKmsgLines is the maximum number of kernel messages added to a StartError.
+	postmortemKmsgLines = 10
+)
+
+// kmsgPatterns match kernel messages relevant for a container start failure.
+var kmsgPatterns = []string{
+	`apparmor="DENIED"`,
+	"type=1326", // AUDIT_SECCOMP
+	"type=1400", // AUDIT_AVC
+	"segfault at",
+	"Out of memory",
+}
+
+// kmsgPid matches the process IDs in kernel messages, e.g `pid=1234` in audit
+// records, `sh[1234]: segfault at` and `Killed process 1234 (sh)`.
+var kmsgPid = regexp.MustCompile(`(?:\bpid=|\[|Killed process )(\d+)`)
+
+// kmsgFilter selects the kernel messages of the container processes.
+// Kernel messages are not namespaced, so the messages of other containers
+// and host processes logged in the same time window must be skipped.
+type kmsgFilter struct {
+	// pids are the (host) process IDs of the container processes.
+	pids map[int]bool
+	// cgroup is the container cgroup path as logged by the kernel
+	// e.g in `oom_memcg=/lxcri.slice/c1`.
+	cgroup string
+}
+
+func (f *kmsgFilter) match(msg string) bool {
+	for _, m := range kmsgPid.FindAllStringSubmatch(msg, -1) {
+		if pid, err := strconv.Atoi(m[1]); err == nil && f.pids[pid] {
+			return true
+		}
+	}
+	if f.cgroup == "" {
+		return false
+	}
+	for _, key := range []string{"oom_memcg=", "task_memcg="} {
+		i := strings.Index(msg, key+f.cgroup)
+		if i < 0 {
+			continue
+		}
+		// the container cgroup or a child cgroup
+		end := i + len(key) + len(f.cgroup)
+		if end == len(msg) || strings.IndexByte("/, ", msg[end]) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// kmsgFilter returns the filter for the kernel messages of the container.
+// The processes of a failed container have usually exited, so the
+// init process IDs observed while the container was started are included.
+func (c *Container) kmsgFilter() *kmsgFilter {
+	f := &kmsgFilter{pids: make(map[int]bool)}
+	if c.Pid > 1 {
+		f.pids[c.Pid] = true
+	}
+	for _, pid := range c.startPids {
+		f.pids[pid] = true
+	}
+	if c.CgroupDir != "" {
+		f.cgroup = "/" + strings.Trim(c.CgroupDir, "/")
+		// The cgroup may be deleted already.
+		pids, _ := readCgroupProcs(c.sysFS(), filepath.Join(cgroupRoot, c.CgroupDir))
+		for _, pid := range pids {
+			f.pids[pid] = true
+		}
+	}
+	return f
+}
+
+// trackStartPids records the container init process ID and the processes
+// in the container cgroup while the container is started (see kmsgFilter).
+func (c *Container) trackStartPids() {
+	pids := make([]int, 0, 1)
+	if pid := c.LinuxContainer.InitPid(); pid > 0 {
+		pids = append(pids, pid)
+	}
+	if c.CgroupDir != "" {
+		procs, err := readCgroupProcs(c.sysFS(), filepath.Join(cgroupRoot, c.CgroupDir))
+		if err == nil {
+			pids = append(pids, procs...)
+		}
+	}
+	for _, pid := range pids {
+		found := false
+		for _, p := range c.startPids {
+			found = found || p == pid
+		}
+		if !found {
+			c.startPids = append(c.startPids, pid)
+		}
+	}
+}
+
+// StartError is the error returned when the container init process
+// fails to start. It contains the diagnostic information collected
+// after the failure.
+type StartError struct {
+	Err error
+	// Failure is the known cause of the failure (if any).
+	Failure *StartFailure
+	// LogLines are the last liblxc log lines of the container.
+	LogLines []string
+	// KernelMessages are the relevant kernel messages logged
+	// since the container was created or started.
+	KernelMessages []string
+	// MonitorOutput are the last lines written by the monitor process
+	// to stderr, if stderr is not inherited from the runtime process.
+	MonitorOutput []string
+	// Denials are the denied operations found by the denial audit
+	// (see ContainerConfig.AuditDenials).
+	Denials []Denial
+}
+
+func (e *StartError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	if e.Failure != nil {
+		b.WriteString("\ncause: ")
+		b.WriteString(e.Failure.Error())
+	}
+	if len(e.LogLines) > 0 {
+		b.WriteString("\nlxc log:")
+		for _, l := range e.LogLines {
+			b.WriteString("\n  ")
+			b.WriteString(l)
+		}
+	}
+	if len(e.KernelMessages) > 0 {
+		b.WriteString("\nkernel messages:")
+		for _, l := range e.KernelMessages {
+			b.WriteString("\n  ")
+			b.WriteString(l)
+		}
+	}
+	if len(e.MonitorOutput) > 0 {
+		b.WriteString("\nmonitor output:")
+		for _, l := range e.MonitorOutput {
+			b.WriteString("\n  ")
+			b.WriteString(l)
+		}
+	}
+	if len(e.Denials) > 0 {
+		b.WriteString("\ndenials:")
+		for _, d := range e.Denials {
+			b.WriteString("\n  ")
+			b.WriteString(d.String())
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the wrapped error.
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// monotonicNow returns the current CLOCK_MONOTONIC time in microseconds,
+// which is the clock used for the kernel log timestamps.
+func monotonicNow() uint64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return uint64(ts.Nano() / int64(time.Microsecond))
+}
+
+// postmortem wraps err into a StartError with the diagnostic information
+// collected from the liblxc log file and the kernel log.
+// since is the CLOCK_MONOTONIC timestamp in microseconds (see monotonicNow)
+// from which on kernel messages are collected.
+func (c *Container) postmortem(err error, since uint64) error {
+	serr := &StartError{Err: err}
+
+	lines, lerr := readLogTail(c.LogFile, " "+c.ContainerID+" ", postmortemLogLines)
+	if lerr != nil {
+		c.Log.Debug().Err(lerr).Str("file", c.LogFile).Msg("failed to read liblxc log")
+	}
+	serr.LogLines = lines
+
+	lines, lerr = readLogTail(c.monitorStderrPath(), "", postmortemLogLines)
+	if lerr != nil && !os.IsNotExist(lerr) {
+		c.Log.Debug().Err(lerr).Msg("failed to read monitor output")
+	}
+	serr.MonitorOutput = lines
+
+	serr.Failure = classifyStartFailure(serr.LogLines, serr.MonitorOutput)
+
+	msgs, kerr := readKmsg("/dev/kmsg", since, postmortemKmsgLines, c.kmsgFilter().match)
+	if kerr != nil {
+		// Reading the kernel log requires CAP_SYSLOG if kernel.dmesg_restrict is set.
+		c.Log.Debug().Err(kerr).Msg("failed to read kernel log")
+	}
+	serr.KernelMessages = msgs
+
+	if c.AuditDenials {
+		serr.Denials = auditDenials(c.Spec.Process, serr.LogLines, serr.MonitorOutput, serr.KernelMessages)
+	}
+	return serr
+}
+
+// readLogTail returns the last n lines from the given log file
+// that contain substr.
+// Non-regular files (e.g /dev/stderr) are ignored.
+func readLogTail(filename string, substr string, n int) ([]string, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	offset := fi.Size() - postmortemLogSize
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, fi.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return filterLogLines(data, substr, n, offset > 0), nil
+}
+
+// filterLogLines returns the last n lines in data that contain substr.
+// If partial is true the first line in data is skipped.
+func filterLogLines(data []byte, substr string, n int, partial bool) []string {
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 4096), len(data)+1)
+	for s.Scan() {
+		if partial {
+			partial = false
+			continue
+		}
+		line := s.Text()
+		if !strings.Contains(line, substr) {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
+
+// readKmsg returns the last n kernel messages, logged after the
+// given CLOCK_MONOTONIC timestamp (in microseconds), that match any of kmsgPatterns
+// and are selected by the match function (see kmsgFilter).
+// The whole kernel ring buffer is read in non-blocking mode, because the
+// records are read oldest first and the recent records are at the end.
+// Records logged after readKmsg was called are not read,
+// so the work done is limited if the kernel ring buffer is flooded.
+func readKmsg(filename string, since uint64, n int, match func(msg string) bool) ([]string, error) {
+	fd, err := unix.Open(filename, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer unix.Close(fd)
+
+	until := monotonicNow()
+	var msgs []string
+	// Each read returns a single record (max 8k).
+	buf := make([]byte, 8192)
+	for {
+		nr, err := unix.Read(fd, buf)
+		if err == unix.EPIPE {
+			// record was overwritten in the ring buffer
+			continue
+		}
+		if errors.Is(err, unix.EAGAIN) || (err == nil && nr == 0) {
+			break
+		}
+		if err != nil {
+			return msgs, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		ts, msg, ok := parseKmsgRecord(string(buf[:nr]))
+		if ok && until > 0 && ts > until {
+			break
+		}
+		if !ok || ts < since || !matchesAny(msg, kmsgPatterns) || !match(msg) {
+			continue
+		}
+		msgs = append(msgs, msg)
+		if len(msgs) > n {
+			msgs = msgs[1:]
+		}
+	}
+	return msgs, nil
+}
+
+// parseKmsgRecord parses a record read from /dev/kmsg
+// and returns the timestamp in microseconds and the message.
+// See https://www.kernel.org/doc/Documentation/ABI/testing/dev-kmsg
+// Record format: `<priority>,<sequence>,<timestamp>,<flags>[,..];<message>\n[ KEY=value\n ...]`
+func parseKmsgRecord(record string) (uint64, string, bool) {
+	i := strings.IndexByte(record, ';')
+	if i < 0 {
+		return 0, "", false
+	}
+	prefix := strings.Split(record[:i], ",")
+	if len(prefix) < 4 {
+		return 0, "", false
+	}
+	ts, err := strconv.ParseUint(prefix[2], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	msg := record[i+1:]
+	// strip continuation lines (dictionary)
+	if j := strings.IndexByte(msg, '\n'); j >= 0 {
+		msg = msg[:j]
+	}
+	return ts, msg, true
+}
+
+func matchesAny(s string, patterns []string) bool {
+	for _, p := range patterns {
+		if strings.Contains(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package lxcri
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKmsgRecord(t *testing.T) {
+	ts, msg, ok := parseKmsgRecord("6,1234,5678901,-;audit: type=1400 apparmor=\"DENIED\" operation=\"mount\"\n SUBSYSTEM=foo\n")
+	require.True(t, ok)
+	require.Equal(t, uint64(5678901), ts)
+	require.Equal(t, "audit: type=1400 apparmor=\"DENIED\" operation=\"mount\"", msg)
+	require.True(t, matchesAny(msg, kmsgPatterns))
+
+	_, _, ok = parseKmsgRecord("6,1234;invalid")
+	require.False(t, ok)
+}
+
+func TestFilterLogLines(t *testing.T) {
+	data := []byte(`partial line c1
+lxc c1 20210101 ERROR start - start.c:1 - failed 1
+lxc c2 20210101 ERROR start - start.c:1 - failed 2
+lxc c1 20210101 ERROR start - start.c:1 - failed 3
+lxc c1 20210101 ERROR start - start.c:1 - failed 4
+`)
+	lines := filterLogLines(data, " c1 ", 2, true)
+	require.Equal(t, []string{
+		"lxc c1 20210101 ERROR start - start.c:1 - failed 3",
+		"lxc c1 20210101 ERROR start - start.c:1 - failed 4",
+	}, lines)
+}
+
+func TestStartError(t *testing.T) {
+	cause := fmt.Errorf("init failed")
+	err := &StartError{Err: cause, LogLines: []string{"l1"}, KernelMessages: []string{"k1"}}
+	require.True(t, errors.Is(err, cause))
+	require.Equal(t, "init failed\nlxc log:\n  l1\nkernel messages:\n  k1", err.Error())
+
+	err.MonitorOutput = []string{"m1"}
+	require.Equal(t, "init failed\nlxc log:\n  l1\nkernel messages:\n  k1\nmonitor output:\n  m1", err.Error())
+}
+
+func TestKmsgFilter(t *testing.T) {
+	f := &kmsgFilter{pids: map[int]bool{1234: true}, cgroup: "/lxcri.slice/c1"}
+	require.True(t, f.match(`audit: type=1400 audit(1618231234.123:42): apparmor="DENIED" operation="mount" profile="c1" pid=1234 comm="sh"`))
+	require.False(t, f.match(`audit: type=1400 audit(1618231234.123:42): apparmor="DENIED" operation="mount" profile="c2" pid=12345 comm="sh"`))
+	require.False(t, f.match(`audit: type=1326 audit(1618231234.123:44): auid=1234 ppid=1234 pid=1 comm="sh" syscall=165`))
+	require.True(t, f.match(`sh[1234]: segfault at 0 ip 00007f sp 00007ffd error 4 in sh[55d0+1000]`))
+	require.True(t, f.match(`Memory cgroup out of memory: Killed process 1234 (sh) total-vm:1kB`))
+	require.True(t, f.match(`oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),oom_memcg=/lxcri.slice/c1,task_memcg=/lxcri.slice/c1/lxc.payload,task=sh,pid=99,uid=0`))
+	require.False(t, f.match(`oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),oom_memcg=/lxcri.slice/c10,task_memcg=/lxcri.slice/c10,task=sh,pid=99,uid=0`))
+}
@@ -0,0 +1,392 @@
+package lxcri
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// parseProcStatus parses the content of /proc/[pid]/status
+// into a map of field names and values.
+func parseProcStatus(data string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		vals := strings.SplitN(line, ":", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		fields[vals[0]] = strings.TrimSpace(vals[1])
+	}
+	return fields
+}
+
+func readProcStatus(fsys FS, pid int) (map[string]string, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	return parseProcStatus(string(data)), nil
+}
+
+// readLSMLabel returns the label of the active linux security module
+// (e.g the AppArmor profile or the SELinux context) for the given process.
+func readLSMLabel(fsys FS, pid int) (string, error) {
+	// The LSM specific interface is preferred, because
+	// /proc/[pid]/attr/current is ambiguous if multiple LSMs are stacked.
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%d/attr/apparmor/current", pid))
+	if os.IsNotExist(err) {
+		data, err = fsys.ReadFile(fmt.Sprintf("/proc/%d/attr/current", pid))
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00")), nil
+}
+
+// seccompModes maps the Seccomp field from /proc/[pid]/status to the mode name.
+var seccompModes = map[string]string{
+	"0": "disabled",
+	"1": "strict",
+	"2": "filter",
+}
+
+// SecurityState is the effective security configuration of the container init process.
+// Unlike the container spec, it reflects what is actually enforced by the kernel.
+type SecurityState struct {
+	// LSMLabel is the label of the active linux security module
+	// e.g the AppArmor profile `lxc-container-default (enforce)`
+	LSMLabel string `json:",omitempty"`
+	// Seccomp is the seccomp mode (disabled|strict|filter)
+	Seccomp string `json:",omitempty"`
+	// NoNewPrivs is true if the no_new_privs bit is set.
+	NoNewPrivs bool
+}
+
+// securityStateFromStatus returns the security state from the
+// fields of /proc/[pid]/status (see parseProcStatus).
+func securityStateFromStatus(status map[string]string) *SecurityState {
+	return &SecurityState{
+		Seccomp:    seccompModes[status["Seccomp"]],
+		NoNewPrivs: status["NoNewPrivs"] == "1",
+	}
+}
+
+func readSecurityState(fsys FS, pid int) (*SecurityState, error) {
+	status, err := readProcStatus(fsys, pid)
+	if err != nil {
+		return nil, err
+	}
+	sec := securityStateFromStatus(status)
+	// The LSM label is unavailable if no LSM is enabled.
+	if label, err := readLSMLabel(fsys, pid); err == nil {
+		sec.LSMLabel = label
+	}
+	return sec, nil
+}
+
+// clockTicks is the number of clock ticks per second (USER_HZ),
+// which is the unit of the process start time in /proc/[pid]/stat.
+// USER_HZ is 100 on all architectures supported by the runtime.
+const clockTicks = 100
+
+// Process describes a process within the container cgroup.
+type Process struct {
+	Pid int
+	// Comm is the command name of the process.
+	Comm string
+	// Cmdline are the command line arguments of the process.
+	Cmdline []string
+	// StartTime is the time the process was started.
+	StartTime time.Time
+}
+
+// procStat are the fields of /proc/[pid]/stat used by the runtime.
+type procStat struct {
+	Comm string
+	// UTime and STime are the user and system CPU time in clock ticks.
+	UTime uint64
+	STime uint64
+	// NumThreads is the number of threads of the process.
+	NumThreads int
+	// StartTicks is the start time in clock ticks after system boot.
+	StartTicks uint64
+}
+
+// parseProcStat parses the content of /proc/[pid]/stat.
+func parseProcStat(data string) (*procStat, error) {
+	// The command name is enclosed in parentheses and may contain
+	// any characters (including spaces and parentheses).
+	start := strings.IndexByte(data, '(')
+	end := strings.LastIndexByte(data, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid stat format")
+	}
+	stat := &procStat{Comm: data[start+1 : end]}
+	// The fields after the command name start with field 3 (state),
+	// so field n is at index n-3.
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("invalid stat format: expected at least 22 fields")
+	}
+	var err error
+	if stat.UTime, err = strconv.ParseUint(fields[11], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid utime: %w", err)
+	}
+	if stat.STime, err = strconv.ParseUint(fields[12], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid stime: %w", err)
+	}
+	if stat.NumThreads, err = strconv.Atoi(fields[17]); err != nil {
+		return nil, fmt.Errorf("invalid num_threads: %w", err)
+	}
+	if stat.StartTicks, err = strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid starttime: %w", err)
+	}
+	return stat, nil
+}
+
+// ticksToDuration converts clock ticks to a duration.
+func ticksToDuration(ticks uint64) time.Duration {
+	return time.Duration(ticks) * time.Second / clockTicks
+}
+
+// bootTime returns the system boot time from /proc/stat
+func bootTime(fsys FS) (time.Time, error) {
+	data, err := fsys.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		vals := strings.Fields(line)
+		if len(vals) == 2 && vals[0] == "btime" {
+			sec, err := strconv.ParseInt(vals[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("btime not found in /proc/stat")
+}
+
+func readProcess(fsys FS, pid int, boot time.Time) (*Process, error) {
+	stat, err := fsys.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	ps, err := parseProcStat(string(stat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse /proc/%d/stat: %w", pid, err)
+	}
+	cmdline, err := fsys.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+	p := &Process{
+		Pid:       pid,
+		Comm:      ps.Comm,
+		StartTime: boot.Add(ticksToDuration(ps.StartTicks)),
+	}
+	// Arguments are separated by null bytes. Kernel threads have no cmdline.
+	if s := strings.TrimRight(string(cmdline), "\x00"); s != "" {
+		p.Cmdline = strings.Split(s, "\x00")
+	}
+	return p, nil
+}
+
+// Processes returns all processes within the container cgroup.
+// The liblxc monitor process is not included.
+// Processes that exit while the process list is created are omitted.
+func (c *Container) Processes() ([]Process, error) {
+	if c.CgroupDir == "" {
+		return nil, fmt.Errorf("container cgroup is undefined")
+	}
+	pids, err := readCgroupProcs(c.sysFS(), filepath.Join(cgroupRoot, c.CgroupDir))
+	if err != nil {
+		return nil, err
+	}
+	boot, err := bootTime(c.sysFS())
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]Process, 0, len(pids))
+	for _, pid := range pids {
+		if pid == c.Pid {
+			continue
+		}
+		p, err := readProcess(c.sysFS(), pid, boot)
+		if os.IsNotExist(err) || errors.Is(err, unix.ESRCH) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		procs = append(procs, *p)
+	}
+	return procs, nil
+}
+
+// InitStats are the process statistics of the container init process.
+type InitStats struct {
+	Pid int
+	// StartTime is the time the init process was started.
+	// It changes when the container process is restarted.
+	StartTime time.Time
+	// Uptime is the time elapsed since StartTime.
+	Uptime time.Duration
+	// UserTime is the CPU time spent in user mode.
+	UserTime time.Duration
+	// SystemTime is the CPU time spent in kernel mode.
+	SystemTime time.Duration
+	// Threads is the number of threads.
+	Threads int
+	// FDs is the number of open file descriptors.
+	FDs int
+}
+
+// InterfaceStats are the statistics of a network interface.
+type InterfaceStats struct {
+	Name      string
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDropped uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDropped uint64
+}
+
+// Stats are the runtime statistics of a container.
+type Stats struct {
+	// Init is only set if the container init process is running.
+	Init *InitStats `json:",omitempty"`
+	// Interfaces are the network interfaces in the network namespace
+	// of the container init process. If the container does not have
+	// its own network namespace, these are the interfaces of the joined
+	// (e.g host) network namespace.
+	Interfaces []InterfaceStats `json:",omitempty"`
+	// Cgroup are the resource statistics of the container cgroup.
+	Cgroup *CgroupStats `json:",omitempty"`
+}
+
+// parseNetDev parses the content of /proc/[pid]/net/dev.
+func parseNetDev(data string) ([]InterfaceStats, error) {
+	var ifaces []InterfaceStats
+	lines := strings.Split(data, "\n")
+	// skip the two header lines
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("invalid net/dev format")
+	}
+	for _, line := range lines[2:] {
+		vals := strings.SplitN(line, ":", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		fields := strings.Fields(vals[1])
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("invalid net/dev format: expected 16 fields")
+		}
+		var counters [16]uint64
+		for i, f := range fields[:16] {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid net/dev value %q: %w", f, err)
+			}
+			counters[i] = n
+		}
+		ifaces = append(ifaces, InterfaceStats{
+			Name:      strings.TrimSpace(vals[0]),
+			RxBytes:   counters[0],
+			RxPackets: counters[1],
+			RxErrors:  counters[2],
+			RxDropped: counters[3],
+			TxBytes:   counters[8],
+			TxPackets: counters[9],
+			TxErrors:  counters[10],
+			TxDropped: counters[11],
+		})
+	}
+	return ifaces, nil
+}
+
+// readInterfaceStats returns the network interface statistics
+// of the network namespace of the given process.
+// /proc/[pid]/net/dev is read instead of entering the network namespace
+// with setns, which is not possible for a multithreaded process.
+func readInterfaceStats(fsys FS, pid int) ([]InterfaceStats, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return nil, err
+	}
+	return parseNetDev(string(data))
+}
+
+func readInitStats(fsys FS, pid int, boot time.Time, now time.Time) (*InitStats, error) {
+	data, err := fsys.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	ps, err := parseProcStat(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse /proc/%d/stat: %w", pid, err)
+	}
+	fds, err := fsys.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return nil, err
+	}
+	stats := &InitStats{
+		Pid:        pid,
+		StartTime:  boot.Add(ticksToDuration(ps.StartTicks)),
+		UserTime:   ticksToDuration(ps.UTime),
+		SystemTime: ticksToDuration(ps.STime),
+		Threads:    ps.NumThreads,
+		FDs:        len(fds),
+	}
+	stats.Uptime = now.Sub(stats.StartTime)
+	return stats, nil
+}
+
+// Stats returns the runtime statistics of the container.
+// The process and network interface statistics are read from /proc,
+// the resource statistics are read from the container cgroup.
+func (c *Container) Stats() (*Stats, error) {
+	stats := &Stats{}
+	if c.CgroupDir != "" {
+		cg, err := cgroups.readStats(c.sysFS(), c.CgroupDir)
+		// The cgroup is deleted when the container is stopped.
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errorf("failed to read cgroup stats: %w", err)
+		}
+		stats.Cgroup = cg
+	}
+	pid := c.LinuxContainer.InitPid()
+	if pid < 1 {
+		return stats, nil
+	}
+	boot, err := bootTime(c.sysFS())
+	if err != nil {
+		return nil, err
+	}
+	stats.Init, err = readInitStats(c.sysFS(), pid, boot, c.sysClock().Now())
+	// The init process may exit while the statistics are read.
+	if os.IsNotExist(err) || errors.Is(err, unix.ESRCH) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, errorf("failed to read init process stats: %w", err)
+	}
+	stats.Interfaces, err = readInterfaceStats(c.sysFS(), pid)
+	if os.IsNotExist(err) || errors.Is(err, unix.ESRCH) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, errorf("failed to read network interface stats: %w", err)
+	}
+	return stats, nil
+}
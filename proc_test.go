@@ -0,0 +1,100 @@
+package lxcri
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStatus(t *testing.T) {
+	data := "Name:\tlxcri-init\nUmask:\t0022\nNoNewPrivs:\t1\nSeccomp:\t2\nSeccomp_filters:\t1\n"
+	status := parseProcStatus(data)
+	require.Equal(t, "lxcri-init", status["Name"])
+	require.Equal(t, "2", status["Seccomp"])
+	require.Equal(t, "1", status["NoNewPrivs"])
+}
+
+func TestSecurityStateFromStatus(t *testing.T) {
+	status := parseProcStatus("Name:\tsh\nNoNewPrivs:\t1\nSeccomp:\t2\nSeccomp_filters:\t1\n")
+	require.Equal(t, &SecurityState{Seccomp: "filter", NoNewPrivs: true}, securityStateFromStatus(status))
+
+	// kernels without CONFIG_SECCOMP have no Seccomp field
+	status = parseProcStatus("Name:\tsh\nNoNewPrivs:\t0\n")
+	require.Equal(t, &SecurityState{}, securityStateFromStatus(status))
+}
+
+func TestReadSecurityState(t *testing.T) {
+	status, err := readProcStatus(hostFS{}, os.Getpid())
+	require.NoError(t, err)
+	if _, ok := status["Seccomp"]; !ok {
+		t.Skip("seccomp is not supported by the kernel")
+	}
+	sec, err := readSecurityState(hostFS{}, os.Getpid())
+	require.NoError(t, err)
+	require.NotEmpty(t, sec.Seccomp)
+}
+
+func TestParseProcStat(t *testing.T) {
+	data := "1234 (my (cmd) x) S 1 1234 1234 0 -1 4194560 1184 0 0 0 2 1 0 0 20 0 1 0 4711 12345 123 18446744073709551615\n"
+	stat, err := parseProcStat(data)
+	require.NoError(t, err)
+	require.Equal(t, "my (cmd) x", stat.Comm)
+	require.Equal(t, uint64(4711), stat.StartTicks)
+	require.Equal(t, uint64(2), stat.UTime)
+	require.Equal(t, uint64(1), stat.STime)
+	require.Equal(t, 1, stat.NumThreads)
+
+	_, err = parseProcStat("1234 (cmd) S 1")
+	require.Error(t, err)
+}
+
+func TestReadProcess(t *testing.T) {
+	boot, err := bootTime(hostFS{})
+	require.NoError(t, err)
+	p, err := readProcess(hostFS{}, os.Getpid(), boot)
+	require.NoError(t, err)
+	require.Equal(t, os.Args, p.Cmdline)
+	require.True(t, p.StartTime.After(boot))
+}
+
+func TestReadInitStats(t *testing.T) {
+	boot, err := bootTime(hostFS{})
+	require.NoError(t, err)
+	now := time.Now()
+	stats, err := readInitStats(hostFS{}, os.Getpid(), boot, now)
+	require.NoError(t, err)
+	require.True(t, stats.StartTime.After(boot))
+	require.Equal(t, now.Sub(stats.StartTime), stats.Uptime)
+	require.GreaterOrEqual(t, stats.Threads, 1)
+	// stdin, stdout and stderr
+	require.GreaterOrEqual(t, stats.FDs, 3)
+}
+
+func TestParseNetDev(t *testing.T) {
+	data := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1024      10    0    0    0     0          0         0     1024      10    0    0    0     0       0          0
+  eth0: 5830941    4218    1    2    0     0          0         0   308540    3411    3    4    0     0       0          0
+`
+	ifaces, err := parseNetDev(data)
+	require.NoError(t, err)
+	require.Len(t, ifaces, 2)
+	require.Equal(t, InterfaceStats{Name: "lo", RxBytes: 1024, RxPackets: 10, TxBytes: 1024, TxPackets: 10}, ifaces[0])
+	require.Equal(t, InterfaceStats{
+		Name: "eth0", RxBytes: 5830941, RxPackets: 4218, RxErrors: 1, RxDropped: 2,
+		TxBytes: 308540, TxPackets: 3411, TxErrors: 3, TxDropped: 4,
+	}, ifaces[1])
+
+	_, err = parseNetDev("header\nheader\n  eth0: 1 2 3\n")
+	require.Error(t, err)
+}
+
+func TestReadInterfaceStats(t *testing.T) {
+	ifaces, err := readInterfaceStats(hostFS{}, os.Getpid())
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		require.NotEmpty(t, iface.Name)
+	}
+}
@@ -0,0 +1,88 @@
+package lxcri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// procSysNamespaced are the /proc/sys subtrees (glob patterns) that
+// are namespaced by the given namespace type.
+// See https://kubernetes.io/docs/tasks/administer-cluster/sysctl-cluster/
+var procSysNamespaced = []struct {
+	ns       specs.LinuxNamespaceType
+	patterns []string
+}{
+	{specs.NetworkNamespace, []string{"net"}},
+	{specs.IPCNamespace, []string{"kernel/shm*", "kernel/msg*", "kernel/sem", "fs/mqueue"}},
+}
+
+// procSysRoot is the host procfs sysctl directory used to expand the patterns.
+var procSysRoot = "/proc/sys"
+
+// configureReadonlyProcSys mounts /proc/sys read-only, except for the
+// subtrees that are namespaced by a namespace that is not shared with the runtime.
+// The writable subtrees are bind mounted first and then carried over by the recursive
+// read-only bind mount of /proc/sys, because a bind mount inherits the
+// read-only flag of the source mount.
+func configureReadonlyProcSys(c *Container) error {
+	rootmnt := c.getConfigItem("lxc.rootfs.mount")
+	if rootmnt == "" {
+		return fmt.Errorf("lxc.rootfs.mount unavailable")
+	}
+
+	paths, err := procSysWritablePaths(c.Spec)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		mnt := fmt.Sprintf("%s %s %s %s", filepath.Join(rootmnt, p), strings.TrimPrefix(p, "/"), "bind", "bind,rw,optional")
+		if err := c.setConfigItem("lxc.mount.entry", mnt); err != nil {
+			return fmt.Errorf("failed to make %s writable: %w", p, err)
+		}
+	}
+	mnt := fmt.Sprintf("%s %s %s %s", filepath.Join(rootmnt, "/proc/sys"), "proc/sys", "bind", "rbind,ro")
+	if err := c.setConfigItem("lxc.mount.entry", mnt); err != nil {
+		return fmt.Errorf("failed to make /proc/sys readonly: %w", err)
+	}
+
+	// /proc/sys is already readonly
+	readonly := c.Spec.Linux.ReadonlyPaths[:0]
+	for _, p := range c.Spec.Linux.ReadonlyPaths {
+		if filepath.Clean(p) != "/proc/sys" {
+			readonly = append(readonly, p)
+		}
+	}
+	c.Spec.Linux.ReadonlyPaths = readonly
+	return nil
+}
+
+// procSysWritablePaths returns the container paths of the namespaced /proc/sys subtrees.
+func procSysWritablePaths(spec *specs.Spec) ([]string, error) {
+	var paths []string
+	for _, n := range procSysNamespaced {
+		shared, err := isNamespaceSharedWithRuntime(getNamespace(spec, n.ns))
+		if err != nil {
+			return nil, err
+		}
+		if shared {
+			continue
+		}
+		for _, pattern := range n.patterns {
+			matches, err := filepath.Glob(filepath.Join(procSysRoot, pattern))
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range matches {
+				rel, err := filepath.Rel(procSysRoot, m)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, filepath.Join("/proc/sys", rel))
+			}
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,31 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcSysWritablePaths(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"net/ipv4", "kernel/shmmax", "kernel/msgmax", "kernel/sem", "kernel/hostname", "vm/overcommit_memory"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, p), 0755))
+	}
+	defer func(p string) { procSysRoot = p }(procSysRoot)
+	procSysRoot = root
+
+	spec := &specs.Spec{Linux: &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{{Type: specs.IPCNamespace}},
+	}}
+	paths, err := procSysWritablePaths(spec)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/proc/sys/kernel/shmmax", "/proc/sys/kernel/msgmax", "/proc/sys/kernel/sem"}, paths)
+
+	spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.NetworkNamespace})
+	paths, err = procSysWritablePaths(spec)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/proc/sys/net", "/proc/sys/kernel/shmmax", "/proc/sys/kernel/msgmax", "/proc/sys/kernel/sem"}, paths)
+}
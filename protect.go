@@ -0,0 +1,252 @@
+package lxcri
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+// State protection modes.
+const (
+	// StateProtectionNone stores the container state unmodified.
+	StateProtectionNone = ""
+	// StateProtectionRedact replaces sensitive values with a placeholder.
+	// Redacted values are restored from the bundle spec when the container
+	// is loaded, if the bundle spec was not modified (see Container.BundleHash).
+	StateProtectionRedact = "redact"
+	// StateProtectionEncrypt encrypts sensitive values with AES-256-GCM.
+	// Encrypted values are decrypted when the container is loaded.
+	StateProtectionEncrypt = "encrypt"
+)
+
+const (
+	// NOTE keep in sync with cmd/lxcri-init#redactedValue
+	redactedValue = "lxcri:redacted"
+	// NOTE keep in sync with cmd/lxcri-init#encryptedValue
+	encryptedValue = "lxcri:enc:"
+)
+
+// StateProtection protects sensitive values in the persisted container state.
+// The values of the container process environment (Spec.Process.Env) are sensitive.
+// They are protected in the container state (lxcri.json) and in the spec
+// in the runtime directory (BundleConfigFile), which is readable by the hooks.
+// The liblxc config file does not contain the process environment.
+// The unprotected environment is passed in memory to the monitor process,
+// which sets it as `lxc.environment` for the container init process (see passProcessEnv).
+type StateProtection struct {
+	// Mode is one of StateProtectionNone, StateProtectionRedact or StateProtectionEncrypt.
+	Mode string `json:",omitempty"`
+	// KeyFile is the path to the 32 byte AES-256 key used by StateProtectionEncrypt.
+	KeyFile string `json:",omitempty"`
+}
+
+// init validates the protection mode and creates the cipher for StateProtectionEncrypt.
+func (p *StateProtection) init() (cipher.AEAD, error) {
+	switch p.Mode {
+	case StateProtectionNone, StateProtectionRedact:
+		return nil, nil
+	case StateProtectionEncrypt:
+	default:
+		return nil, fmt.Errorf("invalid state protection mode %q", p.Mode)
+	}
+	if p.KeyFile == "" {
+		return nil, fmt.Errorf("state protection mode %q requires a key file", p.Mode)
+	}
+	// #nosec
+	key, err := os.ReadFile(p.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state protection key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("state protection key must be 32 bytes (was %d)", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// protectedState returns a copy of the container for serialization
+// with the sensitive values redacted or encrypted.
+func (rt *Runtime) protectedState(c *Container) (*Container, error) {
+	if c.SpecHash != "" {
+		// The spec is loaded from the runtime directory.
+		cfg := *c.ContainerConfig
+		cfg.Spec = nil
+		protected := *c
+		protected.ContainerConfig = &cfg
+		return &protected, nil
+	}
+	spec, err := rt.protectedSpec(c.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if spec == c.Spec {
+		return c, nil
+	}
+	cfg := *c.ContainerConfig
+	cfg.Spec = spec
+	protected := *c
+	protected.ContainerConfig = &cfg
+	return &protected, nil
+}
+
+// protectedSpec returns a copy of the spec with the sensitive values
+// redacted or encrypted. The spec itself is returned if there is nothing to protect.
+func (rt *Runtime) protectedSpec(spec *specs.Spec) (*specs.Spec, error) {
+	if rt.StateProtection.Mode == StateProtectionNone || spec == nil || spec.Process == nil {
+		return spec, nil
+	}
+	env := make([]string, len(spec.Process.Env))
+	for i, kv := range spec.Process.Env {
+		key, val := splitEnv(kv)
+		if rt.StateProtection.Mode == StateProtectionRedact {
+			env[i] = key + "=" + redactedValue
+			continue
+		}
+		nonce := make([]byte, rt.stateCipher.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		// The variable name is authenticated, so encrypted values can not be swapped.
+		data := rt.stateCipher.Seal(nonce, nonce, []byte(val), []byte(key))
+		env[i] = key + "=" + encryptedValue + base64.StdEncoding.EncodeToString(data)
+	}
+
+	proc := *spec.Process
+	proc.Env = env
+	protected := *spec
+	protected.Process = &proc
+	return &protected, nil
+}
+
+// unprotectState restores the protected values of the loaded container.
+// Encrypted values are kept if no key is configured, and redacted values
+// are kept if the bundle spec is not available, so the container can still
+// be killed and deleted.
+func (rt *Runtime) unprotectState(c *Container) error {
+	if c.Spec == nil || c.Spec.Process == nil {
+		return nil
+	}
+	var bundleEnv []string
+	for i, kv := range c.Spec.Process.Env {
+		key, val := splitEnv(kv)
+		if val == redactedValue {
+			if bundleEnv == nil {
+				bundleEnv = c.loadBundleEnv()
+			}
+			if v, ok := specki.Getenv(bundleEnv, key); ok {
+				c.Spec.Process.Env[i] = key + "=" + v
+			} else {
+				c.Log.Warn().Str("env", key).Msg("redacted value is not defined in the bundle spec - value is not restored")
+			}
+			continue
+		}
+		if !strings.HasPrefix(val, encryptedValue) {
+			continue
+		}
+		if rt.stateCipher == nil {
+			c.Log.Warn().Str("env", key).Msg("state protection key is not configured - value is not decrypted")
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(val, encryptedValue))
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+		n := rt.stateCipher.NonceSize()
+		if len(data) < n {
+			return fmt.Errorf("failed to decrypt %s: invalid ciphertext", key)
+		}
+		plain, err := rt.stateCipher.Open(nil, data[:n], data[n:], []byte(key))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", key, err)
+		}
+		c.Spec.Process.Env[i] = key + "=" + string(plain)
+	}
+	return nil
+}
+
+// loadBundleEnv returns the process environment of the bundle spec,
+// as it was modified by Runtime.Create (see ContainerConfig.ExpandEnv).
+// An empty (non-nil) environment is returned if the bundle spec
+// was removed or modified after the container was created.
+func (c *Container) loadBundleEnv() []string {
+	env := []string{}
+	if c.BundleHash == "" {
+		return env
+	}
+	spec, err := decodeSpecFile(filepath.Join(c.BundlePath, BundleConfigFile), c.BundleHash)
+	if err != nil {
+		c.Log.Warn().Msgf("failed to restore redacted values from bundle spec: %s", err)
+		return env
+	}
+	if spec.Process == nil {
+		return env
+	}
+	bundle := &Container{ContainerConfig: &ContainerConfig{
+		ContainerID: c.ContainerID,
+		BundlePath:  c.BundlePath,
+		Spec:        spec,
+		Log:         zerolog.Nop(),
+	}, runtimeDir: c.runtimeDir}
+	if c.ExpandEnv {
+		expandEnv(bundle)
+	}
+	cleanenv(bundle, true)
+	return append(env, spec.Process.Env...)
+}
+
+// passProcessEnv passes the unprotected process environment to the monitor
+// process through an in-memory file, if the spec in the runtime directory is protected.
+// The monitor process sets the environment as `lxc.environment` for the
+// init process, and the init process restores the protected values from it.
+// The returned file must be closed after the monitor process was started.
+// NOTE keep in sync with cmd/lxcri-start#read_process_env
+func (rt *Runtime) passProcessEnv(c *Container, cmd *exec.Cmd) (*os.File, error) {
+	if rt.StateProtection.Mode == StateProtectionNone || c.Spec.Process == nil || len(c.Spec.Process.Env) == 0 {
+		return nil, nil
+	}
+	fd, err := unix.MemfdCreate("lxcri-env", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("memfd_create failed: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), "lxcri-env")
+	var buf bytes.Buffer
+	for _, kv := range c.Spec.Process.Env {
+		buf.WriteString(kv)
+		buf.WriteByte(0)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	// ExtraFiles start at file descriptor 3
+	cmd.Env = append(append([]string{}, cmd.Env...), fmt.Sprintf("LXCRI_PROCESS_ENV_FD=%d", len(cmd.ExtraFiles)+2))
+	return f, nil
+}
+
+func splitEnv(kv string) (string, string) {
+	if i := strings.IndexByte(kv, '='); i >= 0 {
+		return kv[:i], kv[i+1:]
+	}
+	return kv, ""
+}
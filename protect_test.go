@@ -0,0 +1,130 @@
+package lxcri
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func newProtectTestContainer() *Container {
+	return &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{Process: &specs.Process{
+			Env: []string{"PATH=/bin", "PASSWORD=s3cr3t"},
+		}},
+		Log: zerolog.Nop(),
+	}}
+}
+
+func TestStateProtectionRedact(t *testing.T) {
+	rt := &Runtime{StateProtection: StateProtection{Mode: StateProtectionRedact}}
+	c := newProtectTestContainer()
+
+	p, err := rt.protectedState(c)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PATH=" + redactedValue, "PASSWORD=" + redactedValue}, p.Spec.Process.Env)
+	// the container itself is not modified
+	require.Equal(t, []string{"PATH=/bin", "PASSWORD=s3cr3t"}, c.Spec.Process.Env)
+
+	// without a bundle spec the redacted values are kept
+	require.NoError(t, rt.unprotectState(p))
+	require.Equal(t, []string{"PATH=" + redactedValue, "PASSWORD=" + redactedValue}, p.Spec.Process.Env)
+}
+
+func TestStateProtectionRedactRestore(t *testing.T) {
+	rt := &Runtime{StateProtection: StateProtection{Mode: StateProtectionRedact}}
+	bundle := t.TempDir()
+	_, hash := writeSpec(t, bundle, &specs.Spec{Process: &specs.Process{
+		Env: []string{"PATH=/bin", "PASSWORD=s3cr3t", "ID=${container_id}"},
+	}})
+
+	c := newProtectTestContainer()
+	c.ContainerID = "c1"
+	c.BundlePath = bundle
+	c.BundleHash = hash
+	c.ExpandEnv = true
+	c.Spec.Process.Env = append(c.Spec.Process.Env, "ID=c1", "ADDED=value")
+
+	p, err := rt.protectedState(c)
+	require.NoError(t, err)
+	require.NoError(t, rt.unprotectState(p))
+	// values that are not defined in the bundle spec can not be restored
+	require.Equal(t, []string{"PATH=/bin", "PASSWORD=s3cr3t", "ID=c1", "ADDED=" + redactedValue}, p.Spec.Process.Env)
+
+	// values are not restored from a modified bundle spec
+	writeSpec(t, bundle, &specs.Spec{Process: &specs.Process{Env: []string{"PASSWORD=other"}}})
+	p, err = rt.protectedState(c)
+	require.NoError(t, err)
+	require.NoError(t, rt.unprotectState(p))
+	require.Contains(t, p.Spec.Process.Env, "PASSWORD="+redactedValue)
+}
+
+func TestPassProcessEnv(t *testing.T) {
+	rt := &Runtime{}
+	c := newProtectTestContainer()
+	cmd := exec.Command("/bin/true")
+	f, err := rt.passProcessEnv(c, cmd)
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	rt.StateProtection.Mode = StateProtectionRedact
+	cmd.ExtraFiles = []*os.File{os.Stdin}
+	f, err = rt.passProcessEnv(c, cmd)
+	require.NoError(t, err)
+	defer f.Close()
+	require.Len(t, cmd.ExtraFiles, 2)
+	require.Contains(t, cmd.Env, "LXCRI_PROCESS_ENV_FD=4")
+
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "PATH=/bin\x00PASSWORD=s3cr3t\x00", string(data))
+}
+
+func TestStateProtectionEncrypt(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(strings.Repeat("k", 32)), 0400))
+
+	rt := &Runtime{StateProtection: StateProtection{Mode: StateProtectionEncrypt, KeyFile: keyFile}}
+	var err error
+	rt.stateCipher, err = rt.StateProtection.init()
+	require.NoError(t, err)
+
+	p, err := rt.protectedState(newProtectTestContainer())
+	require.NoError(t, err)
+	for _, kv := range p.Spec.Process.Env {
+		require.NotContains(t, kv, "s3cr3t")
+		require.Contains(t, kv, encryptedValue)
+	}
+
+	require.NoError(t, rt.unprotectState(p))
+	require.Equal(t, []string{"PATH=/bin", "PASSWORD=s3cr3t"}, p.Spec.Process.Env)
+
+	// encrypted values are bound to the variable name
+	p, err = rt.protectedState(newProtectTestContainer())
+	require.NoError(t, err)
+	_, val := splitEnv(p.Spec.Process.Env[1])
+	p.Spec.Process.Env[0] = "PATH=" + val
+	require.Error(t, rt.unprotectState(p))
+}
+
+func TestStateProtectionInit(t *testing.T) {
+	p := StateProtection{Mode: "rot13"}
+	_, err := p.init()
+	require.Error(t, err)
+
+	p = StateProtection{Mode: StateProtectionEncrypt}
+	_, err = p.init()
+	require.Error(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("short"), 0400))
+	p.KeyFile = keyFile
+	_, err = p.init()
+	require.Error(t, err)
+}
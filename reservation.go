@@ -0,0 +1,161 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// ResourceLimits are host thresholds for the sum of the resource
+// reservations of all containers created by the runtime.
+// A container reserves resources from Runtime.Create until Runtime.Delete.
+type ResourceLimits struct {
+	// Memory is the maximum sum of memory reservations in bytes.
+	// The check is disabled if Memory is zero.
+	Memory int64 `json:",omitempty"`
+	// CPUs is the maximum sum of CPU reservations in CPUs.
+	// The check is disabled if CPUs is zero.
+	CPUs float64 `json:",omitempty"`
+	// WarnOnly logs a warning instead of refusing to create a container
+	// if a limit is exceeded.
+	WarnOnly bool `json:",omitempty"`
+}
+
+func (l ResourceLimits) enabled() bool {
+	return l.Memory > 0 || l.CPUs > 0
+}
+
+// ResourceReservation are the resources reserved by containers.
+type ResourceReservation struct {
+	// Memory is the reserved memory in bytes.
+	// It is the memory reservation (soft limit) or the memory limit
+	// if no reservation is defined.
+	Memory int64
+	// CPUs is the reserved number of CPUs (quota / period).
+	CPUs float64
+}
+
+func (r *ResourceReservation) add(o ResourceReservation) {
+	r.Memory += o.Memory
+	r.CPUs += o.CPUs
+}
+
+// specReservation returns the resources reserved by the given spec.
+func specReservation(spec *specs.Spec) ResourceReservation {
+	var r ResourceReservation
+	if spec == nil || spec.Linux == nil || spec.Linux.Resources == nil {
+		return r
+	}
+	if mem := spec.Linux.Resources.Memory; mem != nil {
+		if mem.Reservation != nil && *mem.Reservation > 0 {
+			r.Memory = *mem.Reservation
+		} else if mem.Limit != nil && *mem.Limit > 0 {
+			r.Memory = *mem.Limit
+		}
+	}
+	if cpu := spec.Linux.Resources.CPU; cpu != nil {
+		if cpu.Quota != nil && *cpu.Quota > 0 && cpu.Period != nil && *cpu.Period > 0 {
+			r.CPUs = float64(*cpu.Quota) / float64(*cpu.Period)
+		}
+	}
+	return r
+}
+
+// reservationFile is the file within the runtime directory that records
+// the resources reserved by the container. It is written before the runtime
+// directory becomes visible, so the runtime root lock can be released
+// before the container is created.
+const reservationFile = "reservation.json"
+
+// Reservations returns the sum of the resources reserved by all containers.
+func (rt *Runtime) Reservations() (ResourceReservation, error) {
+	var total ResourceReservation
+	ids, err := rt.List()
+	if err != nil {
+		return total, err
+	}
+	for _, id := range ids {
+		var r ResourceReservation
+		err := specki.DecodeJSONFile(filepath.Join(rt.runtimeDir(id), reservationFile), &r)
+		if err == nil {
+			total.add(r)
+			continue
+		}
+		if !os.IsNotExist(err) {
+			rt.Log.Warn().Err(err).Str("cid", id).Msg("failed to load container reservation")
+			continue
+		}
+		// Decode only the spec from lxcri.json instead of loading the container.
+		var cfg struct {
+			Spec     *specs.Spec
+			SpecHash string
+		}
+		err := specki.DecodeJSONFile(filepath.Join(rt.runtimeDir(id), "lxcri.json"), &cfg)
+		if err == nil && cfg.Spec == nil && cfg.SpecHash != "" {
+			cfg.Spec, err = decodeSpecFile(filepath.Join(rt.runtimeDir(id), BundleConfigFile), cfg.SpecHash)
+		}
+		if os.IsNotExist(err) {
+			// The container is being created or deleted.
+			continue
+		}
+		if err != nil {
+			rt.Log.Warn().Err(err).Str("cid", id).Msg("failed to load container reservation")
+			continue
+		}
+		total.add(specReservation(cfg.Spec))
+	}
+	return total, nil
+}
+
+// checkReservation checks whether the resources reserved by the given
+// container exceed the ResourceLimits, or if the container count reached
+// Runtime.MaxContainers. The runtime root is locked until the returned
+// unlock function is called, so that concurrent create calls do not exceed the limits.
+// The caller must release the lock as soon as the runtime directory
+// (and the reservationFile) is created.
+func (rt *Runtime) checkReservation(cfg *ContainerConfig) (unlock func(), err error) {
+	unlock, err = flockDir(rt.Root, unix.LOCK_EX)
+	if err != nil {
+		return nil, errorf("failed to lock runtime root: %w", err)
+	}
+
+	if err := rt.checkContainerCount(); err != nil {
+		unlock()
+		return nil, err
+	}
+	if !rt.ResourceLimits.enabled() {
+		return unlock, nil
+	}
+
+	total, err := rt.Reservations()
+	if err != nil {
+		unlock()
+		return nil, errorf("failed to calculate reservations: %w", err)
+	}
+	total.add(specReservation(cfg.Spec))
+
+	err = rt.ResourceLimits.check(total)
+	if err != nil && rt.ResourceLimits.WarnOnly {
+		rt.Log.Warn().Msgf("resource reservation exceeded: %s", err)
+		return unlock, nil
+	}
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+func (l ResourceLimits) check(r ResourceReservation) error {
+	if l.Memory > 0 && r.Memory > l.Memory {
+		return fmt.Errorf("memory reservation %d exceeds limit %d", r.Memory, l.Memory)
+	}
+	if l.CPUs > 0 && r.CPUs > l.CPUs {
+		return fmt.Errorf("cpu reservation %.2f exceeds limit %.2f", r.CPUs, l.CPUs)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecReservation(t *testing.T) {
+	limit := int64(512 << 20)
+	reservation := int64(256 << 20)
+	quota := int64(150000)
+	period := uint64(100000)
+
+	spec := &specs.Spec{Linux: &specs.Linux{Resources: &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit},
+		CPU:    &specs.LinuxCPU{Quota: &quota, Period: &period},
+	}}}
+	require.Equal(t, ResourceReservation{Memory: limit, CPUs: 1.5}, specReservation(spec))
+
+	spec.Linux.Resources.Memory.Reservation = &reservation
+	require.Equal(t, ResourceReservation{Memory: reservation, CPUs: 1.5}, specReservation(spec))
+
+	require.Equal(t, ResourceReservation{}, specReservation(&specs.Spec{}))
+}
+
+func TestResourceLimitsCheck(t *testing.T) {
+	l := ResourceLimits{Memory: 1024, CPUs: 2}
+	require.NoError(t, l.check(ResourceReservation{Memory: 1024, CPUs: 2}))
+	require.Error(t, l.check(ResourceReservation{Memory: 1025}))
+	require.Error(t, l.check(ResourceReservation{CPUs: 2.5}))
+	require.NoError(t, ResourceLimits{}.check(ResourceReservation{Memory: 1 << 40, CPUs: 64}))
+}
+
+func TestReservations(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	for id, r := range map[string]ResourceReservation{"c1": {Memory: 1024, CPUs: 0.5}, "c2": {Memory: 2048, CPUs: 1}} {
+		require.NoError(t, os.Mkdir(filepath.Join(rt.Root, id), 0755))
+		require.NoError(t, specki.EncodeJSONFile(filepath.Join(rt.Root, id, reservationFile), r, os.O_CREATE|os.O_EXCL, 0640))
+	}
+	// container without reservation and state
+	require.NoError(t, os.Mkdir(filepath.Join(rt.Root, "c3"), 0755))
+
+	total, err := rt.Reservations()
+	require.NoError(t, err)
+	require.Equal(t, ResourceReservation{Memory: 3072, CPUs: 1.5}, total)
+}
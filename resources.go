@@ -0,0 +1,196 @@
+package lxcri
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// EffectiveResources are the resource limits that apply to the container cgroup.
+// The limits of the parent cgroups are taken into account,
+// so the effective limit is the most restrictive limit of the cgroup tree.
+type EffectiveResources struct {
+	// MemoryMax is the memory limit in bytes, nil if unlimited.
+	MemoryMax *int64 `json:",omitempty"`
+	// CPUQuota is the CPU time in microseconds the cgroup can use per CPUPeriod.
+	// It is nil if unlimited.
+	CPUQuota  *int64 `json:",omitempty"`
+	CPUPeriod uint64 `json:",omitempty"`
+	// PidsMax is the maximum number of processes, nil if unlimited.
+	PidsMax *int64 `json:",omitempty"`
+	// Drift are the limits that differ from the limits requested in the spec.
+	Drift []ResourceDrift `json:",omitempty"`
+}
+
+// ResourceDrift is an effective resource limit that differs from the requested limit.
+type ResourceDrift struct {
+	// File is the cgroup2 interface file of the limit, e.g memory.max
+	File string
+	// Requested is the value requested in the spec.
+	Requested string
+	// Effective is the effective value.
+	Effective string
+	// Cgroup is the cgroup (relative to the cgroup root) that sets the effective limit.
+	Cgroup string
+}
+
+// effectiveLimit is the most restrictive value of a cgroup2 limit file
+// and the cgroup that sets it.
+type effectiveLimit struct {
+	value  string
+	cgroup string
+}
+
+// EffectiveResources reads back the resource limits that apply to the container cgroup
+// from the cgroup2 interface files of the container cgroup and its parent cgroups.
+// Limits of controllers that are not enabled are unset.
+// An error that satisfies os.IsNotExist is returned if the cgroup does not exist.
+func (c *Container) EffectiveResources() (*EffectiveResources, error) {
+	if c.CgroupDir == "" {
+		return nil, fmt.Errorf("container has no cgroup")
+	}
+	if cgroups.version() != 2 {
+		return nil, fmt.Errorf("effective resources require cgroup2")
+	}
+	if _, err := c.sysFS().ReadFile(filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events")); err != nil {
+		return nil, err
+	}
+
+	// the container cgroup and its parents, the root cgroup has no limits
+	var dirs []string
+	for dir := filepath.Clean(c.CgroupDir); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+
+	r := &EffectiveResources{}
+	limits := make(map[string]effectiveLimit)
+	for _, file := range []string{"memory.max", "cpu.max", "pids.max"} {
+		l, err := readEffectiveLimit(c.sysFS(), dirs, file)
+		if err != nil {
+			return nil, err
+		}
+		if l.value == "" {
+			continue
+		}
+		limits[file] = l
+
+		// the values were already validated by readEffectiveLimit
+		switch file {
+		case "memory.max":
+			r.MemoryMax, _ = parseCgroupLimit(l.value)
+		case "pids.max":
+			r.PidsMax, _ = parseCgroupLimit(l.value)
+		case "cpu.max":
+			r.CPUQuota, r.CPUPeriod, _ = parseCPUMax(l.value)
+		}
+	}
+
+	if c.Spec.Linux == nil || c.Spec.Linux.Resources == nil {
+		return r, nil
+	}
+	items, err := cgroupResourceItems(c.Spec.Linux.Resources)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		l, ok := limits[item.name]
+		if !ok {
+			continue
+		}
+		requested := item.value
+		if item.name == "memory.max" {
+			requested = roundCgroupMemory(requested)
+		}
+		if requested != l.value {
+			r.Drift = append(r.Drift, ResourceDrift{File: item.name, Requested: item.value, Effective: l.value, Cgroup: l.cgroup})
+		}
+	}
+	return r, nil
+}
+
+// readEffectiveLimit returns the most restrictive value of the limit file
+// in the given cgroups. The value is empty if no cgroup has the limit file.
+func readEffectiveLimit(fs FS, dirs []string, file string) (effectiveLimit, error) {
+	var eff effectiveLimit
+	var effRatio float64
+	for _, dir := range dirs {
+		data, err := fs.ReadFile(filepath.Join(cgroupRoot, dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return eff, err
+		}
+		val := strings.TrimSpace(string(data))
+		// cpu.max is compared by the ratio of quota and period
+		ratio, err := cgroupLimitRatio(file, val)
+		if err != nil {
+			return eff, fmt.Errorf("invalid value %q in %s of cgroup %s: %w", val, file, dir, err)
+		}
+		if eff.value == "" || ratio < effRatio {
+			eff = effectiveLimit{value: val, cgroup: dir}
+			effRatio = ratio
+		}
+	}
+	return eff, nil
+}
+
+// cgroupLimitRatio returns a comparable value for a cgroup limit,
+// where unlimited is +Inf.
+func cgroupLimitRatio(file string, val string) (float64, error) {
+	if file == "cpu.max" {
+		quota, period, err := parseCPUMax(val)
+		if err != nil || quota == nil {
+			return math.Inf(1), err
+		}
+		return float64(*quota) / float64(period), nil
+	}
+	n, err := parseCgroupLimit(val)
+	if err != nil || n == nil {
+		return math.Inf(1), err
+	}
+	return float64(*n), nil
+}
+
+// parseCgroupLimit parses a cgroup2 limit value, where "max" is returned as nil.
+func parseCgroupLimit(val string) (*int64, error) {
+	if val == "max" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// parseCPUMax parses the value of cpu.max, e.g `max 100000` or `50000 100000`.
+func parseCPUMax(val string) (*int64, uint64, error) {
+	fields := strings.Fields(val)
+	if len(fields) != 2 {
+		return nil, 0, fmt.Errorf("expected quota and period")
+	}
+	quota, err := parseCgroupLimit(fields[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	period, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	return quota, period, nil
+}
+
+// roundCgroupMemory rounds the memory limit down to the page size,
+// like the kernel does when memory.max is written.
+func roundCgroupMemory(val string) string {
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return val
+	}
+	pageSize := int64(os.Getpagesize())
+	return strconv.FormatInt(n/pageSize*pageSize, 10)
+}
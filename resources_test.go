@@ -0,0 +1,57 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEffectiveResources(t *testing.T) {
+	file := func(dir, name string) string {
+		return filepath.Join(cgroupRoot, dir, name)
+	}
+	mfs := &memFS{files: map[string][]byte{
+		file("pod/ctr", "cgroup.events"): []byte("populated 1\nfrozen 0\n"),
+		file("pod/ctr", "memory.max"):    []byte("1073741824\n"),
+		file("pod/ctr", "cpu.max"):       []byte("max 100000\n"),
+		file("pod/ctr", "pids.max"):      []byte("100\n"),
+		// the parent cgroup clamps the memory and cpu limits
+		file("pod", "memory.max"): []byte("536870912\n"),
+		file("pod", "cpu.max"):    []byte("50000 100000\n"),
+		file("pod", "pids.max"):   []byte("max\n"),
+	}}
+
+	limit := int64(1 << 30)
+	quota := int64(200000)
+	c := &Container{
+		ContainerConfig: &ContainerConfig{
+			CgroupDir: "pod/ctr",
+			Spec: &specs.Spec{Linux: &specs.Linux{Resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: &limit},
+				CPU:    &specs.LinuxCPU{Quota: &quota},
+				Pids:   &specs.LinuxPids{Limit: 100},
+			}}},
+			Log: zerolog.Nop(),
+		},
+		fs: mfs,
+	}
+
+	r, err := c.EffectiveResources()
+	require.NoError(t, err)
+	require.Equal(t, int64(536870912), *r.MemoryMax)
+	require.Equal(t, int64(50000), *r.CPUQuota)
+	require.Equal(t, uint64(100000), r.CPUPeriod)
+	require.Equal(t, int64(100), *r.PidsMax)
+	require.Equal(t, []ResourceDrift{
+		{File: "memory.max", Requested: "1073741824", Effective: "536870912", Cgroup: "pod"},
+		{File: "cpu.max", Requested: "200000 100000", Effective: "50000 100000", Cgroup: "pod"},
+	}, r.Drift)
+
+	c.CgroupDir = "pod/deleted"
+	_, err = c.EffectiveResources()
+	require.True(t, os.IsNotExist(err))
+}
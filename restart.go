@@ -0,0 +1,143 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// restartCountFile is written by the monitor process when the container is restarted.
+	// NOTE keep in sync with cmd/lxcri-start#RESTART_COUNT_FILE
+	restartCountFile = "restarts"
+	// noRestartFile prevents the monitor process from restarting the container.
+	// NOTE keep in sync with cmd/lxcri-start#NO_RESTART_FILE
+	noRestartFile = "norestart"
+)
+
+// Restart policy names.
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// RestartPolicy is applied by the monitor process when the container process exits.
+// The delay between two restarts starts at Backoff and is doubled
+// after each restart, up to one minute.
+// The restart policy is disabled when the container is killed
+// with a terminating signal (see isTerminatingSignal)
+// or deleted through the runtime.
+type RestartPolicy struct {
+	// Name is one of RestartNo, RestartOnFailure or RestartAlways.
+	Name string
+	// MaxRetries is the maximum number of restarts for RestartOnFailure.
+	// Zero means no limit.
+	MaxRetries int `json:",omitempty"`
+	// Backoff is the initial delay before the container is restarted.
+	Backoff time.Duration `json:",omitempty"`
+}
+
+// ParseRestartPolicy parses a restart policy in the format `<name>[:<max retries>]`.
+func ParseRestartPolicy(s string) (*RestartPolicy, error) {
+	p := &RestartPolicy{}
+	name, retries := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, retries = s[:i], s[i+1:]
+	}
+	p.Name = name
+	if retries != "" {
+		if name != RestartOnFailure {
+			return nil, fmt.Errorf("max retries are only supported for restart policy %q", RestartOnFailure)
+		}
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid max retries %q", retries)
+		}
+		p.MaxRetries = n
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *RestartPolicy) validate() error {
+	switch p.Name {
+	case RestartNo, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("invalid restart policy %q", p.Name)
+	}
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("invalid restart policy max retries %d", p.MaxRetries)
+	}
+	if p.Backoff < 0 {
+		return fmt.Errorf("invalid restart policy backoff %s", p.Backoff)
+	}
+	return nil
+}
+
+// env returns the environment variables for the monitor process.
+func (p *RestartPolicy) env() []string {
+	env := []string{
+		"LXCRI_RESTART_POLICY=" + p.Name,
+		"LXCRI_RESTART_MAX_RETRIES=" + strconv.Itoa(p.MaxRetries),
+	}
+	if p.Backoff > 0 {
+		env = append(env, "LXCRI_RESTART_BACKOFF_MS="+strconv.FormatInt(p.Backoff.Milliseconds(), 10))
+	}
+	return env
+}
+
+// disableRestart prevents the monitor process from restarting the container.
+func (c *Container) disableRestart() error {
+	if c.RestartPolicy == nil || c.RestartPolicy.Name == RestartNo {
+		return nil
+	}
+	return touchFile(c.RuntimePath(noRestartFile), 0640)
+}
+
+// isTerminatingSignal returns true if the signal is sent to stop the container.
+// Other signals (e.g SIGHUP or SIGUSR1) are commonly handled by the container
+// process (e.g to reload the configuration) and do not disable restarts.
+func isTerminatingSignal(signum unix.Signal) bool {
+	switch signum {
+	case unix.SIGKILL, unix.SIGTERM, unix.SIGINT, unix.SIGQUIT:
+		return true
+	}
+	return false
+}
+
+// killMonitor kills the monitor process and waits until it exited,
+// so that it can not restart the container anymore.
+func (c *Container) killMonitor() error {
+	if err := unix.Kill(c.Pid, unix.SIGKILL); err != nil && err != unix.ESRCH {
+		return err
+	}
+	err := pollUntil(context.Background(), c.sysClock(), time.Second*5, time.Millisecond*100, func() (bool, error) {
+		return !c.isMonitorRunning(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("monitor process is still running: %w", err)
+	}
+	return nil
+}
+
+// restartCount returns the number of times the container was restarted
+// by the monitor process.
+func (c *Container) restartCount() (int, error) {
+	// #nosec
+	data, err := os.ReadFile(c.RuntimePath(restartCountFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,44 @@
+package lxcri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	p, err := ParseRestartPolicy("always")
+	require.NoError(t, err)
+	require.Equal(t, &RestartPolicy{Name: RestartAlways}, p)
+
+	p, err = ParseRestartPolicy("on-failure:3")
+	require.NoError(t, err)
+	require.Equal(t, &RestartPolicy{Name: RestartOnFailure, MaxRetries: 3}, p)
+
+	_, err = ParseRestartPolicy("always:3")
+	require.Error(t, err)
+
+	_, err = ParseRestartPolicy("on-failure:-1")
+	require.Error(t, err)
+
+	_, err = ParseRestartPolicy("unless-stopped")
+	require.Error(t, err)
+}
+
+func TestRestartPolicyEnv(t *testing.T) {
+	p := &RestartPolicy{Name: RestartOnFailure, MaxRetries: 2, Backoff: 1500 * time.Millisecond}
+	require.Equal(t, []string{
+		"LXCRI_RESTART_POLICY=on-failure",
+		"LXCRI_RESTART_MAX_RETRIES=2",
+		"LXCRI_RESTART_BACKOFF_MS=1500",
+	}, p.env())
+}
+
+func TestIsTerminatingSignal(t *testing.T) {
+	require.True(t, isTerminatingSignal(unix.SIGTERM))
+	require.True(t, isTerminatingSignal(unix.SIGKILL))
+	require.False(t, isTerminatingSignal(unix.SIGHUP))
+	require.False(t, isTerminatingSignal(unix.SIGUSR1))
+}
@@ -0,0 +1,69 @@
+package lxcri
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// rlimitName returns the normalized lowercase name of the rlimit type without prefix,
+// which is the name used by liblxc (e.g `nofile` for `RLIMIT_NOFILE`).
+func rlimitName(t string) string {
+	return strings.TrimPrefix(strings.ToLower(t), "rlimit_")
+}
+
+func parseRlimitValue(s string) (uint64, error) {
+	if s == "unlimited" {
+		return unix.RLIM_INFINITY, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// ParseRlimit parses a resource limit in the format `<name>=<soft>[:<hard>]`
+// e.g `nofile=1048576` or `RLIMIT_CORE=0:unlimited`.
+// The hard limit defaults to the soft limit.
+func ParseRlimit(s string) (specs.POSIXRlimit, error) {
+	var limit specs.POSIXRlimit
+	vals := strings.SplitN(s, "=", 2)
+	if len(vals) != 2 || vals[0] == "" {
+		return limit, fmt.Errorf("invalid rlimit %q: expected <name>=<soft>[:<hard>]", s)
+	}
+	limit.Type = "RLIMIT_" + strings.ToUpper(rlimitName(vals[0]))
+
+	soft, hard := vals[1], vals[1]
+	if i := strings.IndexByte(vals[1], ':'); i >= 0 {
+		soft, hard = vals[1][:i], vals[1][i+1:]
+	}
+	var err error
+	if limit.Soft, err = parseRlimitValue(soft); err != nil {
+		return limit, fmt.Errorf("invalid rlimit %q soft limit: %w", s, err)
+	}
+	if limit.Hard, err = parseRlimitValue(hard); err != nil {
+		return limit, fmt.Errorf("invalid rlimit %q hard limit: %w", s, err)
+	}
+	if limit.Soft > limit.Hard {
+		return limit, fmt.Errorf("invalid rlimit %q: soft limit exceeds hard limit", s)
+	}
+	return limit, nil
+}
+
+// applyDefaultRlimits adds the Runtime.DefaultRlimits to the container process,
+// unless the spec defines a limit of the same type.
+func applyDefaultRlimits(rt *Runtime, c *Container) {
+	for _, def := range rt.DefaultRlimits {
+		name := rlimitName(def.Type)
+		found := false
+		for _, limit := range c.Spec.Process.Rlimits {
+			if rlimitName(limit.Type) == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Spec.Process.Rlimits = append(c.Spec.Process.Rlimits, def)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseRlimit(t *testing.T) {
+	valid := map[string]specs.POSIXRlimit{
+		"nofile=1048576":         {Type: "RLIMIT_NOFILE", Soft: 1048576, Hard: 1048576},
+		"RLIMIT_NPROC=100:200":   {Type: "RLIMIT_NPROC", Soft: 100, Hard: 200},
+		"core=0:unlimited":       {Type: "RLIMIT_CORE", Soft: 0, Hard: unix.RLIM_INFINITY},
+		"memlock=unlimited":      {Type: "RLIMIT_MEMLOCK", Soft: unix.RLIM_INFINITY, Hard: unix.RLIM_INFINITY},
+		"rlimit_stack=8192:8192": {Type: "RLIMIT_STACK", Soft: 8192, Hard: 8192},
+	}
+	for s, expected := range valid {
+		limit, err := ParseRlimit(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expected, limit, s)
+	}
+
+	for _, s := range []string{"nofile", "=10", "nofile=", "nofile=a", "nofile=2:1", "nofile=1:b"} {
+		_, err := ParseRlimit(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestApplyDefaultRlimits(t *testing.T) {
+	rt := &Runtime{DefaultRlimits: []specs.POSIXRlimit{
+		{Type: "RLIMIT_NOFILE", Soft: 1048576, Hard: 1048576},
+		{Type: "RLIMIT_NPROC", Soft: 4096, Hard: 4096},
+	}}
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{Process: &specs.Process{
+			Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 4096}},
+		}},
+	}}
+	applyDefaultRlimits(rt, c)
+	require.Equal(t, []specs.POSIXRlimit{
+		{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 4096},
+		{Type: "RLIMIT_NPROC", Soft: 4096, Hard: 4096},
+	}, c.Spec.Process.Rlimits)
+}
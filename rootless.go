@@ -0,0 +1,162 @@
+package lxcri
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Files that define the subordinate IDs delegated to unprivileged users.
+// See `man 5 subuid` and `man 5 subgid`.
+var (
+	subUIDFile = "/etc/subuid"
+	subGIDFile = "/etc/subgid"
+)
+
+// rootlessIDMap are the default ID mappings of containers created by a rootless runtime.
+type rootlessIDMap struct {
+	uids []specs.LinuxIDMapping
+	gids []specs.LinuxIDMapping
+}
+
+// initRootless configures the runtime for an unprivileged user.
+// The runtime state is stored in $XDG_RUNTIME_DIR/lxcri if Root is unset,
+// and features that require privileges are disabled.
+func (rt *Runtime) initRootless() error {
+	if os.Getuid() == 0 {
+		rt.Log.Warn().Msg("rootless mode is enabled but the runtime is running as root")
+	}
+
+	if rt.Root == "" {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return fmt.Errorf("XDG_RUNTIME_DIR is not set")
+		}
+		rt.Root = filepath.Join(dir, "lxcri")
+	}
+
+	// Loading apparmor profiles requires CAP_MAC_ADMIN and the
+	// device controller (eBPF) requires CAP_SYS_ADMIN in the initial user namespace.
+	if rt.Features.Apparmor || rt.Features.ApparmorProtectRuntime {
+		rt.Log.Info().Msg("rootless mode - apparmor is disabled")
+		rt.Features.Apparmor = false
+		rt.Features.ApparmorProtectRuntime = false
+	}
+	if rt.Features.CgroupDevices {
+		rt.Log.Info().Msg("rootless mode - cgroup device access control is disabled")
+		rt.Features.CgroupDevices = false
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("failed to lookup runtime user: %w", err)
+	}
+	g, err := user.LookupGroupId(strconv.Itoa(os.Getgid()))
+	if err != nil {
+		return fmt.Errorf("failed to lookup runtime group: %w", err)
+	}
+
+	uids, err := readSubIDs(subUIDFile, u.Username, u.Uid)
+	if err != nil {
+		return err
+	}
+	gids, err := readSubIDs(subGIDFile, g.Name, g.Gid)
+	if err != nil {
+		return err
+	}
+	rt.rootlessIDMap.uids = rootlessIDMappings(os.Getuid(), uids)
+	rt.rootlessIDMap.gids = rootlessIDMappings(os.Getgid(), gids)
+
+	// liblxc uses newuidmap and newgidmap to write the mappings
+	// of the subordinate IDs, which requires the setuid helpers.
+	if uids != nil || gids != nil {
+		for _, cmd := range []string{"newuidmap", "newgidmap"} {
+			if _, err := exec.LookPath(cmd); err != nil {
+				return fmt.Errorf("subordinate IDs are delegated but %s is not available: %w", cmd, err)
+			}
+		}
+	} else {
+		rt.Log.Warn().Msgf("no subordinate IDs delegated to user %s - only the container root user is mapped", u.Username)
+	}
+	return nil
+}
+
+// configureRootless enables the user namespace and sets the default
+// ID mappings of the rootless runtime, if the spec does not define any.
+func configureRootless(rt *Runtime, c *Container) error {
+	if !isNamespaceEnabled(c.Spec, specs.UserNamespace) {
+		c.Spec.Linux.Namespaces = append(c.Spec.Linux.Namespaces,
+			specs.LinuxNamespace{Type: specs.UserNamespace},
+		)
+	}
+	if len(c.Spec.Linux.UIDMappings) == 0 {
+		c.Spec.Linux.UIDMappings = rt.rootlessIDMap.uids
+	}
+	if len(c.Spec.Linux.GIDMappings) == 0 {
+		c.Spec.Linux.GIDMappings = rt.rootlessIDMap.gids
+	}
+	if len(c.Spec.Linux.UIDMappings) == 0 || len(c.Spec.Linux.GIDMappings) == 0 {
+		return fmt.Errorf("rootless container requires UID and GID mappings")
+	}
+	return nil
+}
+
+// rootlessIDMappings maps the container root user to the runtime user id,
+// and the container IDs starting at 1 to the subordinate ID range.
+func rootlessIDMappings(id int, sub *specs.LinuxIDMapping) []specs.LinuxIDMapping {
+	m := []specs.LinuxIDMapping{{ContainerID: 0, HostID: uint32(id), Size: 1}}
+	if sub != nil {
+		m = append(m, specs.LinuxIDMapping{ContainerID: 1, HostID: sub.HostID, Size: sub.Size})
+	}
+	return m
+}
+
+// readSubIDs returns the first subordinate ID range of the given user or group
+// (by name or numeric id) from the subuid / subgid file.
+// It returns nil if the file does not exist or contains no range.
+func readSubIDs(file string, name string, id string) (*specs.LinuxIDMapping, error) {
+	// #nosec
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 || (fields[0] != name && fields[0] != id) {
+			continue
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start in %s: %q: %w", file, line, err)
+		}
+		count, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid count in %s: %q: %w", file, line, err)
+		}
+		if count == 0 {
+			continue
+		}
+		return &specs.LinuxIDMapping{HostID: uint32(start), Size: uint32(count)}, nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,52 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSubIDs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "subuid")
+	data := "# comment\nalice:100000:65536\n1001:200000:65536\nbob:300000:0\nbob:400000:1000\n"
+	require.NoError(t, os.WriteFile(file, []byte(data), 0644))
+
+	m, err := readSubIDs(file, "alice", "1000")
+	require.NoError(t, err)
+	require.Equal(t, &specs.LinuxIDMapping{HostID: 100000, Size: 65536}, m)
+
+	m, err = readSubIDs(file, "carol", "1001")
+	require.NoError(t, err)
+	require.Equal(t, &specs.LinuxIDMapping{HostID: 200000, Size: 65536}, m)
+
+	// ranges with count 0 are skipped
+	m, err = readSubIDs(file, "bob", "1002")
+	require.NoError(t, err)
+	require.Equal(t, &specs.LinuxIDMapping{HostID: 400000, Size: 1000}, m)
+
+	m, err = readSubIDs(file, "dave", "1003")
+	require.NoError(t, err)
+	require.Nil(t, m)
+
+	m, err = readSubIDs(filepath.Join(t.TempDir(), "missing"), "alice", "1000")
+	require.NoError(t, err)
+	require.Nil(t, m)
+
+	require.NoError(t, os.WriteFile(file, []byte("alice:abc:65536\n"), 0644))
+	_, err = readSubIDs(file, "alice", "1000")
+	require.Error(t, err)
+}
+
+func TestRootlessIDMappings(t *testing.T) {
+	m := rootlessIDMappings(1000, &specs.LinuxIDMapping{HostID: 100000, Size: 65536})
+	require.Equal(t, []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: 1000, Size: 1},
+		{ContainerID: 1, HostID: 100000, Size: 65536},
+	}, m)
+
+	m = rootlessIDMappings(1000, nil)
+	require.Equal(t, []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}, m)
+}
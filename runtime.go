@@ -3,15 +3,21 @@ package lxcri
 
 import (
 	"context"
+	"crypto/cipher"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"time"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/creack/pty"
 	"github.com/drachenfels-de/gocapability/capability"
+	"github.com/lxc/lxcri/internal/mountattr"
+	"github.com/lxc/lxcri/pkg/log"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/rs/zerolog"
@@ -39,6 +45,14 @@ var (
 var (
 	// ErrNotExist is returned if the container (runtime dir) does not exist.
 	ErrNotExist = fmt.Errorf("container does not exist")
+	// ErrBundleModified is returned by Runtime.Start and Container.Exec
+	// if the bundle spec was modified after the container was created.
+	ErrBundleModified = fmt.Errorf("bundle modified")
+	// ErrExist is returned by Runtime.Create if the container (runtime dir) already exists.
+	ErrExist = fmt.Errorf("container already exists")
+	// ErrInitTimeout is returned by Runtime.Create (wrapped into a StartError)
+	// if the container init process is not ready before the create timeout.
+	ErrInitTimeout = fmt.Errorf("timeout waiting for container init")
 )
 
 // RuntimeFeatures are (security) features supported by the Runtime.
@@ -49,12 +63,73 @@ type RuntimeFeatures struct {
 	Capabilities  bool
 	Apparmor      bool
 	CgroupDevices bool
+	// Keyring creates a new session keyring for each container
+	// and masks /proc/keys. If disabled the liblxc default is kept.
+	Keyring bool
+	// ApparmorProtectRuntime denies access to the runtime directories
+	// (Root, EphemeralRoot and LibexecDir) for all containers. The deny rules
+	// are added to the profile generated by liblxc, any other container profile
+	// (including unconfined) is stacked with the profile lxcri-protect-runtime,
+	// which is loaded with apparmor_parser.
+	ApparmorProtectRuntime bool
+	// ReadonlyProcSys mounts /proc/sys read-only, except for the subtrees
+	// of the network and IPC namespaces, if these are not shared with the runtime.
+	ReadonlyProcSys bool
+	// DefaultMaskedPaths applies specki.DefaultMaskedPaths and specki.DefaultReadonlyPaths
+	// to containers without masked and read-only paths (e.g hand-written bundles),
+	// so they are not less protected than containers created by CRI-O.
+	DefaultMaskedPaths bool
+}
+
+// RuntimeFileModes are the permissions and the group ownership of
+// directories and files created by the runtime for each container.
+// Zero values are replaced with the builtin defaults by Runtime.Init.
+type RuntimeFileModes struct {
+	// Umask is the file mode creation mask of the monitor process,
+	// that applies to files created by liblxc e.g the liblxc log file.
+	// The umask of the runtime process is never changed, because it is process-wide.
+	// Files created by the runtime are changed to the modes below instead.
+	// The umask of the monitor process is inherited if Umask is nil.
+	Umask *int `json:",omitempty"`
+	// Group is the group ID that owns the container runtime directories and files.
+	// The group is not changed if Group is nil.
+	Group *int `json:",omitempty"`
+	// DirMode is the permission of the container runtime directory (default 0777).
+	// The container process must be able to access the runtime directory
+	// if it runs with a UID/GID that is different from the runtime UID/GID.
+	DirMode os.FileMode `json:",omitempty"`
+	// ConfigFileMode is the permission of the liblxc config file (default 0640).
+	ConfigFileMode os.FileMode `json:",omitempty"`
+	// PrivateFileMode is the permission of files that are only accessed by
+	// the runtime e.g lxcri.json and the seccomp profile (default 0440).
+	PrivateFileMode os.FileMode `json:",omitempty"`
+	// PublicFileMode is the permission of files that are read by the
+	// container init process and the hooks e.g config.json, state.json and
+	// hooks.json (default 0444).
+	PublicFileMode os.FileMode `json:",omitempty"`
+}
+
+func (m *RuntimeFileModes) setDefaults() {
+	if m.DirMode == 0 {
+		m.DirMode = 0777
+	}
+	if m.ConfigFileMode == 0 {
+		m.ConfigFileMode = 0640
+	}
+	if m.PrivateFileMode == 0 {
+		m.PrivateFileMode = 0440
+	}
+	if m.PublicFileMode == 0 {
+		m.PublicFileMode = 0444
+	}
 }
 
 // Runtime is a factory for creating and managing containers.
 // The exported methods of Runtime  are required to implement the
 // OCI container runtime interface spec (CRI).
 // It shares the common settings
+// Runtime instances that share the same Root can be used concurrently
+// by multiple processes (see the concurrency contract in lock.go).
 type Runtime struct {
 	// Log is the logger used by the runtime.
 	Log zerolog.Logger `json:"-"`
@@ -64,11 +139,102 @@ type Runtime struct {
 	// are created within this directory.
 	Root string `json:",omitempty"`
 
+	// HashLongContainerIDs replaces container IDs longer than 64 characters
+	// with their SHA-256 hash in the runtime directory name, and raises the
+	// maximum container ID length to MaxContainerIDLength.
+	// The original container ID is stored in the file ContainerIDFile.
+	HashLongContainerIDs bool `json:",omitempty"`
+
+	// Rootless runs the runtime as an unprivileged user.
+	// The state is stored in $XDG_RUNTIME_DIR/lxcri if Root is unset,
+	// features that require privileges (apparmor and cgroup device access control)
+	// are disabled, and containers without ID mappings are mapped to the
+	// runtime user and the subordinate IDs delegated in /etc/subuid and /etc/subgid.
+	Rootless bool `json:",omitempty"`
+
+	// RequireResourceLimits fails Runtime.Create in Rootless mode if resource limits
+	// of the spec can not be enforced, because the cgroup controller is not delegated
+	// to the runtime user. Otherwise the limits are skipped and recorded
+	// in ContainerConfig.SkippedLimits.
+	RequireResourceLimits bool `json:",omitempty"`
+
+	// Tenant scopes the runtime to the containers of a tenant on a shared host.
+	// If set, Init changes Root and EphemeralRoot to a per-tenant sub directory
+	// and MonitorCgroup to a per-tenant child cgroup.
+	// The tenant name must be a valid container ID with a maximum length of 64.
+	Tenant string `json:",omitempty"`
+
+	// MaxContainers is the maximum number of containers in Root
+	// (the containers of Tenant if set). Zero means unlimited.
+	MaxContainers int `json:",omitempty"`
+
+	// EphemeralRoot is the optional file path to a directory on a tmpfs.
+	// If set, ephemeral container runtime files (e.g the init socket and
+	// the seccomp profile) are placed in a per-container directory within
+	// EphemeralRoot instead of the container runtime directory within Root.
+	// The durable container state (lxcri.json) is always stored within Root.
+	EphemeralRoot string `json:",omitempty"`
+
 	// Path for lxc monitor cgroup (lxc specific feature).
 	// This is the cgroup where the liblxc monitor process (lxcri-start)
 	// will be placed in. It's similar to /etc/crio/crio.conf#conmon_cgroup
 	MonitorCgroup string `json:",omitempty"`
 
+	// MonitorInContainerCgroup places the liblxc monitor process (lxcri-start)
+	// into a child cgroup of the container cgroup instead of MonitorCgroup,
+	// so the resource usage of the monitor is accounted to the container.
+	// MonitorCgroup is still used as pivot cgroup for the monitor process
+	// when the container cgroup is removed by liblxc.
+	MonitorInContainerCgroup bool `json:",omitempty"`
+
+	// CgroupManager is the cgroup manager (CgroupManagerCgroupfs or CgroupManagerSystemd).
+	// With the systemd cgroup manager the cgroup path must be systemd encoded
+	// (see ContainerConfig.SystemdCgroup), and the container and monitor cgroups
+	// are registered as transient systemd scopes, that are stopped by Runtime.Delete.
+	CgroupManager string `json:",omitempty"`
+
+	// MonitorSlice is the systemd slice (e.g lxcri-monitor.slice) of the monitor
+	// scopes, if the systemd cgroup manager is used. It replaces MonitorCgroup.
+	MonitorSlice string `json:",omitempty"`
+
+	// ExternalCgroups enables external cgroup management.
+	// The container cgroup (Spec.Linux.CgroupsPath) is managed by the caller
+	// (e.g kubelet or systemd). It must exist when the container is created,
+	// and it is not deleted when the container is deleted.
+	ExternalCgroups bool `json:",omitempty"`
+
+	// NetworkRootfs is the policy for a container rootfs located on a network
+	// filesystem like NFS or CIFS (NetworkRootfsWarn or NetworkRootfsDeny).
+	NetworkRootfs string `json:",omitempty"`
+
+	// ApparmorProfileDir is the optional directory that contains apparmor profiles
+	// bundled with the runtime. The file name must match the profile name.
+	// A profile used by a container is loaded (with apparmor_parser) when the container
+	// is created, unless the same profile file is already loaded.
+	ApparmorProfileDir string `json:",omitempty"`
+
+	// DefaultRlimits are the resource limits of the container process,
+	// for limit types that are not defined in Spec.Process.Rlimits.
+	// Otherwise the limits are inherited from the monitor process,
+	// which gives inconsistent results across hosts.
+	DefaultRlimits []specs.POSIXRlimit `json:",omitempty"`
+
+	// AllowedSysctls are the sysctls that can be set by containers (see Spec.Linux.Sysctl).
+	// A pattern with the suffix `*` allows all sysctls with the pattern prefix (e.g `net.*`).
+	// If empty all namespaced sysctls are allowed.
+	AllowedSysctls []string `json:",omitempty"`
+
+	// MountPolicy restricts the host paths that can be bind mounted into containers.
+	MountPolicy MountPolicy
+
+	// SwapDir is the directory for container swap files (see ContainerConfig.SwapSize).
+	// The filesystem must support swap files (e.g ext4 or xfs).
+	SwapDir string `json:",omitempty"`
+
+	// LibexecHashes are the expected SHA-256 hashes (hex encoded) of the runtime
+	// executables by name (e.g lxcri-start), that are verified by Runtime.Healthy.
+	LibexecHashes map[string]string `json:",omitempty"`
+
 	// LibexecDir is the the directory that contains the runtime executables.
 	LibexecDir string `json:",omitempty"`
 
@@ -76,11 +242,104 @@ type Runtime struct {
 	// created by the runtime.
 	Features RuntimeFeatures
 
+	// FileModes are the permissions of container runtime files and directories.
+	FileModes RuntimeFileModes
+
+	// CoreDumps enables core dumps of container processes.
+	// RLIMIT_CORE is set to unlimited, unless it is defined by the container spec.
+	// Core dumps are collected in the directory `cores` within the
+	// container runtime directory (or within CoreDumpDir if set).
+	// Core dumps in the runtime directory are removed by Runtime.Delete,
+	// set CoreDumpDir to keep them.
+	// An absolute core_pattern must use a dedicated directory,
+	// e.g `/var/crash/core.%e.%p`, because it is shadowed within the container.
+	CoreDumps bool `json:",omitempty"`
+
+	// CoreDumpDir is the optional directory where core dumps are collected.
+	// Core dumps within CoreDumpDir are not removed when the container is deleted.
+	CoreDumpDir string `json:",omitempty"`
+
+	// CopyResolvConf copies a bind mounted /etc/resolv.conf into the container
+	// runtime directory if the user namespace is enabled, because the
+	// source may not be readable by the container root user.
+	CopyResolvConf bool `json:",omitempty"`
+
+	// ValidateEntrypoint checks on create, that the container process
+	// executable and its interpreter exist in the rootfs and that the
+	// executable architecture is supported.
+	ValidateEntrypoint bool `json:",omitempty"`
+
+	// Wasm configures the (experimental) execution of WASM images.
+	Wasm WasmConfig
+
+	// KeepVolumes disables the removal of anonymous volumes
+	// (see ContainerConfig.Volumes) by Runtime.Delete.
+	KeepVolumes bool `json:",omitempty"`
+
+	// ResourceLimits are the host thresholds for the sum of the
+	// resources reserved by all containers.
+	ResourceLimits ResourceLimits
+
+	// MonitorOOMScoreAdj is the optional OOM score adjustment of the
+	// liblxc monitor process (lxcri-start), so the monitor is not killed
+	// before the container processes (conmon uses -999).
+	// The container processes keep the OOM score adjustment of the runtime,
+	// unless it is defined by the container spec.
+	MonitorOOMScoreAdj *int `json:",omitempty"`
+
+	// LogSampling limits the number of debug and trace entries
+	// of container loggers created by ContainerLog.
+	LogSampling log.Sampling
+
+	// TraceConfig records the liblxc config items set by Runtime.Create
+	// together with the runtime spec field and the reason
+	// in the file ConfigTraceFile (see Container.ConfigTrace).
+	TraceConfig bool `json:",omitempty"`
+
+	// KillOnPoststartHookError kills the container and fails Runtime.Start
+	// if a poststart hook fails. By default the failure is only logged
+	// (as required by the runtime spec).
+	// Runtime.Start always blocks until the poststart hooks are finished.
+	// The remaining poststart hooks are not run after a hook failed.
+	// The container process is already running when the poststart hooks are run,
+	// so setup it depends on (e.g networking) belongs in the createRuntime hooks.
+	KillOnPoststartHookError bool `json:",omitempty"`
+
+	// SpecReference stores a reference to the spec in the container runtime
+	// directory (BundleConfigFile) together with its hash in the container state,
+	// instead of serializing the spec again. This reduces the size of the
+	// state for huge specs (e.g with thousands of environment variables or mounts).
+	// The spec in the runtime directory is not protected by StateProtection.
+	SpecReference bool `json:",omitempty"`
+
+	// StateProtection protects sensitive values in the persisted container state.
+	StateProtection StateProtection
+
+	// SecuritySensor is notified with the kernel identifiers of each created container.
+	SecuritySensor SecuritySensor
+
+	// Clock is the clock used by the runtime. The real clock is used if Clock is nil.
+	Clock Clock `json:"-"`
+
+	// FS provides access to the cgroup filesystem.
+	// The host filesystem is used if FS is nil.
+	FS FS `json:"-"`
+
 	// Environment passed to `lxcri-start`
 	env []string
 
 	caps capability.Capabilities
 
+	// rootlessIDMap are the default ID mappings if Rootless is enabled.
+	rootlessIDMap rootlessIDMap
+
+	// mountSetattr is true if the kernel supports mount_setattr(2)
+	mountSetattr bool
+
+	// stateCipher encrypts the sensitive container state values
+	// if StateProtection.Mode is StateProtectionEncrypt.
+	stateCipher cipher.AEAD
+
 	specs.Hooks `json:",omitempty"`
 }
 
@@ -88,6 +347,28 @@ func (rt *Runtime) libexec(name string) string {
 	return filepath.Join(rt.LibexecDir, name)
 }
 
+// ephemeralDir returns the directory for ephemeral
+// runtime files of the container with the given ID.
+func (rt *Runtime) ephemeralDir(containerID string) string {
+	if rt.EphemeralRoot == "" {
+		return rt.runtimeDir(containerID)
+	}
+	return filepath.Join(rt.EphemeralRoot, rt.containerDirName(containerID))
+}
+
+// chgrp changes the group of the given files to RuntimeFileModes.Group
+func (rt *Runtime) chgrp(files ...string) error {
+	if rt.FileModes.Group == nil {
+		return nil
+	}
+	for _, f := range files {
+		if err := os.Chown(f, -1, *rt.FileModes.Group); err != nil {
+			return fmt.Errorf("failed to change group of %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
 func (rt *Runtime) hasCapability(s string) bool {
 	c, exist := capability.Parse(s)
 	if !exist {
@@ -113,6 +394,44 @@ func (rt *Runtime) Init() error {
 
 	rt.keepEnv("HOME", "XDG_RUNTIME_DIR", "PATH")
 
+	if adj := rt.MonitorOOMScoreAdj; adj != nil {
+		if *adj < -1000 || *adj > 1000 {
+			return errorf("invalid monitor OOM score adjustment %d", *adj)
+		}
+		rt.env = append(rt.env, fmt.Sprintf("LXCRI_MONITOR_OOM_SCORE_ADJ=%d", *adj))
+	}
+
+	rt.FileModes.setDefaults()
+	if mask := rt.FileModes.Umask; mask != nil {
+		if *mask < 0 || *mask > 0777 {
+			return errorf("invalid umask %o", *mask)
+		}
+		rt.env = append(rt.env, fmt.Sprintf("LXCRI_MONITOR_UMASK=%o", *mask))
+	}
+
+	rt.MountPolicy.setDefaults()
+	if err := rt.MountPolicy.validate(); err != nil {
+		return errorf("invalid mount policy: %w", err)
+	}
+
+	if rt.Rootless {
+		if err := rt.initRootless(); err != nil {
+			return errorf("failed to initialize rootless mode: %w", err)
+		}
+	}
+
+	if err := rt.SecuritySensor.validate(); err != nil {
+		return errorf("invalid security sensor: %w", err)
+	}
+
+	if err := rt.validateCgroupManager(); err != nil {
+		return errorf("invalid cgroup manager configuration: %w", err)
+	}
+
+	if err := rt.scopeTenant(); err != nil {
+		return errorf("invalid tenant configuration: %w", err)
+	}
+
 	err = canExecute(rt.libexec(ExecStart), rt.libexec(ExecHook), rt.libexec(ExecInit))
 	if err != nil {
 		return errorf("access check failed: %w", err)
@@ -122,11 +441,32 @@ func (rt *Runtime) Init() error {
 		return errorf("procfs not mounted on /proc: %w", err)
 	}
 
+	if rt.EphemeralRoot != "" {
+		if err := os.MkdirAll(rt.EphemeralRoot, 0755); err != nil {
+			return errorf("failed to create ephemeral root: %w", err)
+		}
+		if err := isFilesystem(rt.EphemeralRoot, "tmpfs"); err != nil {
+			rt.Log.Warn().Msgf("ephemeral root is not memory backed: %s", err)
+		}
+	}
+
+	rt.stateCipher, err = rt.StateProtection.init()
+	if err != nil {
+		return errorf("failed to initialize state protection: %w", err)
+	}
+
+	checkNetworkRuntimeRoot(rt)
+
+	rt.mountSetattr = mountattr.Supported()
+	if !rt.mountSetattr {
+		rt.Log.Info().Msg("mount_setattr is not supported - recursive read-only mounts are disabled")
+	}
+
 	cgroupRoot, err = detectCgroupRoot()
 	if err != nil {
 		rt.Log.Warn().Msgf("cgroup root detection failed: %s", err)
 	}
-	rt.Log.Info().Msgf("using cgroup root %s", cgroupRoot)
+	rt.Log.Info().Int("version", cgroups.version()).Msgf("using cgroup root %s", cgroupRoot)
 
 	if !lxc.VersionAtLeast(3, 1, 0) {
 		return errorf("liblxc runtime version is %s, but >= 3.1.0 is required", lxc.Version())
@@ -143,8 +483,34 @@ func (rt *Runtime) Init() error {
 }
 
 func (rt *Runtime) checkConfig(cfg *ContainerConfig) error {
-	if len(cfg.ContainerID) == 0 {
-		return errorf("missing container ID")
+	if err := rt.checkContainerID(cfg.ContainerID); err != nil {
+		return errorf("invalid container config: %w", err)
+	}
+	if cfg.RestartPolicy != nil {
+		if err := cfg.RestartPolicy.validate(); err != nil {
+			return err
+		}
+	}
+	for i := range cfg.WaitFor {
+		if err := cfg.WaitFor[i].validate(); err != nil {
+			return err
+		}
+	}
+	if len(cfg.Secrets) > 0 && cfg.RestartPolicy != nil && cfg.RestartPolicy.Name != RestartNo {
+		return errorf("secrets are not supported with restart policy %q", cfg.RestartPolicy.Name)
+	}
+	files := make(map[string]bool)
+	for i := range cfg.Secrets {
+		s := &cfg.Secrets[i]
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if s.File != "" {
+			if files[s.File] {
+				return errorf("duplicate secret file %q", s.File)
+			}
+			files[s.File] = true
+		}
 	}
 	return rt.checkSpec(cfg.Spec)
 }
@@ -203,22 +569,48 @@ func (rt *Runtime) keepEnv(names ...string) {
 // The logger Container.Log is set to Runtime.Log by default.
 // A loaded Container must be released with Container.Release after use.
 func (rt *Runtime) Load(containerID string) (*Container, error) {
-	dir := filepath.Join(rt.Root, containerID)
+	if err := rt.checkContainerID(containerID); err != nil {
+		return nil, errorf("failed to load container: %w", err)
+	}
+	dir := rt.runtimeDir(containerID)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return nil, ErrNotExist
 	}
 	c := &Container{
 		ContainerConfig: &ContainerConfig{
-			Log: rt.Log,
+			Log: rt.ContainerLog(containerID, ""),
 		},
-		runtimeDir: dir,
+		runtimeDir:   dir,
+		ephemeralDir: rt.ephemeralDir(containerID),
+		clock:        rt.sysClock(),
+		fs:           rt.sysFS(),
 	}
 	if err := c.load(); err != nil {
 		return nil, err
 	}
+	if err := c.loadSpecReference(); err != nil {
+		c.Release()
+		return nil, errorf("failed to load container spec: %w", err)
+	}
+	if err := rt.unprotectState(c); err != nil {
+		c.Release()
+		return nil, errorf("failed to load container state: %w", err)
+	}
 	return c, nil
 }
 
+// ContainerLog returns a logger for the given container and operation
+// (e.g create, start, delete), derived from the runtime logger.
+// The container ID and the operation are attached to all log entries,
+// and the LogSampling limits are applied.
+func (rt *Runtime) ContainerLog(containerID string, operation string) zerolog.Logger {
+	ctx := rt.Log.With().Str("cid", containerID)
+	if operation != "" {
+		ctx = ctx.Str("op", operation)
+	}
+	return log.Sample(ctx.Logger(), rt.LogSampling)
+}
+
 // Start starts the given container.
 // Start simply unblocks the init process `lxcri-init`,
 // which then executes the container process.
@@ -226,17 +618,42 @@ func (rt *Runtime) Load(containerID string) (*Container, error) {
 func (rt *Runtime) Start(ctx context.Context, c *Container) error {
 	rt.Log.Info().Msg("notify init to start container process")
 
+	unlock, err := rt.lockContainer(c.ContainerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := c.checkBundle(); err != nil {
+		return err
+	}
+
 	state, err := c.State()
 	if err != nil {
 		return errorf("failed to get container state: %w", err)
 	}
 	if state.SpecState.Status != specs.StateCreated {
+		if state.Exit != nil && state.Exit.Error != "" {
+			return fmt.Errorf("invalid container state. expected %q, but was %q: %s", specs.StateCreated, state.SpecState.Status, state.Exit.Error)
+		}
 		return fmt.Errorf("invalid container state. expected %q, but was %q", specs.StateCreated, state.SpecState.Status)
 	}
 
+	if err := c.waitConditions(ctx); err != nil {
+		return err
+	}
+
+	if c.CreateFrozen {
+		c.Log.Debug().Msg("thawing container cgroup")
+		if err := c.freeze(ctx, false); err != nil {
+			return errorf("failed to thaw container: %w", err)
+		}
+	}
+
+	since := monotonicNow()
 	err = c.start(ctx)
 	if err != nil {
-		return err
+		return c.postmortem(err, since)
 	}
 
 	if c.Spec.Hooks != nil {
@@ -244,18 +661,43 @@ func (rt *Runtime) Start(ctx context.Context, c *Container) error {
 		if err != nil {
 			return errorf("failed to get container state: %w", err)
 		}
-		specki.RunHooks(ctx, &state.SpecState, c.Spec.Hooks.Poststart, true)
+		// Continuing after a failed hook is pointless if the container is killed.
+		err = specki.RunHooks(ctx, &state.SpecState, c.Spec.Hooks.Poststart, !rt.KillOnPoststartHookError)
+		if err != nil && rt.KillOnPoststartHookError {
+			c.Log.Error().Msgf("killing container: %s", err)
+			if err := c.killAll(ctx); err != nil {
+				c.Log.Error().Msgf("failed to kill container: %s", err)
+			}
+			return errorf("poststart hook failed: %w", err)
+		}
+		if err != nil {
+			c.Log.Warn().Msgf("poststart hook failed: %s", err)
+		}
 	}
 	return nil
 }
 
 func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
+	monitorStart := rt.sysClock().Now()
 	// #nosec
 	cmd := exec.Command(rt.libexec(ExecStart), c.LinuxContainer.Name(), rt.Root, c.ConfigFilePath())
 	cmd.Env = rt.env
+	if c.RestartPolicy != nil {
+		cmd.Env = append(append([]string{}, rt.env...), c.RestartPolicy.env()...)
+	}
 	cmd.Dir = c.RuntimePath()
 
-	if c.ConsoleSocket == "" && !c.Spec.Process.Terminal {
+	if c.ConsoleMode == ConsoleStdio {
+		if err := c.setConfigItem("lxc.console.path", "none"); err != nil {
+			return err
+		}
+		files, err := rt.setupConsoleStdio(c, cmd)
+		if err != nil {
+			return errorf("failed to setup console: %w", err)
+		}
+		// The file descriptors are duplicated to the monitor process.
+		defer closeFiles(files)
+	} else if c.ConsoleMode != ConsoleSerial && c.ConsoleSocket == "" && !c.Spec.Process.Terminal {
 		// Inherit stdio from calling process (conmon).
 		// lxc.console.path must be set to 'none' or stdio of init process is replaced with a PTY by lxc
 		if err := c.setConfigItem("lxc.console.path", "none"); err != nil {
@@ -264,6 +706,30 @@ func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
+	} else {
+		// Errors (e.g from liblxc) written by the monitor process
+		// would get lost or end up in the container console output.
+		// #nosec
+		stderr, err := os.OpenFile(c.monitorStderrPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, rt.FileModes.PrivateFileMode)
+		if err != nil {
+			return errorf("failed to create monitor stderr file: %w", err)
+		}
+		// The file descriptor is duplicated to the monitor process.
+		defer stderr.Close()
+		// The initial permissions are affected by the umask.
+		if err := stderr.Chmod(rt.FileModes.PrivateFileMode); err != nil {
+			return errorf("failed to chmod monitor stderr file: %w", err)
+		}
+		cmd.Stderr = stderr
+	}
+
+	envFile, err := rt.passProcessEnv(c, cmd)
+	if err != nil {
+		return errorf("failed to pass process environment: %w", err)
+	}
+	if envFile != nil {
+		// The file descriptor is duplicated to the monitor process.
+		defer envFile.Close()
 	}
 
 	// NOTE any config change via clxc.setConfigItem
@@ -274,6 +740,7 @@ func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
 	}
 
 	rt.Log.Debug().Msg("starting lxc monitor process")
+	since := monotonicNow()
 	if c.ConsoleSocket != "" {
 		err = runStartCmdConsole(ctx, cmd, c.ConsoleSocket)
 	} else {
@@ -284,67 +751,127 @@ func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
 		return err
 	}
 
-	c.CreatedAt = time.Now()
+	c.CreatedAt = rt.sysClock().Now()
 	c.Pid = cmd.Process.Pid
+	c.monitor = startMonitorReaper(cmd.Process)
 	rt.Log.Info().Int("pid", cmd.Process.Pid).Msg("monitor process started")
+	if c.CreateTimings != nil {
+		c.CreateTimings.MonitorStart = c.CreatedAt.Sub(monitorStart)
+	}
 
-	p := c.RuntimePath("lxcri.json")
-	err = specki.EncodeJSONFile(p, c, os.O_EXCL|os.O_CREATE, 0440)
-	if err != nil {
+	if err := rt.saveState(c, false); err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := c.cancelOnMonitorExit(ctx)
 	defer cancel()
 
 	rt.Log.Debug().Msg("waiting for init")
+	initStart := rt.sysClock().Now()
 	if err := c.waitCreated(ctx); err != nil {
+		return c.postmortem(c.createError(err), since)
+	}
+	if c.CreateTimings != nil {
+		c.CreateTimings.Init = rt.sysClock().Now().Sub(initStart)
+	}
+	if err := c.setConsoleOwner(); err != nil {
+		return err
+	}
+	if err := rt.registerSystemdScopes(ctx, c); err != nil {
+		return errorf("failed to register systemd scopes: %w", err)
+	}
+	if err := rt.notifySecuritySensor(ctx, c); err != nil {
 		return err
 	}
 
+	if c.CreateFrozen {
+		rt.Log.Debug().Msg("freezing container cgroup")
+		if err := c.freeze(ctx, true); err != nil {
+			return errorf("failed to freeze container: %w", err)
+		}
+	}
 	return nil
 }
 
+// saveState atomically writes the (protected) container state to the runtime directory.
+// An existing state is only replaced if replace is true.
+func (rt *Runtime) saveState(c *Container, replace bool) error {
+	state, err := rt.protectedState(c)
+	if err != nil {
+		return errorf("failed to protect container state: %w", err)
+	}
+	p := c.RuntimePath("lxcri.json")
+	if replace {
+		err = replaceJSONFileAtomic(p, state, rt.FileModes.PrivateFileMode)
+	} else {
+		err = encodeJSONFileAtomic(p, state, rt.FileModes.PrivateFileMode)
+	}
+	if err != nil {
+		return err
+	}
+	return rt.chgrp(p)
+}
+
 func runStartCmdConsole(ctx context.Context, cmd *exec.Cmd, consoleSocket string) error {
+	sockFile, err := dialConsoleSocket(ctx, consoleSocket)
+	if err != nil {
+		return err
+	}
+	defer sockFile.Close()
+
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to start with pty: %w", err)
+	}
+	if err := sendConsole(sockFile, ptmx); err != nil {
+		ptmx.Close()
+		return err
+	}
+	return ptmx.Close()
+}
+
+// dialConsoleSocket connects to the given console socket
+// and returns the file of the connection.
+func dialConsoleSocket(ctx context.Context, consoleSocket string) (*os.File, error) {
 	dialer := net.Dialer{}
 	c, err := dialer.DialContext(ctx, "unix", consoleSocket)
 	if err != nil {
-		return fmt.Errorf("connecting to console socket failed: %w", err)
+		return nil, fmt.Errorf("connecting to console socket failed: %w", err)
 	}
 	defer c.Close()
 
 	conn, ok := c.(*net.UnixConn)
 	if !ok {
-		return fmt.Errorf("expected a unix connection but was %T", conn)
+		return nil, fmt.Errorf("expected a unix connection but was %T", conn)
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
 		err = conn.SetDeadline(deadline)
 		if err != nil {
-			return fmt.Errorf("failed to set connection deadline: %w", err)
+			return nil, fmt.Errorf("failed to set connection deadline: %w", err)
 		}
 	}
 
 	sockFile, err := conn.File()
 	if err != nil {
-		return fmt.Errorf("failed to get file from unix connection: %w", err)
-	}
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		return fmt.Errorf("failed to start with pty: %w", err)
+		return nil, fmt.Errorf("failed to get file from unix connection: %w", err)
 	}
+	return sockFile, nil
+}
 
+// sendConsole sends the pty master ptmx over the console socket sockFile.
+func sendConsole(sockFile *os.File, ptmx *os.File) error {
 	// Send the pty file descriptor over the console socket (to the 'conmon' process)
 	// For technical backgrounds see:
 	// * `man sendmsg 2`, `man unix 3`, `man cmsg 1`
 	// * https://blog.cloudflare.com/know-your-scm_rights/
 	oob := unix.UnixRights(int(ptmx.Fd()))
 	// Don't know whether 'terminal' is the right data to send, but conmon doesn't care anyway.
-	err = unix.Sendmsg(int(sockFile.Fd()), []byte("terminal"), oob, nil, 0)
+	err := unix.Sendmsg(int(sockFile.Fd()), []byte("terminal"), oob, nil, 0)
 	if err != nil {
 		return fmt.Errorf("failed to send console fd: %w", err)
 	}
-	return ptmx.Close()
+	return nil
 }
 
 // Kill sends the signal signum to the container init process.
@@ -356,6 +883,11 @@ func (rt *Runtime) Kill(ctx context.Context, c *Container, signum unix.Signal) e
 	if state == specs.StateStopped {
 		return errorf("container already stopped")
 	}
+	if isTerminatingSignal(signum) {
+		if err := c.disableRestart(); err != nil {
+			return errorf("failed to disable restart: %w", err)
+		}
+	}
 	return c.kill(ctx, signum)
 }
 
@@ -365,14 +897,28 @@ func (rt *Runtime) Kill(ctx context.Context, c *Container, signum unix.Signal) e
 // the container will be killed with unix.SIGKILL.
 func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) error {
 	rt.Log.Info().Bool("force", force).Msg("delete container")
+	unlock, err := rt.lockContainer(containerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	c, err := rt.Load(containerID)
-	if err == ErrNotExist {
+	if errors.Is(err, ErrNotExist) {
 		return err
 	}
 	if err != nil {
 		// NOTE hooks won't run in this case
 		rt.Log.Warn().Msgf("deleting runtime dir for unloadable container: %s", err)
-		return os.RemoveAll(filepath.Join(rt.Root, containerID))
+		if err := os.RemoveAll(rt.ephemeralDir(containerID)); err != nil {
+			rt.Log.Warn().Msgf("failed to delete ephemeral runtime dir: %s", err)
+		}
+		if err := rt.deleteVolumes(containerID); err != nil {
+			rt.Log.Warn().Msgf("failed to delete volumes: %s", err)
+		}
+		if err := rt.deleteSwap(containerID); err != nil {
+			rt.Log.Warn().Msgf("failed to delete swap file: %s", err)
+		}
+		return os.RemoveAll(rt.runtimeDir(containerID))
 	}
 
 	defer c.Release()
@@ -381,18 +927,36 @@ func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) e
 	if err != nil {
 		return err
 	}
+	if state != specs.StateStopped && !force {
+		return errorf("container is not not stopped (current state %s)", state)
+	}
+	// The monitor process may be waiting to restart the container.
+	if err := c.disableRestart(); err != nil {
+		return errorf("failed to disable restart: %w", err)
+	}
 	if state != specs.StateStopped {
 		c.Log.Debug().Msgf("delete state:%s", state)
-		if !force {
-			return errorf("container is not not stopped (current state %s)", state)
-		}
-		if err := c.kill(ctx, unix.SIGKILL); err != nil {
+		if err := c.killAll(ctx); err != nil {
 			return errorf("failed to kill container: %w", err)
 		}
 	}
 
 	if err := c.waitMonitorStopped(ctx); err != nil {
-		c.Log.Error().Msgf("failed to stop monitor process %d", c.Pid)
+		// The runtime directory must not be removed while the monitor process
+		// is running, it may still restart the container.
+		c.Log.Warn().Msgf("monitor process %d did not stop: %s", c.Pid, err)
+		if err := c.killMonitor(); err != nil {
+			return errorf("failed to kill monitor process %d: %w", c.Pid, err)
+		}
+	} else if state == specs.StateStopped {
+		// Processes may be left in the container cgroup,
+		// if the monitor process died unexpectedly.
+		if err := c.killAll(ctx); err != nil {
+			c.Log.Warn().Msgf("failed to kill remaining container processes: %s", err)
+		}
+	}
+	if err := c.killConsoleForwarder(); err != nil {
+		c.Log.Warn().Msgf("failed to kill console forwarder: %s", err)
 	}
 
 	// From OCI runtime spec
@@ -404,19 +968,34 @@ func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) e
 		return fmt.Errorf("failed to destroy container: %w", err)
 	}
 
-	// the monitor might be part of the cgroup so wait for it to exit
-	eventsFile := filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events")
-	err = pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
-		return !ev.populated
+	// The monitor might be part of the cgroup (see Runtime.MonitorInContainerCgroup)
+	// so wait for it to exit.
+	err = pollCgroup(ctx, c, func() (bool, error) {
+		populated, err := cgroups.isPopulated(c.sysFS(), c.CgroupDir)
+		return !populated, err
 	})
 	if err != nil && !os.IsNotExist(err) {
 		// try to delete the cgroup anyways
-		c.Log.Warn().Msgf("failed to wait until cgroup.events populated=0: %s", err)
+		c.Log.Warn().Msgf("failed to wait until the cgroup is empty: %s", err)
 	}
 
-	err = deleteCgroup(c.CgroupDir)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete cgroup: %s", err)
+	if err := c.stopSystemdScopes(ctx); err != nil {
+		c.Log.Warn().Msgf("failed to stop systemd scopes: %s", err)
+	}
+
+	if c.ExternalCgroup {
+		c.Log.Debug().Str("cgroup", c.CgroupDir).Msg("keep externally managed cgroup")
+		if c.isMonitorInContainerCgroup() {
+			err := c.sysFS().Rmdir(filepath.Join(cgroupRoot, c.MonitorCgroupDir))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete monitor cgroup: %w", err)
+			}
+		}
+	} else {
+		err = deleteCgroup(c.sysFS(), c.CgroupDir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete cgroup: %s", err)
+		}
 	}
 
 	if c.Spec.Hooks != nil {
@@ -424,12 +1003,78 @@ func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) e
 		if err != nil {
 			return errorf("failed to get container state: %w", err)
 		}
-		specki.RunHooks(ctx, &state.SpecState, c.Spec.Hooks.Poststop, true)
+		if err := specki.RunHooks(ctx, &state.SpecState, c.Spec.Hooks.Poststop, true); err != nil {
+			c.Log.Warn().Msgf("poststop hook failed: %s", err)
+		}
 	}
 
+	if err := os.RemoveAll(c.EphemeralPath()); err != nil {
+		return errorf("failed to delete ephemeral runtime dir: %w", err)
+	}
+	if err := rt.deleteVolumes(containerID); err != nil {
+		return errorf("failed to delete volumes: %w", err)
+	}
+	if err := rt.deleteSwap(containerID); err != nil {
+		return errorf("failed to delete swap file: %w", err)
+	}
 	return os.RemoveAll(c.RuntimePath())
 }
 
+// DeleteAllConcurrency is the maximum number of containers
+// that are deleted in parallel by Runtime.DeleteAll.
+const DeleteAllConcurrency = 8
+
+// DeleteAllError is returned by Runtime.DeleteAll.
+// It maps the IDs of the containers that could not be deleted to the error.
+type DeleteAllError map[string]error
+
+func (e DeleteAllError) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", id, e[id]))
+	}
+	return fmt.Sprintf("failed to delete %d containers: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// DeleteAll deletes the given containers in parallel (see Runtime.Delete)
+// e.g the containers of a pod. Containers that do not exist are ignored.
+// All containers are processed, even if the deletion of a container fails.
+func (rt *Runtime) DeleteAll(ctx context.Context, containerIDs []string, force bool) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(DeleteAllError)
+		sem  = make(chan struct{}, DeleteAllConcurrency)
+	)
+	for _, id := range containerIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := rt.Delete(ctx, id, force)
+			if err == nil || errors.Is(err, ErrNotExist) {
+				return
+			}
+			mu.Lock()
+			errs[id] = err
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
 // List returns the IDs for all existing containers.
 func (rt *Runtime) List() ([]string, error) {
 	dir, err := os.Open(rt.Root)
@@ -444,9 +1089,15 @@ func (rt *Runtime) List() ([]string, error) {
 	// ignore hidden elements
 	visible := make([]string, 0, len(names))
 	for _, name := range names {
-		if name[0] != '.' {
-			visible = append(visible, name)
+		if name[0] == '.' {
+			continue
+		}
+		id, err := rt.containerIDFromDir(name)
+		if err != nil {
+			rt.Log.Warn().Err(err).Str("dir", name).Msg("failed to read container ID")
+			continue
 		}
+		visible = append(visible, id)
 	}
 	return visible, nil
 }
@@ -331,3 +331,40 @@ func testRuntime(t *testing.T, rt *Runtime, cfg *ContainerConfig) {
 	err = c.Release()
 	require.NoError(t, err)
 }
+
+func TestDeleteAll(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	// Unloadable containers are removed, missing containers are ignored.
+	require.NoError(t, os.MkdirAll(filepath.Join(rt.Root, "broken"), 0755))
+	require.NoError(t, rt.DeleteAll(context.Background(), []string{"broken", "missing"}, false))
+	_, err := os.Stat(filepath.Join(rt.Root, "broken"))
+	require.True(t, os.IsNotExist(err))
+
+	err = DeleteAllError{"b": fmt.Errorf("busy"), "a": ErrNotExist}
+	require.Equal(t, "failed to delete 2 containers: a: container does not exist; b: busy", err.Error())
+}
+
+func TestRuntimeRootless(t *testing.T) {
+	t.Parallel()
+	if os.Getuid() == 0 {
+		t.Skipf("This test only runs as non-root")
+	}
+
+	rt := newRuntime(t)
+	defer removeAll(t, rt.Root)
+	rt.Rootless = true
+	require.NoError(t, rt.Init())
+	require.False(t, rt.Features.CgroupDevices)
+	require.False(t, rt.Features.Apparmor)
+
+	cfg := newConfig(t, "lxcri-test")
+	defer removeAll(t, cfg.Spec.Root.Path)
+
+	// The rootfs must be accessible by the subordinate IDs.
+	err := unix.Chmod(cfg.Spec.Root.Path, 0777)
+	require.NoError(t, err)
+
+	testRuntime(t, rt, cfg)
+	require.Equal(t, uint32(os.Getuid()), cfg.Spec.Linux.UIDMappings[0].HostID)
+	require.Equal(t, uint32(os.Getgid()), cfg.Spec.Linux.GIDMappings[0].HostID)
+}
@@ -8,6 +8,7 @@ import (
 
 	"golang.org/x/sys/unix"
 
+	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -16,21 +17,25 @@ var seccompAction = map[specs.LinuxSeccompAction]string{
 	specs.ActTrap:  "trap",
 	specs.ActErrno: "errno",
 	specs.ActAllow: "allow",
+	specs.ActLog:   "log",
 	//specs.ActTrace: "trace",
-	//specs.ActLog: "log",
 	//specs.ActKillProcess: "kill_process",
 }
 
 // Note seccomp flags (see `man 2 seccomp`) are currently not supported
 // https://github.com/opencontainers/runtime-spec/blob/v1.0.2/config-linux.md#seccomp
-func writeSeccompProfile(profilePath string, seccomp *specs.LinuxSeccomp) error {
+func writeSeccompProfile(profilePath string, seccomp *specs.LinuxSeccomp, perm os.FileMode) error {
 	// #nosec
-	profile, err := os.OpenFile(profilePath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0440)
+	profile, err := os.OpenFile(profilePath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, perm)
 	if err != nil {
 		return err
 	}
 	// #nosec
 	defer profile.Close()
+	// The initial permissions are affected by the umask.
+	if err := profile.Chmod(perm); err != nil {
+		return err
+	}
 
 	w := bufio.NewWriter(profile)
 
@@ -72,7 +77,9 @@ func defaultAction(seccomp *specs.LinuxSeccomp) (string, error) {
 		return "errno 0", nil
 	case specs.ActAllow:
 		return "allow", nil
-	case specs.ActTrace, specs.ActLog: // Not (yet) supported by lxc
+	case specs.ActLog:
+		return "log", nil
+	case specs.ActTrace: // Not (yet) supported by lxc
 		fallthrough
 	//case specs.ActKillProcess: fallthrough // specs > 1.0.2
 	default:
@@ -132,3 +139,21 @@ func writeSeccompSyscall(w *bufio.Writer, sc specs.LinuxSyscall) error {
 	}
 	return nil
 }
+
+// LintSeccompProfile returns the issues of the given seccomp profile
+// (see specki.LintSeccomp) and the actions that are not supported by liblxc.
+func LintSeccompProfile(seccomp *specs.LinuxSeccomp, isKnownSyscall func(name string) bool) []specki.SeccompIssue {
+	issues := specki.LintSeccomp(seccomp, isKnownSyscall)
+	if _, err := defaultAction(seccomp); err != nil {
+		issues = append(issues, specki.SeccompIssue{Message: err.Error()})
+	}
+	for _, sc := range seccomp.Syscalls {
+		if _, ok := seccompAction[sc.Action]; ok {
+			continue
+		}
+		for _, name := range sc.Names {
+			issues = append(issues, specki.SeccompIssue{Syscall: name, Message: fmt.Sprintf("action %q is not supported by liblxc", sc.Action)})
+		}
+	}
+	return issues
+}
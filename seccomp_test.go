@@ -0,0 +1,35 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSeccompProfileLog(t *testing.T) {
+	seccomp := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActLog,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"read"}, Action: specs.ActAllow},
+			{Names: []string{"write"}, Action: specs.ActLog},
+		},
+	}
+	p := filepath.Join(t.TempDir(), "seccomp.conf")
+	require.NoError(t, writeSeccompProfile(p, seccomp, 0640))
+
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 5)
+	require.Equal(t, "2", lines[0])
+	require.Equal(t, "allowlist log", lines[1])
+	require.Equal(t, "read allow", lines[3])
+	require.Equal(t, "write log", lines[4])
+
+	seccomp.DefaultAction = specs.ActTrace
+	require.Error(t, writeSeccompProfile(p, seccomp, 0640))
+}
@@ -0,0 +1,143 @@
+package lxcri
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// SecretsDir is the container directory where file secrets are created.
+// A tmpfs is mounted at SecretsDir if the container has file secrets.
+const SecretsDir = "/run/secrets"
+
+// maxSecretSize is the maximum size of a secret file.
+const maxSecretSize = 1 << 20
+
+// Secret is a host file that is exposed to the container process,
+// either as environment variable or as file within SecretsDir.
+// The secret is read by Runtime.Start and sent to the container init process,
+// so it is never written to the container runtime directory.
+type Secret struct {
+	// Source is the host path of the secret file.
+	// The file should only be readable by root.
+	Source string
+	// Env is the name of the environment variable set to the secret.
+	// A single trailing newline is removed from the secret.
+	Env string `json:",omitempty"`
+	// File is the name of the file within SecretsDir.
+	File string `json:",omitempty"`
+}
+
+// ParseSecret parses a secret in the format `env:<name>=<source>` or `file:<name>=<source>`
+// e.g `env:DB_PASSWORD=/etc/secrets/db`
+func ParseSecret(s string) (*Secret, error) {
+	i := strings.IndexByte(s, ':')
+	j := strings.IndexByte(s, '=')
+	if i < 0 || j < i {
+		return nil, fmt.Errorf("invalid secret %q", s)
+	}
+	secret := &Secret{Source: s[j+1:]}
+	switch name := s[i+1 : j]; s[:i] {
+	case "env":
+		secret.Env = name
+	case "file":
+		secret.File = name
+	default:
+		return nil, fmt.Errorf("invalid secret type %q", s[:i])
+	}
+	if err := secret.validate(); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (s *Secret) validate() error {
+	if s.Source == "" {
+		return fmt.Errorf("secret: missing source")
+	}
+	if (s.Env == "") == (s.File == "") {
+		return fmt.Errorf("secret %s: exactly one of env or file is required", s.Source)
+	}
+	if strings.ContainsAny(s.Env, "=\x00") {
+		return fmt.Errorf("secret %s: invalid environment variable name %q", s.Source, s.Env)
+	}
+	if s.File == "." || s.File == ".." || strings.ContainsAny(s.File, "/\x00") {
+		return fmt.Errorf("secret %s: invalid file name %q", s.Source, s.File)
+	}
+	return nil
+}
+
+// configureSecrets mounts a tmpfs at SecretsDir for the file secrets.
+// The tmpfs is owned by the container process user.
+func configureSecrets(c *Container) error {
+	hasFiles := false
+	for _, s := range c.Secrets {
+		if s.File != "" {
+			hasFiles = true
+			break
+		}
+	}
+	if !hasFiles {
+		return nil
+	}
+	if hasMountDestination(c.Spec.Mounts, SecretsDir) {
+		return fmt.Errorf("a mount for %s already exists", SecretsDir)
+	}
+	c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+		Source:      "tmpfs",
+		Destination: SecretsDir,
+		Type:        "tmpfs",
+		Options: []string{"nosuid", "nodev", "noexec", "mode=0700",
+			fmt.Sprintf("uid=%d", c.Spec.Process.User.UID),
+			fmt.Sprintf("gid=%d", c.Spec.Process.User.GID),
+		},
+	})
+	return nil
+}
+
+// readSecrets reads the container secrets and returns the environment
+// variables and the files (name to content) that are passed to the init process.
+func (c *Container) readSecrets() (env []string, files map[string][]byte, err error) {
+	for _, s := range c.Secrets {
+		data, err := readSecret(s.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		if s.Env != "" {
+			env = append(env, s.Env+"="+strings.TrimSuffix(string(data), "\n"))
+			continue
+		}
+		if files == nil {
+			files = make(map[string][]byte)
+		}
+		files[s.File] = data
+	}
+	return env, files, nil
+}
+
+func readSecret(filename string) ([]byte, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secret: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat secret: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("secret %s is not a regular file", filename)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxSecretSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+	if len(data) > maxSecretSize {
+		return nil, fmt.Errorf("secret %s exceeds the maximum size of %d bytes", filename, maxSecretSize)
+	}
+	return data, nil
+}
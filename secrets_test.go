@@ -0,0 +1,52 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecret(t *testing.T) {
+	s, err := ParseSecret("env:DB_PASSWORD=/etc/secrets/db")
+	require.NoError(t, err)
+	require.Equal(t, &Secret{Source: "/etc/secrets/db", Env: "DB_PASSWORD"}, s)
+
+	s, err = ParseSecret("file:token=/etc/secrets/a=b")
+	require.NoError(t, err)
+	require.Equal(t, &Secret{Source: "/etc/secrets/a=b", File: "token"}, s)
+
+	_, err = ParseSecret("file:../token=/etc/secrets/token")
+	require.Error(t, err)
+
+	_, err = ParseSecret("volume:token=/etc/secrets/token")
+	require.Error(t, err)
+
+	_, err = ParseSecret("env:=/etc/secrets/token")
+	require.Error(t, err)
+
+	_, err = ParseSecret("env:TOKEN")
+	require.Error(t, err)
+}
+
+func TestReadSecrets(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(p, []byte("s3cr3t\n"), 0400))
+
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Secrets: []Secret{
+			{Source: p, Env: "PASSWORD"},
+			{Source: p, File: "password"},
+		},
+	}}
+	env, files, err := c.readSecrets()
+	require.NoError(t, err)
+	require.Equal(t, []string{"PASSWORD=s3cr3t"}, env)
+	require.Equal(t, map[string][]byte{"password": []byte("s3cr3t\n")}, files)
+
+	c.Secrets = []Secret{{Source: dir, Env: "PASSWORD"}}
+	_, _, err = c.readSecrets()
+	require.Error(t, err)
+}
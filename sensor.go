@@ -0,0 +1,193 @@
+package lxcri
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultSensorTimeout is the default timeout of the security sensor notification.
+const defaultSensorTimeout = time.Second * 5
+
+// SecuritySensor is an external security sensor (e.g an eBPF based runtime
+// security agent) that is notified with the kernel identifiers of a container
+// when the container is created, so that the sensor can scope its policies
+// to the container without resolving the container from /proc.
+// The sensor is notified after the container init process was created,
+// and before the container process is started.
+type SecuritySensor struct {
+	// Command is the path to an executable that is called with Args
+	// and the SensorEvent as JSON on stdin.
+	Command string `json:",omitempty"`
+	// Args are the arguments of Command.
+	Args []string `json:",omitempty"`
+	// Socket is the path to a unix socket of an HTTP endpoint.
+	// The SensorEvent is sent as JSON with a POST request to /v1/containers.
+	// The request must be answered with a 2xx status code.
+	Socket string `json:",omitempty"`
+	// Timeout is the timeout of the notification (default 5s).
+	Timeout time.Duration `json:",omitempty"`
+	// Required fails Runtime.Create if the sensor notification fails.
+	// Otherwise the failure is only logged.
+	Required bool `json:",omitempty"`
+}
+
+// SensorEvent are the kernel identifiers of a container passed to the SecuritySensor.
+type SensorEvent struct {
+	ContainerID string
+	// CgroupPath is the container cgroup path relative to the cgroup root.
+	CgroupPath string
+	// CgroupID is the cgroup2 ID (the inode number of the cgroup directory)
+	// as returned by the eBPF helper bpf_get_current_cgroup_id.
+	CgroupID uint64 `json:",omitempty"`
+	// InitPid is the host PID of the container init process.
+	InitPid int
+	// NetNSInode is the inode number of the network namespace of the init process.
+	NetNSInode uint64
+	// PidNSInode is the inode number of the PID namespace of the init process.
+	PidNSInode uint64
+	// MntNSInode is the inode number of the mount namespace of the init process.
+	MntNSInode uint64
+	// Annotations are the annotations of the container spec.
+	Annotations map[string]string `json:",omitempty"`
+}
+
+func (s *SecuritySensor) enabled() bool {
+	return s.Command != "" || s.Socket != ""
+}
+
+func (s *SecuritySensor) validate() error {
+	if s.Command != "" && s.Socket != "" {
+		return fmt.Errorf("security sensor command and socket are mutually exclusive")
+	}
+	if s.Command != "" && !filepath.IsAbs(s.Command) {
+		return fmt.Errorf("security sensor command %q is not an absolute path", s.Command)
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("invalid security sensor timeout %s", s.Timeout)
+	}
+	return nil
+}
+
+// notifySecuritySensor sends the SensorEvent of the container to the SecuritySensor.
+func (rt *Runtime) notifySecuritySensor(ctx context.Context, c *Container) error {
+	s := &rt.SecuritySensor
+	if !s.enabled() {
+		return nil
+	}
+	ev, err := c.sensorEvent()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultSensorTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if s.Command != "" {
+		err = s.runCommand(ctx, data)
+	} else {
+		err = s.post(ctx, data)
+	}
+	if err == nil {
+		c.Log.Debug().Uint64("cgroup_id", ev.CgroupID).Uint64("netns", ev.NetNSInode).Msg("security sensor notified")
+		return nil
+	}
+	if s.Required {
+		return fmt.Errorf("security sensor notification failed: %w", err)
+	}
+	c.Log.Warn().Msgf("security sensor notification failed: %s", err)
+	return nil
+}
+
+// sensorEvent collects the kernel identifiers of the container init process.
+func (c *Container) sensorEvent() (*SensorEvent, error) {
+	pid := c.LinuxContainer.InitPid()
+	if pid < 1 {
+		return nil, fmt.Errorf("container init process is not running")
+	}
+	ev := &SensorEvent{
+		ContainerID: c.ContainerID,
+		CgroupPath:  c.CgroupDir,
+		InitPid:     pid,
+		Annotations: c.Spec.Annotations,
+	}
+	var err error
+	if c.CgroupDir != "" {
+		ev.CgroupID, err = inodeNumber(filepath.Join(cgroupRoot, c.CgroupDir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cgroup ID: %w", err)
+		}
+	}
+	nsDir := filepath.Join("/proc", strconv.Itoa(pid), "ns")
+	for ns, dst := range map[string]*uint64{"net": &ev.NetNSInode, "pid": &ev.PidNSInode, "mnt": &ev.MntNSInode} {
+		*dst, err = inodeNumber(filepath.Join(nsDir, ns))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s namespace inode: %w", ns, err)
+		}
+	}
+	return ev, nil
+}
+
+func inodeNumber(path string) (uint64, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, fmt.Errorf("stat %s: %w", path, err)
+	}
+	return st.Ino, nil
+}
+
+func (s *SecuritySensor) runCommand(ctx context.Context, data []byte) error {
+	// #nosec
+	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", s.Command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s *SecuritySensor) post(ctx context.Context, data []byte) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", s.Socket)
+			},
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://sensor/v1/containers", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sensor %s returned %s: %s", s.Socket, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package lxcri
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecuritySensorValidate(t *testing.T) {
+	require.NoError(t, (&SecuritySensor{}).validate())
+	require.NoError(t, (&SecuritySensor{Command: "/usr/bin/sensor"}).validate())
+	require.Error(t, (&SecuritySensor{Command: "sensor"}).validate())
+	require.Error(t, (&SecuritySensor{Command: "/usr/bin/sensor", Socket: "/run/sensor.sock"}).validate())
+	require.Error(t, (&SecuritySensor{Socket: "/run/sensor.sock", Timeout: -1}).validate())
+}
+
+func TestSecuritySensorCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event.json")
+	s := &SecuritySensor{Command: "/bin/sh", Args: []string{"-c", "cat > " + out}}
+	data, err := json.Marshal(SensorEvent{ContainerID: "c1", CgroupID: 42, InitPid: 1})
+	require.NoError(t, err)
+	require.NoError(t, s.runCommand(context.Background(), data))
+
+	written, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.JSONEq(t, string(data), string(written))
+
+	s = &SecuritySensor{Command: "/bin/sh", Args: []string{"-c", "echo denied; exit 1"}}
+	err = s.runCommand(context.Background(), data)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "denied")
+}
+
+func TestSecuritySensorSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "sensor.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	events := make(chan SensorEvent, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev SensorEvent
+		if r.URL.Path != "/v1/containers" || json.NewDecoder(r.Body).Decode(&ev) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if ev.ContainerID == "denied" {
+			http.Error(w, "policy violation", http.StatusForbidden)
+			return
+		}
+		events <- ev
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	s := &SecuritySensor{Socket: socket}
+	data, err := json.Marshal(SensorEvent{ContainerID: "c1", NetNSInode: 4026531992})
+	require.NoError(t, err)
+	require.NoError(t, s.post(context.Background(), data))
+	ev := <-events
+	require.Equal(t, "c1", ev.ContainerID)
+	require.Equal(t, uint64(4026531992), ev.NetNSInode)
+
+	data, err = json.Marshal(SensorEvent{ContainerID: "denied"})
+	require.NoError(t, err)
+	err = s.post(context.Background(), data)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "policy violation")
+}
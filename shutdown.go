@@ -0,0 +1,201 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Annotations to configure how a container is stopped by Runtime.Shutdown.
+const (
+	// StopSignalAnnotation is the signal sent to stop the container (e.g SIGQUIT).
+	// It is set from the image config by container engines.
+	StopSignalAnnotation = "org.opencontainers.image.stopSignal"
+	// StopTimeoutAnnotation is the grace period in seconds before the
+	// container processes are killed. It overrides ShutdownOptions.Timeout.
+	StopTimeoutAnnotation = "org.linuxcontainers.lxcri.StopTimeout"
+)
+
+// DefaultStopTimeout is the default grace period for Runtime.Shutdown.
+const DefaultStopTimeout = time.Second * 10
+
+// ShutdownOptions are the options for Runtime.Shutdown.
+type ShutdownOptions struct {
+	// Timeout is the grace period after the stop signal was sent before
+	// the container processes are killed with SIGKILL (default is DefaultStopTimeout).
+	Timeout time.Duration
+	// ReverseOrder stops the containers one after another
+	// in reverse creation order. By default all containers are stopped in parallel.
+	ReverseOrder bool
+	// Delete deletes the containers after they are stopped.
+	Delete bool
+	// ContainerIDs are the containers to stop (default is all containers).
+	ContainerIDs []string
+}
+
+// ShutdownError is returned by Runtime.Shutdown.
+// It maps the IDs of the containers that could not be stopped to the error.
+type ShutdownError map[string]error
+
+func (e ShutdownError) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", id, e[id]))
+	}
+	return fmt.Sprintf("failed to stop %d containers: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Shutdown stops all containers of the runtime or the containers
+// given by ShutdownOptions.ContainerIDs.
+// The stop signal (see StopSignalAnnotation, default SIGTERM) is sent to each
+// container and the container processes are killed if the container does not
+// stop within the grace period (see StopTimeoutAnnotation).
+// All containers are processed, even if a container can not be stopped.
+func (rt *Runtime) Shutdown(ctx context.Context, opts ShutdownOptions) error {
+	ids := opts.ContainerIDs
+	if len(ids) == 0 {
+		var err error
+		ids, err = rt.List()
+		if err != nil {
+			return errorf("failed to list containers: %w", err)
+		}
+	}
+
+	containers := make([]*Container, 0, len(ids))
+	errs := make(ShutdownError)
+	for _, id := range ids {
+		c, err := rt.Load(id)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		containers = append(containers, c)
+	}
+	// reverse creation order
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].CreatedAt.After(containers[j].CreatedAt)
+	})
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	shutdown := func(c *Container) {
+		defer wg.Done()
+		err := rt.stop(ctx, c, opts.Timeout)
+		c.Release()
+		if err == nil && opts.Delete {
+			err = rt.Delete(ctx, c.ContainerID, true)
+		}
+		if err != nil {
+			mu.Lock()
+			errs[c.ContainerID] = err
+			mu.Unlock()
+		}
+	}
+	for _, c := range containers {
+		wg.Add(1)
+		if opts.ReverseOrder {
+			shutdown(c)
+		} else {
+			go shutdown(c)
+		}
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// stop sends the stop signal to the container and kills
+// the container processes when the grace period expires.
+func (rt *Runtime) stop(ctx context.Context, c *Container, timeout time.Duration) error {
+	state, err := c.ContainerState()
+	if err != nil {
+		return err
+	}
+	if state == specs.StateStopped {
+		return nil
+	}
+	sig, timeout, err := c.stopOptions(timeout)
+	if err != nil {
+		return err
+	}
+	c.Log.Info().Stringer("signal", sig).Dur("timeout", timeout).Msg("stop container")
+	if err := rt.Kill(ctx, c, sig); err != nil {
+		return err
+	}
+
+	if err := c.waitStopped(ctx, timeout); err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	c.Log.Warn().Msg("container did not stop within grace period")
+	if err := c.killAll(ctx); err != nil {
+		return errorf("failed to kill container: %w", err)
+	}
+	return c.waitStopped(ctx, 0)
+}
+
+// stopOptions returns the stop signal and the grace period of the container.
+func (c *Container) stopOptions(timeout time.Duration) (unix.Signal, time.Duration, error) {
+	if timeout == 0 {
+		timeout = DefaultStopTimeout
+	}
+	if val, ok := c.Spec.Annotations[StopTimeoutAnnotation]; ok {
+		n, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid annotation %s: %q", StopTimeoutAnnotation, val)
+		}
+		timeout = time.Duration(n) * time.Second
+	}
+	sig := unix.SIGTERM
+	if val, ok := c.Spec.Annotations[StopSignalAnnotation]; ok && val != "" {
+		sig = ParseSignal(val)
+		if sig == 0 {
+			return 0, 0, fmt.Errorf("invalid annotation %s: %q", StopSignalAnnotation, val)
+		}
+	}
+	return sig, timeout, nil
+}
+
+// ParseSignal parses the signal number or name (e.g 9, kill, KILL, SIGKILL).
+// Zero is returned if the signal is unknown.
+func ParseSignal(sig string) unix.Signal {
+	if num, err := strconv.Atoi(sig); err == nil {
+		return unix.Signal(num)
+	}
+	s := strings.ToUpper(sig)
+	if !strings.HasPrefix(s, "SIG") {
+		s = "SIG" + s
+	}
+	return unix.SignalNum(s)
+}
+
+// waitStopped waits until the container is stopped, the timeout expires
+// or the context is done. A zero timeout never expires.
+func (c *Container) waitStopped(ctx context.Context, timeout time.Duration) error {
+	return pollUntil(ctx, c.sysClock(), timeout, time.Millisecond*100, func() (bool, error) {
+		state, err := c.ContainerState()
+		return state == specs.StateStopped, err
+	})
+}
@@ -0,0 +1,38 @@
+package lxcri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestStopOptions(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: &specs.Spec{}}}
+	sig, timeout, err := c.stopOptions(0)
+	require.NoError(t, err)
+	require.Equal(t, unix.SIGTERM, sig)
+	require.Equal(t, DefaultStopTimeout, timeout)
+
+	c.Spec.Annotations = map[string]string{
+		StopSignalAnnotation:  "SIGQUIT",
+		StopTimeoutAnnotation: "30",
+	}
+	sig, timeout, err = c.stopOptions(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, unix.SIGQUIT, sig)
+	require.Equal(t, time.Second*30, timeout)
+
+	c.Spec.Annotations[StopSignalAnnotation] = "SIGNOTEXIST"
+	_, _, err = c.stopOptions(0)
+	require.Error(t, err)
+}
+
+func TestParseSignal(t *testing.T) {
+	require.Equal(t, unix.SIGKILL, ParseSignal("9"))
+	require.Equal(t, unix.SIGKILL, ParseSignal("kill"))
+	require.Equal(t, unix.SIGKILL, ParseSignal("SIGKILL"))
+	require.Equal(t, unix.Signal(0), ParseSignal("SIGNOTEXIST"))
+}
@@ -0,0 +1,103 @@
+package lxcri
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// hashFile returns the hex encoded SHA-256 hash of the given file.
+// The file is streamed, so it is never held in memory.
+func hashFile(filename string) (string, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", filename, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// decodeSpecFile stream-decodes the spec from filename and verifies
+// that the SHA-256 hash of the file matches the given hash.
+func decodeSpecFile(filename string, hash string) (*specs.Spec, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	spec := new(specs.Spec)
+	if err := json.NewDecoder(io.TeeReader(f, h)).Decode(spec); err != nil {
+		return nil, fmt.Errorf("failed to decode spec from %s: %w", filename, err)
+	}
+	// Hash the remainder (e.g the trailing newline) of the file.
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", filename, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != hash {
+		return nil, fmt.Errorf("spec %s was modified (hash %s, expected %s)", filename, sum, hash)
+	}
+	return spec, nil
+}
+
+// bundleHash returns the hash of the bundle spec (BundleConfigFile).
+// An empty hash is returned if the container has no bundle spec.
+func bundleHash(bundlePath string) (string, error) {
+	if bundlePath == "" {
+		return "", nil
+	}
+	hash, err := hashFile(filepath.Join(bundlePath, BundleConfigFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// checkBundle verifies that the bundle spec was not modified since the
+// container was created (see Container.BundleHash).
+// A removed bundle spec is only logged, because the runtime does not
+// depend on the bundle spec after the container is created.
+func (c *Container) checkBundle() error {
+	if c.BundleHash == "" {
+		return nil
+	}
+	p := filepath.Join(c.BundlePath, BundleConfigFile)
+	hash, err := hashFile(p)
+	if os.IsNotExist(err) {
+		c.Log.Warn().Str("file", p).Msg("bundle spec was removed")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if hash != c.BundleHash {
+		return fmt.Errorf("%w: %s was changed after the container was created", ErrBundleModified, p)
+	}
+	return nil
+}
+
+// loadSpecReference loads the spec referenced by Container.SpecHash
+// from the runtime directory (see Runtime.SpecReference).
+func (c *Container) loadSpecReference() error {
+	if c.Spec != nil || c.SpecHash == "" {
+		return nil
+	}
+	spec, err := decodeSpecFile(c.RuntimePath(BundleConfigFile), c.SpecHash)
+	if err != nil {
+		return err
+	}
+	c.Spec = spec
+	return nil
+}
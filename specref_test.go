@@ -0,0 +1,130 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// largeSpec returns a spec with the given number of environment variables and mounts.
+func largeSpec(nenv int, nmounts int) *specs.Spec {
+	spec := specki.NewSpec("/rootfs", "/bin/sh")
+	for i := 0; i < nenv; i++ {
+		spec.Process.Env = append(spec.Process.Env, fmt.Sprintf("SERVICE_%d_PORT=tcp://10.0.%d.%d:8080", i, i/256, i%256))
+	}
+	for i := 0; i < nmounts; i++ {
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: fmt.Sprintf("/var/lib/volumes/%d", i),
+			Source:      fmt.Sprintf("/var/lib/kubelet/pods/volumes/%d", i),
+			Type:        "bind",
+			Options:     []string{"rbind", "ro"},
+		})
+	}
+	return spec
+}
+
+func writeSpec(t testing.TB, dir string, spec *specs.Spec) (string, string) {
+	p := filepath.Join(dir, BundleConfigFile)
+	require.NoError(t, specki.EncodeJSONFile(p, spec, os.O_CREATE|os.O_TRUNC, 0644))
+	hash, err := hashFile(p)
+	require.NoError(t, err)
+	return p, hash
+}
+
+func TestSpecReference(t *testing.T) {
+	dir := t.TempDir()
+	spec := largeSpec(10, 10)
+	_, hash := writeSpec(t, dir, spec)
+
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1"}, runtimeDir: dir, SpecHash: hash}
+	require.NoError(t, c.loadSpecReference())
+	require.Equal(t, spec, c.Spec)
+
+	// the spec is not serialized with the state
+	rt := &Runtime{}
+	state, err := rt.protectedState(c)
+	require.NoError(t, err)
+	require.Nil(t, state.Spec)
+	require.NotNil(t, c.Spec)
+
+	// modified spec
+	spec.Process.Env = append(spec.Process.Env, "FOO=bar")
+	writeSpec(t, dir, spec)
+	c.Spec = nil
+	require.Error(t, c.loadSpecReference())
+}
+
+func benchmarkState(b *testing.B, reference bool) {
+	dir := b.TempDir()
+	spec := largeSpec(5000, 1000)
+	_, hash := writeSpec(b, dir, spec)
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1", Spec: spec}, runtimeDir: dir}
+	if reference {
+		c.SpecHash = hash
+	}
+	rt := &Runtime{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state, err := rt.protectedState(c)
+		if err != nil {
+			b.Fatal(err)
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkLargeSpecStateEmbedded(b *testing.B) {
+	benchmarkState(b, false)
+}
+
+func BenchmarkLargeSpecStateReference(b *testing.B) {
+	benchmarkState(b, true)
+}
+
+func BenchmarkLargeSpecDecode(b *testing.B) {
+	dir := b.TempDir()
+	p, hash := writeSpec(b, dir, largeSpec(5000, 1000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeSpecFile(p, hash); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCheckBundle(t *testing.T) {
+	dir := t.TempDir()
+	p, _ := writeSpec(t, dir, largeSpec(1, 1))
+
+	hash, err := bundleHash(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, hash)
+
+	c := &Container{ContainerConfig: &ContainerConfig{BundlePath: dir, Log: zerolog.Nop()}, BundleHash: hash}
+	require.NoError(t, c.checkBundle())
+
+	writeSpec(t, dir, largeSpec(2, 1))
+	require.True(t, errors.Is(c.checkBundle(), ErrBundleModified))
+
+	// a removed bundle spec is not an error
+	require.NoError(t, os.Remove(p))
+	require.NoError(t, c.checkBundle())
+
+	hash, err = bundleHash(dir)
+	require.NoError(t, err)
+	require.Empty(t, hash)
+}
@@ -0,0 +1,138 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SwapSizeAnnotation overrides ContainerConfig.SwapSize (see ParseSize for the format).
+const SwapSizeAnnotation = "org.linuxcontainers.lxcri.SwapSize"
+
+// mkswapCmd is the command used to initialize swap files.
+var mkswapCmd = "mkswap"
+
+// minSwapSize is the minimum size of a swap file (10 pages, like mkswap).
+var minSwapSize = int64(10 * os.Getpagesize())
+
+// ParseSize parses a size in bytes with an optional binary
+// unit suffix (K, M, G or T) e.g `512M` or `2G`.
+func ParseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	mult := int64(1)
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMGT", num[n-1]); i >= 0 {
+			mult = 1 << (10 * (i + 1))
+			num = num[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+func (c *Container) swapSize() (int64, error) {
+	if val, ok := c.Spec.Annotations[SwapSizeAnnotation]; ok {
+		n, err := ParseSize(val)
+		if err != nil {
+			return 0, fmt.Errorf("invalid annotation %s: %w", SwapSizeAnnotation, err)
+		}
+		return n, nil
+	}
+	return c.SwapSize, nil
+}
+
+// swapFile returns the path of the swap file of the given container.
+func (rt *Runtime) swapFile(containerID string) string {
+	return filepath.Join(rt.SwapDir, rt.containerDirName(containerID)+".swap")
+}
+
+// configureSwap provisions a swap file for the container and limits
+// the swap usage of the container cgroup to the size of the swap file.
+// Swap space is not namespaced, so the swap file is added to the swap space of the host.
+// The swap file is removed by Runtime.Delete.
+func configureSwap(rt *Runtime, c *Container) error {
+	size, err := c.swapSize()
+	if err != nil || size == 0 {
+		return err
+	}
+	if cgroups.version() != 2 {
+		return fmt.Errorf("swap file requires cgroup2")
+	}
+	if rt.SwapDir == "" {
+		return fmt.Errorf("swap file requires a swap directory (Runtime.SwapDir)")
+	}
+	if size < minSwapSize {
+		return fmt.Errorf("swap size %d is less than the minimum size %d", size, minSwapSize)
+	}
+	// round up to page size
+	pageSize := int64(os.Getpagesize())
+	size = (size + pageSize - 1) / pageSize * pageSize
+
+	if err := os.MkdirAll(rt.SwapDir, 0700); err != nil {
+		return fmt.Errorf("failed to create swap directory: %w", err)
+	}
+	p := rt.swapFile(c.ContainerID)
+	if err := createSwapFile(p, size); err != nil {
+		return err
+	}
+	c.Log.Info().Str("file", p).Int64("size", size).Msg("swap file enabled")
+	return c.setConfigItem("lxc.cgroup2.memory.swap.max", strconv.FormatInt(size, 10))
+}
+
+// createSwapFile creates and enables a swap file with the given size.
+func createSwapFile(p string, size int64) error {
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create swap file: %w", err)
+	}
+	// Swap files must not contain holes.
+	err = unix.Fallocate(int(f.Fd()), 0, 0, size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to allocate swap file: %w", err)
+	}
+	// #nosec
+	out, err := exec.Command(mkswapCmd, p).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to initialize swap file: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	path, err := unix.BytePtrFromString(p)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SWAPON, uintptr(unsafe.Pointer(path)), 0, 0); errno != 0 {
+		return fmt.Errorf("swapon %s failed: %w", p, errno)
+	}
+	return nil
+}
+
+// deleteSwap disables and removes the swap file of the given container.
+func (rt *Runtime) deleteSwap(containerID string) error {
+	if rt.SwapDir == "" {
+		return nil
+	}
+	p := rt.swapFile(containerID)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return nil
+	}
+	path, err := unix.BytePtrFromString(p)
+	if err != nil {
+		return err
+	}
+	// EINVAL is returned if the swap file is not enabled.
+	if _, _, errno := unix.Syscall(unix.SYS_SWAPOFF, uintptr(unsafe.Pointer(path)), 0, 0); errno != 0 && errno != unix.EINVAL {
+		return fmt.Errorf("swapoff %s failed: %w", p, errno)
+	}
+	return os.Remove(p)
+}
@@ -0,0 +1,67 @@
+package lxcri
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	valid := map[string]int64{
+		"0":     0,
+		"4096":  4096,
+		"512k":  512 << 10,
+		"512M":  512 << 20,
+		"2G":    2 << 30,
+		"2GiB":  2 << 30,
+		"1T":    1 << 40,
+		" 8M ":  8 << 20,
+		"100MB": 100 << 20,
+	}
+	for s, n := range valid {
+		v, err := ParseSize(s)
+		require.NoError(t, err, s)
+		require.Equal(t, n, v, s)
+	}
+
+	for _, s := range []string{"", "M", "-1M", "1.5G", "1X"} {
+		_, err := ParseSize(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestConfigureSwapValidation(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	c := &Container{ContainerConfig: &ContainerConfig{
+		ContainerID: "test",
+		Spec:        &specs.Spec{},
+		Log:         zerolog.Nop(),
+	}}
+
+	// no swap requested
+	require.NoError(t, configureSwap(rt, c))
+
+	c.SwapSize = 1 << 20
+	require.Error(t, configureSwap(rt, c), "swap dir is required")
+
+	rt.SwapDir = t.TempDir()
+	c.SwapSize = 1
+	require.Error(t, configureSwap(rt, c), "swap size is too small")
+
+	c.Spec.Annotations = map[string]string{SwapSizeAnnotation: "invalid"}
+	require.Error(t, configureSwap(rt, c))
+}
+
+func TestDeleteSwap(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	// no swap dir configured
+	require.NoError(t, rt.deleteSwap("test"))
+
+	rt.SwapDir = t.TempDir()
+	require.Equal(t, filepath.Join(rt.SwapDir, "test.swap"), rt.swapFile("test"))
+	// no swap file
+	require.NoError(t, rt.deleteSwap("test"))
+}
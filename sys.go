@@ -0,0 +1,120 @@
+package lxcri
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Clock provides the current time and timers to the runtime.
+// The state transitions, timeouts and polling loops of the runtime
+// use the Clock, so they can be tested without sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// FS provides the file operations on the host pseudo filesystems
+// (cgroupfs and procfs) used by the runtime, so the cgroup and process
+// handling can be tested without touching the real cgroupfs and procfs.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	ReadDir(name string) ([]os.DirEntry, error)
+	// Rmdir removes the (empty) directory name.
+	Rmdir(name string) error
+}
+
+// pollUntil calls cond every interval until it returns true or an error,
+// ctx is done or the timeout expires. A zero timeout never expires.
+// Unlike context.WithTimeout the deadline is measured by the given clock,
+// so a fake clock does not busy-wait until the wall clock deadline.
+func pollUntil(ctx context.Context, clock Clock, timeout time.Duration, interval time.Duration, cond func() (bool, error)) error {
+	deadline := clock.Now().Add(timeout)
+	for {
+		done, err := cond()
+		if err != nil || done {
+			return err
+		}
+		if timeout > 0 && !clock.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(interval):
+		}
+	}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type hostFS struct{}
+
+func (hostFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// WriteFile writes data to the existing file name.
+// Pseudo filesystem files must not be created or truncated.
+func (hostFS) WriteFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return err
+}
+
+func (hostFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (hostFS) Rmdir(name string) error {
+	return unix.Rmdir(name)
+}
+
+// sysClock returns Runtime.Clock or the real clock if Runtime.Clock is nil.
+func (rt *Runtime) sysClock() Clock {
+	if rt.Clock == nil {
+		return realClock{}
+	}
+	return rt.Clock
+}
+
+// sysFS returns Runtime.FS or the host filesystem if Runtime.FS is nil.
+func (rt *Runtime) sysFS() FS {
+	if rt.FS == nil {
+		return hostFS{}
+	}
+	return rt.FS
+}
+
+// sysClock returns the clock of the runtime that created or loaded the container.
+func (c *Container) sysClock() Clock {
+	if c.clock == nil {
+		return realClock{}
+	}
+	return c.clock
+}
+
+// sysFS returns the filesystem of the runtime that created or loaded the container.
+func (c *Container) sysFS() FS {
+	if c.fs == nil {
+		return hostFS{}
+	}
+	return c.fs
+}
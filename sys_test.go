@@ -0,0 +1,189 @@
+package lxcri
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock advances the time on every call to After without sleeping.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// memFS is an in-memory FS. Directories are the path prefixes of the files.
+type memFS struct {
+	files map[string][]byte
+	// reads are the number of ReadFile calls per file.
+	reads map[string]int
+	// onRead is called before a file is read.
+	onRead func(name string, n int)
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	if m.reads == nil {
+		m.reads = make(map[string]int)
+	}
+	m.reads[name]++
+	if m.onRead != nil {
+		m.onRead(name, m.reads[name])
+	}
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (m *memFS) WriteFile(name string, data []byte) error {
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	m.files[name] = data
+	return nil
+}
+
+func (m *memFS) ReadDir(name string) ([]os.DirEntry, error) {
+	seen := make(map[string]bool)
+	var entries []os.DirEntry
+	for p := range m.files {
+		rel := strings.TrimPrefix(p, name+"/")
+		if rel == p || !strings.Contains(rel, "/") {
+			continue
+		}
+		dir := strings.SplitN(rel, "/", 2)[0]
+		if !seen[dir] {
+			seen[dir] = true
+			entries = append(entries, memDirEntry(dir))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *memFS) Rmdir(name string) error {
+	for p := range m.files {
+		if strings.HasPrefix(p, name+"/") {
+			delete(m.files, p)
+		}
+	}
+	return nil
+}
+
+type memDirEntry string
+
+func (e memDirEntry) Name() string               { return string(e) }
+func (e memDirEntry) IsDir() bool                { return true }
+func (e memDirEntry) Type() fs.FileMode          { return fs.ModeDir }
+func (e memDirEntry) Info() (fs.FileInfo, error) { return nil, os.ErrInvalid }
+
+func TestPollCgroupEventsFakeClock(t *testing.T) {
+	events := filepath.Join(cgroupRoot, "test", "cgroup.events")
+	mfs := &memFS{files: map[string][]byte{events: []byte("populated 1\nfrozen 0\n")}}
+	mfs.onRead = func(name string, n int) {
+		if n == 100 {
+			mfs.files[name] = []byte("populated 0\nfrozen 0\n")
+		}
+	}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := &Container{ContainerConfig: &ContainerConfig{}, clock: clock, fs: mfs}
+
+	err := pollCgroupEvents(context.Background(), c, events, func(ev cgroupEvents) bool {
+		return !ev.populated
+	})
+	require.NoError(t, err)
+	require.Equal(t, 100, mfs.reads[events])
+	require.Equal(t, time.Unix(0, 0).Add(99*5*time.Millisecond), clock.Now())
+}
+
+func TestDeleteCgroupMemFS(t *testing.T) {
+	mfs := &memFS{files: map[string][]byte{
+		filepath.Join(cgroupRoot, "c1", "cgroup.procs"):                nil,
+		filepath.Join(cgroupRoot, "c1", "lxc.payload", "cgroup.procs"): nil,
+		filepath.Join(cgroupRoot, "c2", "cgroup.procs"):                nil,
+	}}
+	require.NoError(t, deleteCgroup(mfs, "c1"))
+	require.Len(t, mfs.files, 1)
+
+	require.NoError(t, cgroupFreeze(mfs, filepath.Join(cgroupRoot, "c2", "cgroup.procs"), true))
+	require.Error(t, cgroupFreeze(mfs, filepath.Join(cgroupRoot, "c1", "cgroup.freeze"), true))
+}
+
+func TestPollUntilFakeClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	calls := 0
+	err := pollUntil(context.Background(), clock, time.Second, time.Millisecond*100, func() (bool, error) {
+		calls++
+		return false, nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 11, calls)
+	require.Equal(t, time.Unix(1, 0), clock.Now())
+
+	// a zero timeout never expires
+	calls = 0
+	err = pollUntil(context.Background(), clock, 0, time.Millisecond*100, func() (bool, error) {
+		calls++
+		return calls == 100, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 100, calls)
+}
+
+func TestWaitConditionFakeClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	w := &WaitCondition{Type: WaitPath, Path: filepath.Join(t.TempDir(), "missing"), Timeout: time.Minute}
+	err := w.wait(context.Background(), clock)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, time.Unix(60, 0), clock.Now())
+}
+
+func TestReadCgroupProcsMemFS(t *testing.T) {
+	mfs := &memFS{files: map[string][]byte{
+		filepath.Join(cgroupRoot, "c1", "cgroup.procs"):                []byte("1\n"),
+		filepath.Join(cgroupRoot, "c1", "lxc.payload", "cgroup.procs"): []byte("2\n3\n"),
+		filepath.Join(cgroupRoot, "c2", "cgroup.procs"):                []byte("4\n"),
+	}}
+	pids, err := readCgroupProcs(mfs, filepath.Join(cgroupRoot, "c1"))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, pids)
+
+	// a child cgroup removed after the parent was listed is skipped
+	payload := filepath.Join(cgroupRoot, "c1", "lxc.payload", "cgroup.procs")
+	mfs.onRead = func(name string, n int) {
+		if name == payload {
+			delete(mfs.files, payload)
+		}
+	}
+	pids, err = readCgroupProcs(mfs, filepath.Join(cgroupRoot, "c1"))
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, pids)
+}
+
+func TestReadSecurityStateMemFS(t *testing.T) {
+	mfs := &memFS{files: map[string][]byte{
+		"/proc/1/status":                []byte("Name:\tinit\nNoNewPrivs:\t1\nSeccomp:\t2\n"),
+		"/proc/1/attr/apparmor/current": []byte("lxc-container-default (enforce)\n"),
+	}}
+	sec, err := readSecurityState(mfs, 1)
+	require.NoError(t, err)
+	require.Equal(t, &SecurityState{LSMLabel: "lxc-container-default (enforce)", Seccomp: "filter", NoNewPrivs: true}, sec)
+}
@@ -0,0 +1,89 @@
+package lxcri
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// namespacedSysctls are the sysctls that are namespaced by the kernel
+// and the namespace type that must be owned by the container to set them.
+// All other sysctls are global to the host and must not be set by a container.
+// See https://github.com/opencontainers/runtime-spec/blob/master/config-linux.md#sysctl
+var namespacedSysctls = map[string]specs.LinuxNamespaceType{
+	"kernel.msgmax":          specs.IPCNamespace,
+	"kernel.msgmnb":          specs.IPCNamespace,
+	"kernel.msgmni":          specs.IPCNamespace,
+	"kernel.sem":             specs.IPCNamespace,
+	"kernel.shmall":          specs.IPCNamespace,
+	"kernel.shmmax":          specs.IPCNamespace,
+	"kernel.shmmni":          specs.IPCNamespace,
+	"kernel.shm_rmid_forced": specs.IPCNamespace,
+	"kernel.domainname":      specs.UTSNamespace,
+	"kernel.hostname":        specs.UTSNamespace,
+}
+
+// sysctlNamespace returns the namespace type that isolates the given sysctl key.
+func sysctlNamespace(key string) (specs.LinuxNamespaceType, bool) {
+	if t, ok := namespacedSysctls[key]; ok {
+		return t, true
+	}
+	if strings.HasPrefix(key, "fs.mqueue.") {
+		return specs.IPCNamespace, true
+	}
+	if strings.HasPrefix(key, "net.") {
+		return specs.NetworkNamespace, true
+	}
+	return "", false
+}
+
+// validateSysctl returns an error if the given sysctl is not namespaced,
+// or if the namespace that isolates it is shared with the runtime.
+func validateSysctl(spec *specs.Spec, key string) error {
+	nsType, ok := sysctlNamespace(key)
+	if !ok {
+		return fmt.Errorf("sysctl %q is not namespaced", key)
+	}
+	shared, err := isNamespaceSharedWithRuntime(getNamespace(spec, nsType))
+	if err != nil {
+		return fmt.Errorf("failed to check %s namespace for sysctl %q: %w", nsType, key, err)
+	}
+	if shared {
+		return fmt.Errorf("sysctl %q requires a %s namespace that is not shared with the host", key, nsType)
+	}
+	return nil
+}
+
+// isSysctlAllowed returns true if the sysctl key matches any of the given patterns.
+// A pattern with the suffix `*` matches all keys with the pattern prefix (e.g `net.ipv4.*`).
+func isSysctlAllowed(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(key, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+		if p == key {
+			return true
+		}
+	}
+	return false
+}
+
+// configureSysctls sets the sysctls from the spec.
+// liblxc applies the sysctls within the container namespaces after
+// they are created (or joined, e.g the network namespace of a pod sandbox)
+// and before the container process is executed.
+func configureSysctls(rt *Runtime, c *Container) error {
+	for key, val := range c.Spec.Linux.Sysctl {
+		if len(rt.AllowedSysctls) > 0 && !isSysctlAllowed(rt.AllowedSysctls, key) {
+			return fmt.Errorf("sysctl %q is not allowed", key)
+		}
+		if err := validateSysctl(c.Spec, key); err != nil {
+			return err
+		}
+		if err := c.setConfigItem("lxc.sysctl."+key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSysctl(t *testing.T) {
+	spec := &specs.Spec{
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.IPCNamespace},
+				{Type: specs.NetworkNamespace},
+			},
+		},
+	}
+
+	require.NoError(t, validateSysctl(spec, "kernel.shmmax"))
+	require.NoError(t, validateSysctl(spec, "fs.mqueue.msg_max"))
+	require.NoError(t, validateSysctl(spec, "net.ipv4.ip_forward"))
+
+	// UTS namespace is shared with the host
+	require.Error(t, validateSysctl(spec, "kernel.hostname"))
+
+	// global sysctls
+	require.Error(t, validateSysctl(spec, "kernel.panic"))
+	require.Error(t, validateSysctl(spec, "vm.overcommit_memory"))
+}
+
+func TestIsSysctlAllowed(t *testing.T) {
+	patterns := []string{"net.ipv4.*", "kernel.shm_rmid_forced"}
+	require.True(t, isSysctlAllowed(patterns, "net.ipv4.ip_forward"))
+	require.True(t, isSysctlAllowed(patterns, "net.ipv4.conf.all.forwarding"))
+	require.True(t, isSysctlAllowed(patterns, "kernel.shm_rmid_forced"))
+	require.False(t, isSysctlAllowed(patterns, "net.ipv6.conf.all.forwarding"))
+	require.False(t, isSysctlAllowed(patterns, "kernel.shmmax"))
+	require.False(t, isSysctlAllowed(nil, "net.ipv4.ip_forward"))
+}
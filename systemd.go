@@ -0,0 +1,155 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Cgroup managers (see Runtime.CgroupManager).
+const (
+	// CgroupManagerCgroupfs creates and deletes the cgroups directly in the cgroupfs.
+	CgroupManagerCgroupfs = "cgroupfs"
+	// CgroupManagerSystemd registers the container and monitor cgroups
+	// as transient systemd scope units (like /etc/crio/crio.conf#cgroup_manager = "systemd").
+	CgroupManagerSystemd = "systemd"
+)
+
+// busctl is the command used to call the systemd D-Bus API.
+var busctl = "busctl"
+
+// validateCgroupManager checks Runtime.CgroupManager and derives
+// Runtime.MonitorCgroup from Runtime.MonitorSlice for the systemd cgroup manager.
+func (rt *Runtime) validateCgroupManager() error {
+	switch rt.CgroupManager {
+	case "", CgroupManagerCgroupfs:
+		if rt.MonitorSlice != "" {
+			return fmt.Errorf("monitor slice requires the %s cgroup manager", CgroupManagerSystemd)
+		}
+	case CgroupManagerSystemd:
+		if rt.ExternalCgroups {
+			return fmt.Errorf("the %s cgroup manager can not be used with external cgroups", CgroupManagerSystemd)
+		}
+		if rt.MonitorSlice != "" {
+			if !strings.HasSuffix(rt.MonitorSlice, ".slice") {
+				return fmt.Errorf("invalid monitor slice %q", rt.MonitorSlice)
+			}
+			rt.MonitorCgroup = parseSystemdCgroupPath(rt.MonitorSlice)
+		}
+	default:
+		return fmt.Errorf("unsupported cgroup manager %q", rt.CgroupManager)
+	}
+	return nil
+}
+
+// systemdScope returns the scope unit name and the slice unit name for the cgroup dir,
+// e.g `kubepods.slice/kubepods-pod1.slice/crio-ABC.scope` is the scope
+// `crio-ABC.scope` in the slice `kubepods-pod1.slice`.
+func systemdScope(cgroupDir string) (scope string, slice string, err error) {
+	scope = filepath.Base(cgroupDir)
+	if !strings.HasSuffix(scope, ".scope") {
+		return "", "", fmt.Errorf("cgroup %s is not a systemd scope", cgroupDir)
+	}
+	slice = filepath.Base(filepath.Dir(cgroupDir))
+	if slice == "." || slice == "/" {
+		slice = "-.slice"
+	}
+	if !strings.HasSuffix(slice, ".slice") {
+		return "", "", fmt.Errorf("parent of cgroup %s is not a systemd slice", cgroupDir)
+	}
+	return scope, slice, nil
+}
+
+// registerSystemdScopes registers the container cgroup and the monitor cgroup
+// (if it is not nested within the container cgroup) as transient scope units.
+// The cgroups are created by liblxc and systemd adopts the existing cgroups.
+// Delegate is set, so systemd does not manage the controllers within the container cgroup.
+func (rt *Runtime) registerSystemdScopes(ctx context.Context, c *Container) error {
+	if rt.CgroupManager != CgroupManagerSystemd {
+		return nil
+	}
+	if c.MonitorCgroupDir != "" && !c.isMonitorInContainerCgroup() {
+		scope, slice, err := systemdScope(c.MonitorCgroupDir)
+		if err != nil {
+			return err
+		}
+		desc := "lxcri monitor " + c.ContainerID
+		if err := startTransientScope(ctx, scope, slice, desc, c.Pid); err != nil {
+			return err
+		}
+		c.SystemdScopes = append(c.SystemdScopes, scope)
+	}
+
+	scope, slice, err := systemdScope(c.CgroupDir)
+	if err != nil {
+		return err
+	}
+	desc := "lxcri container " + c.ContainerID
+	if err := startTransientScope(ctx, scope, slice, desc, c.LinuxContainer.InitPid()); err != nil {
+		return err
+	}
+	c.SystemdScopes = append(c.SystemdScopes, scope)
+	return nil
+}
+
+// stopSystemdScopes stops the transient scope units of the container.
+// systemd kills the remaining processes and removes the cgroups.
+func (c *Container) stopSystemdScopes(ctx context.Context) error {
+	for _, scope := range c.SystemdScopes {
+		c.Log.Debug().Str("unit", scope).Msg("stopping systemd scope")
+		if err := stopUnit(ctx, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startTransientScope calls StartTransientUnit of the systemd manager.
+// See https://www.freedesktop.org/wiki/Software/systemd/ControlGroupInterface/
+func startTransientScope(ctx context.Context, scope string, slice string, desc string, pid int) error {
+	if pid < 1 {
+		return fmt.Errorf("invalid pid %d for scope %s", pid, scope)
+	}
+	return callSystemdManager(ctx, "StartTransientUnit", "ssa(sv)a(sa(sv))",
+		scope, "fail",
+		"4",
+		"Description", "s", desc,
+		"Slice", "s", slice,
+		"Delegate", "b", "true",
+		"PIDs", "au", "1", strconv.Itoa(pid),
+		"0",
+	)
+}
+
+// stopUnit calls StopUnit of the systemd manager.
+// It is not an error if the unit is not loaded.
+func stopUnit(ctx context.Context, unit string) error {
+	err := callSystemdManager(ctx, "StopUnit", "ss", unit, "replace")
+	if err != nil && strings.Contains(err.Error(), "NoSuchUnit") {
+		return nil
+	}
+	return err
+}
+
+// callSystemdManager calls a method of the org.freedesktop.systemd1.Manager D-Bus interface.
+// The user manager is used if the runtime is not running as root.
+func callSystemdManager(ctx context.Context, method string, signature string, args ...string) error {
+	cmdArgs := []string{"--system"}
+	if os.Getuid() != 0 {
+		cmdArgs[0] = "--user"
+	}
+	cmdArgs = append(cmdArgs, "call", "org.freedesktop.systemd1", "/org/freedesktop/systemd1",
+		"org.freedesktop.systemd1.Manager", method, signature)
+	cmdArgs = append(cmdArgs, args...)
+
+	// #nosec
+	out, err := exec.CommandContext(ctx, busctl, cmdArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemd %s failed: %w: %s", method, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
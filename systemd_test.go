@@ -0,0 +1,46 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdScope(t *testing.T) {
+	scope, slice, err := systemdScope("kubepods.slice/kubepods-pod1.slice/crio-ABC.scope")
+	require.NoError(t, err)
+	require.Equal(t, "crio-ABC.scope", scope)
+	require.Equal(t, "kubepods-pod1.slice", slice)
+
+	scope, slice, err = systemdScope("ABC.scope")
+	require.NoError(t, err)
+	require.Equal(t, "ABC.scope", scope)
+	require.Equal(t, "-.slice", slice)
+
+	_, _, err = systemdScope("kubepods.slice/kubepods-pod1.slice")
+	require.Error(t, err)
+
+	_, _, err = systemdScope("pod1/crio-ABC.scope")
+	require.Error(t, err)
+}
+
+func TestValidateCgroupManager(t *testing.T) {
+	rt := &Runtime{}
+	require.NoError(t, rt.validateCgroupManager())
+
+	rt = &Runtime{CgroupManager: CgroupManagerCgroupfs, MonitorSlice: "lxcri-monitor.slice"}
+	require.Error(t, rt.validateCgroupManager())
+
+	rt = &Runtime{CgroupManager: CgroupManagerSystemd, MonitorSlice: "lxcri-monitor.slice"}
+	require.NoError(t, rt.validateCgroupManager())
+	require.Equal(t, "lxcri.slice/lxcri-monitor.slice", rt.MonitorCgroup)
+
+	rt = &Runtime{CgroupManager: CgroupManagerSystemd, MonitorSlice: "lxcri-monitor"}
+	require.Error(t, rt.validateCgroupManager())
+
+	rt = &Runtime{CgroupManager: CgroupManagerSystemd, ExternalCgroups: true}
+	require.Error(t, rt.validateCgroupManager())
+
+	rt = &Runtime{CgroupManager: "cgmanager"}
+	require.Error(t, rt.validateCgroupManager())
+}
@@ -0,0 +1,51 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// tenantsDir is the directory within the runtime root that contains the tenant roots.
+// It is hidden, so it is not listed as a container by Runtime.List.
+const tenantsDir = ".tenants"
+
+// scopeTenant scopes the runtime root, the ephemeral root and the monitor cgroup
+// to Runtime.Tenant. All runtime methods (e.g Runtime.List, Runtime.DeleteAll
+// and Runtime.Shutdown) only operate on the containers of the tenant.
+func (rt *Runtime) scopeTenant() error {
+	if rt.Tenant == "" {
+		return nil
+	}
+	if len(rt.Tenant) > maxContainerDirName || !containerIDPattern.MatchString(rt.Tenant) {
+		return fmt.Errorf("tenant %q must match %s", rt.Tenant, containerIDPattern)
+	}
+	rt.Root = filepath.Join(rt.Root, tenantsDir, rt.Tenant)
+	if rt.EphemeralRoot != "" {
+		rt.EphemeralRoot = filepath.Join(rt.EphemeralRoot, tenantsDir, rt.Tenant)
+	}
+	if rt.MonitorCgroup != "" {
+		rt.MonitorCgroup = filepath.Join(rt.MonitorCgroup, rt.Tenant)
+	}
+	if err := os.MkdirAll(rt.Root, rt.FileModes.DirMode); err != nil {
+		return fmt.Errorf("failed to create tenant root: %w", err)
+	}
+	return nil
+}
+
+// checkContainerCount returns an error if the number of containers
+// in the runtime root has reached Runtime.MaxContainers.
+// The runtime root must be locked by the caller.
+func (rt *Runtime) checkContainerCount() error {
+	if rt.MaxContainers <= 0 {
+		return nil
+	}
+	ids, err := rt.List()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	if len(ids) >= rt.MaxContainers {
+		return fmt.Errorf("container count %d reached limit %d", len(ids), rt.MaxContainers)
+	}
+	return nil
+}
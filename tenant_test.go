@@ -0,0 +1,45 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeTenant(t *testing.T) {
+	root := t.TempDir()
+	rt := &Runtime{Root: root, MonitorCgroup: "lxcri-monitor.slice"}
+	rt.FileModes.setDefaults()
+	require.NoError(t, rt.scopeTenant())
+	require.Equal(t, root, rt.Root, "no tenant")
+
+	rt.Tenant = "tenant-a"
+	require.NoError(t, rt.scopeTenant())
+	require.Equal(t, filepath.Join(root, tenantsDir, "tenant-a"), rt.Root)
+	require.Equal(t, "", rt.EphemeralRoot)
+	require.Equal(t, "lxcri-monitor.slice/tenant-a", rt.MonitorCgroup)
+	require.DirExists(t, rt.Root)
+
+	// the tenants directory is not listed as container
+	ids, err := (&Runtime{Root: root}).List()
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	for _, tenant := range []string{"../other", "a/b", ".hidden"} {
+		rt := &Runtime{Root: root, Tenant: tenant}
+		require.Error(t, rt.scopeTenant(), tenant)
+	}
+}
+
+func TestCheckContainerCount(t *testing.T) {
+	rt := &Runtime{Root: t.TempDir()}
+	require.NoError(t, rt.checkContainerCount(), "unlimited")
+
+	rt.MaxContainers = 2
+	require.NoError(t, os.Mkdir(filepath.Join(rt.Root, "c1"), 0700))
+	require.NoError(t, rt.checkContainerCount())
+	require.NoError(t, os.Mkdir(filepath.Join(rt.Root, "c2"), 0700))
+	require.Error(t, rt.checkContainerCount())
+}
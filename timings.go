@@ -0,0 +1,77 @@
+package lxcri
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hookTimingsFile is the file (relative to the container runtime directory)
+// where lxcri-hook appends the duration of the OCI hooks run for a liblxc hook.
+// Each line has the format `<liblxc hook type> <duration in nanoseconds>`.
+// NOTE keep in sync with cmd/lxcri-hook#hookTimingsFile
+const hookTimingsFile = "hooks.timings"
+
+// CreateTimings are the durations of the phases of Runtime.Create.
+// They are logged at info level and stored in the container state,
+// to find the slow phase of a slow container start.
+type CreateTimings struct {
+	// Check is the duration of the container config and resource checks.
+	Check time.Duration
+	// Configure is the duration of the liblxc container configuration
+	// and the serialization of the runtime files.
+	Configure time.Duration
+	// MonitorStart is the duration until the monitor process is started.
+	MonitorStart time.Duration
+	// Init is the duration until the container init process is ready.
+	// It includes the container setup by liblxc and the Hooks.
+	Init time.Duration
+	// Hooks is the duration of the OCI hooks by liblxc hook type (e.g mount).
+	Hooks map[string]time.Duration `json:",omitempty"`
+	// Total is the duration of Runtime.Create.
+	Total time.Duration
+}
+
+// readHookTimings reads the hook durations from the given hookTimingsFile.
+// The durations of multiple runs of the same hook type are added up
+// (e.g if the container is restarted).
+func readHookTimings(filename string) (map[string]time.Duration, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	timings := make(map[string]time.Duration)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		ns, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		timings[fields[0]] += time.Duration(ns)
+	}
+	return timings, s.Err()
+}
+
+func (t *CreateTimings) log(c *Container) {
+	ev := c.Log.Info().
+		Dur("check", t.Check).
+		Dur("configure", t.Configure).
+		Dur("monitor_start", t.MonitorStart).
+		Dur("init", t.Init)
+	for name, d := range t.Hooks {
+		ev = ev.Dur("hook_"+strings.ReplaceAll(name, "-", "_"), d)
+	}
+	ev.Dur("total", t.Total).Msg("container created")
+}
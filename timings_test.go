@@ -0,0 +1,26 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHookTimings(t *testing.T) {
+	p := filepath.Join(t.TempDir(), hookTimingsFile)
+	timings, err := readHookTimings(p)
+	require.NoError(t, err)
+	require.Nil(t, timings)
+
+	data := "pre-mount 1500000\nmount 2000000\ninvalid\nmount 1000000\n"
+	require.NoError(t, os.WriteFile(p, []byte(data), 0600))
+	timings, err = readHookTimings(p)
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		"pre-mount": 1500 * time.Microsecond,
+		"mount":     3 * time.Millisecond,
+	}, timings)
+}
@@ -0,0 +1,110 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/lxc/lxcri/pkg/specki"
+)
+
+// ConfigTraceFile is the name of the file within the container runtime
+// directory that contains the config trace (see Runtime.TraceConfig).
+const ConfigTraceFile = "config-trace.json"
+
+// ConfigDecision records a liblxc config item set by the runtime
+// while the container is configured.
+type ConfigDecision struct {
+	// SpecField is the runtime spec field the config item is derived from.
+	// It is empty if the config item is set by the runtime itself.
+	SpecField string `json:",omitempty"`
+	// Key is the liblxc config item.
+	Key string
+	// Value is the value of the config item.
+	Value string
+	// Reason is the runtime function that set the config item.
+	Reason string
+}
+
+// configSpecFields maps liblxc config item prefixes to the runtime spec fields.
+// The longest matching prefix wins.
+var configSpecFields = map[string]string{
+	"lxc.apparmor.":          "process.apparmorProfile",
+	"lxc.cap.":               "process.capabilities",
+	"lxc.cgroup.dir":         "linux.cgroupsPath",
+	"lxc.cgroup.devices.":    "linux.resources.devices",
+	"lxc.cgroup.cpuset.":     "linux.resources",
+	"lxc.cgroup.pids.":       "linux.resources",
+	"lxc.cgroup2.":           "linux.resources",
+	"lxc.cgroup2.devices.":   "linux.resources.devices",
+	"lxc.hook.":              "hooks",
+	"lxc.idmap":              "linux.uidMappings,linux.gidMappings",
+	"lxc.init.cwd":           "process.cwd",
+	"lxc.init.uid":           "process.user.uid",
+	"lxc.init.gid":           "process.user.gid",
+	"lxc.init.groups":        "process.user.additionalGids",
+	"lxc.mount.entry":        "mounts",
+	"lxc.namespace.":         "linux.namespaces",
+	"lxc.no_new_privs":       "process.noNewPrivileges",
+	"lxc.prlimit.":           "process.rlimits",
+	"lxc.proc.oom_score_adj": "process.oomScoreAdj",
+	"lxc.rootfs.":            "root",
+	"lxc.seccomp.":           "linux.seccomp",
+	"lxc.selinux.":           "process.selinuxLabel",
+	"lxc.sysctl.":            "linux.sysctl",
+	"lxc.uts.name":           "hostname",
+}
+
+func configSpecField(key string) string {
+	field := ""
+	match := 0
+	for prefix, f := range configSpecFields {
+		if strings.HasPrefix(key, prefix) && len(prefix) > match {
+			field = f
+			match = len(prefix)
+		}
+	}
+	return field
+}
+
+// traceConfigItem records the config item if config tracing is enabled.
+// The caller of setConfigItem is recorded as reason.
+func (c *Container) traceConfigItem(key, value string) {
+	if !c.traceConfig {
+		return
+	}
+	reason := "unknown"
+	// skip traceConfigItem and setConfigItem
+	if pc, _, _, ok := runtime.Caller(2); ok {
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			name := fn.Name()
+			reason = name[strings.LastIndex(name, ".")+1:]
+		}
+	}
+	c.configTrace = append(c.configTrace, ConfigDecision{
+		SpecField: configSpecField(key),
+		Key:       key,
+		Value:     value,
+		Reason:    reason,
+	})
+}
+
+func (c *Container) writeConfigTrace(perm os.FileMode) error {
+	err := specki.EncodeJSONFile(c.RuntimePath(ConfigTraceFile), c.configTrace, os.O_EXCL|os.O_CREATE, perm)
+	if err != nil {
+		return fmt.Errorf("failed to write config trace: %w", err)
+	}
+	return nil
+}
+
+// ConfigTrace returns the config decisions recorded when
+// the container was created (see Runtime.TraceConfig).
+func (c *Container) ConfigTrace() ([]ConfigDecision, error) {
+	var trace []ConfigDecision
+	err := specki.DecodeJSONFile(c.RuntimePath(ConfigTraceFile), &trace)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no config trace available (enable Runtime.TraceConfig): %w", err)
+	}
+	return trace, err
+}
@@ -0,0 +1,27 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSpecField(t *testing.T) {
+	require.Equal(t, "linux.resources.devices", configSpecField("lxc.cgroup2.devices.allow"))
+	require.Equal(t, "linux.resources", configSpecField("lxc.cgroup2.pids.max"))
+	require.Equal(t, "process.user.uid", configSpecField("lxc.init.uid"))
+	require.Equal(t, "", configSpecField("lxc.autodev"))
+}
+
+func TestTraceConfigItem(t *testing.T) {
+	c := &Container{traceConfig: true}
+	traceConfigItemCaller(c)
+	require.Equal(t, []ConfigDecision{
+		{SpecField: "linux.sysctl", Key: "lxc.sysctl.net.ipv4.ip_forward", Value: "1", Reason: "traceConfigItemCaller"},
+	}, c.configTrace)
+}
+
+// traceConfigItemCaller calls traceConfigItem like setConfigItem does.
+func traceConfigItemCaller(c *Container) {
+	func() { c.traceConfigItem("lxc.sysctl.net.ipv4.ip_forward", "1") }()
+}
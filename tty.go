@@ -0,0 +1,98 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// ttyGID is the conventional group ID of the `tty` group,
+// that owns the terminals (see devpts option gid).
+const ttyGID = 5
+
+// isMappedID returns true if the container ID is mapped by the given idmaps.
+func isMappedID(id uint32, idmaps []specs.LinuxIDMapping) bool {
+	for _, idmap := range idmaps {
+		if id >= idmap.ContainerID && id-idmap.ContainerID < idmap.Size {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDevptsGID removes the devpts gid option if the container
+// has a user namespace and the group ID is not mapped into it,
+// because the kernel refuses to mount devpts with an unmapped gid.
+// If no gid option is set the tty group is used if it is mapped.
+func checkDevptsGID(c *Container, opts []string) []string {
+	if c.Spec.Linux == nil || !isNamespaceEnabled(c.Spec, specs.UserNamespace) {
+		return opts
+	}
+	for i, o := range opts {
+		if !strings.HasPrefix(o, "gid=") {
+			continue
+		}
+		gid, err := strconv.ParseUint(strings.TrimPrefix(o, "gid="), 10, 32)
+		if err == nil && isMappedID(uint32(gid), c.Spec.Linux.GIDMappings) {
+			return opts
+		}
+		c.Log.Warn().Str("option", o).Msg("removed devpts option: gid is not mapped into the user namespace")
+		return append(opts[:i], opts[i+1:]...)
+	}
+	if isMappedID(ttyGID, c.Spec.Linux.GIDMappings) {
+		opts = setMountOption(opts, "gid", strconv.Itoa(ttyGID))
+	}
+	return opts
+}
+
+// setConsoleOwner changes the owner of the container console (the stdio pty of
+// the init process) to the (host mapped) user of the container process
+// and the `tty` group (or the process group if the tty group is not mapped).
+// The pty is allocated by the runtime on the host and is otherwise owned by the
+// runtime user, so the container process can not reopen it (e.g /proc/self/fd/0)
+// which results in 'not a tty' or permission errors for non-root processes.
+func (c *Container) setConsoleOwner() error {
+	if c.Spec.Process == nil || !c.Spec.Process.Terminal {
+		return nil
+	}
+	pid := c.LinuxContainer.InitPid()
+	if pid < 1 {
+		return fmt.Errorf("init process is not running")
+	}
+	// #nosec
+	f, err := os.OpenFile(fmt.Sprintf("/proc/%d/fd/0", pid), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open console: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS); err != nil {
+		c.Log.Debug().Msg("stdin of init is not a tty")
+		return nil
+	}
+
+	var uidMappings, gidMappings []specs.LinuxIDMapping
+	if c.Spec.Linux != nil && isNamespaceEnabled(c.Spec, specs.UserNamespace) {
+		uidMappings = c.Spec.Linux.UIDMappings
+		gidMappings = c.Spec.Linux.GIDMappings
+	}
+	gid := c.Spec.Process.User.GID
+	if gidMappings == nil || isMappedID(ttyGID, gidMappings) {
+		gid = ttyGID
+	}
+	uid := specki.UnmapContainerID(c.Spec.Process.User.UID, uidMappings)
+	hostGID := specki.UnmapContainerID(gid, gidMappings)
+	c.Log.Debug().Uint32("uid", uid).Uint32("gid", hostGID).Msg("set console owner")
+	if err := f.Chown(int(uid), int(hostGID)); err != nil {
+		return fmt.Errorf("failed to change console owner: %w", err)
+	}
+	if err := f.Chmod(0620); err != nil {
+		return fmt.Errorf("failed to change console mode: %w", err)
+	}
+	return nil
+}
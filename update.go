@@ -0,0 +1,170 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Update changes the resource limits of the created or running container.
+// The limits are written directly to the cgroup2 interface files of the
+// container cgroup, the container is not restarted.
+// Only the set values of resources are changed. The container spec in the
+// runtime directory is not modified, so the limits are reset when the
+// container is restored from a checkpoint.
+func (rt *Runtime) Update(ctx context.Context, c *Container, resources *specs.LinuxResources) error {
+	if resources == nil {
+		return fmt.Errorf("resources are nil")
+	}
+	unlock, err := rt.lockContainer(c.ContainerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state == specs.StateStopped {
+		return fmt.Errorf("invalid container state %q", state)
+	}
+	if c.CgroupDir == "" {
+		return fmt.Errorf("container has no cgroup")
+	}
+	if cgroups.version() != 2 {
+		return fmt.Errorf("updating the container resources requires cgroup2")
+	}
+
+	items, err := cgroupResourceItems(resources)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(cgroupRoot, c.CgroupDir)
+	for _, item := range items {
+		c.Log.Debug().Str("file", item.name).Str("value", item.value).Msg("update cgroup")
+		if err := c.sysFS().WriteFile(filepath.Join(dir, item.name), []byte(item.value)); err != nil {
+			return fmt.Errorf("failed to update cgroup file %s: %w", item.name, err)
+		}
+	}
+	return nil
+}
+
+// cgroupItem is a value for a cgroup2 interface file.
+type cgroupItem struct {
+	name  string
+	value string
+}
+
+// cgroupMax returns the cgroup2 limit value for n,
+// where a negative value is unlimited.
+func cgroupMax(n int64) string {
+	if n < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// cgroupResourceItems converts the given resources to cgroup2 interface file values.
+// The conversion of cgroup v1 values is the same as runc does
+// (see https://github.com/opencontainers/runc/blob/master/docs/cgroup-v2.md)
+func cgroupResourceItems(r *specs.LinuxResources) ([]cgroupItem, error) {
+	var items []cgroupItem
+	add := func(name string, value string) {
+		items = append(items, cgroupItem{name: name, value: value})
+	}
+
+	if mem := r.Memory; mem != nil {
+		if mem.Reservation != nil {
+			add("memory.low", cgroupMax(*mem.Reservation))
+		}
+		// memory.max must be set before memory.swap.max
+		if mem.Limit != nil {
+			add("memory.max", cgroupMax(*mem.Limit))
+		}
+		if mem.Swap != nil {
+			// The v1 swap limit is the limit of memory and swap,
+			// the v2 swap limit is the limit of swap only.
+			swap := *mem.Swap
+			if swap > 0 {
+				if mem.Limit == nil || *mem.Limit < 0 {
+					return nil, fmt.Errorf("memory swap limit requires a memory limit")
+				}
+				if swap < *mem.Limit {
+					return nil, fmt.Errorf("memory swap limit %d is lower than memory limit %d", swap, *mem.Limit)
+				}
+				swap -= *mem.Limit
+			}
+			add("memory.swap.max", cgroupMax(swap))
+		}
+	}
+
+	if cpu := r.CPU; cpu != nil {
+		if cpu.Shares != nil && *cpu.Shares > 0 {
+			// valid cpu shares are in the range [2, 262144]
+			shares := *cpu.Shares
+			if shares < 2 {
+				shares = 2
+			}
+			weight := 1 + ((shares-2)*9999)/262142
+			add("cpu.weight", strconv.FormatUint(weight, 10))
+		}
+		if cpu.Quota != nil || cpu.Period != nil {
+			quota := "max"
+			if cpu.Quota != nil && *cpu.Quota > 0 {
+				quota = strconv.FormatInt(*cpu.Quota, 10)
+			}
+			var period uint64 = 100000
+			if cpu.Period != nil && *cpu.Period > 0 {
+				period = *cpu.Period
+			}
+			add("cpu.max", fmt.Sprintf("%s %d", quota, period))
+		}
+		if cpu.Cpus != "" {
+			add("cpuset.cpus", cpu.Cpus)
+		}
+		if cpu.Mems != "" {
+			add("cpuset.mems", cpu.Mems)
+		}
+	}
+
+	if pids := r.Pids; pids != nil {
+		limit := pids.Limit
+		if limit == 0 {
+			limit = -1
+		}
+		add("pids.max", cgroupMax(limit))
+	}
+
+	if blkio := r.BlockIO; blkio != nil {
+		if blkio.Weight != nil && *blkio.Weight > 0 {
+			// valid blkio weights are in the range [10, 1000]
+			w := uint64(*blkio.Weight)
+			if w < 10 {
+				w = 10
+			}
+			weight := 1 + (w-10)*9999/990
+			add("io.weight", strconv.FormatUint(weight, 10))
+		}
+		for _, d := range blkio.ThrottleReadBpsDevice {
+			add("io.max", fmt.Sprintf("%d:%d rbps=%d", d.Major, d.Minor, d.Rate))
+		}
+		for _, d := range blkio.ThrottleWriteBpsDevice {
+			add("io.max", fmt.Sprintf("%d:%d wbps=%d", d.Major, d.Minor, d.Rate))
+		}
+		for _, d := range blkio.ThrottleReadIOPSDevice {
+			add("io.max", fmt.Sprintf("%d:%d riops=%d", d.Major, d.Minor, d.Rate))
+		}
+		for _, d := range blkio.ThrottleWriteIOPSDevice {
+			add("io.max", fmt.Sprintf("%d:%d wiops=%d", d.Major, d.Minor, d.Rate))
+		}
+	}
+
+	for _, h := range r.HugepageLimits {
+		add(fmt.Sprintf("hugetlb.%s.max", h.Pagesize), strconv.FormatUint(h.Limit, 10))
+	}
+	return items, nil
+}
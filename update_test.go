@@ -0,0 +1,56 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupResourceItems(t *testing.T) {
+	limit := int64(1 << 30)
+	swap := int64(2 << 30)
+	shares := uint64(1024)
+	quota := int64(50000)
+	weight := uint16(500)
+
+	r := &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit, Swap: &swap},
+		CPU:    &specs.LinuxCPU{Shares: &shares, Quota: &quota, Cpus: "0-1"},
+		Pids:   &specs.LinuxPids{Limit: 0},
+		BlockIO: &specs.LinuxBlockIO{
+			Weight: &weight,
+			ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{
+				{Rate: 1048576},
+			},
+		},
+		HugepageLimits: []specs.LinuxHugepageLimit{{Pagesize: "2MB", Limit: 4 << 20}},
+	}
+	r.BlockIO.ThrottleReadBpsDevice[0].Major = 8
+	r.BlockIO.ThrottleReadBpsDevice[0].Minor = 0
+
+	items, err := cgroupResourceItems(r)
+	require.NoError(t, err)
+	require.Equal(t, []cgroupItem{
+		{"memory.max", "1073741824"},
+		{"memory.swap.max", "1073741824"},
+		{"cpu.weight", "39"},
+		{"cpu.max", "50000 100000"},
+		{"cpuset.cpus", "0-1"},
+		{"pids.max", "max"},
+		{"io.weight", "4950"},
+		{"io.max", "8:0 rbps=1048576"},
+		{"hugetlb.2MB.max", "4194304"},
+	}, items)
+
+	// unlimited swap
+	swap = -1
+	items, err = cgroupResourceItems(&specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit, Swap: &swap}})
+	require.NoError(t, err)
+	require.Equal(t, cgroupItem{"memory.swap.max", "max"}, items[1])
+
+	// swap limit lower than the memory limit
+	swap = 1 << 20
+	_, err = cgroupResourceItems(&specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit, Swap: &swap}})
+	require.Error(t, err)
+}
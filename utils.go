@@ -23,8 +23,12 @@ func fsMagic(fsName string) int64 {
 	switch fsName {
 	case "proc", "procfs":
 		return unix.PROC_SUPER_MAGIC
+	case "cgroup":
+		return unix.CGROUP_SUPER_MAGIC
 	case "cgroup2", "cgroup2fs":
 		return unix.CGROUP2_SUPER_MAGIC
+	case "tmpfs":
+		return unix.TMPFS_MAGIC
 	default:
 		return -1
 	}
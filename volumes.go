@@ -0,0 +1,97 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// volumesDir returns the directory that contains the anonymous volumes
+// of the given container. The directory is hidden from Runtime.List
+// and it is not removed together with the container runtime directory,
+// so volumes can be kept when the container is deleted.
+func (rt *Runtime) volumesDir(containerID string) string {
+	return filepath.Join(rt.Root, ".volumes", rt.containerDirName(containerID))
+}
+
+func (rt *Runtime) deleteVolumes(containerID string) error {
+	if rt.KeepVolumes {
+		return nil
+	}
+	return os.RemoveAll(rt.volumesDir(containerID))
+}
+
+// volumeName returns the directory name for the anonymous volume
+// with the given index and container path.
+func volumeName(i int, p string) string {
+	name := strings.ReplaceAll(strings.Trim(filepath.Clean(p), "/"), "/", "_")
+	return strconv.Itoa(i) + "-" + name
+}
+
+// configureVolumes creates a directory for each anonymous volume
+// and bind mounts it into the container.
+// A volume is skipped if the spec already defines a mount for its path.
+// The owner and permissions of the volume directory are copied from the
+// directory in the rootfs, but the volume is not populated with its content.
+func configureVolumes(rt *Runtime, c *Container) error {
+	dir := rt.volumesDir(c.ContainerID)
+	for i, p := range c.Volumes {
+		dst := filepath.Clean("/" + p)
+		if hasMountDestination(c.Spec.Mounts, dst) {
+			c.Log.Info().Str("volume", dst).Msg("anonymous volume is shadowed by mount")
+			continue
+		}
+
+		src := filepath.Join(dir, volumeName(i, dst))
+		if err := os.MkdirAll(src, 0755); err != nil {
+			return fmt.Errorf("failed to create volume %s: %w", dst, err)
+		}
+		if err := copyDirOwnership(filepath.Join(c.Spec.Root.Path, dst), src); err != nil {
+			return fmt.Errorf("failed to set volume %s ownership: %w", dst, err)
+		}
+
+		c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+			Source:      src,
+			Destination: dst,
+			Type:        "bind",
+			Options:     []string{"rbind", "rw", "nodev", "nosuid"},
+		})
+	}
+	return nil
+}
+
+func hasMountDestination(mounts []specs.Mount, dst string) bool {
+	for _, m := range mounts {
+		if filepath.Clean("/"+m.Destination) == dst {
+			return true
+		}
+	}
+	return false
+}
+
+// copyDirOwnership copies the owner and the permissions of directory src to dst.
+// Nothing is changed if src does not exist (or is not a directory).
+func copyDirOwnership(src string, dst string) error {
+	var stat unix.Stat_t
+	err := unix.Stat(src, &stat)
+	if err == unix.ENOENT || err == unix.ENOTDIR {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return nil
+	}
+	if os.Getuid() == 0 {
+		if err := unix.Chown(dst, int(stat.Uid), int(stat.Gid)); err != nil {
+			return err
+		}
+	}
+	return unix.Chmod(dst, stat.Mode&07777)
+}
@@ -0,0 +1,41 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumeName(t *testing.T) {
+	require.Equal(t, "0-var_lib_data", volumeName(0, "/var/lib/data/"))
+	require.Equal(t, "1-data", volumeName(1, "data"))
+}
+
+func TestHasMountDestination(t *testing.T) {
+	mounts := []specs.Mount{{Destination: "var/lib/data/"}}
+	require.True(t, hasMountDestination(mounts, "/var/lib/data"))
+	require.False(t, hasMountDestination(mounts, "/var/lib"))
+}
+
+func TestCopyDirOwnership(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "src")
+	dst := filepath.Join(tmpdir, "dst")
+	require.NoError(t, os.Mkdir(src, 0700))
+	require.NoError(t, os.Chmod(src, 01770))
+	require.NoError(t, os.Mkdir(dst, 0755))
+
+	require.NoError(t, copyDirOwnership(src, dst))
+	info, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0770)|os.ModeSticky, info.Mode()&(os.ModePerm|os.ModeSticky))
+
+	// missing source is ignored
+	require.NoError(t, copyDirOwnership(filepath.Join(tmpdir, "missing"), dst))
+}
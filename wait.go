@@ -0,0 +1,120 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Wait condition types.
+const (
+	// WaitPath waits until the path exists.
+	WaitPath = "path"
+	// WaitDevice waits until the path is a device node.
+	WaitDevice = "device"
+	// WaitSocket waits until the path is a unix socket that accepts connections.
+	WaitSocket = "socket"
+)
+
+// DefaultWaitTimeout is the timeout of a WaitCondition without timeout.
+const DefaultWaitTimeout = time.Second * 10
+
+// WaitCondition is a condition that must be met before
+// the container process is started by Runtime.Start.
+type WaitCondition struct {
+	// Type is one of WaitPath, WaitDevice or WaitSocket.
+	Type string
+	// Path is the host path to check.
+	Path string
+	// Timeout is the maximum time to wait for the condition (default DefaultWaitTimeout).
+	Timeout time.Duration `json:",omitempty"`
+}
+
+// ParseWaitCondition parses a wait condition in the format `<type>:<path>[:<timeout>]`
+// e.g `device:/dev/nvidia0:30s`
+func ParseWaitCondition(s string) (*WaitCondition, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid wait condition %q", s)
+	}
+	w := &WaitCondition{Type: s[:i], Path: s[i+1:]}
+	if j := strings.LastIndexByte(w.Path, ':'); j >= 0 {
+		if d, err := time.ParseDuration(w.Path[j+1:]); err == nil {
+			w.Timeout = d
+			w.Path = w.Path[:j]
+		}
+	}
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *WaitCondition) validate() error {
+	switch w.Type {
+	case WaitPath, WaitDevice, WaitSocket:
+	default:
+		return fmt.Errorf("invalid wait condition type %q", w.Type)
+	}
+	if w.Path == "" {
+		return fmt.Errorf("wait condition %q: missing path", w.Type)
+	}
+	if w.Timeout < 0 {
+		return fmt.Errorf("wait condition %s:%s: invalid timeout %s", w.Type, w.Path, w.Timeout)
+	}
+	return nil
+}
+
+// met returns true if the condition is met.
+func (w *WaitCondition) met() bool {
+	fi, err := os.Stat(w.Path)
+	if err != nil {
+		return false
+	}
+	switch w.Type {
+	case WaitDevice:
+		return fi.Mode()&os.ModeDevice != 0
+	case WaitSocket:
+		if fi.Mode()&os.ModeSocket == 0 {
+			return false
+		}
+		conn, err := net.DialTimeout("unix", w.Path, time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	default:
+		return true
+	}
+}
+
+// wait waits until the condition is met, the timeout expires or ctx is done.
+func (w *WaitCondition) wait(ctx context.Context, clock Clock) error {
+	timeout := w.Timeout
+	if timeout == 0 {
+		timeout = DefaultWaitTimeout
+	}
+	err := pollUntil(ctx, clock, timeout, time.Millisecond*100, func() (bool, error) {
+		return w.met(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait for %s %s failed: %w", w.Type, w.Path, err)
+	}
+	return nil
+}
+
+// waitConditions waits until all of the container wait conditions are met.
+func (c *Container) waitConditions(ctx context.Context) error {
+	for i := range c.WaitFor {
+		w := &c.WaitFor[i]
+		c.Log.Debug().Str("type", w.Type).Str("path", w.Path).Msg("wait for condition")
+		if err := w.wait(ctx, c.sysClock()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
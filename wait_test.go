@@ -0,0 +1,52 @@
+package lxcri
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWaitCondition(t *testing.T) {
+	w, err := ParseWaitCondition("device:/dev/nvidia0:30s")
+	require.NoError(t, err)
+	require.Equal(t, &WaitCondition{Type: WaitDevice, Path: "/dev/nvidia0", Timeout: 30 * time.Second}, w)
+
+	w, err = ParseWaitCondition("path:/run/a:b")
+	require.NoError(t, err)
+	require.Equal(t, &WaitCondition{Type: WaitPath, Path: "/run/a:b"}, w)
+
+	_, err = ParseWaitCondition("file:/run/a")
+	require.Error(t, err)
+
+	_, err = ParseWaitCondition("socket:")
+	require.Error(t, err)
+}
+
+func TestWaitCondition(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	p := filepath.Join(dir, "file")
+	w := &WaitCondition{Type: WaitPath, Path: p, Timeout: time.Millisecond * 200}
+	require.Error(t, w.wait(ctx, realClock{}))
+	require.NoError(t, os.WriteFile(p, nil, 0600))
+	require.NoError(t, w.wait(ctx, realClock{}))
+
+	w.Type = WaitDevice
+	require.Error(t, w.wait(ctx, realClock{}))
+	w.Path = "/dev/null"
+	require.NoError(t, w.wait(ctx, realClock{}))
+
+	sock := filepath.Join(dir, "sock")
+	w = &WaitCondition{Type: WaitSocket, Path: sock, Timeout: time.Millisecond * 200}
+	require.Error(t, w.wait(ctx, realClock{}))
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer l.Close()
+	require.NoError(t, w.wait(ctx, realClock{}))
+}
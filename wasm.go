@@ -0,0 +1,102 @@
+package lxcri
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// WasmVariantAnnotation is the image annotation that marks WASM images.
+	// See https://github.com/solo-io/wasm/blob/master/spec/spec-compat.md
+	WasmVariantAnnotation = "module.wasm.image/variant"
+	// WasmVariantCompat runs the image entrypoint with the WASM runtime.
+	WasmVariantCompat = "compat"
+	// WasmVariantCompatSmart runs the image entrypoint with the WASM runtime,
+	// only if the entrypoint is a WASM module.
+	WasmVariantCompatSmart = "compat-smart"
+
+	// wasmRuntimePath is the path of the WASM runtime within the container.
+	wasmRuntimePath = "/.lxcri/wasm-runtime"
+)
+
+// wasmMagic is the magic number of a WASM binary module.
+var wasmMagic = []byte("\x00asm")
+
+// WasmConfig configures the (experimental) execution of WASM modules.
+type WasmConfig struct {
+	// Runtime is the host path to the WASM runtime executable (e.g wasmtime or wasmedge).
+	// The executable is bind mounted into the container, so it should
+	// be statically linked. WASM support is disabled if Runtime is empty.
+	Runtime string `json:",omitempty"`
+	// Args are inserted between the WASM runtime executable and the
+	// WASM module (e.g `run` for wasmtime).
+	Args []string `json:",omitempty"`
+}
+
+// isWasmModule returns true if the file starts with the WASM magic number.
+func isWasmModule(filename string) bool {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, len(wasmMagic))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, wasmMagic)
+}
+
+// configureWasm runs the container process with the WASM runtime,
+// if the container image is a WASM image (see WasmVariantAnnotation).
+func configureWasm(rt *Runtime, c *Container) error {
+	variant, ok := c.Spec.Annotations[WasmVariantAnnotation]
+	if !ok || len(c.Spec.Process.Args) == 0 {
+		return nil
+	}
+	if rt.Wasm.Runtime == "" {
+		return fmt.Errorf("WASM image variant %q requires a WASM runtime", variant)
+	}
+
+	switch variant {
+	case WasmVariantCompat:
+	case WasmVariantCompatSmart:
+		module := c.Spec.Process.Args[0]
+		if !filepath.IsAbs(module) {
+			module = filepath.Join(c.Spec.Process.Cwd, module)
+		}
+		if !isWasmModule(filepath.Join(c.Spec.Root.Path, module)) {
+			c.Log.Debug().Str("entrypoint", module).Msg("entrypoint is not a WASM module")
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported WASM image variant %q", variant)
+	}
+
+	// bind mount the WASM runtime into the container
+	p := c.RuntimePath("wasm-runtime")
+	if err := touchFile(p, 0); err != nil {
+		return fmt.Errorf("failed to create %s: %w", p, err)
+	}
+	c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+		Source:      rt.Wasm.Runtime,
+		Destination: strings.TrimLeft(wasmRuntimePath, "/"),
+		Type:        "bind",
+		Options:     []string{"bind", "ro", "nosuid"},
+	})
+
+	args := make([]string, 0, len(rt.Wasm.Args)+len(c.Spec.Process.Args)+1)
+	args = append(args, wasmRuntimePath)
+	args = append(args, rt.Wasm.Args...)
+	args = append(args, c.Spec.Process.Args...)
+	c.Log.Info().Strs("args", args).Msg("running WASM module")
+	c.Spec.Process.Args = args
+	return nil
+}
@@ -0,0 +1,23 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsWasmModule(t *testing.T) {
+	dir := t.TempDir()
+
+	module := filepath.Join(dir, "hello.wasm")
+	require.NoError(t, os.WriteFile(module, []byte("\x00asm\x01\x00\x00\x00"), 0644))
+	require.True(t, isWasmModule(module))
+
+	script := filepath.Join(dir, "hello.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0755))
+	require.False(t, isWasmModule(script))
+
+	require.False(t, isWasmModule(filepath.Join(dir, "missing")))
+}